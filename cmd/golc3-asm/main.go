@@ -18,24 +18,79 @@ package main
 import (
 	"bufio"
 	"bytes"
-	"encoding/binary"
 	"encoding/gob"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"sort"
 	"strings"
 
 	"github.com/lassandro/golc3/pkg/assembler"
+	"github.com/lassandro/golc3/pkg/encoding"
 )
 
+var ErrNotRegularFile = errors.New("Input is not a regular file")
+
+type diagnosticEntry struct {
+	File     string `json:"file"`
+	Line     int    `json:"line"`
+	Col      int    `json:"col"`
+	Message  string `json:"message"`
+	Severity string `json:"severity"`
+}
+
+type sourceMapEntry struct {
+	Addr string `json:"addr"`
+	File string `json:"file"`
+	Line int    `json:"line"`
+	Col  int    `json:"col"`
+}
+
 var helpvar bool
 var debugvar bool
+var debugformatvar string
+var strictvar bool
+var relocatablevar bool
+var mnemoniclabelvar bool
+var underscorelabelvar bool
+var aliasesvar bool
+var sizevar bool
+var printaddressvar bool
+var disassemblevar bool
 var outvar string
+var symoutvar string
+var sourcemapvar string
+var checkvar bool
+var jsonvar bool
+var charsetvar string
+var formatvar string
+var definevar defines
+
+// Collects each -define flag given as NAME=VALUE
+type defines []string
+
+func (d *defines) String() string {
+	return strings.Join(*d, ",")
+}
+
+func (d *defines) Set(value string) error {
+	*d = append(*d, value)
+	return nil
+}
+
+var formats = map[string]encoding.OutputFormat{
+	"raw":  encoding.RawFormat{},
+	"ihex": encoding.IHEXFormat{},
+	"srec": encoding.SRECFormat{},
+	"elf":  encoding.ELFFormat{},
+}
 
-const usage = "golc3-asm [-debug] [-o outfile] filename"
+const usage = "golc3-asm [-debug] [-debug-format format] [-check [-json]] [-strict] [-relocatable] [-size] [-a] [-d] [-input-charset charset] [-format format] [-sourcemap file] [-define name=value] [-sym-out symfile] [-o outfile] filename"
 
 func init() {
 	log.SetFlags(0)
@@ -50,12 +105,102 @@ func init() {
 			"table. The table will use the output filename with extension "+
 			"'.lc3db'",
 	)
+	flag.StringVar(
+		&debugformatvar, "debug-format", "gob",
+		"Specifies the encoding of the symbol table, either 'gob' or "+
+			"'json'. JSON symbol tables use the extension '.lc3db.json'",
+	)
+	flag.BoolVar(
+		&strictvar, "strict", false,
+		"Specifies whether warnings should be treated as errors",
+	)
+	flag.BoolVar(
+		&strictvar, "Werror", false,
+		"Alias of -strict",
+	)
+	flag.BoolVar(
+		&relocatablevar, "relocatable", false,
+		"Specifies whether to generate a relocatable binary, which is "+
+			"prefixed with its load address and only contains the "+
+			"region of memory used by the program",
+	)
+	flag.BoolVar(
+		&mnemoniclabelvar, "allow-mnemonic-label", false,
+		"Specifies whether labels may share their name with an "+
+			"instruction or directive without a warning",
+	)
+	flag.BoolVar(
+		&underscorelabelvar, "allow-underscore-labels", false,
+		"Specifies whether labels may begin with an underscore without a "+
+			"warning",
+	)
+	flag.BoolVar(
+		&aliasesvar, "aliases", false,
+		"Specifies whether SP and LR are accepted as aliases of the "+
+			"registers R6 and R7",
+	)
+	flag.BoolVar(
+		&sizevar, "size", false,
+		"Specifies whether to print the size of the assembled program, "+
+			"broken down into its text, data and bss sections",
+	)
+	flag.BoolVar(
+		&printaddressvar, "print-address", false,
+		"Specifies whether to print each assembled word alongside its "+
+			"address to stderr",
+	)
+	flag.BoolVar(
+		&printaddressvar, "a", false, "Shorthand for -print-address",
+	)
+	flag.BoolVar(
+		&disassemblevar, "d", false,
+		"Specifies that the input is a raw binary which should be "+
+			"disassembled to stdout. Labels are taken from the symbol "+
+			"table alongside it with extension '.lc3db', if present",
+	)
+	flag.StringVar(
+		&charsetvar, "input-charset", "ascii",
+		"Specifies the character set of the input source, either 'ascii' "+
+			"or 'utf8'. UTF-8 characters are only permitted within "+
+			"strings and comments",
+	)
+	flag.StringVar(
+		&formatvar, "format", "raw",
+		"Specifies the output format, one of 'raw', 'ihex', 'srec' or "+
+			"'elf'. Formats other than 'raw' only contain the region of "+
+			"memory used by the program",
+	)
 	flag.StringVar(
 		&outvar, "out", "",
 		"Specifies a precise name for the output file, "+
-			"overriding the default means of determining it",
+			"overriding the default means of determining it. A name of "+
+			"'-' writes the binary to stdout",
+	)
+	flag.StringVar(
+		&symoutvar, "sym-out", "",
+		"Specifies a precise name for the symbol table, overriding the "+
+			"name derived from the output file. Implies -debug",
+	)
+	flag.BoolVar(
+		&checkvar, "check", false,
+		"Specifies that the source should only be checked for errors and "+
+			"warnings, without writing any output files",
+	)
+	flag.BoolVar(
+		&jsonvar, "json", false,
+		"Specifies that errors and warnings found by -check are written to "+
+			"stdout as a JSON array",
+	)
+	flag.StringVar(
+		&sourcemapvar, "sourcemap", "",
+		"Specifies a file to write a JSON source map to, giving the line "+
+			"and column of the instruction at each address",
+	)
+	flag.Var(
+		&definevar, "define",
+		"Defines a constant as NAME=VALUE, as if declared with .EQU at the "+
+			"start of the source. May be given multiple times",
 	)
-	flag.Parse()
 }
 
 func golc3_asm() int {
@@ -67,15 +212,36 @@ func golc3_asm() int {
 
 	args := flag.Args()
 
+	format, ok := formats[strings.ToLower(formatvar)]
+
+	if !ok {
+		log.Printf("Unknown output format '%s'", formatvar)
+		return 1
+	}
+
+	if _, raw := format.(encoding.RawFormat); relocatablevar && !raw {
+		log.Println("-relocatable is only supported by the raw format")
+		return 1
+	}
+
 	var infile string
 	var input io.ReadSeeker
 
 	if stat, _ := os.Stdin.Stat(); stat.Mode()&os.ModeCharDevice == 0 {
-		input = os.Stdin
+		// Buffered so that offending lines can be re-read for error reporting
+		data, err := io.ReadAll(os.Stdin)
+
+		if err != nil {
+			log.Println(err)
+			return 1
+		}
+
+		input = bytes.NewReader(data)
 		log.SetPrefix("\033[1m<stdin>:\033[0m")
 
+		// Piped input is piped back out unless told otherwise
 		if outvar == "" {
-			outvar = "out.bin"
+			outvar = "-"
 		}
 	} else {
 		if len(args) != 1 {
@@ -97,11 +263,14 @@ func golc3_asm() int {
 		if stat, err := file.Stat(); err != nil {
 			log.Println(err)
 			return 1
-		} else {
-			if stat.IsDir() {
-				log.Printf("%s is not a valid LC3 assembly file", filename)
-				return 1
-			}
+		} else if stat.IsDir() {
+			log.Printf("%s is not a valid LC3 assembly file", filename)
+			return 1
+		} else if !stat.Mode().IsRegular() {
+			// Named pipes, devices and sockets cannot be seeked for error
+			// reporting
+			log.Printf("%s: %s", filename, ErrNotRegularFile)
+			return 1
 		}
 
 		input = file
@@ -110,79 +279,179 @@ func golc3_asm() int {
 
 		if outvar == "" {
 			outvar = strings.ReplaceAll(
-				filename, filepath.Ext(filename), ".bin",
+				filename, filepath.Ext(filename), format.FileExtension(),
 			)
 		}
 	}
 
+	if disassemblevar {
+		return disassemble(input, infile)
+	}
+
+	if jsonvar && !checkvar {
+		log.Println("-json is only supported alongside -check")
+		return 1
+	}
+
+	debugformatvar = strings.ToLower(debugformatvar)
+
+	if debugformatvar != "gob" && debugformatvar != "json" {
+		log.Printf("Unknown symbol table format '%s'", debugformatvar)
+		return 1
+	}
+
+	if symoutvar != "" {
+		debugvar = true
+	} else if outvar == "-" && debugvar {
+		log.Println(
+			"Symbol table cannot be written to stdout without -sym-out, " +
+				"ignoring -debug",
+		)
+		debugvar = false
+	}
+
 	var symtable assembler.SymTable
 	var symtarget *assembler.SymTable = nil
 
-	if debugvar {
-		if input != os.Stdin {
+	if debugvar || printaddressvar || sourcemapvar != "" {
+		if infile != "" {
 			var err error
 			if symtable.Source, err = filepath.Abs(infile); err != nil {
 				log.Println(err)
 				symtable.Source = ""
 			}
 		}
-		symtable.Symbols = make(map[uint16]int64)
-		symtable.Labels = make(map[uint16]string)
 		symtarget = &symtable
 	}
 
-	result, errs := assembler.AssembleLC3Source(input, symtarget)
+	var opts []assembler.AssemblerOption
+
+	switch strings.ToLower(charsetvar) {
+	case "ascii":
+		opts = append(opts, assembler.WithInputCharset(assembler.CHARSET_ASCII))
+	case "utf8", "utf-8":
+		opts = append(opts, assembler.WithInputCharset(assembler.CHARSET_UTF8))
+	default:
+		log.Printf("Unknown input charset '%s'", charsetvar)
+		return 1
+	}
+
+	if mnemoniclabelvar {
+		opts = append(opts, assembler.AllowMnemonicLabels())
+	}
 
-	if len(errs) > 0 {
+	if underscorelabelvar {
+		opts = append(opts, assembler.AllowUnderscoreLabels())
+	}
 
-		if input == os.Stdin {
-			for _, err := range errs {
-				log.Println(err)
-			}
-		} else {
-			for _, err := range errs {
-				if tokenErr, ok := err.(assembler.TokenError); ok {
-					cursor := tokenErr.GetPosition()
-
-					if _, err := input.Seek(
-						cursor.LineByte, os.SEEK_SET,
-					); err != nil {
-						panic(err)
-					}
-
-					line, _ := bufio.NewReader(input).ReadString('\n')
-
-					underlinefmt := fmt.Sprintf(
-						"%% %ds%s",
-						int(cursor.Byte-cursor.LineByte)+1,
-						strings.Repeat("~", int(cursor.Size)-1),
-					)
-
-					log.Printf(
-						"%s\n%s\n\033[31m%s\033[0m",
-						err,
-						line[:len(line)-1],
-						fmt.Sprintf(underlinefmt, "^"),
-					)
-				} else {
-					log.Println(err)
-				}
-			}
+	if aliasesvar {
+		opts = append(opts, assembler.WithRegisterAliases())
+	}
+
+	var sizes assembler.SectionSizes
+
+	if sizevar {
+		opts = append(opts, assembler.WithSectionSizes(&sizes))
+	}
+
+	var sections []assembler.Section
+
+	if printaddressvar {
+		opts = append(opts, assembler.WithSections(&sections))
+	}
+
+	if symtarget != nil {
+		opts = append(opts, assembler.WithSymTable(symtarget))
+	}
+
+	for _, define := range definevar {
+		parts := strings.SplitN(define, "=", 2)
+
+		if len(parts) != 2 {
+			log.Printf("Invalid define '%s', expected NAME=VALUE", define)
+			return 1
+		}
+
+		opts = append(opts, assembler.WithDefine(parts[0], parts[1]))
+	}
+
+	assembled := assembler.AssembleLC3Source(input, opts...)
+	result := assembled.Memory
+
+	failed := !assembled.Success() || (strictvar && len(assembled.Warnings) > 0)
+
+	diagnostics := append(assembled.Errors, assembled.Warnings...)
+
+	if jsonvar {
+		source := infile
+
+		if source == "" {
+			source = "<stdin>"
+		}
+
+		if err := writeDiagnostics(os.Stdout, source, diagnostics); err != nil {
+			log.Println("Error writing diagnostics")
+			log.Println(err)
+			return 1
+		}
+	} else {
+		for _, err := range diagnostics {
+			printDiagnostic(input, err)
 		}
+	}
 
+	if failed {
 		return 1
 	}
 
+	// Nothing is written when only checking the source
+	if checkvar {
+		return 0
+	}
+
+	if printaddressvar {
+		if err := assembler.WriteListing(
+			os.Stderr, result, sections, symtarget, input,
+		); err != nil {
+			log.Println("Error writing listing")
+			log.Println(err)
+			return 1
+		}
+	}
+
+	if sizevar && outvar == "-" {
+		fmt.Fprintln(os.Stderr, sizes)
+	} else if sizevar {
+		fmt.Println(sizes)
+	}
+
 	{
 		buffer := new(bytes.Buffer)
 
-		if err := binary.Write(buffer, binary.BigEndian, result); err != nil {
+		var err error
+
+		if relocatablevar {
+			err = assembler.WriteRelocatable(buffer, result, assembled.Origin)
+		} else if _, raw := format.(encoding.RawFormat); raw {
+			err = format.Write(buffer, result, 0x0000)
+		} else {
+			start, end := assembler.ProgramBounds(result)
+			err = format.Write(buffer, result[start:end], uint16(start))
+		}
+
+		if err != nil {
 			log.Println("Error writing output file")
 			log.Println(err)
 			return 1
 		}
 
-		if err := os.WriteFile(outvar, buffer.Bytes(), 0666); err != nil {
+		if outvar == "-" {
+			if _, err := os.Stdout.Write(buffer.Bytes()); err != nil {
+				log.Println("Error writing output to stdout")
+				log.Println(err)
+				return 1
+			}
+		} else if err := os.WriteFile(outvar, buffer.Bytes(), 0666); err != nil {
 			log.Println("Error writing output file")
 			log.Println(err)
 			return 1
@@ -190,14 +459,32 @@ func golc3_asm() int {
 	}
 
 	if debugvar {
-		filename := filepath.Dir(outvar) + "/" + strings.ReplaceAll(
-			filepath.Base(outvar), filepath.Ext(outvar), ".lc3db",
-		)
+		ext := ".lc3db"
+
+		if debugformatvar == "json" {
+			ext = ".lc3db.json"
+		}
+
+		filename := symoutvar
+
+		if filename == "" {
+			filename = filepath.Dir(outvar) + "/" + strings.ReplaceAll(
+				filepath.Base(outvar), filepath.Ext(outvar), ext,
+			)
+		}
 
 		if file, err := os.OpenFile(
 			filename, os.O_WRONLY|os.O_CREATE, 0666,
 		); err == nil {
-			if err := gob.NewEncoder(file).Encode(symtable); err != nil {
+			var err error
+
+			if debugformatvar == "json" {
+				err = json.NewEncoder(file).Encode(symtable)
+			} else {
+				err = gob.NewEncoder(file).Encode(symtable)
+			}
+
+			if err != nil {
 				log.Println("Error writing symbol table")
 				log.Println(err)
 				return 1
@@ -211,9 +498,157 @@ func golc3_asm() int {
 		}
 	}
 
+	if sourcemapvar != "" {
+		source := infile
+
+		if source == "" {
+			source = "<stdin>"
+		}
+
+		if err := writeSourceMap(sourcemapvar, source, &symtable); err != nil {
+			log.Println("Error writing source map")
+			log.Println(err)
+			return 1
+		}
+	}
+
+	return 0
+}
+
+// Logs an error along with the source line it occurred on, underlining the
+// offending token
+func printDiagnostic(input io.ReadSeeker, err error) {
+	tokenErr, ok := err.(assembler.TokenError)
+
+	if !ok {
+		log.Println(err)
+		return
+	}
+
+	cursor := tokenErr.GetPosition()
+
+	// Errors for -define constants have no source line to display
+	if cursor.Line == 0 {
+		log.Println(err)
+		return
+	}
+
+	if _, err := input.Seek(cursor.LineByte, io.SeekStart); err != nil {
+		panic(err)
+	}
+
+	line, _ := bufio.NewReader(input).ReadString('\n')
+
+	underlinefmt := fmt.Sprintf(
+		"%% %ds%s",
+		int(cursor.Byte-cursor.LineByte)+1,
+		strings.Repeat("~", int(cursor.Size)-1),
+	)
+
+	color := "\033[31m"
+	if _, ok := err.(assembler.Warning); ok && !strictvar {
+		color = "\033[33m"
+	}
+
+	log.Printf(
+		"%s\n%s\n%s%s\033[0m",
+		err,
+		strings.TrimRight(line, "\r\n"),
+		color,
+		fmt.Sprintf(underlinefmt, "^"),
+	)
+}
+
+// Writes errors and warnings to w as a JSON array, for consumption by CI tools
+func writeDiagnostics(w io.Writer, source string, errs []error) error {
+	entries := make([]diagnosticEntry, len(errs))
+
+	for i, err := range errs {
+		entries[i] = diagnosticEntry{
+			File:     source,
+			Message:  err.Error(),
+			Severity: "error",
+		}
+
+		if _, ok := err.(assembler.Warning); ok && !strictvar {
+			entries[i].Severity = "warning"
+		}
+
+		if tokenErr, ok := err.(assembler.TokenError); ok {
+			cursor := tokenErr.GetPosition()
+			entries[i].Line = cursor.Line
+			entries[i].Col = cursor.Column
+			entries[i].Message = strings.TrimPrefix(
+				entries[i].Message, cursor.String()+": ",
+			)
+		}
+	}
+
+	return json.NewEncoder(w).Encode(entries)
+}
+
+// Writes the source map of symtable to filename as a JSON array ordered by
+// address
+func writeSourceMap(filename, source string, symtable *assembler.SymTable) error {
+	addrs := make([]int, 0, len(symtable.SourceMap))
+
+	for addr := range symtable.SourceMap {
+		addrs = append(addrs, int(addr))
+	}
+
+	sort.Ints(addrs)
+
+	entries := make([]sourceMapEntry, len(addrs))
+
+	for i, addr := range addrs {
+		cursor := symtable.SourceMap[uint16(addr)]
+		entries[i] = sourceMapEntry{
+			Addr: fmt.Sprintf("0x%04x", addr),
+			File: source,
+			Line: cursor.Line,
+			Col:  cursor.Column,
+		}
+	}
+
+	data, err := json.Marshal(entries)
+
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filename, append(data, '\n'), 0666)
+}
+
+func disassemble(input io.Reader, infile string) int {
+	var symtable *assembler.SymTable
+
+	if infile != "" {
+		filename := strings.TrimSuffix(infile, filepath.Ext(infile)) + ".lc3db"
+
+		if file, err := os.Open(filename); err == nil {
+			if symtable, err = assembler.ReadSymTable(file); err != nil {
+				log.Println("Error reading symbol table")
+				log.Println(err)
+				return 1
+			}
+
+			file.Close()
+		}
+	}
+
+	disassembly, err := assembler.DisassembleBinary(input, 0x0000, symtable)
+
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+
+	fmt.Print(disassembly)
+
 	return 0
 }
 
 func main() {
+	flag.Parse()
 	os.Exit(golc3_asm())
 }
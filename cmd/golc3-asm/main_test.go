@@ -0,0 +1,265 @@
+// Copyright (C) 2021  Antonio Lassandro
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+
+// You should have received a copy of the GNU General Public License along
+// with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/lassandro/golc3/pkg/assembler"
+	"github.com/lassandro/golc3/pkg/machine"
+)
+
+// Runs golc3_asm with the given command line, returning its exit code and
+// everything it logged
+func runAsm(t *testing.T, args ...string) (int, string) {
+	t.Helper()
+
+	flag.VisitAll(func(f *flag.Flag) {
+		if !strings.HasPrefix(f.Name, "test.") {
+			f.Value.Set(f.DefValue)
+		}
+	})
+	definevar = nil
+
+	if err := flag.CommandLine.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+
+	// golc3_asm reads piped stdin in preference to its arguments
+	stdin := os.Stdin
+	devnull, err := os.Open(os.DevNull)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	os.Stdin = devnull
+
+	logged := new(bytes.Buffer)
+	log.SetOutput(logged)
+
+	defer func() {
+		os.Stdin = stdin
+		devnull.Close()
+		log.SetOutput(os.Stderr)
+	}()
+
+	return golc3_asm(), logged.String()
+}
+
+// Runs fn with stdout redirected, returning everything it wrote
+func captureStdout(t *testing.T, fn func()) []byte {
+	t.Helper()
+
+	reader, writer, err := os.Pipe()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer reader.Close()
+
+	// Read alongside fn, as the output may be larger than the pipe buffer
+	output := make(chan []byte)
+
+	go func() {
+		data, _ := io.ReadAll(reader)
+		output <- data
+	}()
+
+	stdout := os.Stdout
+	os.Stdout = writer
+
+	fn()
+
+	os.Stdout = stdout
+	writer.Close()
+
+	return <-output
+}
+
+func TestDirectoryInput(t *testing.T) {
+	dir, err := os.MkdirTemp("", "golc3-asm")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	outfile := filepath.Join(dir, "out.obj")
+
+	if code, logged := runAsm(t, "-out", outfile, dir); code != 1 {
+		t.Fatalf("Expected exit code 1, have:%d\n%s", code, logged)
+	}
+
+	if _, err := os.Stat(outfile); !os.IsNotExist(err) {
+		t.Fatalf("Expected no output file to be written, have:%v", err)
+	}
+}
+
+func TestIrregularInput(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("no /dev/null on windows")
+	}
+
+	dir, err := os.MkdirTemp("", "golc3-asm")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	outfile := filepath.Join(dir, "out.obj")
+
+	code, logged := runAsm(t, "-out", outfile, "/dev/null")
+
+	if code != 1 {
+		t.Fatalf("Expected exit code 1, have:%d\n%s", code, logged)
+	}
+
+	if !strings.Contains(logged, ErrNotRegularFile.Error()) {
+		t.Fatalf("Expected '%s' to be logged, have:%s", ErrNotRegularFile, logged)
+	}
+
+	if _, err := os.Stat(outfile); !os.IsNotExist(err) {
+		t.Fatalf("Expected no output file to be written, have:%v", err)
+	}
+}
+
+func TestStdoutOutput(t *testing.T) {
+	dir, err := os.MkdirTemp("", "golc3-asm")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	infile := filepath.Join(dir, "halt.asm")
+
+	if err := os.WriteFile(infile, []byte("HALT\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	var code int
+	var logged string
+
+	output := captureStdout(t, func() {
+		code, logged = runAsm(t, "-out", "-", infile)
+	})
+
+	if code != 0 {
+		t.Fatalf("Expected exit code 0, have:%d\n%s", code, logged)
+	}
+
+	var mc machine.Machine
+
+	if _, err := mc.LoadBin(bytes.NewReader(output), 0); err != nil {
+		t.Fatal(err)
+	}
+
+	if have, want := mc.State.Memory[0x0000], uint16(0xF025); have != want {
+		t.Fatalf(
+			"Memory value mismatch\nwant:%#04x (HALT)\nhave:%#04x", want, have,
+		)
+	}
+}
+
+func TestDisassembleLeadingZeros(t *testing.T) {
+	dir, err := os.MkdirTemp("", "golc3-asm")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	infile := filepath.Join(dir, "halt.bin")
+
+	// A zero word (NOP) ahead of HALT
+	if err := os.WriteFile(
+		infile, []byte{0x00, 0x00, 0xF0, 0x25}, 0666,
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	var code int
+	var logged string
+
+	output := captureStdout(t, func() {
+		code, logged = runAsm(t, "-d", infile)
+	})
+
+	if code != 0 {
+		t.Fatalf("Expected exit code 0, have:%d\n%s", code, logged)
+	}
+
+	want := assembler.Disassemble([]uint16{0x0000, 0xF025}, 0x0000, nil)
+
+	if have := string(output); have != want {
+		t.Fatalf("Disassembly mismatch\nwant:\n%s\nhave:\n%s", want, have)
+	}
+}
+
+func TestStrictWarning(t *testing.T) {
+	dir, err := os.MkdirTemp("", "golc3-asm")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	infile := filepath.Join(dir, "block.asm")
+	outfile := filepath.Join(dir, "block.obj")
+
+	if err := os.WriteFile(infile, []byte(".BLKW #0\nHALT\n"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	// The zero-sized block is only a warning unless -strict is given
+	if code, logged := runAsm(t, "-out", outfile, infile); code != 0 {
+		t.Fatalf("Expected exit code 0, have:%d\n%s", code, logged)
+	}
+
+	if err := os.Remove(outfile); err != nil {
+		t.Fatal(err)
+	}
+
+	code, logged := runAsm(t, "-strict", "-out", outfile, infile)
+
+	if code != 1 {
+		t.Fatalf("Expected exit code 1, have:%d\n%s", code, logged)
+	}
+
+	if !strings.Contains(logged, "Block allocates zero words") {
+		t.Fatalf("Expected zero-sized block to be logged, have:%s", logged)
+	}
+
+	if _, err := os.Stat(outfile); !os.IsNotExist(err) {
+		t.Fatalf("Expected no output file to be written, have:%v", err)
+	}
+}
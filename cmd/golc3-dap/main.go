@@ -0,0 +1,65 @@
+// Copyright (C) 2021  Antonio Lassandro
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+
+// You should have received a copy of the GNU General Public License along
+// with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+
+	"github.com/lassandro/golc3/pkg/dap"
+)
+
+var helpvar bool
+
+const usage = "golc3-dap"
+
+func init() {
+	log.SetFlags(0)
+	log.SetOutput(os.Stderr)
+}
+
+func init() {
+	flag.BoolVar(&helpvar, "help", false, "Displays command usage")
+	flag.Parse()
+}
+
+func golc3_dap() int {
+	if helpvar {
+		fmt.Println(usage)
+		flag.PrintDefaults()
+		return 0
+	}
+
+	if len(flag.Args()) != 0 {
+		log.Println(usage)
+		return 1
+	}
+
+	// The protocol is spoken over stdin and stdout, so diagnostics are only
+	// written to stderr
+	if err := dap.NewServer(os.Stdin, os.Stdout).Serve(); err != nil {
+		log.Println(err)
+		return 1
+	}
+
+	return 0
+}
+
+func main() {
+	os.Exit(golc3_dap())
+}
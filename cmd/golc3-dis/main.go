@@ -0,0 +1,155 @@
+// Copyright (C) 2021  Antonio Lassandro
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+
+// You should have received a copy of the GNU General Public License along
+// with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/lassandro/golc3/pkg/assembler"
+	"github.com/lassandro/golc3/pkg/encoding"
+)
+
+var helpvar bool
+var outvar string
+var symvar string
+var originvar string
+
+const usage = "golc3-dis [-o outfile] [-sym symfile] [-origin address] filename"
+
+func init() {
+	log.SetFlags(0)
+	log.SetOutput(os.Stderr)
+}
+
+func init() {
+	flag.BoolVar(&helpvar, "help", false, "Displays command usage")
+	flag.StringVar(
+		&outvar, "o", "",
+		"Specifies the output file, otherwise the disassembly is written "+
+			"to stdout",
+	)
+	flag.StringVar(
+		&symvar, "sym", "",
+		"Specifies the symbol table providing labels, otherwise the input "+
+			"filename with extension '.lc3db' is used if present",
+	)
+	flag.StringVar(
+		&originvar, "origin", "",
+		"Specifies the load address of the first word in the binary, "+
+			"otherwise the binary is assumed to be an image of memory "+
+			"starting at 0x0000 as written by golc3-asm",
+	)
+	flag.Parse()
+}
+
+func golc3_dis() int {
+	if helpvar {
+		fmt.Println(usage)
+		flag.PrintDefaults()
+		return 0
+	}
+
+	args := flag.Args()
+
+	if len(args) != 1 {
+		log.Println(usage)
+		return 1
+	}
+
+	infile := args[0]
+	log.SetPrefix(fmt.Sprintf("\033[1m%s:\033[0m", filepath.Base(infile)))
+
+	input, err := os.Open(infile)
+
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+
+	defer input.Close()
+
+	var origin uint16
+
+	if originvar != "" {
+		if origin, err = encoding.DecodeHex(originvar); err != nil {
+			log.Printf("Invalid origin '%s'", originvar)
+			return 1
+		}
+	}
+
+	symfile := symvar
+
+	if symfile == "" {
+		symfile = strings.TrimSuffix(infile, filepath.Ext(infile)) + ".lc3db"
+	}
+
+	var symtable *assembler.SymTable
+
+	if file, err := os.Open(symfile); err == nil {
+		symtable, err = assembler.ReadSymTable(file)
+		file.Close()
+
+		if err != nil {
+			log.Println("Error reading symbol table")
+			log.Println(err)
+			return 1
+		}
+	} else if symvar != "" {
+		log.Println(err)
+		return 1
+	}
+
+	disassembly, err := assembler.DisassembleBinary(input, origin, symtable)
+
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+
+	var output io.Writer = os.Stdout
+
+	if outvar != "" {
+		file, err := os.Create(outvar)
+
+		if err != nil {
+			log.Println("Error creating output file")
+			log.Println(err)
+			return 1
+		}
+
+		defer file.Close()
+
+		output = file
+	}
+
+	if _, err := io.WriteString(output, disassembly); err != nil {
+		log.Println("Error writing output")
+		log.Println(err)
+		return 1
+	}
+
+	return 0
+}
+
+func main() {
+	os.Exit(golc3_dis())
+}
@@ -0,0 +1,320 @@
+// Copyright (C) 2021  Antonio Lassandro
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+
+// You should have received a copy of the GNU General Public License along
+// with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/lassandro/golc3/pkg/assembler"
+	"github.com/lassandro/golc3/pkg/encoding"
+)
+
+var helpvar bool
+var outvar string
+var formatvar string
+var encodingvar string
+var filtervar string
+var addrvar string
+var fromtextvar bool
+var mergevar bool
+
+const usage = "golc3-sym [-format format] [-filter prefix] [-addr address] symfile\n" +
+	"golc3-sym -from-text [-encoding encoding] [-o outfile] listing\n" +
+	"golc3-sym -merge [-encoding encoding] -o outfile symfile symfile"
+
+func init() {
+	log.SetFlags(0)
+	log.SetOutput(os.Stderr)
+}
+
+func init() {
+	flag.BoolVar(&helpvar, "help", false, "Displays command usage")
+	flag.StringVar(
+		&formatvar, "format", "text",
+		"Specifies the format labels are listed in, one of 'text', 'csv' "+
+			"or 'json'",
+	)
+	flag.StringVar(
+		&filtervar, "filter", "",
+		"Specifies a prefix which listed labels must begin with",
+	)
+	flag.StringVar(
+		&addrvar, "addr", "",
+		"Specifies an address to print the label of, instead of listing "+
+			"every label",
+	)
+	flag.BoolVar(
+		&fromtextvar, "from-text", false,
+		"Specifies that the input is a text listing of labels and "+
+			"addresses, from which a symbol table should be built",
+	)
+	flag.BoolVar(
+		&mergevar, "merge", false,
+		"Specifies that the two given symbol tables should be merged into "+
+			"the output file",
+	)
+	flag.StringVar(
+		&encodingvar, "encoding", "gob",
+		"Specifies the encoding of written symbol tables, either 'gob' or "+
+			"'json'",
+	)
+	flag.StringVar(
+		&outvar, "o", "",
+		"Specifies the file symbol tables are written to. A name of '-' "+
+			"writes to stdout. With -from-text the listing filename with "+
+			"extension '.lc3db' is used by default",
+	)
+}
+
+func readSymTable(filename string) (*assembler.SymTable, error) {
+	file, err := os.Open(filename)
+
+	if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	if fromtextvar {
+		return assembler.ReadSymTableText(file)
+	}
+
+	return assembler.ReadSymTable(file)
+}
+
+func writeSymTable(filename string, symtable *assembler.SymTable) error {
+	var output io.Writer = os.Stdout
+
+	if filename != "-" {
+		file, err := os.Create(filename)
+
+		if err != nil {
+			return err
+		}
+
+		defer file.Close()
+
+		output = file
+	}
+
+	if encodingvar == "json" {
+		return json.NewEncoder(output).Encode(symtable)
+	}
+
+	return gob.NewEncoder(output).Encode(symtable)
+}
+
+// Merges the labels and constants of b into a copy of a, returning a
+// description of each entry which the tables disagree on. Source positions are
+// only taken from b if both tables were assembled from the same source
+func mergeSymTables(a, b *assembler.SymTable) (*assembler.SymTable, []string) {
+	merged := assembler.SymTable{
+		Source:    a.Source,
+		Symbols:   make(map[uint16]int64),
+		Labels:    make(map[uint16]string),
+		Constants: make(map[string]uint16),
+	}
+
+	var conflicts []string
+
+	for _, table := range []*assembler.SymTable{a, b} {
+		for addr, label := range table.Labels {
+			if existing, ok := merged.Labels[addr]; ok && existing != label {
+				conflicts = append(conflicts, fmt.Sprintf(
+					"Address %#04x is labelled both '%s' and '%s'",
+					addr, existing, label,
+				))
+				continue
+			}
+
+			if existing, ok := merged.Lookup(label); ok && existing != addr {
+				conflicts = append(conflicts, fmt.Sprintf(
+					"Label '%s' is declared at both %#04x and %#04x",
+					label, existing, addr,
+				))
+				continue
+			}
+
+			merged.Labels[addr] = label
+		}
+
+		for name, value := range table.Constants {
+			if existing, ok := merged.Constants[name]; ok && existing != value {
+				conflicts = append(conflicts, fmt.Sprintf(
+					"Constant '%s' is defined as both %#04x and %#04x",
+					name, existing, value,
+				))
+				continue
+			}
+
+			merged.Constants[name] = value
+		}
+
+		if table == b && b.Source != a.Source {
+			continue
+		}
+
+		for addr, offset := range table.Symbols {
+			merged.AddSymbol(addr, offset)
+		}
+
+		for addr, cursor := range table.SourceMap {
+			if merged.SourceMap == nil {
+				merged.SourceMap = make(map[uint16]assembler.Cursor)
+			}
+
+			merged.SourceMap[addr] = cursor
+		}
+	}
+
+	sort.Strings(conflicts)
+
+	return &merged, conflicts
+}
+
+func golc3_sym() int {
+	if helpvar {
+		fmt.Println(usage)
+		flag.PrintDefaults()
+		return 0
+	}
+
+	args := flag.Args()
+
+	encodingvar = strings.ToLower(encodingvar)
+
+	if encodingvar != "gob" && encodingvar != "json" {
+		log.Printf("Unknown symbol table encoding '%s'", encodingvar)
+		return 1
+	}
+
+	if mergevar {
+		if len(args) != 2 || outvar == "" {
+			log.Println(usage)
+			return 1
+		}
+
+		tables := make([]*assembler.SymTable, len(args))
+
+		for i, filename := range args {
+			symtable, err := readSymTable(filename)
+
+			if err != nil {
+				log.Printf("Error reading symbol table %s", filename)
+				log.Println(err)
+				return 1
+			}
+
+			tables[i] = symtable
+		}
+
+		merged, conflicts := mergeSymTables(tables[0], tables[1])
+
+		if len(conflicts) > 0 {
+			for _, conflict := range conflicts {
+				log.Println(conflict)
+			}
+
+			return 1
+		}
+
+		if err := writeSymTable(outvar, merged); err != nil {
+			log.Println("Error writing symbol table")
+			log.Println(err)
+			return 1
+		}
+
+		return 0
+	}
+
+	if len(args) != 1 {
+		log.Println(usage)
+		return 1
+	}
+
+	infile := args[0]
+	log.SetPrefix(fmt.Sprintf("\033[1m%s:\033[0m", filepath.Base(infile)))
+
+	symtable, err := readSymTable(infile)
+
+	if err != nil {
+		log.Println("Error reading symbol table")
+		log.Println(err)
+		return 1
+	}
+
+	if fromtextvar {
+		if outvar == "" {
+			outvar = strings.TrimSuffix(infile, filepath.Ext(infile)) + ".lc3db"
+		}
+
+		if err := writeSymTable(outvar, symtable); err != nil {
+			log.Println("Error writing symbol table")
+			log.Println(err)
+			return 1
+		}
+
+		return 0
+	}
+
+	if addrvar != "" {
+		addr, err := encoding.DecodeHex(addrvar)
+
+		if err != nil {
+			log.Printf("Invalid address '%s'", addrvar)
+			return 1
+		}
+
+		label, ok := symtable.LookupAddr(addr)
+
+		if !ok {
+			log.Printf("No label at %#04x", addr)
+			return 1
+		}
+
+		fmt.Println(label)
+		return 0
+	}
+
+	if filtervar != "" {
+		for addr, label := range symtable.Labels {
+			if !strings.HasPrefix(label, filtervar) {
+				delete(symtable.Labels, addr)
+			}
+		}
+	}
+
+	if err := symtable.WriteTo(os.Stdout, strings.ToLower(formatvar)); err != nil {
+		log.Println(err)
+		return 1
+	}
+
+	return 0
+}
+
+func main() {
+	flag.Parse()
+	os.Exit(golc3_sym())
+}
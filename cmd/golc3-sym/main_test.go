@@ -0,0 +1,154 @@
+// Copyright (C) 2021  Antonio Lassandro
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+
+// You should have received a copy of the GNU General Public License along
+// with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/lassandro/golc3/pkg/assembler"
+)
+
+func TestMergeSymTables(t *testing.T) {
+	tests := []struct {
+		Name      string
+		A, B      assembler.SymTable
+		Labels    map[uint16]string
+		Constants map[string]uint16
+		Symbols   map[uint16]int64
+		Conflicts []string
+	}{
+		{
+			Name: "Disjoint",
+			A: assembler.SymTable{
+				Source:  "program.asm",
+				Symbols: map[uint16]int64{0x3000: 0},
+				Labels:  map[uint16]string{0x3000: "START"},
+			},
+			B: assembler.SymTable{
+				Source:    "program.asm",
+				Symbols:   map[uint16]int64{0x3001: 12},
+				Labels:    map[uint16]string{0x3001: "LOOP"},
+				Constants: map[string]uint16{"SIZE": 4},
+			},
+			Labels:    map[uint16]string{0x3000: "START", 0x3001: "LOOP"},
+			Constants: map[string]uint16{"SIZE": 4},
+			Symbols:   map[uint16]int64{0x3000: 0, 0x3001: 12},
+		},
+		{
+			Name: "Duplicate",
+			A: assembler.SymTable{
+				Labels:    map[uint16]string{0x3000: "START"},
+				Constants: map[string]uint16{"SIZE": 4},
+			},
+			B: assembler.SymTable{
+				Labels:    map[uint16]string{0x3000: "START"},
+				Constants: map[string]uint16{"SIZE": 4},
+			},
+			Labels:    map[uint16]string{0x3000: "START"},
+			Constants: map[string]uint16{"SIZE": 4},
+			Symbols:   map[uint16]int64{},
+		},
+		{
+			Name: "Address Conflict",
+			A:    assembler.SymTable{Labels: map[uint16]string{0x3000: "START"}},
+			B:    assembler.SymTable{Labels: map[uint16]string{0x3000: "MAIN"}},
+			Conflicts: []string{
+				"Address 0x3000 is labelled both 'START' and 'MAIN'",
+			},
+		},
+		{
+			Name: "Label Conflict",
+			A:    assembler.SymTable{Labels: map[uint16]string{0x3000: "START"}},
+			B:    assembler.SymTable{Labels: map[uint16]string{0x4000: "START"}},
+			Conflicts: []string{
+				"Label 'START' is declared at both 0x3000 and 0x4000",
+			},
+		},
+		{
+			Name: "Constant Conflict",
+			A:    assembler.SymTable{Constants: map[string]uint16{"SIZE": 4}},
+			B:    assembler.SymTable{Constants: map[string]uint16{"SIZE": 8}},
+			Conflicts: []string{
+				"Constant 'SIZE' is defined as both 0x0004 and 0x0008",
+			},
+		},
+		{
+			Name: "Different Source",
+			A: assembler.SymTable{
+				Source:  "a.asm",
+				Symbols: map[uint16]int64{0x3000: 0},
+				Labels:  map[uint16]string{0x3000: "START"},
+			},
+			B: assembler.SymTable{
+				Source:  "b.asm",
+				Symbols: map[uint16]int64{0x4000: 0},
+				Labels:  map[uint16]string{0x4000: "OTHER"},
+			},
+			Labels:    map[uint16]string{0x3000: "START", 0x4000: "OTHER"},
+			Constants: map[string]uint16{},
+			Symbols:   map[uint16]int64{0x3000: 0},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			merged, conflicts := mergeSymTables(&test.A, &test.B)
+
+			if !reflect.DeepEqual(conflicts, test.Conflicts) {
+				t.Fatalf(
+					"Conflict mismatch\nwant:%q\nhave:%q",
+					test.Conflicts,
+					conflicts,
+				)
+			}
+
+			if test.Conflicts != nil {
+				return
+			}
+
+			if merged.Source != test.A.Source {
+				t.Fatalf(
+					"Source mismatch\nwant:%s\nhave:%s",
+					test.A.Source,
+					merged.Source,
+				)
+			}
+
+			if !reflect.DeepEqual(merged.Labels, test.Labels) {
+				t.Fatalf(
+					"Label mismatch\nwant:%v\nhave:%v", test.Labels, merged.Labels,
+				)
+			}
+
+			if !reflect.DeepEqual(merged.Constants, test.Constants) {
+				t.Fatalf(
+					"Constant mismatch\nwant:%v\nhave:%v",
+					test.Constants,
+					merged.Constants,
+				)
+			}
+
+			if !reflect.DeepEqual(merged.Symbols, test.Symbols) {
+				t.Fatalf(
+					"Symbol mismatch\nwant:%v\nhave:%v",
+					test.Symbols,
+					merged.Symbols,
+				)
+			}
+		})
+	}
+}
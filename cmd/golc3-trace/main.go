@@ -0,0 +1,148 @@
+// Copyright (C) 2021  Antonio Lassandro
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+
+// You should have received a copy of the GNU General Public License along
+// with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/lassandro/golc3/pkg/debugger"
+)
+
+var helpvar bool
+var countvar int
+
+const usage = "golc3-trace [-n count] [filename]"
+
+func init() {
+	log.SetFlags(0)
+	log.SetOutput(os.Stderr)
+}
+
+func init() {
+	flag.BoolVar(&helpvar, "help", false, "Displays command usage")
+	flag.IntVar(
+		&countvar, "n", 10,
+		"Specifies the number of hotspots shown, zero shows every executed "+
+			"address",
+	)
+	flag.Parse()
+}
+
+type hotspot struct {
+	addr      uint16
+	statement string
+	count     uint64
+}
+
+func golc3_trace() int {
+	if helpvar {
+		fmt.Println(usage)
+		flag.PrintDefaults()
+		return 0
+	}
+
+	args := flag.Args()
+
+	if len(args) > 1 {
+		log.Println(usage)
+		return 1
+	}
+
+	var input io.Reader = os.Stdin
+
+	if len(args) == 1 {
+		log.SetPrefix(fmt.Sprintf("\033[1m%s:\033[0m", filepath.Base(args[0])))
+
+		file, err := os.Open(args[0])
+
+		if err != nil {
+			log.Println(err)
+			return 1
+		}
+
+		defer file.Close()
+
+		input = file
+	}
+
+	hotspots := make(map[uint16]*hotspot)
+	var total uint64
+
+	scanner := bufio.NewScanner(input)
+
+	for line := 1; scanner.Scan(); line++ {
+		addr, statement, err := debugger.ParseTraceLine(scanner.Text())
+
+		if err != nil {
+			log.Printf("%d: %s", line, err)
+			return 1
+		}
+
+		// The latest statement is kept should the address be overwritten
+		if spot, exists := hotspots[addr]; exists {
+			spot.statement = statement
+			spot.count++
+		} else {
+			hotspots[addr] = &hotspot{addr, statement, 1}
+		}
+
+		total++
+	}
+
+	if err := scanner.Err(); err != nil {
+		log.Println(err)
+		return 1
+	}
+
+	sorted := make([]*hotspot, 0, len(hotspots))
+
+	for _, spot := range hotspots {
+		sorted = append(sorted, spot)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].count != sorted[j].count {
+			return sorted[i].count > sorted[j].count
+		}
+
+		return sorted[i].addr < sorted[j].addr
+	})
+
+	if countvar > 0 && len(sorted) > countvar {
+		sorted = sorted[:countvar]
+	}
+
+	for _, spot := range sorted {
+		fmt.Printf(
+			"%#04x %10d %6.2f%% %s\n",
+			spot.addr, spot.count,
+			100*float64(spot.count)/float64(total), spot.statement,
+		)
+	}
+
+	return 0
+}
+
+func main() {
+	os.Exit(golc3_trace())
+}
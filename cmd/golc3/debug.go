@@ -18,10 +18,11 @@ package main
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"log"
 	"math"
 	"os"
-	"sort"
+	"path/filepath"
 	"strconv"
 	"strings"
 
@@ -30,7 +31,27 @@ import (
 	"github.com/lassandro/golc3/pkg/machine"
 )
 
-var lastcmd []string
+// Commands entered at the REPL are persisted to historyFile in the home
+// directory, keeping only the most recent historySize
+const historyFile = ".golc3_history"
+const historySize = 1000
+
+var history = debugger.History{Max: historySize}
+var editor *debugger.LineEditor
+
+// Source of REPL commands, either stdin or a session replay file
+var replinput *bufio.Scanner
+var replaying bool
+
+// Delivers the command being read from the REPL input while remote requests
+// are served. A read still in progress when a remote command resumes execution
+// is kept for the next time the REPL is entered
+var pendingcommand chan replCommand
+
+type replCommand struct {
+	Line string
+	Ok   bool
+}
 
 func debugBreak(dbg *debugger.Debugger, args []string) {
 	const usage = "break [add|list|remove]"
@@ -44,9 +65,9 @@ func debugBreak(dbg *debugger.Debugger, args []string) {
 
 	switch cmd {
 	case "a", "add":
-		const usage = "break add [0x####]"
+		const usage = "break add [0x####] [condition]"
 
-		if len(args) != 1 {
+		if len(args) == 0 {
 			log.Println(usage)
 			return
 		}
@@ -58,21 +79,16 @@ func debugBreak(dbg *debugger.Debugger, args []string) {
 			return
 		}
 
-		exists := false
-
-		for _, breakpoint := range dbg.Breakpoints {
-			if breakpoint.Addr == addr {
-				exists = true
-				break
-			}
-		}
-
-		if !exists {
-			dbg.Breakpoints = append(
-				dbg.Breakpoints,
-				debugger.Breakpoint{addr},
-			)
+		// The condition may be split across arguments, i.e. R0 == 0
+		condition := strings.Join(args[1:], "")
 
+		if added, err := dbg.AddConditionalBreakpoint(
+			addr, condition,
+		); err != nil {
+			log.Println(err)
+		} else if added && condition != "" {
+			fmt.Printf("Breakpoint added [%#04x] if %s\n", addr, condition)
+		} else if added {
 			fmt.Printf("Breakpoint added [%#04x]\n", addr)
 		}
 
@@ -87,11 +103,18 @@ func debugBreak(dbg *debugger.Debugger, args []string) {
 		var fmtstring string
 		{
 			digits := math.Floor(math.Log10(float64(len(dbg.Breakpoints) + 1)))
-			fmtstring = fmt.Sprintf("#%%0%dd: %%#x\n", int64(digits)+1)
+			fmtstring = fmt.Sprintf("#%%0%dd: %%#x", int64(digits)+1)
 		}
 
 		for i, breakpoint := range dbg.Breakpoints {
-			log.Printf(fmtstring, i, breakpoint.Addr)
+			if breakpoint.Condition != "" {
+				log.Printf(
+					fmtstring+" if %s\n", i, breakpoint.Addr,
+					breakpoint.Condition,
+				)
+			} else {
+				log.Printf(fmtstring+"\n", i, breakpoint.Addr)
+			}
 		}
 
 	case "r", "rm", "remove":
@@ -140,7 +163,21 @@ func debugWatch(dbg *debugger.Debugger, args []string) {
 
 	switch cmd {
 	case "a", "add":
-		const usage = "watch add [0x####] [read|write|readwrite]"
+		const usage = "watch add [0x####] [read|write|readwrite] [-max #]"
+
+		var maxhits uint64
+
+		if len(args) == 4 && args[2] == "-max" {
+			var err error
+			maxhits, err = strconv.ParseUint(args[3], 10, 64)
+
+			if err != nil {
+				log.Println(err)
+				return
+			}
+
+			args = args[:2]
+		}
 
 		if len(args) != 2 {
 			log.Println(usage)
@@ -168,21 +205,11 @@ func debugWatch(dbg *debugger.Debugger, args []string) {
 			return
 		}
 
-		exists := false
-
-		for _, watchpoint := range dbg.Watchpoints {
-			if watchpoint.Addr == addr && watchpoint.Type == wtype {
-				exists = true
-				break
-			}
-		}
-
-		if !exists {
-			dbg.Watchpoints = append(
-				dbg.Watchpoints,
-				debugger.Watchpoint{addr, wtype},
-			)
-
+		if added, err := dbg.AddWatchpoint(debugger.Watchpoint{
+			Addr: addr, Type: wtype, MaxHits: maxhits,
+		}); err != nil {
+			log.Println(err)
+		} else if added {
 			var typename string
 			switch wtype {
 			case debugger.ReadWatch:
@@ -207,17 +234,21 @@ func debugWatch(dbg *debugger.Debugger, args []string) {
 		var fmtstring string
 		{
 			digits := math.Floor(math.Log10(float64(len(dbg.Watchpoints) + 1)))
-			fmtstring = fmt.Sprintf("#%%0%dd: %%#x %%s\n", int64(digits)+1)
+			fmtstring = fmt.Sprintf(
+				"#%%0%dd: %%#x %%s (%%d hits)\n", int64(digits)+1,
+			)
 		}
 
 		for i, watchpoint := range dbg.Watchpoints {
+			hits := watchpoint.HitCount
+
 			switch watchpoint.Type {
 			case debugger.WriteWatch:
-				log.Printf(fmtstring, i, watchpoint.Addr, "write")
+				log.Printf(fmtstring, i, watchpoint.Addr, "write", hits)
 			case debugger.ReadWatch:
-				log.Printf(fmtstring, i, watchpoint.Addr, "read")
+				log.Printf(fmtstring, i, watchpoint.Addr, "read", hits)
 			case debugger.ReadWriteWatch:
-				log.Printf(fmtstring, i, watchpoint.Addr, "rwrite")
+				log.Printf(fmtstring, i, watchpoint.Addr, "rwrite", hits)
 			}
 		}
 
@@ -254,7 +285,7 @@ func debugWatch(dbg *debugger.Debugger, args []string) {
 	}
 }
 
-func debugReg(dbg *debugger.Debugger, mc *machine.MachineState, args []string) {
+func debugReg(dbg *debugger.Debugger, mc *machine.Machine, args []string) {
 	const usage = "register [R#|PC|PS] [0x####]"
 
 	if len(args) > 0 {
@@ -272,37 +303,28 @@ func debugReg(dbg *debugger.Debugger, mc *machine.MachineState, args []string) {
 
 		args[0] = strings.ToUpper(args[0])
 
-		switch args[0] {
-		case "R0":
-			mc.Registers[0] = value
-		case "R1":
-			mc.Registers[1] = value
-		case "R2":
-			mc.Registers[2] = value
-		case "R3":
-			mc.Registers[3] = value
-		case "R4":
-			mc.Registers[4] = value
-		case "R5":
-			mc.Registers[5] = value
-		case "R6":
-			mc.Registers[6] = value
-		case "R7":
-			mc.Registers[7] = value
-		case "PC":
-			mc.Program = value
-		case "PS":
-			mc.Procstat = value
+		switch {
+		case args[0] == "PC":
+			mc.State.Program = value
+		case args[0] == "PS":
+			mc.State.Procstat = value
+		case len(args[0]) == 2 && args[0][0] == 'R':
+			if err := mc.SetRegister(int(args[0][1])-'0', value); err != nil {
+				log.Println(err)
+				return
+			}
 		default:
-			log.Println("Invalid regsiter")
+			log.Println(machine.ErrInvalidRegister)
 			return
 		}
 
 		fmt.Printf("\033[1m%s:\033[0m %#04x\n", args[0], value)
 	} else {
-		for i, register := range mc.Registers {
+		for i := 0; i < len(mc.State.Registers); i++ {
+			register, _ := mc.GetRegister(i)
+
 			fmt.Printf("\033[1mR%d:\033[0m %#04x\t", i, register)
-			if i == (len(mc.Registers)-1)/2 {
+			if i == (len(mc.State.Registers)-1)/2 {
 				fmt.Println()
 			}
 		}
@@ -310,8 +332,8 @@ func debugReg(dbg *debugger.Debugger, mc *machine.MachineState, args []string) {
 		fmt.Println()
 		fmt.Printf(
 			"\033[1mPC:\033[0m %#04x\t\033[1mPS:\033[0m %#04x\n",
-			mc.Program,
-			mc.Procstat,
+			mc.State.Program,
+			mc.State.Procstat,
 		)
 	}
 }
@@ -324,22 +346,49 @@ func debugSource(dbg *debugger.Debugger, mc *machine.MachineState, args []string
 		return
 	}
 
-	if dbg.SymTable == nil {
-		fmt.Println("No symbol table loaded")
+	addr, size, ok := parseListingArgs(dbg, mc, args)
+
+	if !ok {
 		return
 	}
 
+	// Without the original source the instructions are disassembled instead
+	if dbg.Source == nil || dbg.SymTable == nil {
+		dbg.PrintDisasm(mc, addr, size)
+	} else {
+		dbg.PrintSource(addr, mc.Program, size)
+	}
+}
+
+func debugDisasm(dbg *debugger.Debugger, mc *machine.MachineState, args []string) {
+	const usage = "disasm [0x####|label] [#]"
+
+	if len(args) > 2 {
+		log.Println(usage)
+		return
+	}
+
+	if addr, size, ok := parseListingArgs(dbg, mc, args); ok {
+		dbg.PrintDisasm(mc, addr, size)
+	}
+}
+
+// Parses the arguments of the source and disasm commands: [0x####|label] [#],
+// where the address defaults to the program counter and the count to 3
+func parseListingArgs(
+	dbg *debugger.Debugger, mc *machine.MachineState, args []string,
+) (uint16, uint16, bool) {
 	var addr uint16 = mc.Program
 	var size uint16 = 3
 	var err error = nil
 
 	if len(args) > 0 {
 		isLabel := false
-		for labelAddr, label := range dbg.SymTable.Labels {
-			if label == args[0] {
+
+		if dbg.SymTable != nil {
+			if labelAddr, ok := dbg.SymTable.Lookup(args[0]); ok {
 				isLabel = true
 				addr = labelAddr
-				break
 			}
 		}
 
@@ -352,7 +401,7 @@ func debugSource(dbg *debugger.Debugger, mc *machine.MachineState, args []string
 
 				if err != nil {
 					log.Println(err)
-					return
+					return 0, 0, false
 				}
 
 				addr = mc.Program
@@ -367,13 +416,13 @@ func debugSource(dbg *debugger.Debugger, mc *machine.MachineState, args []string
 
 		if err != nil {
 			log.Println(err)
-			return
+			return 0, 0, false
 		}
 
 		size = uint16(value)
 	}
 
-	dbg.PrintSource(addr, size)
+	return addr, size, true
 }
 
 func debugLabels(dbg *debugger.Debugger, args []string) {
@@ -389,22 +438,39 @@ func debugLabels(dbg *debugger.Debugger, args []string) {
 		return
 	}
 
-	keys := make([]uint16, 0, len(dbg.SymTable.Labels))
-	for addr, _ := range dbg.SymTable.Labels {
-		keys = append(keys, addr)
+	if err := dbg.SymTable.WriteTo(os.Stdout, "text"); err != nil {
+		log.Println(err)
 	}
+}
 
-	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+// Strips a trailing --force argument, reporting whether it was present
+func forceArg(args []string) ([]string, bool) {
+	if n := len(args); n > 0 && (args[n-1] == "--force" || args[n-1] == "-f") {
+		return args[:n-1], true
+	}
 
-	for _, addr := range keys {
-		fmt.Printf(
-			"\033[1m[%#04x]\033[0m %s\n", addr, dbg.SymTable.Labels[addr],
+	return args, false
+}
+
+// Reports whether addr may be modified, warning if it is a device register
+// and force was not given
+func checkDeviceAddress(addr uint16, force bool) bool {
+	if debugger.IsDeviceAddress(addr) && !force {
+		log.Printf(
+			"Address %#04x is in device register space, use --force to "+
+				"proceed",
+			addr,
 		)
+		return false
 	}
+
+	return true
 }
 
 func debugJump(dbg *debugger.Debugger, mc *machine.MachineState, args []string) {
-	const usage = "jump [0x####|label]"
+	const usage = "jump [0x####|label] [--force]"
+
+	args, force := forceArg(args)
 
 	if len(args) != 1 {
 		fmt.Println(usage)
@@ -412,20 +478,26 @@ func debugJump(dbg *debugger.Debugger, mc *machine.MachineState, args []string)
 	}
 
 	if addr, err := encoding.DecodeHex(args[0]); err == nil {
+		if !checkDeviceAddress(addr, force) {
+			return
+		}
+
 		mc.Program = addr
 
 		fmt.Printf("\033[1mPC:\033[0m %#04x\n", addr)
 	} else if dbg.SymTable != nil {
-		for addr, label := range dbg.SymTable.Labels {
-			if label == args[0] {
-				mc.Program = addr
-				fmt.Printf(
-					"\033[1mPC:\033[0m %#04x \033[1;30m(%s)\033[0m\n",
-					addr,
-					label,
-				)
+		if addr, ok := dbg.SymTable.Lookup(args[0]); ok {
+			if !checkDeviceAddress(addr, force) {
 				return
 			}
+
+			mc.Program = addr
+			fmt.Printf(
+				"\033[1mPC:\033[0m %#04x \033[1;30m(%s)\033[0m\n",
+				addr,
+				args[0],
+			)
+			return
 		}
 
 		fmt.Printf("Unable to find '%s'\n", args[0])
@@ -442,44 +514,37 @@ func debugMemory(dbg *debugger.Debugger, mc *machine.MachineState, args []string
 		return
 	}
 
-	var size uint16 = 1
-	var addr uint16 = mc.Program
-	var err error
-
-	if len(args) > 0 {
-		addr, err = encoding.DecodeHex(args[0])
+	if err := dbg.PrintMemRange(mc, args); err != nil {
+		log.Println(err)
+	}
+}
 
-		if err != nil {
-			var value int64
-			value, err = strconv.ParseInt(args[0], 10, 16)
+func debugStack(dbg *debugger.Debugger, mc *machine.MachineState, args []string) {
+	const usage = "stack [#]"
 
-			if err != nil {
-				log.Println(err)
-				return
-			}
-
-			addr = mc.Program
-			size = uint16(value)
-		}
-	}
+	var count uint16 = 8
 
 	if len(args) > 1 {
-		var value int64
-		value, err = strconv.ParseInt(args[1], 10, 16)
+		log.Println(usage)
+		return
+	} else if len(args) == 1 {
+		value, err := strconv.ParseUint(args[0], 10, 16)
 
 		if err != nil {
 			log.Println(err)
 			return
 		}
 
-		size = uint16(value)
+		count = uint16(value)
 	}
 
-	dbg.PrintMem(mc, addr, size)
+	dbg.PrintStack(mc, count)
 }
 
-func debugSet(dbg *debugger.Debugger, mc *machine.MachineState, args []string) {
-	const usage = "set [0x####] [0x####]"
+func debugSet(dbg *debugger.Debugger, mc *machine.Machine, args []string) {
+	const usage = "set [0x####] [0x####] [--force]"
+
+	args, force := forceArg(args)
 
 	if len(args) != 2 {
 		log.Println(usage)
@@ -504,94 +569,437 @@ func debugSet(dbg *debugger.Debugger, mc *machine.MachineState, args []string) {
 		return
 	}
 
-	mc.Memory[addr] = value
-	dbg.PrintMem(mc, addr, 1)
+	if !checkDeviceAddress(addr, force) {
+		return
+	}
+
+	// Written with the debugger detached, so that watchpoints on addr are not
+	// triggered from within the REPL
+	attached := mc.Debugger
+	mc.Debugger = nil
+	mc.SetMemory(addr, value)
+	mc.Debugger = attached
+
+	dbg.PrintMem(&mc.State, addr, 1)
+}
+
+// File written by the trace command, and its buffered writer
+var tracelog *os.File
+var tracelogwriter *bufio.Writer
+
+func debugTrace(dbg *debugger.Debugger, mc *machine.Machine, args []string) {
+	const usage = "trace [start <file>|stop]"
+
+	if len(args) == 0 {
+		fmt.Println(usage)
+		return
+	}
+
+	switch args[0] {
+	case "start":
+		if len(args) != 2 {
+			fmt.Println(usage)
+			return
+		}
+
+		stopTrace(dbg)
+
+		file, err := os.Create(args[1])
+
+		if err != nil {
+			log.Println(err)
+			return
+		}
+
+		tracelog = file
+		tracelogwriter = bufio.NewWriter(file)
+		dbg.StartTrace(tracelogwriter, mc)
+
+		fmt.Printf("Tracing to %s\n", args[1])
+
+	case "stop":
+		if tracelog == nil {
+			fmt.Println("Not tracing")
+			return
+		}
+
+		name := tracelog.Name()
+		stopTrace(dbg)
+
+		fmt.Printf("Trace written to %s\n", name)
+
+	default:
+		fmt.Println(usage)
+	}
+}
+
+// Closes the file written by the trace command, if any
+func stopTrace(dbg *debugger.Debugger) {
+	if tracelog == nil {
+		return
+	}
+
+	if err := dbg.StopTrace(); err != nil {
+		log.Println(err)
+	}
+
+	if err := tracelogwriter.Flush(); err != nil {
+		log.Println(err)
+	}
+
+	if err := tracelog.Close(); err != nil {
+		log.Println(err)
+	}
+
+	tracelog = nil
+	tracelogwriter = nil
+}
+
+func debugExport(dbg *debugger.Debugger, mc *machine.Machine, args []string) {
+	const usage = "export <file>"
+
+	if len(args) != 1 {
+		fmt.Println(usage)
+		return
+	}
+
+	file, err := os.Create(args[0])
+
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	defer file.Close()
+
+	if err := debugger.ExportJSON(dbg, mc, file); err != nil {
+		log.Println(err)
+		return
+	}
+
+	fmt.Printf("Session exported to %s\n", args[0])
+}
+
+func debugImport(dbg *debugger.Debugger, mc *machine.Machine, args []string) {
+	const usage = "import <file>"
+
+	if len(args) != 1 {
+		fmt.Println(usage)
+		return
+	}
+
+	file, err := os.Open(args[0])
+
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	defer file.Close()
+
+	imported, state, err := debugger.ImportJSON(file)
+
+	if err != nil {
+		log.Println(err)
+		return
+	}
+
+	// Handlers and files of the current session are kept
+	mc.RestoreState(state)
+	dbg.Breakpoints = imported.Breakpoints
+	dbg.Watchpoints = imported.Watchpoints
+
+	if imported.SymTable != nil {
+		dbg.SymTable = imported.SymTable
+	}
+
+	fmt.Printf("Session imported from %s\n", args[0])
+	dbg.PrintMem(&mc.State, mc.State.Program, 1)
 }
 
 func debugREPL(dbg *debugger.Debugger, mc *machine.Machine) {
 	exitRawTerm()
 	defer enterRawTerm()
 
-	scanner := bufio.NewScanner(os.Stdin)
+	// Lines are edited in place when typed at a terminal, but read as is
+	// from a replay or a pipe
+	if replinput == nil && editor == nil {
+		if isTerminal() {
+			editor = &debugger.LineEditor{
+				Input:   stdin,
+				Output:  os.Stdout,
+				History: &history,
+			}
+		} else {
+			replinput = bufio.NewScanner(stdin)
+		}
+	}
 
 	for {
-		fmt.Print("\033[1;30m(dbg)\033[0m ")
+		line, ok, resumed := nextCommand(dbg, mc)
 
-		if !scanner.Scan() {
-			fmt.Println()
+		if resumed {
+			return
+		} else if !ok {
 			shouldexit = true
 			return
 		}
 
-		args := strings.Split(strings.TrimSpace(scanner.Text()), " ")
+		// An empty line repeats the last command
+		line = history.Resolve(line)
 
-		if len(args[0]) == 0 {
-			if len(lastcmd) == 0 {
-				continue
+		if line == "" {
+			continue
+		}
+
+		args := strings.Split(line, " ")
+
+		switch args[0] {
+		case "clear", "q", "quit", "exit":
+			// Meta commands are not recorded
+		default:
+			if err := dbg.RecordCommand(args); err != nil {
+				log.Println(err)
 			}
-			args = lastcmd
-		} else {
-			lastcmd = make([]string, len(args))
-			copy(lastcmd, args)
 		}
 
-		cmd := args[0]
-		args = args[1:]
+		if debugCommand(dbg, mc, args[0], args[1:]) {
+			return
+		}
+	}
+}
+
+func loadHistory() {
+	home, err := os.UserHomeDir()
 
-		switch cmd {
-		case "b", "bp", "break", "breakpoint":
-			debugBreak(dbg, args)
+	if err != nil {
+		return
+	}
 
-		case "w", "wp", "watch", "watchpoint":
-			debugWatch(dbg, args)
+	file, err := os.Open(filepath.Join(home, historyFile))
 
-		case "r", "reg", "register", "registers":
-			debugReg(dbg, &mc.State, args)
+	if err != nil {
+		return
+	}
 
-		case "s", "src", "source":
-			debugSource(dbg, &mc.State, args)
+	defer file.Close()
 
-		case "l", "label", "labels":
-			debugLabels(dbg, args)
+	if err := history.Load(file); err != nil {
+		log.Println("Error loading command history")
+		log.Println(err)
+	}
+}
 
-		case "j", "jmp", "jump":
-			debugJump(dbg, &mc.State, args)
+func saveHistory() {
+	home, err := os.UserHomeDir()
 
-		case "m", "mem", "memory":
-			debugMemory(dbg, &mc.State, args)
+	if err != nil {
+		return
+	}
 
-		case "set":
-			debugSet(dbg, &mc.State, args)
+	file, err := os.Create(filepath.Join(home, historyFile))
 
-		case "c", "continue":
-			dbg.Break = false
-			return
+	if err != nil {
+		log.Println("Error saving command history")
+		log.Println(err)
+		return
+	}
 
-		case "n", "next":
-			dbg.Break = true
-			return
+	defer file.Close()
 
-		case "q", "quit", "exit":
-			shouldexit = true
-			return
+	if err := history.Save(file); err != nil {
+		log.Println("Error saving command history")
+		log.Println(err)
+	}
+}
+
+// Reads the next command from the REPL input, running any remote requests
+// received while waiting for it. Reports resumed when a remote command resumes
+// execution before a command is read
+func nextCommand(
+	dbg *debugger.Debugger, mc *machine.Machine,
+) (line string, ok bool, resumed bool) {
+	if remoterequests == nil {
+		line, ok = readCommand(os.Stdout)
+		return
+	}
 
-		case "clear":
-			fmt.Print("\033[H\033[2J")
+	if pendingcommand == nil {
+		commands := make(chan replCommand, 1)
+		pendingcommand = commands
 
-		case "reset":
-			mc.LoadBin(dbg.Source)
+		// Remote commands capture stdout while they run, so the prompt is
+		// written to the stdout of the REPL instead
+		out := os.Stdout
 
-		default:
-			fmt.Printf("error: '%s' is not a valid command\n", cmd)
+		go func() {
+			line, ok := readCommand(out)
+			commands <- replCommand{line, ok}
+		}()
+	}
+
+	for {
+		select {
+		case command := <-pendingcommand:
+			pendingcommand = nil
+			return command.Line, command.Ok, false
+
+		case req := <-remoterequests:
+			if runRemote(dbg, mc, req) {
+				return "", true, true
+			}
 		}
 	}
 }
 
+// Reads the next command, writing the prompt to out, reporting false once input
+// is exhausted
+func readCommand(out io.Writer) (string, bool) {
+	const prompt = "\033[1;30m(dbg)\033[0m "
+
+	if replinput == nil {
+		enterLineTerm()
+		defer exitRawTerm()
+
+		line, err := editor.ReadLine(prompt)
+
+		if err != nil && err != io.EOF {
+			log.Println(err)
+		}
+
+		return line, err == nil
+	}
+
+	fmt.Fprint(out, prompt)
+
+	if !replinput.Scan() {
+		fmt.Fprintln(out)
+		return "", false
+	}
+
+	if replaying {
+		fmt.Fprintln(out, replinput.Text())
+	}
+
+	return replinput.Text(), true
+}
+
+// Runs a single debugger command, reporting whether execution should resume
+func debugCommand(
+	dbg *debugger.Debugger, mc *machine.Machine, cmd string, args []string,
+) bool {
+	switch cmd {
+	case "b", "bp", "break", "breakpoint":
+		debugBreak(dbg, args)
+
+	case "w", "wp", "watch", "watchpoint":
+		debugWatch(dbg, args)
+
+	case "r", "reg", "register", "registers":
+		debugReg(dbg, mc, args)
+
+	case "s", "src", "source":
+		debugSource(dbg, &mc.State, args)
+
+	case "stack":
+		debugStack(dbg, &mc.State, args)
+
+	case "d", "dis", "disasm":
+		debugDisasm(dbg, &mc.State, args)
+
+	case "l", "label", "labels":
+		debugLabels(dbg, args)
+
+	case "j", "jmp", "jump":
+		debugJump(dbg, &mc.State, args)
+
+	case "m", "mem", "memory":
+		debugMemory(dbg, &mc.State, args)
+
+	case "set":
+		debugSet(dbg, mc, args)
+
+	case "trace":
+		debugTrace(dbg, mc, args)
+
+	case "export":
+		debugExport(dbg, mc, args)
+
+	case "import":
+		debugImport(dbg, mc, args)
+
+	case "c", "continue":
+		dbg.Break = false
+		return true
+
+	case "n", "next":
+		dbg.StepOver(mc)
+		return true
+
+	case "finish", "step-out":
+		debugFinish(dbg, mc)
+		return true
+
+	case "q", "quit", "exit":
+		shouldexit = true
+		return true
+
+	case "clear":
+		fmt.Print("\033[H\033[2J")
+
+	case "reset":
+		debugReset(dbg, mc)
+
+	default:
+		fmt.Printf("error: '%s' is not a valid command\n", cmd)
+	}
+
+	return false
+}
+
+// Reloads the binary from the start of the file, resetting the machine
+func debugReset(dbg *debugger.Debugger, mc *machine.Machine) {
+	if _, err := dbg.Binary.Seek(0, io.SeekStart); err != nil {
+		fmt.Printf("error: %s\n", err)
+		return
+	}
+
+	var err error
+
+	if relocatablevar {
+		err = mc.LoadRelocatable(dbg.Binary)
+	} else {
+		_, err = mc.LoadBin(dbg.Binary, originvar)
+	}
+
+	if err != nil {
+		fmt.Printf("error: %s\n", err)
+	}
+}
+
+// Runs until the current subroutine returns to the address held in R7
+func debugFinish(dbg *debugger.Debugger, mc *machine.Machine) {
+	ret := mc.State.Registers[7]
+
+	if ret < machine.MEMSPACE_USER || ret >= machine.MEMSPACE_DEVICES {
+		log.Printf("R7 points outside user memory (%#04x)", ret)
+	}
+
+	dbg.StepOut(mc)
+}
+
 func handleBreak(dbg *debugger.Debugger, mc *machine.Machine) {
+	// Output written by the program so far is shown ahead of the prompt
+	if mc.Devices != nil && mc.Devices.Display != nil {
+		if err := mc.Devices.Display.Flush(); err != nil {
+			log.Println(err)
+		}
+	}
+
 	if !dbg.Break {
 		fmt.Println()
 		fmt.Println("Program stopped")
-		dbg.PrintSource(mc.State.Program, 8)
+		dbg.PrintSource(mc.State.Program, mc.State.Program, 8)
 	}
 	debugREPL(dbg, mc)
 }
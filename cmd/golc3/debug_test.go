@@ -0,0 +1,74 @@
+// Copyright (C) 2021  Antonio Lassandro
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+
+// You should have received a copy of the GNU General Public License along
+// with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/lassandro/golc3/pkg/debugger"
+	"github.com/lassandro/golc3/pkg/machine"
+)
+
+func TestDebugSetWatched(t *testing.T) {
+	var mc machine.Machine
+	var dbg debugger.Debugger
+
+	dbg.HandleWrite = func(addr uint16, _ *debugger.Debugger, _ *machine.Machine) {
+		t.Fatalf("Unexpected write watchpoint trigger at %#04x", addr)
+	}
+
+	dbg.AddWatchpoint(debugger.Watchpoint{Addr: 0x3000, Type: debugger.WriteWatch})
+	mc.Debugger = &dbg
+
+	debugSet(&dbg, &mc, []string{"0x3000", "0xCAFE"})
+
+	if have := mc.State.Memory[0x3000]; have != 0xCAFE {
+		t.Fatalf("Memory mismatch at 0x3000\nwant:%#04x\nhave:%#04x", 0xCAFE, have)
+	}
+
+	if have := dbg.Watchpoints[0].HitCount; have != 0 {
+		t.Fatalf("Expected watchpoint hit count to be unchanged, have:%d", have)
+	}
+
+	if mc.Debugger != &dbg {
+		t.Fatal("Expected debugger to be reattached after set")
+	}
+}
+
+func TestDebugJumpDevice(t *testing.T) {
+	var mc machine.Machine
+	var dbg debugger.Debugger
+
+	mc.State.Program = 0x3000
+
+	logged := new(bytes.Buffer)
+	log.SetOutput(logged)
+	defer log.SetOutput(os.Stderr)
+
+	debugJump(&dbg, &mc.State, []string{"0xFE00"})
+
+	if !strings.Contains(logged.String(), "device register space") {
+		t.Fatalf("Expected device register warning, have:%q", logged.String())
+	}
+
+	if have := mc.State.Program; have != 0x3000 {
+		t.Fatalf("PC mismatch\nwant:%#04x\nhave:%#04x", 0x3000, have)
+	}
+}
@@ -17,26 +17,57 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"encoding/gob"
+	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"os"
 	"os/signal"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/lassandro/golc3/pkg/assembler"
 	"github.com/lassandro/golc3/pkg/debugger"
+	"github.com/lassandro/golc3/pkg/encoding"
 	"github.com/lassandro/golc3/pkg/machine"
 )
 
 var helpvar bool
 var debugvar bool
+var relocatablevar bool
+var recordvar string
+var replayvar string
+var tracevar string
+var replaytracevar string
+var listenvar string
+var attachvar string
+var symbolsstdinvar bool
+var symbolsjsonvar bool
+var originvar uint16
+var statedumpvar string
+var profilevar bool
+var profileformatvar string
+var timeoutvar time.Duration
+var keyboardfilevar string
+var verbosevar bool
+var maxstepsvar uint64
 var shouldexit bool
 
+// Shared by the symbol table, the debugger and the keyboard, so that none of
+// them consumes input buffered ahead of the others
+var stdin *bufio.Reader
+
 const usage = "golc3 filename"
 
+// Binaries larger than this many bytes display a loading indicator
+const loadIndicatorSize = 8 * 1024
+
 func init() {
 	exe, _ := os.Executable()
 	log.SetFlags(0)
@@ -47,7 +78,122 @@ func init() {
 func init() {
 	flag.BoolVar(&helpvar, "help", false, "Displays command usage")
 	flag.BoolVar(&debugvar, "debug", false, "Runs the machine in a debug CLI")
-	flag.Parse()
+	flag.BoolVar(
+		&relocatablevar, "relocatable", false,
+		"Loads the file as a relocatable binary",
+	)
+	flag.StringVar(
+		&recordvar, "record", "",
+		"Records debugger commands to the given file, implies -debug",
+	)
+	flag.StringVar(
+		&replayvar, "replay", "",
+		"Replays debugger commands from the given file, implies -debug",
+	)
+	flag.StringVar(
+		&tracevar, "trace-file", "",
+		"Writes a binary trace of the machine state after every step to "+
+			"the given file",
+	)
+	flag.StringVar(
+		&replaytracevar, "replay-trace", "",
+		"Prints the binary trace in the given file and exits",
+	)
+	flag.StringVar(
+		&listenvar, "listen", "",
+		"Accepts debugger commands from 'golc3 -attach' on the given Unix "+
+			"socket, implies -debug",
+	)
+	flag.StringVar(
+		&attachvar, "attach", "",
+		"Sends debugger commands to the golc3 instance listening on the "+
+			"given Unix socket",
+	)
+	flag.BoolVar(
+		&symbolsstdinvar, "symbols-stdin", false,
+		"Reads the symbol table from stdin rather than the '.lc3db' file "+
+			"alongside the binary, implies -debug",
+	)
+	flag.BoolVar(
+		&symbolsjsonvar, "symbols-json", false,
+		"Decodes the symbol table as JSON rather than gob",
+	)
+	flag.BoolVar(
+		&profilevar, "profile", false,
+		"Prints the number of times each address was executed on exit",
+	)
+	flag.StringVar(
+		&profileformatvar, "profile-format", "text",
+		"Specifies the format of the -profile output, one of text, csv or "+
+			"json",
+	)
+	flag.StringVar(
+		&statedumpvar, "state-dump", "",
+		"Writes the machine state as JSON to the given file on exit",
+	)
+	flag.BoolVar(
+		&verbosevar, "verbose", false,
+		"Prints the number of words loaded from the binary to stderr",
+	)
+	flag.StringVar(
+		&keyboardfilevar, "keyboard-file", "",
+		"Reads keyboard input from the given file rather than stdin. Once "+
+			"the file is exhausted no further keys are available",
+	)
+	flag.Uint64Var(
+		&maxstepsvar, "max-steps", 0,
+		"Stops the machine if it has not halted after executing the given "+
+			"number of instructions, exiting with a non-zero status",
+	)
+	flag.DurationVar(
+		&timeoutvar, "timeout", 0,
+		"Stops the machine if it has not halted after the given duration "+
+			"(i.e. '500ms', '2s', '1m'), exiting with a non-zero status",
+	)
+	flag.Func(
+		"origin",
+		"Loads the binary into memory starting at the given address "+
+			"(default 0x0000)",
+		func(value string) (err error) {
+			originvar, err = encoding.DecodeHex(value)
+			return
+		},
+	)
+}
+
+func replayTrace(filename string) int {
+	file, err := os.Open(filename)
+
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+
+	defer file.Close()
+
+	reader := bufio.NewReader(file)
+
+	for {
+		record, err := machine.ReadTraceRecord(reader)
+
+		if err == io.EOF {
+			return 0
+		} else if err != nil {
+			log.Println(err)
+			return 1
+		}
+
+		fmt.Printf(
+			"%8d PC:%#04x IR:%#04x", record.Step, record.Program,
+			record.Instruction,
+		)
+
+		for i, reg := range record.Registers {
+			fmt.Printf(" R%d:%#04x", i, reg)
+		}
+
+		fmt.Println()
+	}
 }
 
 func golc3() int {
@@ -56,6 +202,14 @@ func golc3() int {
 		return 0
 	}
 
+	if replaytracevar != "" {
+		return replayTrace(replaytracevar)
+	}
+
+	if attachvar != "" {
+		return attachRemote(attachvar)
+	}
+
 	args := flag.Args()
 
 	if len(args) != 1 {
@@ -63,6 +217,11 @@ func golc3() int {
 		return 1
 	}
 
+	if !isProfileFormat(profileformatvar) {
+		log.Printf("Invalid profile format '%s'", profileformatvar)
+		return 1
+	}
+
 	file, err := os.Open(args[0])
 
 	if err != nil {
@@ -73,37 +232,54 @@ func golc3() int {
 	defer file.Close()
 
 	var mc machine.Machine
+	var dbg debugger.Debugger
 	var dh machine.DeviceHandler
-	dh.Keyboard = bufio.NewReader(os.Stdin)
+
+	stdin = bufio.NewReader(os.Stdin)
+
 	dh.Display = bufio.NewWriter(os.Stdout)
 	mc.Devices = &dh
+	mc.MaxSteps = maxstepsvar
+
+	if recordvar != "" || replayvar != "" || listenvar != "" ||
+		symbolsstdinvar {
+		debugvar = true
+	}
 
 	if debugvar {
-		var dbg debugger.Debugger
 		dbg.HandleBreak = handleBreak
 		dbg.HandleRead = handleRead
 		dbg.HandleWrite = handleWrite
 		dbg.Binary = file
 		mc.Debugger = &dbg
 
-		filename := filepath.Dir(args[0]) + "/" + strings.ReplaceAll(
-			filepath.Base(args[0]), filepath.Ext(args[0]), ".lc3db",
-		)
+		readSymTable := assembler.ReadSymTable
 
-		if file, err := os.Open(filename); err == nil {
-			var symtable assembler.SymTable
+		if symbolsjsonvar {
+			readSymTable = assembler.ReadSymTableJSON
+		}
 
-			if err := gob.NewDecoder(file).Decode(&symtable); err == nil {
-				dbg.SymTable = &symtable
+		if symbolsstdinvar {
+			if symtable, err := readSymTableStdin(); err == nil {
+				dbg.SymTable = symtable
 			} else {
-				log.Println("Error loading symbol file")
+				log.Println("Error loading symbol table from stdin")
 				log.Println(err)
 			}
-
-			file.Close()
 		} else {
-			log.Println("Error loading symbol file")
-			log.Println(err)
+			if file, err := os.Open(symTableFilename(args[0])); err == nil {
+				if symtable, err := readSymTable(file); err == nil {
+					dbg.SymTable = symtable
+				} else {
+					log.Println("Error loading symbol file")
+					log.Println(err)
+				}
+
+				file.Close()
+			} else {
+				log.Println("Error loading symbol file")
+				log.Println(err)
+			}
 		}
 
 		if dbg.SymTable != nil && dbg.SymTable.Source != "" {
@@ -116,6 +292,33 @@ func golc3() int {
 			}
 		}
 
+		if recordvar != "" {
+			if file, err := os.Create(recordvar); err == nil {
+				dbg.RecordSession(file)
+				defer file.Close()
+			} else {
+				log.Println("Error creating session recording")
+				log.Println(err)
+				return 1
+			}
+		}
+
+		loadHistory()
+		defer saveHistory()
+		defer stopTrace(&dbg)
+
+		if replayvar != "" {
+			if file, err := os.Open(replayvar); err == nil {
+				replinput = bufio.NewScanner(file)
+				replaying = true
+				defer file.Close()
+			} else {
+				log.Println("Error loading session recording")
+				log.Println(err)
+				return 1
+			}
+		}
+
 		c := make(chan os.Signal, 1)
 		defer close(c)
 
@@ -128,25 +331,257 @@ func golc3() int {
 		}()
 	}
 
-	if err := mc.LoadBin(file); err != nil {
+	// Assigned once the symbol table has been read, which may replace stdin
+	dh.Keyboard = stdin
+
+	if keyboardfilevar != "" {
+		keyboard, err := os.Open(keyboardfilevar)
+
+		if err != nil {
+			log.Println("Error opening keyboard file")
+			log.Println(err)
+			return 1
+		}
+
+		defer keyboard.Close()
+
+		dh.Keyboard = bufio.NewReader(keyboard)
+	}
+
+	if tracevar != "" {
+		tracefile, err := os.Create(tracevar)
+
+		if err != nil {
+			log.Println("Error creating trace file")
+			log.Println(err)
+			return 1
+		}
+
+		defer tracefile.Close()
+
+		tracer := machine.NewBinaryTracer(tracefile)
+		tracer.Next = mc.Debugger
+		mc.Debugger = tracer
+
+		defer func() {
+			if err := tracer.Flush(); err != nil {
+				log.Println("Error writing trace file")
+				log.Println(err)
+			}
+		}()
+	}
+
+	if stat, err := file.Stat(); err == nil && stat.Size() > loadIndicatorSize {
+		total := stat.Size() / 2
+
+		mc.LoadOptions.OnProgress = func(wordsLoaded int) {
+			fmt.Fprintf(
+				os.Stderr, "\rLoading %d%%", int64(wordsLoaded)*100/total,
+			)
+		}
+	}
+
+	wordsLoaded := 0
+
+	if relocatablevar {
+		err = mc.LoadRelocatable(file)
+	} else {
+		wordsLoaded, err = mc.LoadBin(file, originvar)
+	}
+
+	if mc.LoadOptions.OnProgress != nil {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+		mc.LoadOptions.OnProgress = nil
+	}
+
+	if err != nil {
 		log.Println(err)
 		return 1
 	}
 
+	if verbosevar && !relocatablevar {
+		log.Printf("Loaded %d words at %#04x", wordsLoaded, originvar)
+	}
+
+	if listenvar != "" {
+		listener, err := net.Listen("unix", listenvar)
+
+		if err != nil {
+			log.Println("Error opening debugger socket")
+			log.Println(err)
+			return 1
+		}
+
+		defer listener.Close()
+
+		remoterequests = make(chan remoteRequest)
+		go listenRemote(listener, remoterequests)
+	}
+
+	if profilevar {
+		mc.Profile = &machine.InstructionProfile{}
+
+		symtable := dbg.SymTable
+
+		if symtable == nil {
+			symtable = loadProfileSymTable(args[0])
+		}
+
+		// Deferred ahead of exitRawTerm so the report is printed once the
+		// terminal is restored
+		defer func() {
+			if err := writeProfile(
+				os.Stderr, profileformatvar, mc.Profile, &mc.State, symtable,
+			); err != nil {
+				log.Println("Error writing profile")
+				log.Println(err)
+			}
+		}()
+
+		// Without the debugger an interrupt would otherwise kill the process
+		// before the profile is written
+		if !debugvar {
+			c := make(chan os.Signal, 1)
+			defer close(c)
+
+			signal.Notify(c, os.Interrupt)
+			go func() {
+				for _ = range c {
+					shouldexit = true
+				}
+			}()
+		}
+	}
+
 	enterRawTerm()
 	defer exitRawTerm()
 
 	if debugvar {
-		debugREPL(mc.Debugger.(*debugger.Debugger), &mc)
+		debugREPL(&dbg, &mc)
+	}
+
+	ctx := context.Background()
+
+	if timeoutvar > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, timeoutvar)
+		defer cancel()
+	}
+
+	// The debugger, remote requests and profile interrupts are handled between
+	// steps, otherwise the machine runs uninterrupted
+	if debugvar || remoterequests != nil || profilevar {
+		for !shouldexit && !mc.IsHalted() && !mc.ExecutionLimitReached() &&
+			ctx.Err() == nil {
+			if remoterequests != nil {
+				select {
+				case req := <-remoterequests:
+					runRemote(&dbg, &mc, req)
+				default:
+				}
+			}
+
+			mc.Step()
+		}
+
+		if err = ctx.Err(); err == nil && mc.ExecutionLimitReached() {
+			err = machine.ErrExecutionLimitReached
+		}
+	} else {
+		err = mc.RunWithContext(ctx)
 	}
 
-	for !shouldexit {
-		mc.Step()
+	if errors.Is(err, context.DeadlineExceeded) {
+		// Restored ahead of the message so it is not printed in raw mode
+		exitRawTerm()
+		log.Printf("execution timed out after %s", timeoutvar)
+	} else if err != nil {
+		exitRawTerm()
+		log.Println(err)
+	}
+
+	if statedumpvar != "" {
+		if err := dumpState(statedumpvar, &mc.State); err != nil {
+			log.Println("Error writing state dump")
+			log.Println(err)
+			return 1
+		}
+	}
+
+	if err != nil {
+		return 1
 	}
 
 	return 0
 }
 
+// Decodes the symbol table at the start of stdin, leaving any input which
+// follows it to the debugger and the keyboard
+func readSymTableStdin() (*assembler.SymTable, error) {
+	var symtable assembler.SymTable
+
+	first, err := stdin.Peek(1)
+
+	if err != nil {
+		return nil, err
+	}
+
+	// gob reads no further than the end of the table from a reader which
+	// implements io.ByteReader
+	if !symbolsjsonvar && first[0] != '{' {
+		if err := gob.NewDecoder(stdin).Decode(&symtable); err != nil {
+			return nil, err
+		}
+
+		return &symtable, nil
+	}
+
+	decoder := json.NewDecoder(stdin)
+
+	if err := decoder.Decode(&symtable); err != nil {
+		return nil, err
+	}
+
+	// The JSON decoder reads ahead of the end of the table, so the remaining
+	// input begins with whatever it has buffered
+	stdin = bufio.NewReader(io.MultiReader(decoder.Buffered(), stdin))
+
+	// The newline ending the table is not a debugger command
+	if next, err := stdin.Peek(1); err == nil && next[0] == '\n' {
+		stdin.Discard(1)
+	}
+
+	return &symtable, nil
+}
+
+// Returns the path of the symbol table alongside the binary, which has the same
+// name with the extension '.lc3db', or '.lc3db.json' if only a JSON symbol table
+// exists
+func symTableFilename(filename string) string {
+	base := filepath.Dir(filename) + "/" + strings.ReplaceAll(
+		filepath.Base(filename), filepath.Ext(filename), ".lc3db",
+	)
+
+	if _, err := os.Stat(base); os.IsNotExist(err) {
+		if _, err := os.Stat(base + ".json"); err == nil {
+			return base + ".json"
+		}
+	}
+
+	return base
+}
+
+func dumpState(filename string, state *machine.MachineState) error {
+	data, err := json.Marshal(state)
+
+	if err != nil {
+		return err
+	}
+
+	return os.WriteFile(filename, data, 0666)
+}
+
 func main() {
+	flag.Parse()
 	os.Exit(golc3())
 }
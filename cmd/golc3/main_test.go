@@ -0,0 +1,145 @@
+// Copyright (C) 2021  Antonio Lassandro
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+
+// You should have received a copy of the GNU General Public License along
+// with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bytes"
+	"encoding/gob"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lassandro/golc3/pkg/assembler"
+)
+
+// Feeds a gob symbol table followed by debugger commands through stdin, checking
+// the commands still reach the debugger and can see the table's labels
+func TestSymbolsStdin(t *testing.T) {
+	dir, err := os.MkdirTemp("", "golc3")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	// Keeps the command history out of the real home directory
+	home := os.Getenv("HOME")
+	os.Setenv("HOME", dir)
+	defer os.Setenv("HOME", home)
+
+	binfile := filepath.Join(dir, "halt.bin")
+
+	if err := os.WriteFile(binfile, []byte{0xF0, 0x25}, 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	symtable := assembler.SymTable{
+		Symbols: map[uint16]int64{0x0000: 0},
+		Labels:  map[uint16]string{0x0000: "START"},
+	}
+
+	input, feed, err := os.Pipe()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer input.Close()
+
+	if err := gob.NewEncoder(feed).Encode(&symtable); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := io.WriteString(feed, "labels\n"); err != nil {
+		t.Fatal(err)
+	}
+
+	feed.Close()
+
+	if err := flag.CommandLine.Parse(
+		[]string{"-symbols-stdin", binfile},
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	stdinFile := os.Stdin
+	os.Stdin = input
+
+	logged := new(bytes.Buffer)
+	log.SetOutput(logged)
+
+	defer func() {
+		os.Stdin = stdinFile
+		log.SetOutput(os.Stderr)
+
+		symbolsstdinvar = false
+		debugvar = false
+		shouldexit = false
+		replinput = nil
+	}()
+
+	var code int
+
+	output := captureStdout(t, func() {
+		code = golc3()
+	})
+
+	if code != 0 {
+		t.Fatalf("Expected exit code 0, have:%d\n%s", code, logged)
+	}
+
+	if !strings.Contains(string(output), "START") {
+		t.Fatalf(
+			"Expected label 'START' to be listed, have:%q\n%s", output, logged,
+		)
+	}
+}
+
+// Runs fn with stdout redirected, returning everything it wrote
+func captureStdout(t *testing.T, fn func()) []byte {
+	t.Helper()
+
+	reader, writer, err := os.Pipe()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer reader.Close()
+
+	// Read alongside fn, as the output may be larger than the pipe buffer
+	output := make(chan []byte)
+
+	go func() {
+		data, _ := io.ReadAll(reader)
+		output <- data
+	}()
+
+	stdout := os.Stdout
+	os.Stdout = writer
+
+	fn()
+
+	os.Stdout = stdout
+	writer.Close()
+
+	return <-output
+}
@@ -0,0 +1,125 @@
+// Copyright (C) 2021  Antonio Lassandro
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+
+// You should have received a copy of the GNU General Public License along
+// with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+
+	"github.com/lassandro/golc3/pkg/assembler"
+	"github.com/lassandro/golc3/pkg/machine"
+)
+
+type profileRow struct {
+	Addr   string `json:"address"`
+	Label  string `json:"label"`
+	Opcode string `json:"opcode"`
+	Count  uint64 `json:"count"`
+}
+
+func isProfileFormat(format string) bool {
+	switch format {
+	case "text", "csv", "json":
+		return true
+	}
+
+	return false
+}
+
+// Loads the symbol table alongside the binary for labelling the profile,
+// returning nil if there is none
+func loadProfileSymTable(filename string) *assembler.SymTable {
+	file, err := os.Open(symTableFilename(filename))
+
+	if err != nil {
+		return nil
+	}
+
+	defer file.Close()
+
+	readSymTable := assembler.ReadSymTable
+
+	if symbolsjsonvar {
+		readSymTable = assembler.ReadSymTableJSON
+	}
+
+	symtable, err := readSymTable(file)
+
+	if err != nil {
+		return nil
+	}
+
+	return symtable
+}
+
+// Writes the executed addresses of the profile in descending order of count,
+// along with the label at each address if a symbol table is given
+func writeProfile(
+	w io.Writer,
+	format string,
+	profile *machine.InstructionProfile,
+	state *machine.MachineState,
+	symtable *assembler.SymTable,
+) error {
+	hotspots := profile.Hotspots(state)
+	rows := make([]profileRow, len(hotspots))
+
+	for i, hotspot := range hotspots {
+		rows[i] = profileRow{
+			Addr:   fmt.Sprintf("%#04x", hotspot.Addr),
+			Opcode: hotspot.Opcode,
+			Count:  hotspot.Count,
+		}
+
+		if symtable != nil {
+			rows[i].Label = symtable.Labels[hotspot.Addr]
+		}
+	}
+
+	switch format {
+	case "csv":
+		writer := csv.NewWriter(w)
+		writer.Write([]string{"address", "label", "opcode", "count"})
+
+		for _, row := range rows {
+			writer.Write([]string{
+				row.Addr, row.Label, row.Opcode,
+				strconv.FormatUint(row.Count, 10),
+			})
+		}
+
+		writer.Flush()
+		return writer.Error()
+
+	case "json":
+		return json.NewEncoder(w).Encode(rows)
+	}
+
+	for _, row := range rows {
+		if _, err := fmt.Fprintf(
+			w, "%s %-16s %-4s %10d\n", row.Addr, row.Label, row.Opcode,
+			row.Count,
+		); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
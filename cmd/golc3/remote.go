@@ -0,0 +1,157 @@
+// Copyright (C) 2021  Antonio Lassandro
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+
+// You should have received a copy of the GNU General Public License along
+// with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"os"
+	"strings"
+
+	"github.com/lassandro/golc3/pkg/debugger"
+	"github.com/lassandro/golc3/pkg/machine"
+)
+
+// A command received over the debugger socket, which is run by the main loop
+// between instruction cycles, or by the REPL while it waits for input
+type remoteRequest struct {
+	Cmd   string
+	Args  []string
+	Reply chan remoteResult
+}
+
+type remoteResult struct {
+	Output string
+	Err    error
+}
+
+// Commands received from 'golc3 -attach', or nil when not listening
+var remoterequests chan remoteRequest
+
+// Accepts debugger connections on the socket, forwarding their commands to
+// requests
+func listenRemote(listener net.Listener, requests chan<- remoteRequest) {
+	for {
+		conn, err := listener.Accept()
+
+		if err != nil {
+			return
+		}
+
+		go func() {
+			defer conn.Close()
+
+			err := debugger.ServeRemote(
+				conn,
+				func(cmd string, args []string) (string, error) {
+					reply := make(chan remoteResult)
+					requests <- remoteRequest{cmd, args, reply}
+					result := <-reply
+					return result.Output, result.Err
+				},
+			)
+
+			if err != nil {
+				log.Println(err)
+			}
+		}()
+	}
+}
+
+// Runs a remote command, capturing everything it writes to stdout and the log.
+// Reports whether the command resumes execution
+func runRemote(
+	dbg *debugger.Debugger, mc *machine.Machine, req remoteRequest,
+) bool {
+	reader, writer, err := os.Pipe()
+
+	if err != nil {
+		req.Reply <- remoteResult{"", err}
+		return false
+	}
+
+	defer reader.Close()
+
+	output := make(chan string)
+
+	go func() {
+		data, _ := io.ReadAll(reader)
+		output <- string(data)
+	}()
+
+	stdout := os.Stdout
+	os.Stdout = writer
+	log.SetOutput(writer)
+
+	resume := debugCommand(dbg, mc, req.Cmd, req.Args)
+
+	os.Stdout = stdout
+	log.SetOutput(os.Stderr)
+	writer.Close()
+
+	req.Reply <- remoteResult{<-output, nil}
+
+	return resume
+}
+
+// Sends commands from stdin to the golc3 instance listening on the socket
+func attachRemote(path string) int {
+	conn, err := net.Dial("unix", path)
+
+	if err != nil {
+		log.Println(err)
+		return 1
+	}
+
+	defer conn.Close()
+
+	client := debugger.NewRemoteClient(conn)
+	scanner := bufio.NewScanner(os.Stdin)
+
+	for {
+		fmt.Print("\033[1;30m(dbg)\033[0m ")
+
+		if !scanner.Scan() {
+			fmt.Println()
+			return 0
+		}
+
+		args := strings.Split(strings.TrimSpace(scanner.Text()), " ")
+
+		switch args[0] {
+		case "":
+			continue
+		case "q", "quit", "exit":
+			return 0
+		}
+
+		response, err := client.Send(args[0], args[1:])
+
+		if err != nil {
+			log.Println(err)
+			return 1
+		}
+
+		if !response.Ok {
+			log.Println(response.Output)
+		} else {
+			fmt.Print(response.Output)
+		}
+	}
+}
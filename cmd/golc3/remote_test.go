@@ -0,0 +1,128 @@
+// Copyright (C) 2021  Antonio Lassandro
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+
+// You should have received a copy of the GNU General Public License along
+// with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/lassandro/golc3/pkg/debugger"
+	"github.com/lassandro/golc3/pkg/machine"
+)
+
+// Serves remote commands to a REPL waiting on input which never arrives,
+// checking they are run by debugCommand until one resumes execution
+func TestRemoteREPL(t *testing.T) {
+	dir, err := os.MkdirTemp("", "golc3")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer os.RemoveAll(dir)
+
+	listener, err := net.Listen("unix", filepath.Join(dir, "golc3.sock"))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer listener.Close()
+
+	remoterequests = make(chan remoteRequest)
+	go listenRemote(listener, remoterequests)
+
+	input, blocked := io.Pipe()
+	replinput = bufio.NewScanner(input)
+
+	// The read left pending by the REPL finishes once its input is closed
+	defer func() {
+		blocked.Close()
+		<-pendingcommand
+
+		remoterequests = nil
+		replinput = nil
+		pendingcommand = nil
+	}()
+
+	var mc machine.Machine
+	var dbg debugger.Debugger
+
+	type result struct {
+		Ok      bool
+		Resumed bool
+	}
+
+	done := make(chan result)
+
+	go func() {
+		_, ok, resumed := nextCommand(&dbg, &mc)
+		done <- result{ok, resumed}
+	}()
+
+	conn, err := net.Dial("unix", listener.Addr().String())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer conn.Close()
+
+	client := debugger.NewRemoteClient(conn)
+
+	response, err := client.Send("break", []string{"add", "0x3000"})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(response.Output, "Breakpoint added") {
+		t.Fatalf("Unexpected break output\nhave:%q", response.Output)
+	}
+
+	if len(dbg.Breakpoints) != 1 || dbg.Breakpoints[0].Addr != 0x3000 {
+		t.Fatalf("Breakpoint not added\nhave:%v", dbg.Breakpoints)
+	}
+
+	response, err = client.Send("foo", nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !strings.Contains(response.Output, "not a valid command") {
+		t.Fatalf("Unexpected invalid command output\nhave:%q", response.Output)
+	}
+
+	dbg.Break = true
+
+	if _, err := client.Send("continue", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if have := <-done; !have.Ok || !have.Resumed {
+		t.Fatalf("Expected REPL to resume\nhave:%+v", have)
+	}
+
+	if dbg.Break {
+		t.Fatal("Expected continue to clear the break flag")
+	}
+}
@@ -24,10 +24,11 @@ import (
 var termRestore unix.Termios
 
 func enterRawTerm() {
-	termios, err := unix.IoctlGetTermios(int(os.Stdin.Fd()), unix.TIOCGETA)
+	termios, err := unix.IoctlGetTermios(int(os.Stdin.Fd()), ioctlGetTermios)
 
+	// Input which is not a terminal, such as a pipe, is read as is
 	if err != nil {
-		panic(err)
+		return
 	}
 
 	termRestore = *termios
@@ -42,15 +43,41 @@ func enterRawTerm() {
 	termstate.Cc[unix.VTIME] = 0
 
 	if err := unix.IoctlSetTermios(
-		int(os.Stdin.Fd()), unix.TIOCSETA, &termstate,
+		int(os.Stdin.Fd()), ioctlSetTermios, &termstate,
 	); err != nil {
 		panic(err)
 	}
 }
 
 func exitRawTerm() {
+	if !isTerminal() {
+		return
+	}
+
+	if err := unix.IoctlSetTermios(
+		int(os.Stdin.Fd()), ioctlSetTermios, &termRestore,
+	); err != nil {
+		panic(err)
+	}
+}
+
+func isTerminal() bool {
+	_, err := unix.IoctlGetTermios(int(os.Stdin.Fd()), ioctlGetTermios)
+	return err == nil
+}
+
+// Disables echo and canonical mode with blocking reads, so the line editor
+// receives each key as it is pressed. The terminal is restored by exitRawTerm
+func enterLineTerm() {
+	termstate := termRestore
+
+	termstate.Lflag &^= unix.ECHO | unix.ECHONL | unix.ICANON | unix.IEXTEN
+
+	termstate.Cc[unix.VMIN] = 1
+	termstate.Cc[unix.VTIME] = 0
+
 	if err := unix.IoctlSetTermios(
-		int(os.Stdin.Fd()), unix.TIOCSETA, &termRestore,
+		int(os.Stdin.Fd()), ioctlSetTermios, &termstate,
 	); err != nil {
 		panic(err)
 	}
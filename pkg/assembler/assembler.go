@@ -17,11 +17,19 @@ package assembler
 
 import (
 	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/csv"
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
 	"io"
 	"math"
+	"sort"
 	"strconv"
 	"strings"
 	"unicode"
+	"unicode/utf8"
 
 	"github.com/lassandro/golc3/pkg/encoding"
 )
@@ -35,8 +43,22 @@ func parseDirective(ident string) DirectiveType {
 		return DIRECTIVE_BLKW
 	} else if strings.EqualFold(ident, ".STRINGZ") {
 		return DIRECTIVE_STRINGZ
+	} else if strings.EqualFold(ident, ".ASCIZ") {
+		return DIRECTIVE_STRINGZ
+	} else if strings.EqualFold(ident, ".STRINGZW") {
+		return DIRECTIVE_STRINGZW
+	} else if strings.EqualFold(ident, ".ASCII") {
+		return DIRECTIVE_ASCII
 	} else if strings.EqualFold(ident, ".END") {
 		return DIRECTIVE_END
+	} else if strings.EqualFold(ident, ".MACRO") {
+		return DIRECTIVE_MACRO
+	} else if strings.EqualFold(ident, ".ENDM") {
+		return DIRECTIVE_ENDM
+	} else if strings.EqualFold(ident, ".EQU") {
+		return DIRECTIVE_EQU
+	} else if strings.EqualFold(ident, ".SET") {
+		return DIRECTIVE_SET
 	}
 
 	return DIRECTIVE_INVALID
@@ -107,14 +129,189 @@ func parseInstruction(ident string) InstructionType {
 		return INSTRUCTION_PUTSP
 	} else if strings.EqualFold(ident, "HALT") {
 		return INSTRUCTION_HALT
+	} else if strings.EqualFold(ident, "NOP") {
+		return INSTRUCTION_NOP
+	} else if strings.EqualFold(ident, "SUB") {
+		return INSTRUCTION_SUB
+	} else if strings.EqualFold(ident, "NEG") {
+		return INSTRUCTION_NEG
+	} else if strings.EqualFold(ident, "OR") {
+		return INSTRUCTION_OR
 	}
 
 	return INSTRUCTION_INVALID
 }
 
+func isKeyword(ident string) bool {
+	return parseInstruction(ident) != INSTRUCTION_INVALID ||
+		parseDirective(ident) != DIRECTIVE_INVALID
+}
+
+// Returns the Levenshtein distance between a and b, the number of single
+// character insertions, deletions or substitutions turning one into the other
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	prev := make([]int, len(rb)+1)
+	curr := make([]int, len(rb)+1)
+
+	for j := range prev {
+		prev[j] = j
+	}
+
+	for i := 1; i <= len(ra); i++ {
+		curr[0] = i
+
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+
+			curr[j] = prev[j] + 1
+
+			if insert := curr[j-1] + 1; insert < curr[j] {
+				curr[j] = insert
+			}
+
+			if substitute := prev[j-1] + cost; substitute < curr[j] {
+				curr[j] = substitute
+			}
+		}
+
+		prev, curr = curr, prev
+	}
+
+	return prev[len(rb)]
+}
+
+// Reports whether the keyword's first operand is a label reference
+func takesLabelOperand(ident string) bool {
+	switch parseInstruction(ident) {
+	case INSTRUCTION_BR,
+		INSTRUCTION_BRn,
+		INSTRUCTION_BRz,
+		INSTRUCTION_BRp,
+		INSTRUCTION_BRnz,
+		INSTRUCTION_BRzp,
+		INSTRUCTION_BRnp,
+		INSTRUCTION_BRnzp,
+		INSTRUCTION_JSR:
+		return true
+	}
+
+	return parseDirective(ident) == DIRECTIVE_FILL
+}
+
+// Reports whether the keyword is a complete statement without any operands
+func takesNoOperands(ident string) bool {
+	switch parseInstruction(ident) {
+	case INSTRUCTION_RET,
+		INSTRUCTION_RTI,
+		INSTRUCTION_RTT,
+		INSTRUCTION_GETC,
+		INSTRUCTION_OUT,
+		INSTRUCTION_PUTS,
+		INSTRUCTION_IN,
+		INSTRUCTION_PUTSP,
+		INSTRUCTION_HALT,
+		INSTRUCTION_NOP:
+		return true
+	}
+
+	return parseDirective(ident) == DIRECTIVE_END
+}
+
+// Returns the number of leading operands of the instruction which are
+// registers, beyond which an identifier is a label
+func registerOperands(instruction InstructionType) int {
+	switch instruction {
+	case INSTRUCTION_ADD,
+		INSTRUCTION_AND,
+		INSTRUCTION_SUB,
+		INSTRUCTION_OR:
+		return 3
+	case INSTRUCTION_NOT,
+		INSTRUCTION_NEG,
+		INSTRUCTION_LDR,
+		INSTRUCTION_STR:
+		return 2
+	case INSTRUCTION_JMP,
+		INSTRUCTION_JMPT,
+		INSTRUCTION_JSRR,
+		INSTRUCTION_LD,
+		INSTRUCTION_LDI,
+		INSTRUCTION_LEA,
+		INSTRUCTION_ST,
+		INSTRUCTION_STI:
+		return 1
+	}
+
+	return 0
+}
+
+// Unquotes a string or character literal with Go escape sequences, along with
+// \0 for the null character which Go only accepts as the octal escape \000
+func unquote(literal string) (string, error) {
+	var builder strings.Builder
+
+	for i := 0; i < len(literal); i++ {
+		builder.WriteByte(literal[i])
+
+		if literal[i] != '\\' || i+1 >= len(literal) {
+			continue
+		}
+
+		i++
+
+		next := byte(0)
+
+		if i+1 < len(literal) {
+			next = literal[i+1]
+		}
+
+		// Longer octal escapes such as \012 are left to strconv
+		if literal[i] == '0' && (next < '0' || next > '7') {
+			builder.WriteString("x00")
+		} else {
+			builder.WriteByte(literal[i])
+		}
+	}
+
+	return strconv.Unquote(builder.String())
+}
+
+// Parses a character literal (i.e. 'A' or '\n') as its ASCII value
+func parseCharacter(token *Token) (int16, error) {
+	value, err := unquote(token.Value)
+
+	if err != nil || len([]rune(value)) != 1 {
+		return 0, &InvalidLiteralError{token.Position}
+	}
+
+	char := []rune(value)[0]
+
+	if char > unicode.MaxASCII {
+		return 0, &OversizedCharacterError{token.Position}
+	}
+
+	return int16(char), nil
+}
+
 func parseLiteral(token *Token, bits LiteralType) (uint16, error) {
-	if strings.ContainsAny(token.Value, "xX") {
-		result, err := encoding.DecodeHex(token.Value)
+	character := strings.HasPrefix(token.Value, "'")
+	hex := !character && strings.ContainsAny(token.Value, "xX")
+	bin := !character && !hex && strings.ContainsAny(token.Value, "bB")
+
+	if hex || bin {
+		var result uint16
+		var err error
+
+		if hex {
+			result, err = encoding.DecodeHex(token.Value)
+		} else {
+			result, err = encoding.DecodeBin(token.Value)
+		}
 
 		if err != nil {
 			return 0, &InvalidLiteralError{token.Position}
@@ -134,10 +331,17 @@ func parseLiteral(token *Token, bits LiteralType) (uint16, error) {
 
 		return result, nil
 	} else {
-		result, err := encoding.DecodeInt(token.Value)
+		var result int16
+		var err error
+
+		if character {
+			result, err = parseCharacter(token)
+		} else if result, err = encoding.DecodeInt(token.Value); err != nil {
+			err = &InvalidLiteralError{token.Position}
+		}
 
 		if err != nil {
-			return 0, &InvalidLiteralError{token.Position}
+			return 0, err
 		}
 
 		if bits < 16 {
@@ -180,7 +384,429 @@ func parseRegister(token *Token) (uint16, bool) {
 	return 0, false
 }
 
-func AssembleLC3Source(input io.ReadSeeker, symtable *SymTable) (result []uint16, errs []error) {
+// Replaces the register aliases SP and LR with their canonical names R6 and R7,
+// such that the alias is never seen once operands are parsed
+func resolveRegisterAlias(token *Token) {
+	if token.Type != TOKEN_IDENT {
+		return
+	}
+
+	if strings.EqualFold(token.Value, "SP") {
+		token.Value = "R6"
+	} else if strings.EqualFold(token.Value, "LR") {
+		token.Value = "R7"
+	}
+}
+
+// Parses operands which must each be a register, reporting an error for each
+// which is not
+func parseRegisterOperands(operands []Token) ([]uint16, []error) {
+	var errs []error
+	regs := make([]uint16, len(operands))
+
+	for i := range operands {
+		if operands[i].Type != TOKEN_IDENT {
+			errs = append(
+				errs,
+				&InvalidOperandError{
+					operands[i].Position,
+					[]TokenType{TOKEN_IDENT},
+					operands[i].Type,
+				},
+			)
+
+			continue
+		}
+
+		reg, ok := parseRegister(&operands[i])
+
+		if !ok {
+			errs = append(errs, &InvalidRegisterError{operands[i].Position})
+		}
+
+		regs[i] = reg
+	}
+
+	return regs, errs
+}
+
+func encodeNOT(dr, sr uint16) uint16 {
+	return 0b1001<<12 | dr<<9 | sr<<6 | 0x3F
+}
+
+func encodeADD(dr, sr1, sr2 uint16) uint16 {
+	return 0b0001<<12 | dr<<9 | sr1<<6 | sr2
+}
+
+func encodeADDImm(dr, sr, imm5 uint16) uint16 {
+	return 0b0001<<12 | dr<<9 | sr<<6 | 1<<5 | (imm5 & 0x1F)
+}
+
+func encodeAND(dr, sr1, sr2 uint16) uint16 {
+	return 0b0101<<12 | dr<<9 | sr1<<6 | sr2
+}
+
+// Splits a single line of source into tokens, reporting any syntax errors
+func Tokenize(line string, opts ...AssemblerOption) ([]Token, []error) {
+	var config assemblerConfig
+
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	cursor := Cursor{Line: 1, Size: int64(len(line))}
+
+	return tokenize(line, cursor, &config)
+}
+
+func tokenize(
+	line string, cursor Cursor, config *assemblerConfig,
+) (tokens []Token, errs []error) {
+	var builder strings.Builder
+	var tokenStart int = 0
+	var tokenType TokenType = TOKEN_NONE
+	var escaped bool = false
+	var quoted bool = false
+
+	tokens = make([]Token, 0, 5)
+	builder.Grow(len(line))
+
+	// Parse Line:
+	// - Gather tokens and their types
+	// - Check for syntax errors
+	for column, char := range line {
+		cursor.Column = column + 1
+
+		var flush bool = false
+		var skip bool = false
+
+		if tokenType == TOKEN_NONE {
+			tokenStart = cursor.Column
+		}
+
+		switch {
+		// Character Literal Contents (i.e. 'A')
+		case quoted:
+			if !config.validChar(char, tokenType) {
+				errs = append(errs, &OversizedCharacterError{cursor})
+			}
+
+			// Escaped quotes do not terminate the literal
+			if char == '\'' && !escaped {
+				flush = true
+			}
+
+		// Character Literal
+		case char == '\'':
+			if tokenType == TOKEN_NONE {
+				tokenType = TOKEN_LITERAL
+				quoted = true
+			} else if tokenType != TOKEN_STRING {
+				errs = append(errs, &UnexpectedCharacterError{cursor, char})
+			}
+
+		// Whitespace
+		case unicode.IsSpace(char):
+			if tokenType == TOKEN_NONE {
+				continue
+			} else if tokenType != TOKEN_STRING {
+				flush = true
+			}
+
+		// Comments
+		case char == ';':
+			if tokenType == TOKEN_NONE {
+				skip = true
+			} else if tokenType != TOKEN_STRING {
+				flush = true
+				skip = true
+			}
+
+		// Assembler Directives
+		case char == '.':
+			if tokenType == TOKEN_NONE {
+				tokenType = TOKEN_DIRECTIVE
+			} else if tokenType != TOKEN_STRING {
+				errs = append(errs, &UnexpectedCharacterError{cursor, char})
+			}
+
+		// Operand Separator
+		case char == ',':
+			if tokenType != TOKEN_STRING {
+				flush = true
+			}
+
+		// Hex Literal (i.e. x2A, no leading zero)
+		case char == 'x' || char == 'X':
+			if tokenType == TOKEN_NONE {
+				tokenType = TOKEN_LITERAL
+			}
+
+		// Base 10 Literal (i.e. #42)
+		case char == '#':
+			if tokenType == TOKEN_NONE {
+				tokenType = TOKEN_LITERAL
+			} else if tokenType != TOKEN_STRING {
+				errs = append(errs, &UnexpectedCharacterError{cursor, char})
+			}
+
+		// String Literal
+		case char == '"':
+			if tokenType == TOKEN_NONE {
+				tokenType = TOKEN_STRING
+			} else if tokenType == TOKEN_STRING {
+				// Escaped quotes do not terminate the string
+				if !escaped {
+					flush = true
+				}
+			} else {
+				errs = append(errs, &UnexpectedCharacterError{cursor, char})
+			}
+
+		// Numeric Literal
+		case unicode.IsDigit(char):
+			if tokenType == TOKEN_NONE {
+				tokenType = TOKEN_LITERAL
+			}
+
+		// Numeric Sign
+		case char == '-':
+			if tokenType != TOKEN_LITERAL {
+				errs = append(errs, &UnexpectedCharacterError{cursor, char})
+			}
+
+		// Underscore'd Identifier
+		case char == '_':
+			if tokenType == TOKEN_NONE {
+				tokenType = TOKEN_IDENT
+			} else if tokenType != TOKEN_IDENT && tokenType != TOKEN_STRING {
+				errs = append(errs, &UnexpectedCharacterError{cursor, char})
+			}
+
+		// Identifier
+		case unicode.IsLetter(char):
+			if !config.validChar(char, tokenType) {
+				errs = append(errs, &OversizedCharacterError{cursor})
+			}
+
+			if tokenType == TOKEN_NONE {
+				tokenType = TOKEN_IDENT
+			}
+
+		default:
+			if !config.validChar(char, tokenType) {
+				errs = append(errs, &OversizedCharacterError{cursor})
+			}
+
+			if tokenType != TOKEN_STRING {
+				errs = append(
+					errs, &UnexpectedCharacterError{cursor, char},
+				)
+			}
+		}
+
+		if tokenType == TOKEN_STRING || quoted {
+			escaped = char == '\\' && !escaped
+		}
+
+		// Columns count bytes, so the final rune may span several of them
+		_, width := utf8.DecodeRuneInString(line[column:])
+
+		if column+width == len(line) {
+			if tokenType == TOKEN_STRING {
+				if !flush {
+					errs = append(errs, &InvalidStringError{cursor})
+				}
+			} else if quoted {
+				if !flush {
+					errs = append(errs, &InvalidLiteralError{cursor})
+				}
+			} else {
+				if char == ',' {
+					errs = append(
+						errs, &UnexpectedCharacterError{cursor, char},
+					)
+				}
+			}
+
+			flush = true
+			builder.WriteRune(char)
+		} else {
+			if flush && tokenType == TOKEN_STRING && char == '"' {
+				builder.WriteRune(char)
+			} else if flush && quoted {
+				builder.WriteRune(char)
+			}
+		}
+
+		if flush {
+			if builder.Len() > 0 {
+				var token Token
+				token.Position = Cursor{
+					Line:     cursor.Line,
+					Column:   tokenStart,
+					Byte:     cursor.Byte + int64(tokenStart-1),
+					Size:     int64(builder.Len()),
+					LineByte: cursor.Byte,
+				}
+				token.Type = tokenType
+				token.Value = builder.String()
+				token.Raw = token.Value
+				tokens = append(tokens, token)
+				builder.Reset()
+			}
+
+			flush = false
+			quoted = false
+			tokenType = TOKEN_NONE
+		} else if !skip {
+			builder.WriteRune(char)
+		}
+
+		if skip {
+			break
+		}
+	}
+
+	return
+}
+
+// Reports whether char may appear within a token of the given type. Strings
+// may contain any character which fits in a word when the input charset is
+// UTF-8, otherwise only ASCII is permitted
+func (config *assemblerConfig) validChar(char rune, tokenType TokenType) bool {
+	if config.charset == CHARSET_UTF8 && tokenType == TOKEN_STRING {
+		return char <= math.MaxUint16
+	}
+
+	return char <= unicode.MaxASCII
+}
+
+// Splits lines like bufio.ScanLines, but leaves any carriage return in place
+// so that CRLF line endings are accounted for in byte offsets
+func scanLines(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if atEOF && len(data) == 0 {
+		return 0, nil, nil
+	}
+
+	if i := bytes.IndexByte(data, '\n'); i >= 0 {
+		return i + 1, data[:i], nil
+	}
+
+	if atEOF {
+		return len(data), data, nil
+	}
+
+	return 0, nil, nil
+}
+
+// Permits labels which share their name with an instruction or directive
+// without reporting a MnemonicShadowWarning, including those which are a
+// statement by themselves (i.e. RET HALT)
+func AllowMnemonicLabels() AssemblerOption {
+	return func(config *assemblerConfig) {
+		config.allowMnemonicLabels = true
+	}
+}
+
+// Parses SP and LR as aliases of the registers R6 and R7 wherever an
+// instruction expects a register
+func WithRegisterAliases() AssemblerOption {
+	return func(config *assemblerConfig) {
+		config.registerAliases = true
+	}
+}
+
+// Sets the character set of the input source, see CHARSET_ASCII and
+// CHARSET_UTF8
+func WithInputCharset(charset Charset) AssemblerOption {
+	return func(config *assemblerConfig) {
+		config.charset = charset
+	}
+}
+
+// Permits labels which begin with an underscore without reporting an
+// UnderscoreLabelWarning
+func AllowUnderscoreLabels() AssemblerOption {
+	return func(config *assemblerConfig) {
+		config.allowUnderscoreLabels = true
+	}
+}
+
+// Reports the size of each section of the assembled program into sizes
+func WithSectionSizes(sizes *SectionSizes) AssemblerOption {
+	return func(config *assemblerConfig) {
+		config.sectionSizes = sizes
+	}
+}
+
+// Reports every section of the assembled program into sections, in the order
+// they appear in the source
+func WithSections(sections *[]Section) AssemblerOption {
+	return func(config *assemblerConfig) {
+		config.sections = sections
+	}
+}
+
+// Declares the constant name with the literal value (i.e. #64, x40 or 64), as
+// if the source began with .EQU name value. Defines are reported at line 0
+func WithDefine(name, value string) AssemblerOption {
+	return func(config *assemblerConfig) {
+		config.defines = append(config.defines, define{name, value})
+	}
+}
+
+// Records debugging information for the assembled program into symtable,
+// allocating any of its maps which are nil
+func WithSymTable(symtable *SymTable) AssemblerOption {
+	return func(config *assemblerConfig) {
+		config.symtable = symtable
+	}
+}
+
+// Assembles LC3 source from input into a 64K word memory image, separating any
+// diagnostics into errors and warnings
+func AssembleLC3Source(input io.Reader, opts ...AssemblerOption) AssemblerResult {
+	var config assemblerConfig
+
+	for _, opt := range opts {
+		opt(&config)
+	}
+
+	if symtable := config.symtable; symtable != nil {
+		if symtable.Symbols == nil {
+			symtable.Symbols = make(map[uint16]int64)
+		}
+
+		if symtable.Labels == nil {
+			symtable.Labels = make(map[uint16]string)
+		}
+	}
+
+	memory, origin, errs := assemble(input, &config)
+
+	result := AssemblerResult{
+		Memory:   memory,
+		Errors:   make([]error, 0),
+		Warnings: make([]error, 0),
+		SymTable: config.symtable,
+		Origin:   origin,
+	}
+
+	for _, err := range errs {
+		if _, ok := err.(Warning); ok {
+			result.Warnings = append(result.Warnings, err)
+		} else {
+			result.Errors = append(result.Errors, err)
+		}
+	}
+
+	return result
+}
+
+func assemble(
+	input io.Reader, config *assemblerConfig,
+) (result []uint16, origin uint16, errs []error) {
 	type LabelRef struct {
 		Label    string
 		Addr     uint16
@@ -194,207 +820,334 @@ func AssembleLC3Source(input io.ReadSeeker, symtable *SymTable) (result []uint16
 		Position Cursor
 	}
 
-	var labels = make(map[string]uint16)
+	var symtable = config.symtable
+
+	type Macro struct {
+		Name   Token
+		Params []Token
+		Body   [][]Token
+	}
+
+	// Addresses of declared labels, along with where they were declared
+	type labelEntry struct {
+		addr uint16
+		pos  Cursor
+	}
+
+	var labels = make(map[string]labelEntry)
+
+	// Finds declared labels within two edits of an unknown label, for
+	// suggesting what may have been meant
+	suggest := func(name string) []string {
+		var suggestions []string
+
+		for label := range labels {
+			if levenshtein(name, label) <= 2 {
+				suggestions = append(suggestions, label)
+			}
+		}
+
+		sort.Strings(suggestions)
+
+		return suggestions
+	}
 	var labelRefs []LabelRef
 	var fillRefs []FillRef
+	var sections []Section
+
+	// Literal tokens bound to identifiers by .EQU and .SET
+	var constants = make(map[string]Token)
+
+	var macros = make(map[string]*Macro)
+	var macro *Macro = nil
+
+	// Statements expanded from a macro call, which are assembled before the
+	// next line is scanned
+	var pending [][]Token
 
 	var program uint32 = 0
+	var originSet bool
 
-	var builder strings.Builder
 	var scanner = bufio.NewScanner(input)
+	scanner.Split(scanLines)
 
 	var cursor = Cursor{Line: 1, Column: 0, Size: 0, Byte: 0}
 
-	result = make([]uint16, 1<<16)
-	errs = make([]error, 0)
+	var line string
+	var newline int
+
+	result = make([]uint16, 1<<16)
+	errs = make([]error, 0)
+
+	// Constants given by WithDefine
+	for _, def := range config.defines {
+		token := Token{Type: TOKEN_LITERAL, Value: def.Value}
+
+		if def.Name == "" || unicode.IsDigit(rune(def.Name[0])) {
+			errs = append(errs, &InvalidLabelNameError{Cursor{}, def.Name})
+			continue
+		} else if isKeyword(def.Name) {
+			errs = append(errs, &MnemonicLabelError{Cursor{}, def.Name})
+			continue
+		} else if _, register := parseRegister(
+			&Token{Type: TOKEN_IDENT, Value: def.Name},
+		); register {
+			errs = append(errs, &RegisterConstantError{Cursor{}, def.Name})
+			continue
+		}
+
+		value, err := parseLiteral(&token, LITERAL_WORD)
+
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+
+		constants[def.Name] = token
+
+		if symtable != nil {
+			if symtable.Constants == nil {
+				symtable.Constants = make(map[string]uint16)
+			}
+
+			symtable.Constants[def.Name] = value
+		}
+	}
+
+	// Writes a word at the program counter and advances it. Words beyond the
+	// end of memory are dropped, the statement is then reported as an
+	// OversizedBinaryError once it has been assembled
+	emit := func(word uint16) {
+		if program < 1<<16 {
+			result[program] = word
+		}
+
+		program++
+	}
+
+	// Advances the cursor to the next line once every statement expanded from
+	// the current line has been assembled
+	nextLine := func() {
+		if len(pending) > 0 {
+			return
+		}
+
+		cursor.Line++
+		cursor.Byte += int64(len(line) + newline)
+		cursor.LineByte += int64(len(line) + newline)
+	}
+
+	// Splits a statement calling a macro into its optional label and the call
+	macroCall := func(tokens []Token) (*Token, []Token, bool) {
+		if _, exists := macros[tokens[0].Value]; exists {
+			return nil, tokens, true
+		}
+
+		if len(tokens) > 1 && !isKeyword(tokens[0].Value) {
+			if _, exists := macros[tokens[1].Value]; exists {
+				return &tokens[0], tokens[1:], true
+			}
+		}
+
+		return nil, nil, false
+	}
 
-	// Process:
-	// - Parse line
-	// - Assemble line
-	for scanner.Scan() {
-		var tokens = make([]Token, 0, 5)
-		var tokenStart int = 0
-		var tokenType TokenType = TOKEN_NONE
+	// Expands a macro call into the statements of its body, substituting
+	// each parameter with its argument and expanding any nested calls
+	var expand func(call []Token, active map[string]bool) [][]Token
 
-		var lineErrs = len(errs)
+	expand = func(call []Token, active map[string]bool) (statements [][]Token) {
+		name := call[0]
+		args := call[1:]
+		macro := macros[name.Value]
 
-		line := scanner.Text()
-		builder.Grow(len(line))
+		if active[name.Value] {
+			errs = append(errs, &RecursiveMacroError{name.Position, name.Value})
+			return nil
+		}
 
-		cursor.Size = int64(len(line))
+		if len(args) != len(macro.Params) {
+			errs = append(
+				errs,
+				&InvalidNumArgumentsError{
+					name.Position, len(macro.Params), len(args),
+				},
+			)
+			return nil
+		}
 
-		// Parse Line:
-		// - Gather tokens and their types
-		// - Check for syntax errors
-		for column, char := range line {
-			cursor.Column = column + 1
+		active[name.Value] = true
+		defer delete(active, name.Value)
 
-			var flush bool = false
-			var skip bool = false
+		for _, body := range macro.Body {
+			statement := make([]Token, len(body))
 
-			if tokenType == TOKEN_NONE {
-				tokenStart = cursor.Column
-			}
+			for i, token := range body {
+				statement[i] = token
 
-			switch {
-			// Whitespace
-			case unicode.IsSpace(char):
-				if tokenType == TOKEN_NONE {
+				if token.Type != TOKEN_IDENT {
 					continue
-				} else if tokenType != TOKEN_STRING {
-					flush = true
 				}
 
-			// Comments
-			case char == ';':
-				if tokenType == TOKEN_NONE {
-					skip = true
-				} else if tokenType != TOKEN_STRING {
-					flush = true
-					skip = true
+				for j, param := range macro.Params {
+					if token.Value == param.Value {
+						statement[i] = args[j]
+						break
+					}
 				}
+			}
 
-			// Assembler Directives
-			case char == '.':
-				if tokenType == TOKEN_NONE {
-					tokenType = TOKEN_DIRECTIVE
-				} else if tokenType != TOKEN_STRING {
-					errs = append(errs, &UnexpectedCharacterError{cursor, char})
+			if label, call, ok := macroCall(statement); ok {
+				if label != nil {
+					statements = append(statements, []Token{*label})
 				}
 
-			// Operand Separator
-			case char == ',':
-				if tokenType != TOKEN_STRING {
-					flush = true
-				}
+				statements = append(statements, expand(call, active)...)
+			} else {
+				statements = append(statements, statement)
+			}
+		}
 
-			// Hex Literal (i.e. x2A, no leading zero)
-			case char == 'x' || char == 'X':
-				if tokenType == TOKEN_NONE {
-					tokenType = TOKEN_LITERAL
-				}
+		return statements
+	}
 
-			// Base 10 Literal (i.e. #42)
-			case char == '#':
-				if tokenType == TOKEN_NONE {
-					tokenType = TOKEN_LITERAL
-				} else if tokenType != TOKEN_STRING {
-					errs = append(errs, &UnexpectedCharacterError{cursor, char})
-				}
+	// Process:
+	// - Parse line
+	// - Expand macros
+	// - Assemble line
+	for len(pending) > 0 || scanner.Scan() {
+		var tokens []Token
 
-			// String Literal
-			case char == '"':
-				if tokenType == TOKEN_NONE {
-					tokenType = TOKEN_STRING
-				} else if tokenType == TOKEN_STRING {
-					flush = true
-				} else {
-					errs = append(errs, &UnexpectedCharacterError{cursor, char})
-				}
+		if len(pending) > 0 {
+			tokens, pending = pending[0], pending[1:]
+		} else {
+			line = scanner.Text()
+			newline = 1
 
-			// Numeric Literal
-			case unicode.IsDigit(char):
-				if tokenType == TOKEN_NONE {
-					tokenType = TOKEN_LITERAL
-				}
+			if strings.HasSuffix(line, "\r") {
+				line = line[:len(line)-1]
+				newline = 2
+			}
 
-			// Numeric Sign
-			case char == '-':
-				if tokenType != TOKEN_LITERAL {
-					errs = append(errs, &UnexpectedCharacterError{cursor, char})
-				}
+			cursor.Size = int64(len(line))
 
-			// Underscore'd Identifier
-			case char == '_':
-				if tokenType == TOKEN_NONE {
-					tokenType = TOKEN_IDENT
-				} else if tokenType != TOKEN_IDENT && tokenType != TOKEN_STRING {
-					errs = append(errs, &UnexpectedCharacterError{cursor, char})
-				}
+			var lineErrs []error
 
-			// Identifier
-			case unicode.IsLetter(char):
-				if char > unicode.MaxASCII {
-					errs = append(errs, &OversizedCharacterError{cursor})
-				}
+			tokens, lineErrs = tokenize(line, cursor, config)
+			errs = append(errs, lineErrs...)
 
-				if tokenType == TOKEN_NONE {
-					tokenType = TOKEN_IDENT
-				}
+			if len(tokens) == 0 {
+				nextLine()
+				continue
+			}
 
-			default:
-				if char > unicode.MaxASCII {
-					errs = append(errs, &OversizedCharacterError{cursor})
+			// Pass any potential assembler errors if we already had parser
+			// errors
+			if len(lineErrs) > 0 {
+				nextLine()
+				continue
+			}
+
+			ident := tokens[0].Value
+
+			// Collect the body of a macro definition until its .ENDM
+			if macro != nil {
+				switch parseDirective(ident) {
+				case DIRECTIVE_ENDM:
+					macro = nil
+				case DIRECTIVE_MACRO:
+					errs = append(errs, &NestedMacroError{tokens[0].Position})
+				default:
+					macro.Body = append(macro.Body, tokens)
 				}
 
-				if tokenType != TOKEN_STRING {
+				nextLine()
+				continue
+			}
+
+			switch parseDirective(ident) {
+			// .MACRO name [param...]
+			case DIRECTIVE_MACRO:
+				if len(tokens) < 2 {
 					errs = append(
-						errs, &UnexpectedCharacterError{cursor, char},
+						errs,
+						&InvalidNumArgumentsError{tokens[0].Position, 1, 0},
+					)
+				} else if isKeyword(tokens[1].Value) {
+					// A macro named after a mnemonic or directive could never
+					// be called, but its body is still collected so that it
+					// isn't assembled in place
+					errs = append(
+						errs,
+						&KeywordMacroError{tokens[1].Position, tokens[1].Value},
 					)
-				}
-			}
 
-			if cursor.Column == len(line) {
-				if tokenType == TOKEN_STRING {
-					if char != '"' || tokenStart == cursor.Column {
-						errs = append(errs, &InvalidStringError{cursor})
-					}
+					macro = &Macro{Name: tokens[1], Params: tokens[2:]}
+				} else if tokens[1].Type != TOKEN_IDENT {
+					errs = append(
+						errs,
+						&InvalidOperandError{
+							tokens[1].Position,
+							[]TokenType{TOKEN_IDENT},
+							tokens[1].Type,
+						},
+					)
 				} else {
-					if char == ',' {
+					macro = &Macro{Name: tokens[1], Params: tokens[2:]}
+
+					if _, exists := macros[tokens[1].Value]; exists {
 						errs = append(
-							errs, &UnexpectedCharacterError{cursor, char},
+							errs,
+							&RedeclaredMacroError{
+								tokens[1].Position, tokens[1].Value,
+							},
 						)
+					} else {
+						macros[tokens[1].Value] = macro
 					}
 				}
 
-				flush = true
-				builder.WriteRune(char)
-			} else {
-				if flush && tokenType == TOKEN_STRING && char == '"' {
-					builder.WriteRune(char)
-				}
+				nextLine()
+				continue
+
+			case DIRECTIVE_ENDM:
+				errs = append(
+					errs, &UnexpectedMacroEndError{tokens[0].Position},
+				)
+
+				nextLine()
+				continue
 			}
 
-			if flush {
-				if builder.Len() > 0 {
-					var token Token
-					token.Position = Cursor{
-						Line:     cursor.Line,
-						Column:   tokenStart,
-						Byte:     cursor.Byte + int64(tokenStart-1),
-						Size:     int64(builder.Len()),
-						LineByte: cursor.Byte,
-					}
-					token.Type = tokenType
-					token.Value = builder.String()
-					tokens = append(tokens, token)
-					builder.Reset()
+			if label, call, ok := macroCall(tokens); ok {
+				if label != nil {
+					pending = append(pending, []Token{*label})
 				}
 
-				flush = false
-				tokenType = TOKEN_NONE
-			} else if !skip {
-				builder.WriteRune(char)
-			}
+				pending = append(pending, expand(call, map[string]bool{})...)
 
-			if skip {
-				break
+				nextLine()
+				continue
 			}
 		}
 
-		if len(tokens) == 0 {
-			cursor.Line++
-			cursor.Byte += int64(len(line) + 1)
-			cursor.LineByte += int64(len(line) + 1)
-			continue
-		}
+		// Substitute constants for their values, other than the name being
+		// declared by .EQU or .SET
+		for i := 1; i < len(tokens); i++ {
+			if tokens[i].Type != TOKEN_IDENT {
+				continue
+			}
 
-		// Pass any potential assembler errors if we already had parser errors
-		if len(errs) > lineErrs {
-			cursor.Line++
-			cursor.Byte += int64(len(line) + 1)
-			cursor.LineByte += int64(len(line) + 1)
-			continue
+			switch parseDirective(tokens[i-1].Value) {
+			case DIRECTIVE_EQU, DIRECTIVE_SET:
+				continue
+			}
+
+			if constant, exists := constants[tokens[i].Value]; exists {
+				position := tokens[i].Position
+				tokens[i] = constant
+				tokens[i].Position = position
+			}
 		}
 
 		// Assemble line
@@ -409,7 +1162,24 @@ func AssembleLC3Source(input io.ReadSeeker, symtable *SymTable) (result []uint16
 
 		var scratch uint16 = 0
 
-		if instruction = parseInstruction(tokens[0].Value); instruction != INSTRUCTION_INVALID {
+		// Instructions written by a pseudo-instruction which expands to more
+		// than a single word
+		var expansion []uint16
+
+		// A keyword followed by another keyword is a label that shadows a
+		// mnemonic (i.e. ADD ADD R0, R1, R2), unless the first keyword expects
+		// a label operand (i.e. JSR ADD). A first keyword which is a statement
+		// by itself (i.e. RET HALT) is more likely a missing newline, so it is
+		// only read as a label when mnemonic labels are allowed
+		shadowed := len(tokens) > 1 &&
+			isKeyword(tokens[0].Value) &&
+			isKeyword(tokens[1].Value) &&
+			!takesLabelOperand(tokens[0].Value) &&
+			(config.allowMnemonicLabels || !takesNoOperands(tokens[0].Value))
+
+		if shadowed {
+			label = &tokens[0]
+		} else if instruction = parseInstruction(tokens[0].Value); instruction != INSTRUCTION_INVALID {
 			keyword = &tokens[0]
 
 			if len(tokens) > 1 {
@@ -426,19 +1196,41 @@ func AssembleLC3Source(input io.ReadSeeker, symtable *SymTable) (result []uint16
 		}
 
 		if label != nil {
-			if _, exists := labels[label.Value]; !exists {
-				labels[label.Value] = uint16(program)
-			} else {
+			if shadowed && !config.allowMnemonicLabels {
+				errs = append(
+					errs, &MnemonicShadowWarning{label.Position, label.Value},
+				)
+			}
+
+			if unicode.IsDigit(rune(label.Value[0])) {
+				errs = append(
+					errs, &InvalidLabelNameError{label.Position, label.Value},
+				)
+			} else if label.Value[0] == '_' && !config.allowUnderscoreLabels {
+				errs = append(
+					errs, &UnderscoreLabelWarning{label.Position, label.Value},
+				)
+			}
+
+			if first, exists := labels[label.Value]; exists {
+				errs = append(
+					errs,
+					&RedeclaredLabelError{label.Position, label.Value, first.pos},
+				)
+			} else if constant, exists := constants[label.Value]; exists {
 				errs = append(
-					errs, &RedeclaredLabelError{label.Position, label.Value},
+					errs,
+					&RedeclaredLabelError{
+						label.Position, label.Value, constant.Position,
+					},
 				)
+			} else {
+				labels[label.Value] = labelEntry{uint16(program), label.Position}
 			}
 
 			// No need to assemble label-only statements
 			if len(tokens) == 1 {
-				cursor.Line++
-				cursor.Byte += int64(len(line) + 1)
-				cursor.LineByte += int64(len(line) + 1)
+				nextLine()
 				continue
 			}
 
@@ -457,11 +1249,35 @@ func AssembleLC3Source(input io.ReadSeeker, symtable *SymTable) (result []uint16
 			}
 		}
 
+		if config.registerAliases {
+			count := registerOperands(instruction)
+
+			for i := 0; i < len(operands) && i < count; i++ {
+				resolveRegisterAlias(&operands[i])
+			}
+		}
+
 		if keyword == nil {
-			errs = append(
-				errs,
-				&UnknownIdentifierError{tokens[0].Position, tokens[0].Value},
-			)
+			// An identifier followed by an operand which cannot be a
+			// mnemonic is taken to be a call to a macro (i.e. PUSH R0)
+			call := false
+
+			if len(tokens) > 1 {
+				_, register := parseRegister(&tokens[1])
+				call = register || tokens[1].Type != TOKEN_IDENT
+			}
+
+			if call {
+				errs = append(
+					errs,
+					&UndefinedMacroError{tokens[0].Position, tokens[0].Value},
+				)
+			} else {
+				errs = append(
+					errs,
+					&UnknownIdentifierError{tokens[0].Position, tokens[0].Value},
+				)
+			}
 		}
 
 		if directive == DIRECTIVE_END {
@@ -474,7 +1290,94 @@ func AssembleLC3Source(input io.ReadSeeker, symtable *SymTable) (result []uint16
 			break
 		}
 
+		// Address of any data written or reserved by the directive
+		dataStart := program
+
 		switch directive {
+		// .EQU name #
+		// .SET name #
+		case DIRECTIVE_EQU, DIRECTIVE_SET:
+			if count := len(operands); count != 2 {
+				errs = append(
+					errs, &InvalidNumArgumentsError{keyword.Position, 2, count},
+				)
+
+				break
+			}
+
+			name := operands[0]
+
+			if name.Type != TOKEN_IDENT {
+				errs = append(
+					errs,
+					&InvalidOperandError{
+						name.Position, []TokenType{TOKEN_IDENT}, name.Type,
+					},
+				)
+
+				break
+			}
+
+			// A constant named after a register would be substituted
+			// wherever the register is written
+			if _, register := parseRegister(&name); register {
+				errs = append(
+					errs, &RegisterConstantError{name.Position, name.Value},
+				)
+
+				break
+			}
+
+			if operands[1].Type != TOKEN_LITERAL {
+				errs = append(
+					errs,
+					&InvalidOperandError{
+						operands[1].Position,
+						[]TokenType{TOKEN_LITERAL},
+						operands[1].Type,
+					},
+				)
+
+				break
+			}
+
+			value, err := parseLiteral(&operands[1], LITERAL_WORD)
+
+			if err != nil {
+				errs = append(errs, err)
+				break
+			}
+
+			// Constants may only be redefined by .SET
+			if first, exists := labels[name.Value]; exists {
+				errs = append(
+					errs,
+					&RedeclaredLabelError{name.Position, name.Value, first.pos},
+				)
+
+				break
+			} else if constant, exists := constants[name.Value]; exists &&
+				directive == DIRECTIVE_EQU {
+				errs = append(
+					errs,
+					&RedeclaredLabelError{
+						name.Position, name.Value, constant.Position,
+					},
+				)
+
+				break
+			}
+
+			constants[name.Value] = operands[1]
+
+			if symtable != nil {
+				if symtable.Constants == nil {
+					symtable.Constants = make(map[string]uint16)
+				}
+
+				symtable.Constants[name.Value] = value
+			}
+
 		// .FILL #
 		case DIRECTIVE_FILL:
 			if count := len(operands); count != 1 {
@@ -485,6 +1388,10 @@ func AssembleLC3Source(input io.ReadSeeker, symtable *SymTable) (result []uint16
 				break
 			}
 
+			// Words filled with an unresolved label are written once all
+			// labels are known
+			var word uint16
+
 			if operands[0].Type == TOKEN_LITERAL {
 				literal, err := parseLiteral(
 					&operands[0], LITERAL_WORD,
@@ -494,12 +1401,12 @@ func AssembleLC3Source(input io.ReadSeeker, symtable *SymTable) (result []uint16
 					errs = append(errs, err)
 				}
 
-				result[program] = literal
+				word = literal
 			} else if operands[0].Type == TOKEN_IDENT {
-				addr, exists := labels[operands[0].Value]
+				entry, exists := labels[operands[0].Value]
 
 				if exists {
-					result[program] = addr
+					word = entry.addr
 				} else {
 					fillRefs = append(
 						fillRefs,
@@ -521,43 +1428,97 @@ func AssembleLC3Source(input io.ReadSeeker, symtable *SymTable) (result []uint16
 				)
 			}
 
-			program++
+			sections = append(sections, Section{SECTION_DATA, uint16(program), 1})
+			emit(word)
 
 		// .BLKW #
+		// .BLKW #, #
 		case DIRECTIVE_BLKW:
-			if count := len(operands); count != 1 {
+			if count := len(operands); count == 0 {
 				errs = append(
 					errs, &InvalidNumArgumentsError{keyword.Position, 1, count},
 				)
 
 				break
-			}
-
-			if operands[0].Type != TOKEN_LITERAL {
+			} else if count > 2 {
 				errs = append(
-					errs,
-					&InvalidOperandError{
-						operands[0].Position,
-						[]TokenType{TOKEN_LITERAL},
-						operands[0].Type,
-					},
+					errs, &InvalidNumArgumentsError{keyword.Position, 2, count},
 				)
 
 				break
 			}
 
+			invalid := false
+
+			for i := range operands {
+				if operands[i].Type != TOKEN_LITERAL {
+					errs = append(
+						errs,
+						&InvalidOperandError{
+							operands[i].Position,
+							[]TokenType{TOKEN_LITERAL},
+							operands[i].Type,
+						},
+					)
+
+					invalid = true
+				}
+			}
+
+			if invalid {
+				break
+			}
+
 			literal, err := parseLiteral(
 				&operands[0], LITERAL_WORD,
 			)
 
 			if err != nil {
 				errs = append(errs, err)
+			} else if literal == 0 {
+				errs = append(errs, &ZeroSizedBlockWarning{keyword.Position})
+			}
+
+			// Blocks are zero-filled unless an initialiser is given
+			var fill uint16
+
+			if len(operands) == 2 {
+				if fill, err = parseLiteral(
+					&operands[1], LITERAL_WORD,
+				); err != nil {
+					errs = append(errs, err)
+				}
+			}
+
+			if fill == 0 {
+				sections = append(
+					sections,
+					Section{SECTION_BSS, uint16(program), uint32(literal)},
+				)
+				program += uint32(literal)
+
+				break
+			}
+
+			sections = append(
+				sections,
+				Section{SECTION_DATA, uint16(program), uint32(literal)},
+			)
+
+			// Only the words which fit in memory are filled, the block is then
+			// reported as an OversizedBinaryError once it has been assembled
+			end := program + uint32(literal)
+
+			for ; program < end && program < 1<<16; program++ {
+				result[program] = fill
 			}
 
-			program += uint32(literal)
+			program = end
 
 		// .STRINGZ "..."
-		case DIRECTIVE_STRINGZ:
+		// .STRINGZW "..."
+		// .ASCII "..."
+		case DIRECTIVE_STRINGZ, DIRECTIVE_STRINGZW, DIRECTIVE_ASCII:
 			if count := len(operands); count != 1 {
 				errs = append(
 					errs, &InvalidNumArgumentsError{keyword.Position, 1, count},
@@ -579,19 +1540,57 @@ func AssembleLC3Source(input io.ReadSeeker, symtable *SymTable) (result []uint16
 				break
 			}
 
-			s, err := strconv.Unquote(operands[0].Value)
+			s, err := unquote(operands[0].Value)
 
 			if err != nil {
 				errs = append(errs, &InvalidStringError{operands[0].Position})
+			} else if len(s) == 0 {
+				errs = append(errs, &EmptyStringWarning{operands[0].Position})
+			}
+
+			start := program
+
+			if directive == DIRECTIVE_STRINGZW {
+				// Two characters per word, the first in the high byte
+				runes := []rune(s)
+
+				for _, r := range runes {
+					if r > 0xFF {
+						errs = append(
+							errs,
+							&OversizedCharacterError{operands[0].Position},
+						)
+
+						break
+					}
+				}
+
+				for i := 0; i < len(runes); i += 2 {
+					word := (uint16(runes[i]) & 0xFF) << 8
+
+					if i+1 < len(runes) {
+						word |= uint16(runes[i+1]) & 0xFF
+					}
+
+					emit(word)
+				}
+			} else {
+				for _, c := range s {
+					emit(uint16(c))
+				}
 			}
 
-			for _, c := range s {
-				result[program] = uint16(c)
-				program++
+			// .ASCII strings are not null-terminated
+			if directive != DIRECTIVE_ASCII {
+				emit(0)
 			}
 
-			result[program] = 0
-			program++
+			if program > start {
+				sections = append(
+					sections,
+					Section{SECTION_DATA, uint16(start), program - start},
+				)
+			}
 
 		// .ORIG #
 		case DIRECTIVE_ORIG:
@@ -616,13 +1615,30 @@ func AssembleLC3Source(input io.ReadSeeker, symtable *SymTable) (result []uint16
 				break
 			}
 
-			literal, err := parseLiteral(&operands[0], LITERAL_WORD)
+			literal, err := parseLiteral(&operands[0], LITERAL_WORD)
+
+			if err != nil {
+				errs = append(errs, err)
+			}
+
+			program = uint32(literal)
+
+			if !originSet {
+				origin, originSet = literal, true
+			}
+		}
+
+		// Data is recorded alongside instructions, so that an address within a
+		// block is found on the line of the directive which reserved it
+		if symtable != nil && directive != DIRECTIVE_ORIG &&
+			program > dataStart && dataStart < 1<<16 {
+			symtable.AddSymbol(uint16(dataStart), cursor.LineByte)
 
-			if err != nil {
-				errs = append(errs, err)
+			if symtable.SourceMap == nil {
+				symtable.SourceMap = make(map[uint16]Cursor)
 			}
 
-			program = uint32(literal)
+			symtable.SourceMap[uint16(dataStart)] = keyword.Position
 		}
 
 		switch instruction {
@@ -1167,6 +2183,18 @@ func AssembleLC3Source(input io.ReadSeeker, symtable *SymTable) (result []uint16
 			case INSTRUCTION_HALT:
 				trap = 0x25
 			default:
+				// Trap vectors are unsigned, so negative literals are invalid
+				// rather than being truncated to 8 bits
+				if strings.HasPrefix(
+					strings.TrimPrefix(operands[0].Value, "#"), "-",
+				) {
+					errs = append(
+						errs, &InvalidLiteralError{operands[0].Position},
+					)
+
+					break
+				}
+
 				literal, err := parseLiteral(&operands[0], LITERAL_TRAPVEC8)
 
 				if err != nil {
@@ -1185,40 +2213,165 @@ func AssembleLC3Source(input io.ReadSeeker, symtable *SymTable) (result []uint16
 
 			scratch <<= 12
 			scratch |= (trap & 0xFF)
+
+		// NOP  |0000    |0|0|0|000000000         | Branch never taken
+		// ---- [ _ _ _ _ _ _ _ _ _ _ _ _ _ _ _ _ ]
+		case INSTRUCTION_NOP:
+			if count := len(operands); count != 0 {
+				errs = append(
+					errs, &InvalidNumArgumentsError{keyword.Position, 0, count},
+				)
+			}
+
+			scratch = 0
+
+		// SUB DR, SR1, SR2 negates SR2 in place, which is left negated, so SR1
+		// and SR2 may not be the same register
+		case INSTRUCTION_SUB:
+			if count := len(operands); count != 3 {
+				errs = append(
+					errs, &InvalidNumArgumentsError{keyword.Position, 3, count},
+				)
+
+				break
+			}
+
+			regs, regErrs := parseRegisterOperands(operands)
+			errs = append(errs, regErrs...)
+
+			dr, sr1, sr2 := regs[0], regs[1], regs[2]
+
+			if len(regErrs) == 0 && sr1 == sr2 {
+				errs = append(
+					errs,
+					&AliasedRegisterError{operands[2].Position, keyword.Value},
+				)
+			}
+
+			expansion = []uint16{
+				encodeNOT(sr2, sr2),
+				encodeADDImm(sr2, sr2, 1),
+				encodeADD(dr, sr1, sr2),
+			}
+
+		// NEG DR, SR
+		case INSTRUCTION_NEG:
+			if count := len(operands); count != 2 {
+				errs = append(
+					errs, &InvalidNumArgumentsError{keyword.Position, 2, count},
+				)
+
+				break
+			}
+
+			regs, regErrs := parseRegisterOperands(operands)
+			errs = append(errs, regErrs...)
+
+			dr, sr := regs[0], regs[1]
+
+			expansion = []uint16{
+				encodeNOT(dr, sr),
+				encodeADDImm(dr, dr, 1),
+			}
+
+		// OR DR, SR1, SR2 complements SR1 and SR2 in place, which are left
+		// complemented, so SR1 and SR2 may not be the same register
+		case INSTRUCTION_OR:
+			if count := len(operands); count != 3 {
+				errs = append(
+					errs, &InvalidNumArgumentsError{keyword.Position, 3, count},
+				)
+
+				break
+			}
+
+			regs, regErrs := parseRegisterOperands(operands)
+			errs = append(errs, regErrs...)
+
+			dr, sr1, sr2 := regs[0], regs[1], regs[2]
+
+			if len(regErrs) == 0 && sr1 == sr2 {
+				errs = append(
+					errs,
+					&AliasedRegisterError{operands[2].Position, keyword.Value},
+				)
+			}
+
+			expansion = []uint16{
+				encodeNOT(sr1, sr1),
+				encodeNOT(sr2, sr2),
+				encodeAND(dr, sr1, sr2),
+				encodeNOT(dr, dr),
+			}
 		}
 
-		if symtable != nil {
-			symtable.Symbols[uint16(program)] = cursor.LineByte
+		// Directives have already advanced the program counter past any data
+		// they recorded above, and lines which failed to parse have no keyword
+		if symtable != nil && instruction != INSTRUCTION_INVALID {
+			symtable.AddSymbol(uint16(program), cursor.LineByte)
+
+			if symtable.SourceMap == nil {
+				symtable.SourceMap = make(map[uint16]Cursor)
+			}
+
+			symtable.SourceMap[uint16(program)] = keyword.Position
 		}
 
-		if instruction != INSTRUCTION_INVALID {
-			result[program] = scratch
-			program++
+		if expansion != nil {
+			sections = append(
+				sections,
+				Section{SECTION_TEXT, uint16(program), uint32(len(expansion))},
+			)
+
+			for _, word := range expansion {
+				emit(word)
+			}
+		} else if instruction != INSTRUCTION_INVALID {
+			sections = append(
+				sections, Section{SECTION_TEXT, uint16(program), 1},
+			)
+			emit(scratch)
 		}
 
-		if program >= math.MaxUint16 {
-			errs = append(errs, &OversizedBinaryError{})
+		// A program may end at 0xFFFF, leaving the program counter one past
+		// the last address of memory
+		if program > 1<<16 {
+			errs = append(errs, &OversizedBinaryError{program})
 			return
 		}
 
-		cursor.Line++
-		cursor.Byte += int64(len(line) + 1)
-		cursor.LineByte += int64(len(line) + 1)
+		nextLine()
+	}
+
+	if macro != nil {
+		errs = append(
+			errs, &UnterminatedMacroError{macro.Name.Position, macro.Name.Value},
+		)
 	}
 
 	// Label
 	// - Validate and resolve label references
 	// - Add labels to symbol table
 	for _, ref := range labelRefs {
-		addr, exists := labels[ref.Label]
+		entry, exists := labels[ref.Label]
 
 		if !exists {
-			errs = append(errs, &UnknownLabelError{ref.Position, ref.Label})
+			if isKeyword(ref.Label) {
+				errs = append(errs, &MnemonicLabelError{ref.Position, ref.Label})
+			} else {
+				errs = append(
+					errs,
+					&UnknownLabelError{
+						ref.Position, ref.Label, suggest(ref.Label),
+					},
+				)
+			}
+
 			continue
 		}
 
 		limit := int64(1) << (ref.Size - 1)
-		offset := int64(addr) - int64(ref.Addr) - 1
+		offset := int64(entry.addr) - int64(ref.Addr) - 1
 
 		if offset < -limit || offset >= limit {
 			errs = append(
@@ -1234,9 +2387,28 @@ func AssembleLC3Source(input io.ReadSeeker, symtable *SymTable) (result []uint16
 		result[ref.Addr] = scratch
 	}
 
+	if config.sectionSizes != nil {
+		*config.sectionSizes = SectionSizes{}
+
+		for _, section := range sections {
+			switch section.Type {
+			case SECTION_TEXT:
+				config.sectionSizes.Text += int(section.Size)
+			case SECTION_DATA:
+				config.sectionSizes.Data += int(section.Size)
+			case SECTION_BSS:
+				config.sectionSizes.Bss += int(section.Size)
+			}
+		}
+	}
+
+	if config.sections != nil {
+		*config.sections = sections
+	}
+
 	if symtable != nil {
-		for label, addr := range labels {
-			symtable.Labels[addr] = label
+		for label, entry := range labels {
+			symtable.Labels[entry.addr] = label
 		}
 	}
 
@@ -1244,15 +2416,426 @@ func AssembleLC3Source(input io.ReadSeeker, symtable *SymTable) (result []uint16
 	// - Validate and resolve fill directives whose arguments were unresolved
 	//	 label references
 	for _, ref := range fillRefs {
-		addr, exists := labels[ref.Label]
+		entry, exists := labels[ref.Label]
 
 		if !exists {
-			errs = append(errs, &UnknownLabelError{ref.Position, ref.Label})
+			if isKeyword(ref.Label) {
+				errs = append(errs, &MnemonicLabelError{ref.Position, ref.Label})
+			} else {
+				errs = append(
+					errs,
+					&UnknownLabelError{
+						ref.Position, ref.Label, suggest(ref.Label),
+					},
+				)
+			}
+
 			continue
 		}
 
-		result[ref.Addr] = addr
+		result[ref.Addr] = entry.addr
+	}
+
+	return
+}
+
+// Returns the range of an assembled program from its first non-zero word up to
+// and including its last non-zero word, an empty program yields an empty range
+// at the start of memory
+func ProgramBounds(result []uint16) (start, end int) {
+	end = len(result)
+
+	for start < end && result[start] == 0 {
+		start++
+	}
+
+	for end > start && result[end-1] == 0 {
+		end--
+	}
+
+	if start == end {
+		return 0, 0
+	}
+
+	return start, end
+}
+
+// Writes an assembled program as a relocatable binary: a header word containing
+// its origin, followed by every word from the origin up to and including the
+// last non-zero word
+func WriteRelocatable(w io.Writer, result []uint16, origin uint16) error {
+	_, end := ProgramBounds(result)
+
+	if end < int(origin) {
+		end = int(origin)
+	}
+
+	if err := binary.Write(w, binary.BigEndian, origin); err != nil {
+		return err
+	}
+
+	return binary.Write(w, binary.BigEndian, result[origin:end])
+}
+
+// Writes a listing of the assembled program, annotating each word with its
+// address. Instructions are followed by their source line, which is located
+// through the symbol table and omitted when either is nil
+func WriteListing(
+	w io.Writer,
+	result []uint16,
+	sections []Section,
+	symtable *SymTable,
+	source io.ReadSeeker,
+) error {
+	writer := bufio.NewWriter(w)
+
+	for _, section := range sections {
+		switch section.Type {
+		case SECTION_TEXT:
+			var line string
+
+			if symtable != nil && source != nil {
+				if offset, exists := symtable.Symbols[section.Addr]; exists {
+					if _, err := source.Seek(offset, io.SeekStart); err != nil {
+						return err
+					}
+
+					line, _ = bufio.NewReader(source).ReadString('\n')
+				}
+			}
+
+			fmt.Fprintln(writer, strings.TrimSpace(fmt.Sprintf(
+				"0x%04x: %s  %s",
+				section.Addr,
+				encoding.FormatInstruction(result[section.Addr]),
+				strings.TrimSpace(line),
+			)))
+
+		case SECTION_DATA:
+			for i := uint32(0); i < section.Size; i++ {
+				addr := section.Addr + uint16(i)
+
+				fmt.Fprintf(
+					writer,
+					"0x%04x: %s\n",
+					addr,
+					encoding.FormatInstruction(result[addr]),
+				)
+			}
+
+		case SECTION_BSS:
+			if section.Size == 0 {
+				continue
+			}
+
+			fmt.Fprintf(
+				writer,
+				"0x%04x-0x%04x:  (%d words reserved)\n",
+				section.Addr,
+				section.Addr+uint16(section.Size-1),
+				section.Size,
+			)
+		}
+	}
+
+	return writer.Flush()
+}
+
+// Records the source line offset of the word at addr
+func (s *SymTable) AddSymbol(addr uint16, offset int64) {
+	if s.Symbols == nil {
+		s.Symbols = make(map[uint16]int64)
+	}
+
+	if _, exists := s.Symbols[addr]; !exists && s.sortedKeys != nil {
+		i := sort.Search(len(s.sortedKeys), func(i int) bool {
+			return s.sortedKeys[i] >= addr
+		})
+
+		s.sortedKeys = append(s.sortedKeys, 0)
+		copy(s.sortedKeys[i+1:], s.sortedKeys[i:])
+		s.sortedKeys[i] = addr
+	}
+
+	s.Symbols[addr] = offset
+}
+
+// Finds the symbol with the largest address not exceeding addr, along with
+// its label if it has one. Tables populated without AddSymbol, such as those
+// decoded from a file, are indexed on first use
+func (s *SymTable) FindNearest(addr uint16) (
+	nearestAddr uint16, label string, found bool,
+) {
+	if len(s.sortedKeys) != len(s.Symbols) {
+		s.sortedKeys = make([]uint16, 0, len(s.Symbols))
+
+		for key := range s.Symbols {
+			s.sortedKeys = append(s.sortedKeys, key)
+		}
+
+		sort.Slice(s.sortedKeys, func(i, j int) bool {
+			return s.sortedKeys[i] < s.sortedKeys[j]
+		})
+	}
+
+	i := sort.Search(len(s.sortedKeys), func(i int) bool {
+		return s.sortedKeys[i] > addr
+	})
+
+	if i == 0 {
+		return 0, "", false
+	}
+
+	nearestAddr = s.sortedKeys[i-1]
+
+	return nearestAddr, s.Labels[nearestAddr], true
+}
+
+// Finds the address of label. This scans Labels, as the table holds no inverse
+// map, so lookups are linear in the number of labels
+func (s *SymTable) Lookup(label string) (addr uint16, ok bool) {
+	for labelAddr, name := range s.Labels {
+		if name == label {
+			return labelAddr, true
+		}
 	}
 
+	return 0, false
+}
+
+// Finds the label declared at addr
+func (s *SymTable) LookupAddr(addr uint16) (label string, ok bool) {
+	label, ok = s.Labels[addr]
 	return
 }
+
+type jsonCursor struct {
+	Line     int   `json:"line"`
+	Column   int   `json:"column"`
+	Byte     int64 `json:"byte"`
+	Size     int64 `json:"size"`
+	LineByte int64 `json:"lineByte"`
+}
+
+type jsonSymTable struct {
+	Source    string                `json:"source"`
+	Symbols   map[string]int64      `json:"symbols"`
+	Labels    map[string]string     `json:"labels"`
+	Constants map[string]uint16     `json:"constants,omitempty"`
+	SourceMap map[string]jsonCursor `json:"sourceMap,omitempty"`
+}
+
+// Parses an address key of a JSON symbol table, either as hex (i.e. 0x3000)
+// or as decimal, as written before addresses were encoded as hex
+func parseSymTableAddr(key string) (uint16, error) {
+	if addr, err := encoding.DecodeHex(key); err == nil {
+		return addr, nil
+	}
+
+	addr, err := strconv.ParseUint(key, 10, 16)
+
+	if err != nil {
+		return 0, fmt.Errorf("Invalid symbol table address '%s'", key)
+	}
+
+	return uint16(addr), nil
+}
+
+// Encodes the symbol table with addresses as hex strings (i.e. "0x3000") and
+// byte offsets as decimal
+func (s SymTable) MarshalJSON() ([]byte, error) {
+	table := jsonSymTable{
+		Source:    s.Source,
+		Symbols:   make(map[string]int64, len(s.Symbols)),
+		Labels:    make(map[string]string, len(s.Labels)),
+		Constants: s.Constants,
+	}
+
+	for addr, offset := range s.Symbols {
+		table.Symbols[fmt.Sprintf("0x%04x", addr)] = offset
+	}
+
+	for addr, label := range s.Labels {
+		table.Labels[fmt.Sprintf("0x%04x", addr)] = label
+	}
+
+	if len(s.SourceMap) > 0 {
+		table.SourceMap = make(map[string]jsonCursor, len(s.SourceMap))
+
+		for addr, cursor := range s.SourceMap {
+			table.SourceMap[fmt.Sprintf("0x%04x", addr)] = jsonCursor(cursor)
+		}
+	}
+
+	return json.Marshal(table)
+}
+
+func (s *SymTable) UnmarshalJSON(data []byte) error {
+	var table jsonSymTable
+
+	if err := json.Unmarshal(data, &table); err != nil {
+		return err
+	}
+
+	*s = SymTable{
+		Source:    table.Source,
+		Symbols:   make(map[uint16]int64, len(table.Symbols)),
+		Labels:    make(map[uint16]string, len(table.Labels)),
+		Constants: table.Constants,
+	}
+
+	for key, offset := range table.Symbols {
+		addr, err := parseSymTableAddr(key)
+
+		if err != nil {
+			return err
+		}
+
+		s.Symbols[addr] = offset
+	}
+
+	for key, label := range table.Labels {
+		addr, err := parseSymTableAddr(key)
+
+		if err != nil {
+			return err
+		}
+
+		s.Labels[addr] = label
+	}
+
+	if len(table.SourceMap) > 0 {
+		s.SourceMap = make(map[uint16]Cursor, len(table.SourceMap))
+
+		for key, cursor := range table.SourceMap {
+			addr, err := parseSymTableAddr(key)
+
+			if err != nil {
+				return err
+			}
+
+			s.SourceMap[addr] = Cursor(cursor)
+		}
+	}
+
+	return nil
+}
+
+// Writes the labels of the symbol table in the given format: "text" lists one
+// label and address per line, "csv" includes a header row, and "json" writes
+// the whole table as encoded by MarshalJSON. Labels are sorted by address
+func (s *SymTable) WriteTo(w io.Writer, format string) error {
+	addrs := make([]int, 0, len(s.Labels))
+	width := 0
+
+	for addr, label := range s.Labels {
+		addrs = append(addrs, int(addr))
+
+		if len(label) > width {
+			width = len(label)
+		}
+	}
+
+	sort.Ints(addrs)
+
+	switch format {
+	case "text":
+		for _, addr := range addrs {
+			if _, err := fmt.Fprintf(
+				w, "%-*s  0x%04x\n", width, s.Labels[uint16(addr)], addr,
+			); err != nil {
+				return err
+			}
+		}
+
+		return nil
+	case "csv":
+		writer := csv.NewWriter(w)
+
+		if err := writer.Write([]string{"label", "address"}); err != nil {
+			return err
+		}
+
+		for _, addr := range addrs {
+			if err := writer.Write([]string{
+				s.Labels[uint16(addr)], fmt.Sprintf("0x%04x", addr),
+			}); err != nil {
+				return err
+			}
+		}
+
+		writer.Flush()
+		return writer.Error()
+	case "json":
+		return json.NewEncoder(w).Encode(s)
+	}
+
+	return &UnknownSymTableFormatError{format}
+}
+
+// Reconstructs the labels of a symbol table from a text listing written by
+// WriteTo. Blank lines are skipped
+func ReadSymTableText(r io.Reader) (*SymTable, error) {
+	symtable := SymTable{
+		Symbols: make(map[uint16]int64),
+		Labels:  make(map[uint16]string),
+	}
+
+	scanner := bufio.NewScanner(r)
+
+	for line := 1; scanner.Scan(); line++ {
+		fields := strings.Fields(scanner.Text())
+
+		if len(fields) == 0 {
+			continue
+		}
+
+		if len(fields) != 2 {
+			return nil, &InvalidSymTableLineError{line, scanner.Text()}
+		}
+
+		addr, err := encoding.DecodeHex(fields[1])
+
+		if err != nil {
+			return nil, &InvalidSymTableLineError{line, scanner.Text()}
+		}
+
+		symtable.Labels[addr] = fields[0]
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return &symtable, nil
+}
+
+// Decodes a symbol table as written by golc3-asm -debug, detecting whether it
+// is gob or JSON encoded from its first byte
+func ReadSymTable(r io.Reader) (*SymTable, error) {
+	reader := bufio.NewReader(r)
+
+	if first, err := reader.Peek(1); err == nil && first[0] == '{' {
+		return ReadSymTableJSON(reader)
+	}
+
+	var symtable SymTable
+
+	if err := gob.NewDecoder(reader).Decode(&symtable); err != nil {
+		return nil, err
+	}
+
+	return &symtable, nil
+}
+
+// Decodes a JSON encoded symbol table, whose Symbols and Labels are objects
+// keyed by hex address
+func ReadSymTableJSON(r io.Reader) (*SymTable, error) {
+	var symtable SymTable
+
+	if err := json.NewDecoder(r).Decode(&symtable); err != nil {
+		return nil, err
+	}
+
+	return &symtable, nil
+}
@@ -16,12 +16,20 @@
 package assembler_test
 
 import (
+	"bytes"
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"math"
+	"os"
 	"reflect"
 	"strings"
 	"testing"
 
 	"github.com/lassandro/golc3/pkg/assembler"
+	"github.com/lassandro/golc3/pkg/machine"
 )
 
 type testCase struct {
@@ -29,34 +37,39 @@ type testCase struct {
 	Input    string
 	Output   map[uint16]uint16
 	SymTable *assembler.SymTable
+	Options  []assembler.AssemblerOption
 }
 
 type failCase struct {
-	Name  string
-	Input string
-	Error error
+	Name    string
+	Input   string
+	Error   error
+	Options []assembler.AssemblerOption
 }
 
 func testAssemblerSuccess(t *testing.T, test *testCase) {
-	var result []uint16
-	var errs []error
 	var symtable assembler.SymTable
-	var symtarget *assembler.SymTable = nil
+
+	opts := test.Options
 
 	if test.SymTable != nil {
-		symtable.Symbols = make(map[uint16]int64)
-		symtable.Labels = make(map[uint16]string)
-		symtarget = &symtable
+		opts = append(opts[:len(opts):len(opts)], assembler.WithSymTable(&symtable))
 	}
 
-	result, errs = assembler.AssembleLC3Source(
-		strings.NewReader(test.Input), symtarget,
+	assembled := assembler.AssembleLC3Source(
+		strings.NewReader(test.Input), opts...,
 	)
 
-	if len(errs) > 0 {
-		t.Fatal(errs[0])
+	if !assembled.Success() {
+		t.Fatal(assembled.Errors[0])
+	}
+
+	if len(assembled.Warnings) > 0 {
+		t.Fatal(assembled.Warnings[0])
 	}
 
+	result := assembled.Memory
+
 	if size := len(result); size != math.MaxUint16+1 {
 		t.Fatalf(
 			"Invalid buffer length\n"+
@@ -164,13 +177,122 @@ func testAssemblerSuccess(t *testing.T, test *testCase) {
 				)
 			}
 		}
+
+		for addr, want := range test.SymTable.SourceMap {
+			have, exists := symtable.SourceMap[addr]
+
+			if !exists || have.Line != want.Line || have.Column != want.Column {
+				t.Fatalf(
+					"Symtable source map mismatch\n"+
+						"want:%s (test.SymTable.SourceMap[%#04x])\n"+
+						"have:%s",
+					want,
+					addr,
+					have,
+				)
+			}
+		}
+
+		for addr, have := range symtable.SourceMap {
+			if _, exists := test.SymTable.SourceMap[addr]; !exists &&
+				test.SymTable.SourceMap != nil {
+				t.Fatalf(
+					"Unexpected symtable source map entry\n"+
+						"want: nil\n"+
+						"have: %s (symtable.SourceMap[%#04x])",
+					have,
+					addr,
+				)
+			}
+		}
+
+		if test.SymTable.Constants != nil &&
+			!reflect.DeepEqual(symtable.Constants, test.SymTable.Constants) {
+			t.Fatalf(
+				"Symtable constants mismatch\nwant:%v\nhave:%v",
+				test.SymTable.Constants,
+				symtable.Constants,
+			)
+		}
+	}
+}
+
+// Disassembles the expected output of a test case, labelled from the symbol
+// table of its input, and checks the disassembly assembles to the same output
+func testDisassemblerRoundTrip(t *testing.T, test *testCase) {
+	symtable := assembler.SymTable{
+		Symbols: make(map[uint16]int64),
+		Labels:  make(map[uint16]string),
+	}
+
+	opts := append(
+		test.Options[:len(test.Options):len(test.Options)],
+		assembler.WithSymTable(&symtable),
+	)
+
+	assembler.AssembleLC3Source(strings.NewReader(test.Input), opts...)
+
+	// Disassemble declares each label on a line of its own, which mnemonic
+	// and directive labels cannot be
+	for _, label := range symtable.Labels {
+		declared := assembler.AssembleLC3Source(strings.NewReader(label))
+		_, end := assembler.ProgramBounds(declared.Memory)
+
+		if !declared.Success() || end != 0 {
+			t.Skipf("label '%s' cannot be declared alone", label)
+		}
+	}
+
+	memory := make([]uint16, math.MaxUint16+1)
+
+	for addr, word := range test.Output {
+		memory[addr] = word
+	}
+
+	// Leading zero words are kept, as they may be part of the program
+	_, end := assembler.ProgramBounds(memory)
+
+	// Labels past the last word still need their trailing zero words
+	for addr := range symtable.Labels {
+		if int(addr) > end {
+			end = int(addr)
+		}
+	}
+
+	disassembly := assembler.Disassemble(memory[:end], 0x0000, &symtable)
+
+	assembled := assembler.AssembleLC3Source(
+		strings.NewReader(disassembly), test.Options...,
+	)
+
+	if !assembled.Success() {
+		t.Fatalf(
+			"Disassembly failed to assemble\n%s\n%s",
+			assembled.Errors[0],
+			disassembly,
+		)
+	}
+
+	for addr, have := range assembled.Memory {
+		if want := memory[addr]; have != want {
+			t.Fatalf(
+				"Disassembly did not round-trip\n"+
+					"want:%#04x (test.Output[%#04x])\n"+
+					"have:%#04x\n%s",
+				want,
+				addr,
+				have,
+				disassembly,
+			)
+		}
 	}
 }
 
 func testAssemblerFail(t *testing.T, test *failCase) {
 	file := strings.NewReader(test.Input)
 
-	_, errs := assembler.AssembleLC3Source(file, nil)
+	assembled := assembler.AssembleLC3Source(file, test.Options...)
+	errs := append(assembled.Errors, assembled.Warnings...)
 
 	if test.Error == nil {
 		panic("Fail case missing error value")
@@ -199,7 +321,7 @@ func testAssemblerFail(t *testing.T, test *failCase) {
 		)
 	}
 
-	if reflect.TypeOf(errs[0]) != reflect.TypeOf(test.Error) {
+	if !errors.Is(errs[0], test.Error) {
 		t.Fatalf(
 			"%s produced error of incorrect type"+
 				"\nwant:%T (test.Error)\nhave:%T",
@@ -215,6 +337,7 @@ func testSuccess(t *testing.T, tests []testCase) {
 		for _, test := range tests {
 			t.Run(test.Name, func(t *testing.T) {
 				testAssemblerSuccess(t, &test)
+				testDisassemblerRoundTrip(t, &test)
 			})
 		}
 	})
@@ -266,88 +389,88 @@ func TestAdd(t *testing.T) {
 		{
 			Name:  "ADD Bad SR2",
 			Input: `ADD R0, R1, R9`,
-			Error: &assembler.InvalidRegisterError{},
+			Error: assembler.ErrInvalidRegister,
 		},
 		{
 			Name:  "ADD Label SR2",
 			Input: `ADD R0, R1, LABEL`,
-			Error: &assembler.InvalidRegisterError{},
+			Error: assembler.ErrInvalidRegister,
 		},
 		{
 			Name:  "ADD String imm5",
 			Input: `ADD R0, R1, "foo"`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 		{
 			Name:  "ADD Oversized imm5",
 			Input: `ADD R0, R1, #1234`,
-			Error: &assembler.OversizedLiteralError{},
+			Error: assembler.ErrOversizedLiteral,
 		},
 		{
 			Name:  "ADD Oversized imm5",
 			Input: `ADD R0, R1, 0xFF`,
-			Error: &assembler.OversizedLiteralError{},
+			Error: assembler.ErrOversizedLiteral,
 		},
 
 		// SR1
 		{
 			Name:  "ADD Bad SR1",
 			Input: `ADD R0, R9, R2`,
-			Error: &assembler.InvalidRegisterError{},
+			Error: assembler.ErrInvalidRegister,
 		},
 		{
 			Name:  "ADD Label SR1",
 			Input: `ADD R0, LABEL, R2`,
-			Error: &assembler.InvalidRegisterError{},
+			Error: assembler.ErrInvalidRegister,
 		},
 		{
 			Name:  "ADD String SR1",
 			Input: `ADD R0, "foo", R2`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 		{
 			Name:  "ADD Literal SR1",
 			Input: `ADD R0, #1, R2`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 
 		// DR
 		{
 			Name:  "ADD Bad DR",
 			Input: `ADD R9, R1, R2`,
-			Error: &assembler.InvalidRegisterError{},
+			Error: assembler.ErrInvalidRegister,
 		},
 		{
 			Name:  "ADD Label DR",
 			Input: `ADD LABEL, R1, R2`,
-			Error: &assembler.InvalidRegisterError{},
+			Error: assembler.ErrInvalidRegister,
 		},
 		{
 			Name:  "ADD String DR",
 			Input: `ADD "foo", R1, R2`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 		{
 			Name:  "ADD Literal DR",
 			Input: `ADD #1, R1, R2`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 
 		// Misc
 		{
 			Name:  "ADD Bad Argc",
 			Input: `ADD R0, R1, R2, R3`,
-			Error: &assembler.InvalidNumArgumentsError{},
+			Error: assembler.ErrInvalidNumArguments,
 		},
 		{
 			Name:  "ADD Bad Argc",
 			Input: `ADD R0, R1`,
-			Error: &assembler.InvalidNumArgumentsError{},
+			Error: assembler.ErrInvalidNumArguments,
 		},
 		{
 			Name:  "ADD Bad Argc",
 			Input: `ADD R0`,
-			Error: &assembler.InvalidNumArgumentsError{},
+			Error: assembler.ErrInvalidNumArguments,
 		},
 	})
 }
@@ -387,6 +510,13 @@ func TestAnd(t *testing.T) {
 				0x0000: 0b0101_000_001_1_10000,
 			},
 		},
+		{
+			Name:  "AND imm5",
+			Input: `AND R0, R1, 0b10000`,
+			Output: map[uint16]uint16{
+				0x0000: 0b0101_000_001_1_10000,
+			},
+		},
 	})
 
 	testFail(t, []failCase{
@@ -394,88 +524,98 @@ func TestAnd(t *testing.T) {
 		{
 			Name:  "AND Label SR2",
 			Input: `AND R0, R1, LABEL`,
-			Error: &assembler.InvalidRegisterError{},
+			Error: assembler.ErrInvalidRegister,
 		},
 		{
 			Name:  "AND String imm5",
 			Input: `AND R0, R1, "foo"`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 		{
 			Name:  "AND Oversized imm5",
 			Input: `AND R0, R1, #255`,
-			Error: &assembler.OversizedLiteralError{},
+			Error: assembler.ErrOversizedLiteral,
 		},
 		{
 			Name:  "AND Oversized imm5",
 			Input: `AND R0, R1, 0xFF`,
-			Error: &assembler.OversizedLiteralError{},
+			Error: assembler.ErrOversizedLiteral,
+		},
+		{
+			Name:  "AND Oversized imm5",
+			Input: `AND R0, R1, 0b11110000`,
+			Error: assembler.ErrOversizedLiteral,
+		},
+		{
+			Name:  "AND Invalid Binary imm5",
+			Input: `AND R0, R1, 0b012`,
+			Error: assembler.ErrInvalidLiteral,
 		},
 
 		// SR1
 		{
 			Name:  "AND Bad SR1",
 			Input: `AND R0, R9, R2`,
-			Error: &assembler.InvalidRegisterError{},
+			Error: assembler.ErrInvalidRegister,
 		},
 		{
 			Name:  "AND Label SR1",
 			Input: `AND R0, LABEL, R2`,
-			Error: &assembler.InvalidRegisterError{},
+			Error: assembler.ErrInvalidRegister,
 		},
 		{
 			Name:  "AND String SR1",
 			Input: `AND R0, "foo", R2`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 		{
 			Name:  "AND Literal SR1",
 			Input: `AND R0, #1, R2`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 
 		// DR
 		{
 			Name:  "AND Bad DR",
 			Input: `AND R9, R1, R2`,
-			Error: &assembler.InvalidRegisterError{},
+			Error: assembler.ErrInvalidRegister,
 		},
 		{
 			Name:  "AND Label DR",
 			Input: `AND LABEL, R1, R2`,
-			Error: &assembler.InvalidRegisterError{},
+			Error: assembler.ErrInvalidRegister,
 		},
 		{
 			Name:  "AND String DR",
 			Input: `AND "foo", R1, R2`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 		{
 			Name:  "AND Literal DR",
 			Input: `AND #1, R1, R2`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 
 		// Misc
 		{
 			Name:  "AND Bad Argc",
 			Input: `AND R0, R1, R2, R3`,
-			Error: &assembler.InvalidNumArgumentsError{},
+			Error: assembler.ErrInvalidNumArguments,
 		},
 		{
 			Name:  "AND Bad Argc",
 			Input: `AND R0, R1`,
-			Error: &assembler.InvalidNumArgumentsError{},
+			Error: assembler.ErrInvalidNumArguments,
 		},
 		{
 			Name:  "AND Bad Argc",
 			Input: `AND R0`,
-			Error: &assembler.InvalidNumArgumentsError{},
+			Error: assembler.ErrInvalidNumArguments,
 		},
 		{
 			Name:  "AND Bad Argc",
 			Input: `AND`,
-			Error: &assembler.InvalidNumArgumentsError{},
+			Error: assembler.ErrInvalidNumArguments,
 		},
 	})
 }
@@ -554,44 +694,44 @@ func TestBranch(t *testing.T) {
 		{
 			Name:  "BR(nzp) Bad PCoffset9",
 			Input: `LABEL BR FOO`,
-			Error: &assembler.UnknownLabelError{},
+			Error: assembler.ErrUnknownLabel,
 		},
 		{
 			Name:  "BR(nzp) String PCoffset9",
 			Input: `LABEL BR "LABEL"`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 		{
 			Name:  "BR(nzp) Literal PCoffset9",
 			Input: `LABEL BR 0x3000`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 
 		// Misc
 		{
 			Name:  "BR(nzp) Bad Argc",
 			Input: `LABEL BR LABEL FOO`,
-			Error: &assembler.InvalidNumArgumentsError{},
+			Error: assembler.ErrInvalidNumArguments,
 		},
 		{
 			Name:  "BR(nzp) Bad Argc",
 			Input: `LABEL BR`,
-			Error: &assembler.InvalidNumArgumentsError{},
+			Error: assembler.ErrInvalidNumArguments,
 		},
 		{
 			Name:  "BR(nzp) Bad Order",
 			Input: `LABEL BRpnz LABEL`,
-			Error: &assembler.UnknownIdentifierError{},
+			Error: assembler.ErrUnknownIdentifier,
 		},
 		{
 			Name:  "BR(nzp) Bad Order",
 			Input: `LABEL BRznp LABEL`,
-			Error: &assembler.UnknownIdentifierError{},
+			Error: assembler.ErrUnknownIdentifier,
 		},
 		{
 			Name:  "BR(nzp) Bad Order",
 			Input: `LABEL BRnpz LABEL`,
-			Error: &assembler.UnknownIdentifierError{},
+			Error: assembler.ErrUnknownIdentifier,
 		},
 	})
 }
@@ -675,133 +815,133 @@ func TestJump(t *testing.T) {
 		{
 			Name:  "JMP Bad BaseR",
 			Input: `JMP R9`,
-			Error: &assembler.InvalidRegisterError{},
+			Error: assembler.ErrInvalidRegister,
 		},
 		{
 			Name:  "JMP Literal BaseR",
 			Input: `JMP #1`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 		{
 			Name:  "JMP String BaseR",
 			Input: `JMP "foo"`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 
 		// JMP Misc
 		{
 			Name:  "JMP Bad Argc",
 			Input: `JMP R0, R1`,
-			Error: &assembler.InvalidNumArgumentsError{},
+			Error: assembler.ErrInvalidNumArguments,
 		},
 		{
 			Name:  "JMP Bad Argc",
 			Input: `JMP`,
-			Error: &assembler.InvalidNumArgumentsError{},
+			Error: assembler.ErrInvalidNumArguments,
 		},
 
 		// JMPT BaseR
 		{
 			Name:  "JMPT Bad BaseR",
 			Input: `JMPT R9`,
-			Error: &assembler.InvalidRegisterError{},
+			Error: assembler.ErrInvalidRegister,
 		},
 		{
 			Name:  "JMPT Literal BaseR",
 			Input: `JMPT #1`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 		{
 			Name:  "JMPT String BaseR",
 			Input: `JMPT "foo"`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 
 		// JMPT Misc
 		{
 			Name:  "JMPT Bad Argc",
 			Input: `JMPT R0, R1`,
-			Error: &assembler.InvalidNumArgumentsError{},
+			Error: assembler.ErrInvalidNumArguments,
 		},
 		{
 			Name:  "JMPT Bad Argc",
 			Input: `JMPT`,
-			Error: &assembler.InvalidNumArgumentsError{},
+			Error: assembler.ErrInvalidNumArguments,
 		},
 
 		// JSR PCOffset11
 		{
 			Name:  "JSR String PCOffset11",
 			Input: `LABEL JSR "LABEL"`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 		{
 			Name:  "JSR Literal PCOffset11",
 			Input: `LABEL JSR #1`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 		{
 			Name:  "JSR Unknown PCOffset11",
 			Input: `LABEL JSR FOO`,
-			Error: &assembler.UnknownLabelError{},
+			Error: assembler.ErrUnknownLabel,
 		},
 
 		// JSR Misc
 		{
 			Name:  "JSR Bad Argc",
 			Input: `LABEL JSR LABEL, LABEL`,
-			Error: &assembler.InvalidNumArgumentsError{},
+			Error: assembler.ErrInvalidNumArguments,
 		},
 		{
 			Name:  "JSR Bad Argc",
 			Input: `LABEL JSR`,
-			Error: &assembler.InvalidNumArgumentsError{},
+			Error: assembler.ErrInvalidNumArguments,
 		},
 
 		// JSRR BaseR
 		{
 			Name:  "JSRR Bad BaseR",
 			Input: `JSRR R9`,
-			Error: &assembler.InvalidRegisterError{},
+			Error: assembler.ErrInvalidRegister,
 		},
 		{
 			Name:  "JSRR Literal BaseR",
 			Input: `JSRR #1`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 		{
 			Name:  "JSRR String BaseR",
 			Input: `JSRR "R1"`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 
 		// JSRR Misc
 		{
 			Name:  "JSRR Bad Argc",
 			Input: `JSRR R0, R1`,
-			Error: &assembler.InvalidNumArgumentsError{},
+			Error: assembler.ErrInvalidNumArguments,
 		},
 		{
 			Name:  "JSRR Bad Argc",
 			Input: `JSRR`,
-			Error: &assembler.InvalidNumArgumentsError{},
+			Error: assembler.ErrInvalidNumArguments,
 		},
 
 		// RET/RTT/RTI Misc
 		{
 			Name:  "RET Bad Argc",
 			Input: `RET R0`,
-			Error: &assembler.InvalidNumArgumentsError{},
+			Error: assembler.ErrInvalidNumArguments,
 		},
 		{
 			Name:  "RTT Bad Argc",
 			Input: `RTT R0`,
-			Error: &assembler.InvalidNumArgumentsError{},
+			Error: assembler.ErrInvalidNumArguments,
 		},
 		{
 			Name:  "RTI Bad Argc",
 			Input: `RTI R0`,
-			Error: &assembler.InvalidNumArgumentsError{},
+			Error: assembler.ErrInvalidNumArguments,
 		},
 	})
 }
@@ -913,262 +1053,262 @@ func TestLoadStore(t *testing.T) {
 		{
 			Name:  "LD Bad PCoffset9",
 			Input: `LABEL LD R0 FOO`,
-			Error: &assembler.UnknownLabelError{},
+			Error: assembler.ErrUnknownLabel,
 		},
 		{
 			Name:  "LD String PCoffset9",
 			Input: `LABEL LD R0 "LABEL"`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 		{
 			Name:  "LD Literal DR",
 			Input: `LABEL LD R0 0x3000`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 
 		// LD DR
 		{
 			Name:  "LD Bad DR",
 			Input: `LABEL LD R9 LABEL`,
-			Error: &assembler.InvalidRegisterError{},
+			Error: assembler.ErrInvalidRegister,
 		},
 		{
 			Name:  "LD String DR",
 			Input: `LABEL LD "R0" LABEL`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 		{
 			Name:  "LD Literal DR",
 			Input: `LABEL LD #0 LABEL`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 
 		// LDI PCoffset9
 		{
 			Name:  "LDI Bad PCoffset9",
 			Input: `LABEL LDI R0 FOO`,
-			Error: &assembler.UnknownLabelError{},
+			Error: assembler.ErrUnknownLabel,
 		},
 		{
 			Name:  "LDI String PCoffset9",
 			Input: `LABEL LDI R0 "LABEL"`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 		{
 			Name:  "LDI Literal DR",
 			Input: `LABEL LDI R0 0x3000`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 
 		// LDI DR
 		{
 			Name:  "LDI Bad DR",
 			Input: `LABEL LDI R9 LABEL`,
-			Error: &assembler.InvalidRegisterError{},
+			Error: assembler.ErrInvalidRegister,
 		},
 		{
 			Name:  "LDI String DR",
 			Input: `LABEL LDI "R0" LABEL`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 		{
 			Name:  "LDI Literal DR",
 			Input: `LABEL LDI #0 LABEL`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 
 		// LDR offset6
 		{
 			Name:  "LDR String offset6",
 			Input: `LDR R0 R1 "FOO"`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 		{
 			Name:  "LDR Label DR",
 			Input: `LABEL LDR R0 R1 LABEL`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 
 		// LDR BaseR
 		{
 			Name:  "LDR Bad BaseR",
 			Input: `LDR R0 R9 #32`,
-			Error: &assembler.InvalidRegisterError{},
+			Error: assembler.ErrInvalidRegister,
 		},
 		{
 			Name:  "LDR String BaseR",
 			Input: `LDR R0 "R1" #32`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 		{
 			Name:  "LDR Literal DR",
 			Input: `LDR R0 #1 #32`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 
 		// LDR DR
 		{
 			Name:  "LDR Bad BaseR",
 			Input: `LDR R9 R0 #32`,
-			Error: &assembler.InvalidRegisterError{},
+			Error: assembler.ErrInvalidRegister,
 		},
 		{
 			Name:  "LDR String BaseR",
 			Input: `LDR "R0" R1 #32`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 		{
 			Name:  "LDR Literal DR",
 			Input: `LDR #0 R1 #32`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 
 		// LEA PCoffset9
 		{
 			Name:  "LEA Bad PCoffset9",
 			Input: `LABEL LEA R0 FOO`,
-			Error: &assembler.UnknownLabelError{},
+			Error: assembler.ErrUnknownLabel,
 		},
 		{
 			Name:  "LEA String PCoffset9",
 			Input: `LABEL LEA R0 "LABEL"`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 		{
 			Name:  "LEA Literal DR",
 			Input: `LABEL LEA R0 0x3000`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 
 		// LEA DR
 		{
 			Name:  "LEA Bad DR",
 			Input: `LABEL LEA R9 LABEL`,
-			Error: &assembler.InvalidRegisterError{},
+			Error: assembler.ErrInvalidRegister,
 		},
 		{
 			Name:  "LEA String DR",
 			Input: `LABEL LEA "R0" LABEL`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 		{
 			Name:  "LEA Literal DR",
 			Input: `LABEL LEA #0 LABEL`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 
 		// LD PCoffset9
 		{
 			Name:  "LD Bad PCoffset9",
 			Input: `LABEL LD R0 FOO`,
-			Error: &assembler.UnknownLabelError{},
+			Error: assembler.ErrUnknownLabel,
 		},
 		{
 			Name:  "LD String PCoffset9",
 			Input: `LABEL LD R0 "LABEL"`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 		{
 			Name:  "LD Literal DR",
 			Input: `LABEL LD R0 0x3000`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 
 		// ST DR
 		{
 			Name:  "ST Bad DR",
 			Input: `LABEL ST R9 LABEL`,
-			Error: &assembler.InvalidRegisterError{},
+			Error: assembler.ErrInvalidRegister,
 		},
 		{
 			Name:  "ST String DR",
 			Input: `LABEL ST "R0" LABEL`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 		{
 			Name:  "ST Literal DR",
 			Input: `LABEL ST #0 LABEL`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 
 		// STI PCoffset9
 		{
 			Name:  "STI Bad PCoffset9",
 			Input: `LABEL STI R0 FOO`,
-			Error: &assembler.UnknownLabelError{},
+			Error: assembler.ErrUnknownLabel,
 		},
 		{
 			Name:  "STI String PCoffset9",
 			Input: `LABEL STI R0 "LABEL"`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 		{
 			Name:  "STI Literal DR",
 			Input: `LABEL STI R0 0x3000`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 
 		// STI DR
 		{
 			Name:  "STI Bad DR",
 			Input: `LABEL STI R9 LABEL`,
-			Error: &assembler.InvalidRegisterError{},
+			Error: assembler.ErrInvalidRegister,
 		},
 		{
 			Name:  "STI String DR",
 			Input: `LABEL STI "R0" LABEL`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 		{
 			Name:  "STI Literal DR",
 			Input: `LABEL STI #0 LABEL`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 
 		// STR offset6
 		{
 			Name:  "LDR String offset6",
 			Input: `LDR R0 R1 "FOO"`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 		{
 			Name:  "LDR Label DR",
 			Input: `LABEL LDR R0 R1 LABEL`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 
 		// STR BaseR
 		{
 			Name:  "STR Bad BaseR",
 			Input: `STR R0 R9 #32`,
-			Error: &assembler.InvalidRegisterError{},
+			Error: assembler.ErrInvalidRegister,
 		},
 		{
 			Name:  "STR String BaseR",
 			Input: `STR R0 "R1" #32`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 		{
 			Name:  "STR Literal DR",
 			Input: `STR R0 #1 #32`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 
 		// STR DR
 		{
 			Name:  "STR Bad BaseR",
 			Input: `STR R9 R0 #32`,
-			Error: &assembler.InvalidRegisterError{},
+			Error: assembler.ErrInvalidRegister,
 		},
 		{
 			Name:  "STR String BaseR",
 			Input: `STR "R0" R1 #32`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 		{
 			Name:  "STR Literal DR",
 			Input: `STR #0 R1 #32`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 	})
 }
@@ -1192,51 +1332,51 @@ func TestNot(t *testing.T) {
 		{
 			Name:  "NOT Bad SR",
 			Input: `NOT R3, R9`,
-			Error: &assembler.InvalidRegisterError{},
+			Error: assembler.ErrInvalidRegister,
 		},
 		{
 			Name:  "NOT String SR",
 			Input: `NOT R3, "foo"`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 		{
 			Name:  "NOT Literal SR",
 			Input: `NOT R3, #1`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 
 		// DR
 		{
 			Name:  "NOT Bad DR",
 			Input: `NOT R9, R4`,
-			Error: &assembler.InvalidRegisterError{},
+			Error: assembler.ErrInvalidRegister,
 		},
 		{
 			Name:  "NOT String DR",
 			Input: `NOT "foo", R4`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 		{
 			Name:  "NOT Literal DR",
 			Input: `NOT #1, R4`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 
 		// Misc
 		{
 			Name:  "NOT Bad Argc",
 			Input: `NOT R0, R1, R2`,
-			Error: &assembler.InvalidNumArgumentsError{},
+			Error: assembler.ErrInvalidNumArguments,
 		},
 		{
 			Name:  "NOT Bad Argc",
 			Input: `NOT R0`,
-			Error: &assembler.InvalidNumArgumentsError{},
+			Error: assembler.ErrInvalidNumArguments,
 		},
 		{
 			Name:  "NOT Bad Argc",
 			Input: `NOT`,
-			Error: &assembler.InvalidNumArgumentsError{},
+			Error: assembler.ErrInvalidNumArguments,
 		},
 	})
 }
@@ -1253,6 +1393,34 @@ func TestTrap(t *testing.T) {
 				0x0000: 0b1111_0000_00100000,
 			},
 		},
+		{
+			Name:  "TRAP 0x00",
+			Input: `TRAP 0x00`,
+			Output: map[uint16]uint16{
+				0x0000: 0b1111_0000_00000000,
+			},
+		},
+		{
+			Name:  "TRAP 0x01",
+			Input: `TRAP 0x01`,
+			Output: map[uint16]uint16{
+				0x0000: 0b1111_0000_00000001,
+			},
+		},
+		{
+			Name:  "TRAP 0x10",
+			Input: `TRAP 0x10`,
+			Output: map[uint16]uint16{
+				0x0000: 0b1111_0000_00010000,
+			},
+		},
+		{
+			Name:  "TRAP 0x1F",
+			Input: `TRAP 0x1F`,
+			Output: map[uint16]uint16{
+				0x0000: 0b1111_0000_00011111,
+			},
+		},
 
 		// GETC (TRAP 0x20)
 		{
@@ -1314,53 +1482,265 @@ func TestTrap(t *testing.T) {
 		{
 			Name:  "TRAP String trapvect8",
 			Input: `TRAP "foo"`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 		{
 			Name:  "TRAP Bad trapvect8",
 			Input: `TRAP 0x1FF`,
-			Error: &assembler.OversizedLiteralError{},
+			Error: assembler.ErrOversizedLiteral,
+		},
+		{
+			Name:  "TRAP Oversized trapvect8",
+			Input: `TRAP 0x100`,
+			Error: assembler.ErrOversizedLiteral,
+		},
+		{
+			Name:  "TRAP Negative trapvect8",
+			Input: `TRAP #-1`,
+			Error: assembler.ErrInvalidLiteral,
+		},
+		{
+			Name:  "TRAP Negative Unprefixed trapvect8",
+			Input: `TRAP -1`,
+			Error: assembler.ErrUnexpectedCharacter,
 		},
 
 		// Misc
 		{
 			Name:  "TRAP Bad Argc",
 			Input: `TRAP 0x0020 0x0020`,
-			Error: &assembler.InvalidNumArgumentsError{},
+			Error: assembler.ErrInvalidNumArguments,
 		},
 		{
 			Name:  "GETC Bad Argc",
 			Input: `GETC 0x0020`,
-			Error: &assembler.InvalidNumArgumentsError{},
+			Error: assembler.ErrInvalidNumArguments,
 		},
 		{
 			Name:  "OUT Bad Argc",
 			Input: `OUT 0x0020`,
-			Error: &assembler.InvalidNumArgumentsError{},
+			Error: assembler.ErrInvalidNumArguments,
 		},
 		{
 			Name:  "PUTS Bad Argc",
 			Input: `PUTS 0x0020`,
-			Error: &assembler.InvalidNumArgumentsError{},
+			Error: assembler.ErrInvalidNumArguments,
 		},
 		{
 			Name:  "IN Bad Argc",
 			Input: `IN 0x0020`,
-			Error: &assembler.InvalidNumArgumentsError{},
+			Error: assembler.ErrInvalidNumArguments,
 		},
 		{
 			Name:  "PUTSP Bad Argc",
 			Input: `PUTSP 0x0020`,
-			Error: &assembler.InvalidNumArgumentsError{},
+			Error: assembler.ErrInvalidNumArguments,
 		},
 		{
 			Name:  "HALT Bad Argc",
 			Input: `HALT 0x0020`,
-			Error: &assembler.InvalidNumArgumentsError{},
+			Error: assembler.ErrInvalidNumArguments,
+		},
+	})
+}
+
+func TestPseudoInstructions(t *testing.T) {
+	testSuccess(t, []testCase{
+		{
+			Name: "NOP",
+			Input: `
+			NOP
+			RET
+			`,
+			Output: map[uint16]uint16{
+				0x0001: 0b1100_000_111_000000,
+			},
+		},
+		{
+			Name:  "SUB",
+			Input: "SUB R0, R1, R2\nRET",
+			Output: map[uint16]uint16{
+				0x0000: 0b1001_010_010_111111,   // NOT R2, R2
+				0x0001: 0b0001_010_010_1_00001,  // ADD R2, R2, #1
+				0x0002: 0b0001_000_001_0_00_010, // ADD R0, R1, R2
+				0x0003: 0b1100_000_111_000000,
+			},
+			SymTable: &assembler.SymTable{
+				Symbols: map[uint16]int64{
+					0x0000: 0,  // SUB R0, R1, R2
+					0x0003: 15, // RET
+				},
+				Labels: map[uint16]string{},
+			},
+		},
+		{
+			Name:  "SUB Aliased Destination",
+			Input: `SUB R2, R1, R2`,
+			Output: map[uint16]uint16{
+				0x0000: 0b1001_010_010_111111,   // NOT R2, R2
+				0x0001: 0b0001_010_010_1_00001,  // ADD R2, R2, #1
+				0x0002: 0b0001_010_001_0_00_010, // ADD R2, R1, R2
+			},
+		},
+		{
+			Name:  "NEG",
+			Input: `NEG R3, R4`,
+			Output: map[uint16]uint16{
+				0x0000: 0b1001_011_100_111111,  // NOT R3, R4
+				0x0001: 0b0001_011_011_1_00001, // ADD R3, R3, #1
+			},
+		},
+		{
+			Name:  "OR",
+			Input: "LABEL OR R0, R1, R2",
+			Output: map[uint16]uint16{
+				0x0000: 0b1001_001_001_111111,   // NOT R1, R1
+				0x0001: 0b1001_010_010_111111,   // NOT R2, R2
+				0x0002: 0b0101_000_001_0_00_010, // AND R0, R1, R2
+				0x0003: 0b1001_000_000_111111,   // NOT R0, R0
+			},
+			SymTable: &assembler.SymTable{
+				Symbols: map[uint16]int64{
+					0x0000: 0, // LABEL OR R0, R1, R2
+				},
+				Labels: map[uint16]string{
+					0x0000: "LABEL",
+				},
+			},
+		},
+		{
+			Name:  "OR Aliased Destination",
+			Input: `OR R1, R1, R2`,
+			Output: map[uint16]uint16{
+				0x0000: 0b1001_001_001_111111,   // NOT R1, R1
+				0x0001: 0b1001_010_010_111111,   // NOT R2, R2
+				0x0002: 0b0101_001_001_0_00_010, // AND R1, R1, R2
+				0x0003: 0b1001_001_001_111111,   // NOT R1, R1
+			},
+		},
+	})
+
+	testFail(t, []failCase{
+		{
+			Name:  "NOP Operand",
+			Input: `NOP R0`,
+			Error: assembler.ErrInvalidNumArguments,
+		},
+		{
+			Name:  "SUB Two Arguments",
+			Input: `SUB R0, R1`,
+			Error: assembler.ErrInvalidNumArguments,
+		},
+		{
+			Name:  "SUB Literal",
+			Input: `SUB R0, R1, #1`,
+			Error: assembler.ErrInvalidOperand,
+		},
+		{
+			Name:  "NEG Invalid Register",
+			Input: `NEG R8, R0`,
+			Error: assembler.ErrInvalidRegister,
+		},
+		{
+			Name:  "OR Four Arguments",
+			Input: `OR R0, R1, R2, R3`,
+			Error: assembler.ErrInvalidNumArguments,
+		},
+		{
+			Name:  "SUB Aliased Sources",
+			Input: `SUB R0, R1, R1`,
+			Error: assembler.ErrAliasedRegister,
+		},
+		{
+			Name:  "SUB Aliased Operands",
+			Input: `SUB R1, R1, R1`,
+			Error: assembler.ErrAliasedRegister,
+		},
+		{
+			Name:  "OR Aliased Sources",
+			Input: `OR R0, R1, R1`,
+			Error: assembler.ErrAliasedRegister,
 		},
 	})
 }
 
+// Runs each pseudo-instruction expansion, checking the registers it leaves
+// behind, including the source registers modified in place
+func TestPseudoInstructionRegisters(t *testing.T) {
+	for _, test := range []struct {
+		Name   string
+		Input  string
+		Steps  int
+		Before [8]uint16
+		After  [8]uint16
+	}{
+		{
+			Name:   "SUB",
+			Input:  `SUB R0, R1, R2`,
+			Steps:  3,
+			Before: [8]uint16{0, 7, 3},
+			After:  [8]uint16{4, 7, 0xFFFD}, // R2 is left negated
+		},
+		{
+			Name:   "SUB Aliased Destination",
+			Input:  `SUB R2, R1, R2`,
+			Steps:  3,
+			Before: [8]uint16{0, 7, 3},
+			After:  [8]uint16{0, 7, 4},
+		},
+		{
+			Name:   "NEG",
+			Input:  `NEG R0, R1`,
+			Steps:  2,
+			Before: [8]uint16{0, 5},
+			After:  [8]uint16{0xFFFB, 5},
+		},
+		{
+			Name:   "OR",
+			Input:  `OR R0, R1, R2`,
+			Steps:  4,
+			Before: [8]uint16{0, 0b1010, 0b0110},
+			After:  [8]uint16{0b1110, ^uint16(0b1010), ^uint16(0b0110)},
+		},
+		{
+			Name:   "OR Aliased Destination",
+			Input:  `OR R1, R1, R2`,
+			Steps:  4,
+			Before: [8]uint16{0, 0b1010, 0b0110},
+			After:  [8]uint16{0, 0b1110, ^uint16(0b0110)},
+		},
+	} {
+		t.Run(test.Name, func(t *testing.T) {
+			assembled := assembler.AssembleLC3Source(
+				strings.NewReader(".ORIG 0x3000\n" + test.Input),
+			)
+
+			if !assembled.Success() {
+				t.Fatal(assembled.Errors[0])
+			}
+
+			var mc machine.Machine
+
+			mc.State.Reset()
+			copy(mc.State.Memory[:], assembled.Memory)
+			mc.State.Program = 0x3000
+			mc.State.Registers = test.Before
+
+			for i := 0; i < test.Steps; i++ {
+				mc.Step()
+			}
+
+			if have := mc.State.Registers; have != test.After {
+				t.Fatalf(
+					"Register mismatch\nwant:%#04x\nhave:%#04x",
+					test.After,
+					have,
+				)
+			}
+		})
+	}
+}
+
 func TestOrig(t *testing.T) {
 	testSuccess(t, []testCase{
 		{
@@ -1428,21 +1808,21 @@ func TestOrig(t *testing.T) {
 			LABEL
 			.ORIG LABEL
 			`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 		{
 			Name: ".ORIG String Literal",
 			Input: `
 			.ORIG "foo"
 			`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 		{
 			Name: ".ORIG Invalid",
 			Input: `
 			.ORIG #999999999
 			`,
-			Error: &assembler.InvalidLiteralError{},
+			Error: assembler.ErrInvalidLiteral,
 		},
 	})
 }
@@ -1463,6 +1843,13 @@ func TestFill(t *testing.T) {
 				0x0000: 0b0000000000001101,
 			},
 		},
+		{
+			Name:  ".FILL Binary Literal",
+			Input: `.FILL 0b1111000011110000`,
+			Output: map[uint16]uint16{
+				0x0000: 0b1111000011110000,
+			},
+		},
 		{
 			Name: ".FILL Forward Label",
 			Input: `
@@ -1492,10 +1879,118 @@ func TestFill(t *testing.T) {
 	})
 
 	testFail(t, []failCase{
+		{
+			// Binary literals require the leading zero, leaving b0101 a label
+			Name:  ".FILL Short Binary Prefix",
+			Input: `.FILL b0101`,
+			Error: assembler.ErrUnknownLabel,
+		},
 		{
 			Name:  ".FILL String Literal",
 			Input: `.FILL "foo"`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
+		},
+	})
+}
+
+func TestCharacterLiteral(t *testing.T) {
+	testSuccess(t, []testCase{
+		{
+			Name:  ".FILL Character",
+			Input: `.FILL 'A'`,
+			Output: map[uint16]uint16{
+				0x0000: 0x0041,
+			},
+		},
+		{
+			Name: ".FILL Escapes",
+			Input: `
+			.FILL '\n'
+			.FILL '\t'
+			.FILL '\\'
+			.FILL '\''
+			`,
+			Output: map[uint16]uint16{
+				0x0000: 0x000A,
+				0x0001: 0x0009,
+				0x0002: 0x005C,
+				0x0003: 0x0027,
+			},
+		},
+		{
+			Name: ".FILL Separators",
+			Input: `
+			.FILL ' '
+			.FILL ';' ; Comment
+			.FILL ','
+			.FILL '"'
+			`,
+			Output: map[uint16]uint16{
+				0x0000: 0x0020,
+				0x0001: 0x003B,
+				0x0002: 0x002C,
+				0x0003: 0x0022,
+			},
+		},
+		{
+			Name:  "ADD Character",
+			Input: `ADD R0, R1, '\n'`,
+			Output: map[uint16]uint16{
+				0x0000: 0b0001_000_001_1_01010,
+			},
+		},
+		{
+			Name:  "ADD Null Character",
+			Input: `ADD R0, R1, '\0'`,
+			Output: map[uint16]uint16{
+				0x0000: 0b0001_000_001_1_00000,
+			},
+		},
+		{
+			Name:  ".STRINGZ Quote",
+			Input: `.STRINGZ "'"`,
+			Output: map[uint16]uint16{
+				0x0000: 0x0027,
+				0x0001: 0x0000,
+			},
+		},
+	})
+
+	testFail(t, []failCase{
+		{
+			Name:  "ADD Oversized Character",
+			Input: `ADD R0, R1, 'a'`,
+			Error: assembler.ErrOversizedLiteral,
+		},
+		{
+			Name:  "Non-ASCII Character",
+			Input: `.FILL 'é'`,
+			Error: assembler.ErrOversizedCharacter,
+		},
+		{
+			Name:  "Non-ASCII Escape",
+			Input: `.FILL '\u00e9'`,
+			Error: assembler.ErrOversizedCharacter,
+		},
+		{
+			Name:  "Empty Character",
+			Input: `.FILL ''`,
+			Error: assembler.ErrInvalidLiteral,
+		},
+		{
+			Name:  "Multiple Characters",
+			Input: `.FILL 'AB'`,
+			Error: assembler.ErrInvalidLiteral,
+		},
+		{
+			Name:  "Invalid Escape",
+			Input: `.FILL '\q'`,
+			Error: assembler.ErrInvalidLiteral,
+		},
+		{
+			Name:  "Unterminated Character",
+			Input: `.FILL 'A`,
+			Error: assembler.ErrInvalidLiteral,
 		},
 	})
 }
@@ -1503,7 +1998,7 @@ func TestFill(t *testing.T) {
 func TestBlkw(t *testing.T) {
 	testSuccess(t, []testCase{
 		{
-			Name: ".BLKW Literal",
+			Name: ".BLKW Hex Literal",
 			Input: `
 			.BLKW 0x03
 			RET
@@ -1513,7 +2008,7 @@ func TestBlkw(t *testing.T) {
 			},
 		},
 		{
-			Name: ".BLKW Literal",
+			Name: ".BLKW Decimal Literal",
 			Input: `
 			.BLKW #64
 			RET
@@ -1522,22 +2017,87 @@ func TestBlkw(t *testing.T) {
 				64: 0b1100_000_111_000000,
 			},
 		},
+		{
+			Name: ".BLKW Initialiser",
+			Input: `
+			.BLKW #3, 0xFFFF
+			RET
+			`,
+			Output: map[uint16]uint16{
+				0x0000: 0xFFFF,
+				0x0001: 0xFFFF,
+				0x0002: 0xFFFF,
+				0x0003: 0b1100_000_111_000000,
+			},
+		},
+		{
+			Name: ".BLKW Negative Initialiser",
+			Input: `
+			.BLKW 0x02 #-2
+			RET
+			`,
+			Output: map[uint16]uint16{
+				0x0000: 0xFFFE,
+				0x0001: 0xFFFE,
+				0x0002: 0b1100_000_111_000000,
+			},
+		},
+		{
+			Name: ".BLKW Zero Initialiser",
+			Input: `
+			.BLKW #2, #0
+			RET
+			`,
+			Output: map[uint16]uint16{
+				0x0002: 0b1100_000_111_000000,
+			},
+		},
 	})
 
 	testFail(t, []failCase{
 		{
 			Name:  ".BLKW Label",
 			Input: `LABEL .BLKW LABEL`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
+		},
+		{
+			Name:  ".BLKW Three Arguments",
+			Input: `.BLKW #3, 0xFFFF, 0xFFFF`,
+			Error: assembler.ErrInvalidNumArguments,
+		},
+		{
+			Name:  ".BLKW Label Initialiser",
+			Input: `LABEL .BLKW #3, LABEL`,
+			Error: assembler.ErrInvalidOperand,
+		},
+		{
+			Name:  ".BLKW String Initialiser",
+			Input: `.BLKW #3, "foo"`,
+			Error: assembler.ErrInvalidOperand,
 		},
 		{
 			Name:  ".BLKW String",
 			Input: `.BLKW "foo"`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
-	})
-}
-
+		{
+			Name:  ".BLKW Zero Hex",
+			Input: `.BLKW 0x00`,
+			Error: assembler.ErrZeroSizedBlock,
+		},
+		{
+			Name:  ".BLKW Zero Decimal",
+			Input: `.BLKW #0`,
+			Error: assembler.ErrZeroSizedBlock,
+		},
+		{
+			Name:  ".BLKW Oversized Initialiser",
+			Input: ".ORIG 0xFFFE\n.BLKW #5, 1",
+			Error: assembler.ErrOversizedBinary,
+		},
+	})
+}
+
 func TestStringz(t *testing.T) {
 	t.Run(".STRINGZ", func(t *testing.T) {
 		file := strings.NewReader(`
@@ -1545,12 +2105,14 @@ func TestStringz(t *testing.T) {
 		.STRINGZ "Hello World"
 		`)
 
-		result, errs := assembler.AssembleLC3Source(file, nil)
+		assembled := assembler.AssembleLC3Source(file)
 
-		if len(errs) > 0 {
-			t.Fatal(errs[0])
+		if !assembled.Success() {
+			t.Fatal(assembled.Errors[0])
 		}
 
+		result := assembled.Memory
+
 		{
 			want := math.MaxUint16 + 1
 			have := len(result)
@@ -1598,26 +2160,274 @@ func TestStringz(t *testing.T) {
 		}
 	})
 
+	testSuccess(t, []testCase{
+		{
+			Name:  ".STRINGZ Newline Escape",
+			Input: `.STRINGZ "\n"`,
+			Output: map[uint16]uint16{
+				0x0000: 0x000A,
+			},
+		},
+		{
+			Name:  ".STRINGZ Tab Escape",
+			Input: `.STRINGZ "\t"`,
+			Output: map[uint16]uint16{
+				0x0000: 0x0009,
+			},
+		},
+		{
+			Name:  ".STRINGZ Carriage Return Escape",
+			Input: `.STRINGZ "\r"`,
+			Output: map[uint16]uint16{
+				0x0000: 0x000D,
+			},
+		},
+		{
+			Name:  ".STRINGZ Backslash Escape",
+			Input: `.STRINGZ "\\"`,
+			Output: map[uint16]uint16{
+				0x0000: 0x005C,
+			},
+		},
+		{
+			Name:  ".STRINGZ Quote Escape",
+			Input: `.STRINGZ "\""`,
+			Output: map[uint16]uint16{
+				0x0000: 0x0022,
+			},
+		},
+		{
+			Name:  ".STRINGZ Hex Escape",
+			Input: `.STRINGZ "\x41"`,
+			Output: map[uint16]uint16{
+				0x0000: 0x0041,
+			},
+		},
+		{
+			Name:  ".STRINGZ Null Escape",
+			Input: `.STRINGZ "a\0b"`,
+			Output: map[uint16]uint16{
+				0x0000: 0x0061,
+				0x0001: 0x0000,
+				0x0002: 0x0062,
+			},
+		},
+		{
+			Name:  ".STRINGZ Escaped Backslash Before Zero",
+			Input: `.STRINGZ "\\0"`,
+			Output: map[uint16]uint16{
+				0x0000: 0x005C,
+				0x0001: 0x0030,
+			},
+		},
+		{
+			Name:  ".STRINGZ Octal Escape With Leading Zero",
+			Input: `.STRINGZ "\012"`,
+			Output: map[uint16]uint16{
+				0x0000: 0x000A,
+			},
+		},
+		{
+			Name:  ".STRINGZ Octal Escape",
+			Input: `.STRINGZ "\101"`,
+			Output: map[uint16]uint16{
+				0x0000: 0x0041,
+			},
+		},
+		{
+			Name:  ".STRINGZ Mixed Escapes",
+			Input: `.STRINGZ "a\"b\"\n" ; comment`,
+			Output: map[uint16]uint16{
+				0x0000: 0x0061,
+				0x0001: 0x0022,
+				0x0002: 0x0062,
+				0x0003: 0x0022,
+				0x0004: 0x000A,
+			},
+		},
+	})
+
 	testFail(t, []failCase{
 		{
 			Name:  ".STRINGZ Label",
 			Input: `.STRINGZ LABEL`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 		{
 			Name:  ".STRINGZ Literal",
 			Input: `.STRINGZ #16`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 		{
 			Name:  ".STRINGZ Literal",
 			Input: `.STRINGZ 0xFF`,
-			Error: &assembler.InvalidOperandError{},
+			Error: assembler.ErrInvalidOperand,
 		},
 		{
 			Name:  ".STRINGZ Missing Delimiter",
 			Input: `.STRINGZ "foo`,
-			Error: &assembler.InvalidStringError{},
+			Error: assembler.ErrInvalidString,
+		},
+		{
+			Name:  ".STRINGZ Escaped Delimiter",
+			Input: `.STRINGZ "foo\"`,
+			Error: assembler.ErrInvalidString,
+		},
+		{
+			Name:  ".STRINGZ Malformed Escape",
+			Input: `.STRINGZ "\q"`,
+			Error: assembler.ErrInvalidString,
+		},
+		{
+			Name:  ".STRINGZ Empty",
+			Input: `.STRINGZ ""`,
+			Error: assembler.ErrEmptyString,
+		},
+	})
+}
+
+func TestStringzw(t *testing.T) {
+	testSuccess(t, []testCase{
+		{
+			Name: ".STRINGZW Even",
+			Input: `
+			.STRINGZW "AB"
+			RET
+			`,
+			Output: map[uint16]uint16{
+				0x0000: 0x4142,
+				0x0001: 0x0000,
+				0x0002: 0b1100_000_111_000000,
+			},
+		},
+		{
+			Name: ".STRINGZW Odd",
+			Input: `
+			.STRINGZW "ABC"
+			RET
+			`,
+			Output: map[uint16]uint16{
+				0x0000: 0x4142,
+				0x0001: 0x4300,
+				0x0002: 0x0000,
+				0x0003: 0b1100_000_111_000000,
+			},
+		},
+	})
+
+	t.Run(".STRINGZW Empty", func(t *testing.T) {
+		assembled := assembler.AssembleLC3Source(strings.NewReader(`
+		.STRINGZW ""
+		RET
+		`))
+
+		if !assembled.Success() {
+			t.Fatal(assembled.Errors[0])
+		}
+
+		if len(assembled.Warnings) != 1 {
+			t.Fatalf(
+				"Unexpected warnings\nwant:1\nhave:%d", len(assembled.Warnings),
+			)
+		}
+
+		if _, ok := assembled.Warnings[0].(*assembler.EmptyStringWarning); !ok {
+			t.Fatalf(
+				"Unexpected warning type\nwant:%T\nhave:%T",
+				&assembler.EmptyStringWarning{},
+				assembled.Warnings[0],
+			)
+		}
+
+		result := assembled.Memory
+
+		if result[0x0000] != 0 || result[0x0001] != 0b1100_000_111_000000 {
+			t.Fatalf(
+				"Invalid string encoding\nwant:[0x0000 0xc1c0]\nhave:%#04x",
+				result[:2],
+			)
+		}
+	})
+
+	testFail(t, []failCase{
+		{
+			Name:  ".STRINGZW Label",
+			Input: `.STRINGZW LABEL`,
+			Error: assembler.ErrInvalidOperand,
+		},
+		{
+			Name:  ".STRINGZW Literal",
+			Input: `.STRINGZW #16`,
+			Error: assembler.ErrInvalidOperand,
+		},
+	})
+}
+
+func TestAscii(t *testing.T) {
+	testSuccess(t, []testCase{
+		{
+			Name: ".ASCII",
+			Input: `
+			.ASCII "AB"
+			RET
+			`,
+			Output: map[uint16]uint16{
+				0x0000: 0x0041,
+				0x0001: 0x0042,
+				0x0002: 0b1100_000_111_000000,
+			},
+		},
+		{
+			Name: ".ASCII Escape",
+			Input: `
+			.ASCII "\n"
+			RET
+			`,
+			Output: map[uint16]uint16{
+				0x0000: 0x000A,
+				0x0001: 0b1100_000_111_000000,
+			},
+		},
+		{
+			Name: ".ASCIZ",
+			Input: `
+			.ASCIZ "AB"
+			RET
+			`,
+			Output: map[uint16]uint16{
+				0x0000: 0x0041,
+				0x0001: 0x0042,
+				0x0002: 0x0000,
+				0x0003: 0b1100_000_111_000000,
+			},
+		},
+	})
+
+	testFail(t, []failCase{
+		{
+			Name:  ".ASCII Literal",
+			Input: `.ASCII #16`,
+			Error: assembler.ErrInvalidOperand,
+		},
+		{
+			Name:  ".ASCII Missing Delimiter",
+			Input: `.ASCII "foo`,
+			Error: assembler.ErrInvalidString,
+		},
+		{
+			Name:  ".ASCII Empty",
+			Input: `.ASCII ""`,
+			Error: assembler.ErrEmptyString,
+		},
+		{
+			Name:  ".ASCIZ Literal",
+			Input: `.ASCIZ 0xFF`,
+			Error: assembler.ErrInvalidOperand,
+		},
+		{
+			Name:  ".ASCIZ Missing Delimiter",
+			Input: `.ASCIZ "foo`,
+			Error: assembler.ErrInvalidString,
 		},
 	})
 }
@@ -1655,7 +2465,7 @@ func TestEnd(t *testing.T) {
 		{
 			Name:  ".END Bad Argc",
 			Input: `.END foo`,
-			Error: &assembler.InvalidNumArgumentsError{},
+			Error: assembler.ErrInvalidNumArguments,
 		},
 	})
 }
@@ -1704,6 +2514,149 @@ func TestComment(t *testing.T) {
 	})
 }
 
+func TestRegisterAliases(t *testing.T) {
+	aliases := []assembler.AssemblerOption{assembler.WithRegisterAliases()}
+
+	testSuccess(t, []testCase{
+		{
+			Name:  "LDR SP",
+			Input: `LDR R0, SP, #0`,
+			Output: map[uint16]uint16{
+				0x0000: 0b0110_000_110_000000, // LDR R0, R6, #0
+			},
+			Options: aliases,
+		},
+		{
+			Name:  "ADD SP",
+			Input: `add sp, sp, #-1`,
+			Output: map[uint16]uint16{
+				0x0000: 0b0001_110_110_1_11111, // ADD R6, R6, #-1
+			},
+			Options: aliases,
+		},
+		{
+			Name:  "JSRR LR",
+			Input: `JSRR LR`,
+			Output: map[uint16]uint16{
+				0x0000: 0b0100_0_00_111_000000, // JSRR R7
+			},
+			Options: aliases,
+		},
+		{
+			Name:  "STR LR SP",
+			Input: `STR LR, SP, #1`,
+			Output: map[uint16]uint16{
+				0x0000: 0b0111_111_110_000001, // STR R7, R6, #1
+			},
+			Options: aliases,
+		},
+		{
+			Name: "LD SP Label",
+			Input: `
+			LD SP, SP
+			SP .FILL 0xBEEF
+			`,
+			Output: map[uint16]uint16{
+				0x0000: 0b0010_110_000000000, // LD R6, SP
+				0x0001: 0xBEEF,
+			},
+			Options: aliases,
+		},
+		{
+			Name: "BR LR Label",
+			Input: `
+			LR BR LR
+			`,
+			Output: map[uint16]uint16{
+				0x0000: 0b0000_000_111111111, // BR LR
+			},
+			Options: aliases,
+		},
+	})
+
+	testFail(t, []failCase{
+		{
+			Name:  "LDR SP Without Aliases",
+			Input: `LDR R0, SP, #0`,
+			Error: assembler.ErrInvalidRegister,
+		},
+	})
+}
+
+func TestInputCharset(t *testing.T) {
+	utf8 := []assembler.AssemblerOption{
+		assembler.WithInputCharset(assembler.CHARSET_UTF8),
+	}
+
+	testSuccess(t, []testCase{
+		{
+			Name:   "ASCII Comment",
+			Input:  `; Grüße`,
+			Output: make(map[uint16]uint16),
+		},
+		{
+			Name:    "UTF-8 Comment",
+			Input:   `; Grüße`,
+			Output:  make(map[uint16]uint16),
+			Options: utf8,
+		},
+		{
+			Name:  "UTF-8 String",
+			Input: `.STRINGZ "Grüße"`,
+			Output: map[uint16]uint16{
+				0x0000: 'G',
+				0x0001: 'r',
+				0x0002: 'ü',
+				0x0003: 'ß',
+				0x0004: 'e',
+				0x0005: 0,
+			},
+			Options: utf8,
+		},
+		{
+			Name:  "UTF-8 Packed String",
+			Input: `.STRINGZW "ße"`,
+			Output: map[uint16]uint16{
+				0x0000: 'ß'<<8 | 'e',
+				0x0001: 0,
+			},
+			Options: utf8,
+		},
+	})
+
+	testFail(t, []failCase{
+		{
+			Name:  "ASCII String",
+			Input: `.STRINGZ "Grüsse"`,
+			Error: assembler.ErrOversizedCharacter,
+		},
+		{
+			Name:    "UTF-8 Oversized String",
+			Input:   `.STRINGZ "😀"`,
+			Error:   assembler.ErrOversizedCharacter,
+			Options: utf8,
+		},
+		{
+			Name:    "UTF-8 Oversized Packed String",
+			Input:   `.STRINGZW "Āb"`,
+			Error:   assembler.ErrOversizedCharacter,
+			Options: utf8,
+		},
+		{
+			Name:    "UTF-8 Identifier",
+			Input:   `Grüsse`,
+			Error:   assembler.ErrOversizedCharacter,
+			Options: utf8,
+		},
+		{
+			Name:    "UTF-8 Unterminated String",
+			Input:   `.STRINGZ "Grü`,
+			Error:   assembler.ErrInvalidString,
+			Options: utf8,
+		},
+	})
+}
+
 func TestLabel(t *testing.T) {
 	testSuccess(t, []testCase{
 		{
@@ -1756,91 +2709,1580 @@ func TestLabel(t *testing.T) {
 				255: 0b0000_000_100000000,
 			},
 		},
-	})
-
-	testFail(t, []failCase{
-		{
-			Name:  "Invalid Label",
-			Input: `JSR LABEL`,
-			Error: &assembler.UnknownLabelError{},
-		},
 		{
-			Name: "Oversized Label",
+			Name: "Binary Digit Label",
 			Input: `
-			LABEL
-				.BLKW #1024
-				JSR LABEL
+			B1
+				HALT
+				JSR B1
+			b10 .FILL b10
 			`,
-			Error: &assembler.OversizedLabelError{},
+			Output: map[uint16]uint16{
+				0x0000: 0b1111_0000_00100101, // HALT
+				0x0001: 0b0100_1_11111111110, // JSR -(2)
+				0x0002: 0x0002,
+			},
 		},
+	})
+
+	testSuccess(t, []testCase{
 		{
-			Name: "Oversized Label",
+			Name: "Allowed Mnemonic Label",
 			Input: `
-			JSR LABEL
-			.BLKW #1024
-			LABEL
+			ADD ADD R0, R1, R2
+				JSR ADD
 			`,
-			Error: &assembler.OversizedLabelError{},
+			Output: map[uint16]uint16{
+				0x0000: 0b0001_000_001_0_00_010,
+				0x0001: 0b0100_1_11111111110, // JSR -(2)
+			},
+			Options: []assembler.AssemblerOption{
+				assembler.AllowMnemonicLabels(),
+			},
 		},
-	})
-}
-
-func TestProgramSize(t *testing.T) {
-	testFail(t, []failCase{
 		{
-			Name:  "Oversized Binary",
-			Input: `.BLKW 0xFFFF`,
-			Error: &assembler.OversizedBinaryError{},
+			Name:  "Allowed Directive Label",
+			Input: `.ORIG HALT`,
+			Output: map[uint16]uint16{
+				0x0000: 0b1111_0000_00100101,
+			},
+			Options: []assembler.AssemblerOption{
+				assembler.AllowMnemonicLabels(),
+			},
 		},
 		{
-			Name: "Oversized Binary",
+			Name: "Allowed Statement Mnemonic Label",
 			Input: `
-			.ORIG 0xFFFF
-			.BLKW 0x000F
-			RET
+			RET HALT
+				BR RET
 			`,
-			Error: &assembler.OversizedBinaryError{},
-		},
+			Output: map[uint16]uint16{
+				0x0000: 0b1111_0000_00100101,
+				0x0001: 0b0000_000_111111110, // BR -(2)
+			},
+			Options: []assembler.AssemblerOption{
+				assembler.AllowMnemonicLabels(),
+			},
+		},
+	})
+
+	testSuccess(t, []testCase{
+		{
+			Name: "Underscore Label",
+			Input: `
+			_LABEL
+				HALT
+				BR _LABEL
+			`,
+			Output: map[uint16]uint16{
+				0x0000: 0b1111_0000_00100101,
+				0x0001: 0b0000_000_111111110, // BR -(2)
+			},
+			Options: []assembler.AssemblerOption{
+				assembler.AllowUnderscoreLabels(),
+			},
+		},
+	})
+
+	testFail(t, []failCase{
+		{
+			Name:  "Digit Label",
+			Input: `3LABEL ADD R0, R1, R2`,
+			Error: assembler.ErrInvalidLabelName,
+		},
+		{
+			Name:  "Digit Label Only",
+			Input: `3LABEL`,
+			Error: assembler.ErrInvalidLabelName,
+		},
+		{
+			Name:  "Underscore Label",
+			Input: `_LABEL`,
+			Error: assembler.ErrUnderscoreLabel,
+		},
+		{
+			Name:  "Invalid Label",
+			Input: `JSR LABEL`,
+			Error: assembler.ErrUnknownLabel,
+		},
+		{
+			Name:  "Mnemonic Label",
+			Input: `ADD ADD R0, R1, R2`,
+			Error: assembler.ErrMnemonicShadow,
+		},
+		{
+			Name:  "Statement Mnemonic Label",
+			Input: `RET HALT`,
+			Error: assembler.ErrInvalidNumArguments,
+		},
+		{
+			Name:  "Statement Trap Label",
+			Input: `GETC OUT`,
+			Error: assembler.ErrInvalidNumArguments,
+		},
+		{
+			Name:  "Statement Directive Label",
+			Input: `.END HALT`,
+			Error: assembler.ErrInvalidNumArguments,
+		},
+		{
+			Name:  "Directive Label",
+			Input: `.ORIG HALT`,
+			Error: assembler.ErrMnemonicShadow,
+		},
+		{
+			Name:  "JSR Mnemonic Label Reference",
+			Input: `JSR HALT`,
+			Error: assembler.ErrMnemonicLabel,
+		},
+		{
+			Name:  "BR Mnemonic Label Reference",
+			Input: `BR HALT`,
+			Error: assembler.ErrMnemonicLabel,
+		},
+		{
+			Name:  ".FILL Mnemonic Label Reference",
+			Input: `.FILL ADD`,
+			Error: assembler.ErrMnemonicLabel,
+		},
+		{
+			// BR takes a label operand, so is never read as a label itself
+			Name:  "Branch Mnemonic Label",
+			Input: `BR ADD R0, R1, R2`,
+			Error: assembler.ErrInvalidNumArguments,
+			Options: []assembler.AssemblerOption{
+				assembler.AllowMnemonicLabels(),
+			},
+		},
+		{
+			Name: "Oversized Label",
+			Input: `
+			LABEL
+				.BLKW #1024
+				JSR LABEL
+			`,
+			Error: assembler.ErrOversizedLabel,
+		},
+		{
+			Name: "Oversized Label",
+			Input: `
+			JSR LABEL
+			.BLKW #1024
+			LABEL
+			`,
+			Error: assembler.ErrOversizedLabel,
+		},
 	})
 }
 
-func TestSymtable(t *testing.T) {
+func TestMnemonicShadowWarning(t *testing.T) {
+	assembled := assembler.AssembleLC3Source(
+		strings.NewReader(`
+		ADD ADD R0, R1, R2
+			JSR ADD
+		`),
+	)
+
+	if !assembled.Success() {
+		t.Fatalf("Unexpected errors: %v", assembled.Errors)
+	}
+
+	if len(assembled.Warnings) != 1 {
+		t.Fatalf("Expected a single warning, got %v", assembled.Warnings)
+	}
+
+	if _, ok := assembled.Warnings[0].(*assembler.MnemonicShadowWarning); !ok {
+		t.Fatalf(
+			"Expected MnemonicShadowWarning, got %T", assembled.Warnings[0],
+		)
+	}
+
+	result := assembled.Memory
+
+	if result[0x0000] != 0b0001_000_001_0_00_010 ||
+		result[0x0001] != 0b0100_1_11111111110 {
+		t.Fatalf(
+			"Shadowing label was not assembled\n"+
+				"have:%#04x %#04x",
+			result[0x0000],
+			result[0x0001],
+		)
+	}
+}
+
+func TestRedeclaredLabel(t *testing.T) {
+	assembled := assembler.AssembleLC3Source(strings.NewReader(
+		".ORIG 0x3000\nLOOP ADD R0, R0, #1\nBRp LOOP\nHALT\nLOOP RET",
+	))
+
+	if len(assembled.Errors) != 1 {
+		t.Fatalf("Unexpected errors: %v", assembled.Errors)
+	}
+
+	err, ok := assembled.Errors[0].(*assembler.RedeclaredLabelError)
+
+	if !ok {
+		t.Fatalf(
+			"Unexpected error type\nwant:%T\nhave:%T",
+			&assembler.RedeclaredLabelError{},
+			assembled.Errors[0],
+		)
+	}
+
+	if err.Position.Line != 5 || err.FirstPosition.Line != 2 {
+		t.Fatalf(
+			"Invalid positions\nwant:05:01 02:01\nhave:%s %s",
+			err.Position,
+			err.FirstPosition,
+		)
+	}
+
+	want := "05:01: Redeclaration of label 'LOOP'\n\tfirst declared at 02:01"
+
+	if have := err.Error(); have != want {
+		t.Fatalf("Invalid error message\nwant:%q\nhave:%q", want, have)
+	}
+}
+
+func TestUnknownLabelSuggestions(t *testing.T) {
+	for _, test := range []struct {
+		Name  string
+		Input string
+		Want  string
+	}{
+		{
+			"Exact Match",
+			"PRINT RET\nJSR PRINT",
+			"",
+		},
+		{
+			"Single Edit",
+			"PRINT RET\nJSR PRNT",
+			"02:05: Unknown label 'PRNT', did you mean 'PRINT'?",
+		},
+		{
+			"Two Edits",
+			"PRINT RET\nJSR PRT",
+			"02:05: Unknown label 'PRT', did you mean 'PRINT'?",
+		},
+		{
+			"Multiple Candidates",
+			"PRINT RET\nPRINTS RET\nPRINTLN RET\nJSR PRINTX",
+			"04:05: Unknown label 'PRINTX', did you mean 'PRINT', " +
+				"'PRINTLN' or 'PRINTS'?",
+		},
+		{
+			"No Close Match",
+			"PRINT RET\nJSR LOOP",
+			"02:05: Unknown label 'LOOP'",
+		},
+		{
+			"No Labels",
+			"JSR PRNT",
+			"01:05: Unknown label 'PRNT'",
+		},
+		{
+			"Fill",
+			"PRINT RET\n.FILL PRNT",
+			"02:07: Unknown label 'PRNT', did you mean 'PRINT'?",
+		},
+	} {
+		t.Run(test.Name, func(t *testing.T) {
+			assembled := assembler.AssembleLC3Source(
+				strings.NewReader(test.Input),
+			)
+
+			if test.Want == "" {
+				if !assembled.Success() {
+					t.Fatalf("Unexpected errors: %v", assembled.Errors)
+				}
+
+				return
+			}
+
+			if len(assembled.Errors) != 1 {
+				t.Fatalf("Unexpected errors: %v", assembled.Errors)
+			}
+
+			if have := assembled.Errors[0].Error(); have != test.Want {
+				t.Fatalf(
+					"Invalid error message\nwant:%s\nhave:%s", test.Want, have,
+				)
+			}
+		})
+	}
+}
+
+func TestMacro(t *testing.T) {
+	const push = `
+	.MACRO PUSH reg
+	ADD R6, R6, #-1
+	STR reg, R6, #0
+	.ENDM
+	`
+
 	testSuccess(t, []testCase{
+		{
+			Name:   "Definition",
+			Input:  push,
+			Output: make(map[uint16]uint16),
+		},
+		{
+			Name:  "Call",
+			Input: push + `PUSH R0`,
+			Output: map[uint16]uint16{
+				0x0000: 0b0001_110_110_1_11111,
+				0x0001: 0b0111_000_110_000000,
+			},
+		},
+		{
+			Name:  "Multiple Calls",
+			Input: push + "PUSH R0\nPUSH R7",
+			Output: map[uint16]uint16{
+				0x0000: 0b0001_110_110_1_11111,
+				0x0001: 0b0111_000_110_000000,
+				0x0002: 0b0001_110_110_1_11111,
+				0x0003: 0b0111_111_110_000000,
+			},
+		},
+		{
+			Name: "Labeled Call",
+			Input: push + `
+			RET
+			LABEL PUSH R1
+			BRnzp LABEL
+			`,
+			Output: map[uint16]uint16{
+				0x0000: 0b1100_000_111_000000,
+				0x0001: 0b0001_110_110_1_11111,
+				0x0002: 0b0111_001_110_000000,
+				0x0003: 0b0000_111_111111101, // PCoffset9 = -0x3
+			},
+		},
+		{
+			Name: "Nested Call",
+			Input: push + `
+			.MACRO PUSH2 a b
+			PUSH a
+			PUSH b
+			.ENDM
+			PUSH2 R0 R1
+			`,
+			Output: map[uint16]uint16{
+				0x0000: 0b0001_110_110_1_11111,
+				0x0001: 0b0111_000_110_000000,
+				0x0002: 0b0001_110_110_1_11111,
+				0x0003: 0b0111_001_110_000000,
+			},
+		},
+		{
+			Name: "Literal Parameter",
+			Input: `
+			.MACRO INC reg n
+			ADD reg, reg, n
+			.ENDM
+			INC R2 #3
+			`,
+			Output: map[uint16]uint16{
+				0x0000: 0b0001_010_010_1_00011,
+			},
+		},
 		{
 			Name: "Symtable",
 			/*
-				+ 13	.ORIG 0x3000
-				+  7	LABEL1
-				+ 10	TRAP 0x00
-				+  7	LABEL2
-				+ 10	.BLKW #10
-				+  7	LABEL3
-				+  3	RTI
+				+ 16	.MACRO PUSH reg
+				+ 16	ADD R6, R6, #-1
+				+ 16	STR reg, R6, #0
+				+  6	.ENDM
 				----
-				= 57
+				= 54
 			*/
+			Input: (".MACRO PUSH reg\n" +
+				"ADD R6, R6, #-1\n" +
+				"STR reg, R6, #0\n" +
+				".ENDM\n" +
+				"PUSH R0\n" +
+				"RET"),
+			Output: map[uint16]uint16{
+				0x0000: 0b0001_110_110_1_11111,
+				0x0001: 0b0111_000_110_000000,
+				0x0002: 0b1100_000_111_000000,
+			},
+			SymTable: &assembler.SymTable{
+				Symbols: map[uint16]int64{
+					0x0000: 54, // PUSH R0
+					0x0001: 54, // PUSH R0
+					0x0002: 62, // RET
+				},
+				Labels: map[uint16]string{},
+			},
+		},
+	})
+
+	testFail(t, []failCase{
+		{
+			Name:  "Undefined",
+			Input: `PUSH R0`,
+			Error: assembler.ErrUndefinedMacro,
+		},
+		{
+			Name:  "Missing Arguments",
+			Input: push + `PUSH`,
+			Error: assembler.ErrInvalidNumArguments,
+		},
+		{
+			Name:  "Excess Arguments",
+			Input: push + `PUSH R0 R1`,
+			Error: assembler.ErrInvalidNumArguments,
+		},
+		{
+			Name: "Recursive",
+			Input: `
+			.MACRO A
+			B
+			.ENDM
+			.MACRO B
+			A
+			.ENDM
+			A
+			`,
+			Error: assembler.ErrRecursiveMacro,
+		},
+		{
+			Name:  "Redeclared",
+			Input: push + push,
+			Error: assembler.ErrRedeclaredMacro,
+		},
+		{
+			Name:  "Mnemonic Name",
+			Input: ".MACRO ADD reg\nAND reg, reg, #0\n.ENDM",
+			Error: assembler.ErrKeywordMacro,
+		},
+		{
+			Name:  "Directive Name",
+			Input: ".MACRO .fill\nHALT\n.ENDM",
+			Error: assembler.ErrKeywordMacro,
+		},
+		{
+			Name:  "Nested Definition",
+			Input: ".MACRO A\n.MACRO B\n.ENDM",
+			Error: assembler.ErrNestedMacro,
+		},
+		{
+			Name:  "Unterminated",
+			Input: ".MACRO A\nRET",
+			Error: assembler.ErrUnterminatedMacro,
+		},
+		{
+			Name:  "Unexpected .ENDM",
+			Input: `.ENDM`,
+			Error: assembler.ErrUnexpectedMacroEnd,
+		},
+		{
+			Name:  "Missing Name",
+			Input: `.MACRO`,
+			Error: assembler.ErrInvalidNumArguments,
+		},
+	})
+}
+
+func TestConstant(t *testing.T) {
+	testSuccess(t, []testCase{
+		{
+			Name: ".EQU Literal",
+			Input: `
+			.EQU MAXLEN #64
+			.FILL MAXLEN
+			`,
+			Output: map[uint16]uint16{
+				0x0000: 0x0040,
+			},
+		},
+		{
+			Name: ".EQU Operand",
+			Input: `
+			.EQU STEP #-1
+			.EQU MASK x0F
+			ADD R0, R0, STEP
+			AND R1, R1, MASK
+			`,
+			Output: map[uint16]uint16{
+				0x0000: 0b0001_000_000_1_11111,
+				0x0001: 0b0101_001_001_1_01111,
+			},
+		},
+		{
+			Name: ".EQU Constant",
+			Input: `
+			.EQU A #1
+			.EQU B A
+			.FILL B
+			`,
+			Output: map[uint16]uint16{
+				0x0000: 0x0001,
+			},
+		},
+		{
+			Name: ".SET Redefinition",
+			Input: `
+			.SET COUNT #1
+			.FILL COUNT
+			.SET COUNT #2
+			.FILL COUNT
+			`,
+			Output: map[uint16]uint16{
+				0x0000: 0x0001,
+				0x0001: 0x0002,
+			},
+		},
+		{
+			Name: "Symtable",
 			Input: (".ORIG 0x3000\n" +
-				"LABEL1\n" +
-				"TRAP 0x00\n" +
-				"LABEL2\n" +
-				".BLKW #10\n" +
-				"LABEL3\n" +
-				"RTI"),
+				".EQU LIMIT x10\n" +
+				"LABEL RET"),
 			Output: map[uint16]uint16{
-				0x3000: 0b1111_0000_00000000,
-				0x300B: 0b1000_000000000000,
+				0x3000: 0b1100_000_111_000000,
 			},
 			SymTable: &assembler.SymTable{
 				Symbols: map[uint16]int64{
-					0x3000: 20, // TRAP
-					0x300B: 54, // RTI
+					0x3000: 28, // LABEL RET
 				},
 				Labels: map[uint16]string{
-					0x3000: "LABEL1",
-					0x3001: "LABEL2",
-					0x300B: "LABEL3",
+					0x3000: "LABEL",
+				},
+				Constants: map[string]uint16{
+					"LIMIT": 0x0010,
 				},
 			},
 		},
 	})
+
+	testFail(t, []failCase{
+		{
+			Name:  ".EQU Oversized imm5",
+			Input: ".EQU LIMIT #64\nADD R0, R0, LIMIT",
+			Error: assembler.ErrOversizedLiteral,
+		},
+		{
+			Name:  ".EQU Redefinition",
+			Input: ".EQU A #1\n.EQU A #2",
+			Error: assembler.ErrRedeclaredLabel,
+		},
+		{
+			Name:  ".EQU Label Redeclaration",
+			Input: ".EQU A #1\nA RET",
+			Error: assembler.ErrRedeclaredLabel,
+		},
+		{
+			Name:  ".EQU Redeclared Label",
+			Input: "A RET\n.EQU A #1",
+			Error: assembler.ErrRedeclaredLabel,
+		},
+		{
+			Name:  ".EQU Missing Value",
+			Input: `.EQU A`,
+			Error: assembler.ErrInvalidNumArguments,
+		},
+		{
+			Name:  ".EQU String Value",
+			Input: `.EQU A "foo"`,
+			Error: assembler.ErrInvalidOperand,
+		},
+		{
+			Name:  ".EQU Literal Name",
+			Input: `.EQU #1 #1`,
+			Error: assembler.ErrInvalidOperand,
+		},
+		{
+			Name:  ".EQU Register Name",
+			Input: `.EQU R1 #1`,
+			Error: assembler.ErrRegisterConstant,
+		},
+		{
+			Name:  ".SET Register Name",
+			Input: `.SET r7 #1`,
+			Error: assembler.ErrRegisterConstant,
+		},
+	})
+}
+
+func TestDefine(t *testing.T) {
+	assembled := assembler.AssembleLC3Source(
+		strings.NewReader(".ORIG 0x3000\n.FILL BUFSIZE\nADD R0, R0, STEP"),
+		assembler.WithDefine("BUFSIZE", "64"),
+		assembler.WithDefine("STEP", "#-2"),
+	)
+
+	if !assembled.Success() {
+		t.Fatalf("Unexpected errors: %v", assembled.Errors)
+	}
+
+	want := []uint16{0x0040, 0x103E}
+
+	if have := assembled.Memory[0x3000:0x3002]; !reflect.DeepEqual(have, want) {
+		t.Fatalf("Invalid output\nwant:%04X\nhave:%04X", want, have)
+	}
+
+	for _, test := range []struct {
+		Name   string
+		Input  string
+		Define [2]string
+		Error  error
+	}{
+		{
+			Name:   "Label Conflict",
+			Input:  ".ORIG 0x3000\nBUFSIZE .FILL #0",
+			Define: [2]string{"BUFSIZE", "64"},
+			Error:  assembler.ErrRedeclaredLabel,
+		},
+		{
+			Name:   ".EQU Conflict",
+			Input:  ".ORIG 0x3000\n.EQU BUFSIZE #32",
+			Define: [2]string{"BUFSIZE", "64"},
+			Error:  assembler.ErrRedeclaredLabel,
+		},
+		{
+			Name:   "Invalid Value",
+			Input:  ".ORIG 0x3000",
+			Define: [2]string{"BUFSIZE", "sixty"},
+			Error:  assembler.ErrInvalidLiteral,
+		},
+		{
+			Name:   "Invalid Name",
+			Input:  ".ORIG 0x3000",
+			Define: [2]string{"1ST", "64"},
+			Error:  assembler.ErrInvalidLabelName,
+		},
+		{
+			Name:   "Mnemonic Name",
+			Input:  ".ORIG 0x3000",
+			Define: [2]string{"ADD", "64"},
+			Error:  assembler.ErrMnemonicLabel,
+		},
+		{
+			Name:   "Register Name",
+			Input:  ".ORIG 0x3000",
+			Define: [2]string{"R1", "64"},
+			Error:  assembler.ErrRegisterConstant,
+		},
+	} {
+		test := test
+		t.Run(test.Name, func(t *testing.T) {
+			assembled := assembler.AssembleLC3Source(
+				strings.NewReader(test.Input),
+				assembler.WithDefine(test.Define[0], test.Define[1]),
+			)
+
+			if len(assembled.Errors) == 0 {
+				t.Fatalf("Expected error %T", test.Error)
+			}
+
+			if !errors.Is(assembled.Errors[0], test.Error) {
+				t.Fatalf(
+					"Invalid error\nwant:%T\nhave:%v",
+					test.Error,
+					assembled.Errors[0],
+				)
+			}
+		})
+	}
+}
+
+func TestProgramSize(t *testing.T) {
+	testSuccess(t, []testCase{
+		{
+			Name:  "Last Address",
+			Input: ".ORIG 0xFFFF\nRET",
+			Output: map[uint16]uint16{
+				0xFFFF: 0b1100_000_111_000000,
+			},
+		},
+		{
+			Name:  "Full Memory",
+			Input: ".BLKW 0xFFFF\nRET",
+			Output: map[uint16]uint16{
+				0xFFFF: 0b1100_000_111_000000,
+			},
+		},
+	})
+
+	testFail(t, []failCase{
+		{
+			Name:  "Oversized Binary",
+			Input: ".BLKW 0xFFFF\n.BLKW #2",
+			Error: assembler.ErrOversizedBinary,
+		},
+		{
+			Name:  "Oversized String",
+			Input: ".ORIG 0xFFFE\n.STRINGZ \"ABC\"",
+			Error: assembler.ErrOversizedBinary,
+		},
+	})
+
+	for _, test := range []struct {
+		Name  string
+		Input string
+		Want  uint32
+	}{
+		{"Past Last Address", ".ORIG 0xFFFF\nRET\nRET", 0x10001},
+		{"Oversized Block", ".ORIG 0xFFFF\n.BLKW 0x000F\nRET", 0x1000E},
+	} {
+		t.Run(test.Name, func(t *testing.T) {
+			assembled := assembler.AssembleLC3Source(strings.NewReader(test.Input))
+
+			if len(assembled.Errors) != 1 {
+				t.Fatalf("Unexpected errors: %v", assembled.Errors)
+			}
+
+			err, ok := assembled.Errors[0].(*assembler.OversizedBinaryError)
+
+			if !ok {
+				t.Fatalf(
+					"Unexpected error type\nwant:%T\nhave:%T",
+					&assembler.OversizedBinaryError{},
+					assembled.Errors[0],
+				)
+			}
+
+			if err.WordsEmitted != test.Want {
+				t.Fatalf(
+					"Invalid word count\nwant:%d\nhave:%d",
+					test.Want,
+					err.WordsEmitted,
+				)
+			}
+		})
+	}
+}
+
+func TestSectionSizes(t *testing.T) {
+	var sizes assembler.SectionSizes
+
+	assembled := assembler.AssembleLC3Source(
+		strings.NewReader(`
+		.ORIG 0x3000
+		LEA R0, MESSAGE
+		PUTS
+		HALT
+		MESSAGE .STRINGZ "Hi"
+		COUNT .FILL #3
+		BUFFER .BLKW #4
+		.STRINGZW "ABC"
+		`),
+		assembler.WithSectionSizes(&sizes),
+	)
+
+	if !assembled.Success() {
+		t.Fatalf("Unexpected errors: %v", assembled.Errors)
+	}
+
+	want := assembler.SectionSizes{Text: 3, Data: 7, Bss: 4}
+
+	if sizes != want {
+		t.Fatalf("Invalid section sizes\nwant:%s\nhave:%s", want, sizes)
+	}
+
+	if have := sizes.String(); have != "text: 3 words (6 bytes), "+
+		"data: 7 words, bss: 4 words, total: 14 words" {
+		t.Fatalf("Invalid section summary: %s", have)
+	}
+}
+
+func TestListing(t *testing.T) {
+	const source = ".ORIG 0x3000\n" +
+		"ADD R0, R1, R2\n" +
+		".BLKW #3\n" +
+		"AND R0, R0, #0 ; clear\n" +
+		".FILL x41\n" +
+		"HALT\n"
+
+	var sections []assembler.Section
+
+	symtable := assembler.SymTable{
+		Symbols: make(map[uint16]int64),
+		Labels:  make(map[uint16]string),
+	}
+
+	input := strings.NewReader(source)
+
+	assembled := assembler.AssembleLC3Source(
+		input,
+		assembler.WithSymTable(&symtable),
+		assembler.WithSections(&sections),
+	)
+
+	if !assembled.Success() {
+		t.Fatalf("Unexpected errors: %v", assembled.Errors)
+	}
+
+	result := assembled.Memory
+
+	var listing bytes.Buffer
+
+	if err := assembler.WriteListing(
+		&listing, result, sections, &symtable, input,
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"0x3000: 0001000001000010  ADD R0, R1, R2",
+		"0x3001-0x3003:  (3 words reserved)",
+		"0x3004: 0101000000100000  AND R0, R0, #0 ; clear",
+		"0x3005: 0000000001000001",
+		"0x3006: 1111000000100101  HALT",
+	}
+
+	have := strings.Split(strings.TrimSuffix(listing.String(), "\n"), "\n")
+
+	if len(have) != len(want) {
+		t.Fatalf("Listing mismatch\nwant:%q\nhave:%q", want, have)
+	}
+
+	for i := range want {
+		if have[i] != want[i] {
+			t.Fatalf(
+				"Listing line mismatch\nwant:%s (line %d)\nhave:%s",
+				want[i],
+				i,
+				have[i],
+			)
+		}
+	}
+}
+
+func TestSymtable(t *testing.T) {
+	testSuccess(t, []testCase{
+		{
+			Name: "Symtable",
+			/*
+				+ 13	.ORIG 0x3000
+				+  7	LABEL1
+				+ 10	TRAP 0x00
+				+  7	LABEL2
+				+ 10	.BLKW #10
+				+  7	LABEL3
+				+  3	RTI
+				----
+				= 57
+			*/
+			Input: (".ORIG 0x3000\n" +
+				"LABEL1\n" +
+				"TRAP 0x00\n" +
+				"LABEL2\n" +
+				".BLKW #10\n" +
+				"LABEL3\n" +
+				"RTI"),
+			Output: map[uint16]uint16{
+				0x3000: 0b1111_0000_00000000,
+				0x300B: 0b1000_000000000000,
+			},
+			SymTable: &assembler.SymTable{
+				Symbols: map[uint16]int64{
+					0x3000: 20, // TRAP
+					0x3001: 37, // .BLKW
+					0x300B: 54, // RTI
+				},
+				Labels: map[uint16]string{
+					0x3000: "LABEL1",
+					0x3001: "LABEL2",
+					0x300B: "LABEL3",
+				},
+			},
+		},
+		{
+			Name: "Symtable CRLF",
+			/*
+				+ 14	.ORIG 0x3000
+				+  8	LABEL1
+				+ 11	TRAP 0x00
+				+  8	LABEL2
+				+ 11	.BLKW #10
+				+  8	LABEL3
+				+  3	RTI
+				----
+				= 63
+			*/
+			Input: (".ORIG 0x3000\r\n" +
+				"LABEL1\r\n" +
+				"TRAP 0x00\r\n" +
+				"LABEL2\r\n" +
+				".BLKW #10\r\n" +
+				"LABEL3\r\n" +
+				"RTI"),
+			Output: map[uint16]uint16{
+				0x3000: 0b1111_0000_00000000,
+				0x300B: 0b1000_000000000000,
+			},
+			SymTable: &assembler.SymTable{
+				Symbols: map[uint16]int64{
+					0x3000: 22, // TRAP
+					0x3001: 41, // .BLKW
+					0x300B: 60, // RTI
+				},
+				Labels: map[uint16]string{
+					0x3000: "LABEL1",
+					0x3001: "LABEL2",
+					0x300B: "LABEL3",
+				},
+			},
+		},
+		{
+			Name: "Source Map",
+			Input: (".ORIG 0x3000\n" +
+				"\tADD R0, R0, #1\n" +
+				"LOOP  BRnzp LOOP\n" +
+				"\n" +
+				"  SUB R0, R1, R2\n" +
+				"\tHALT"),
+			Output: map[uint16]uint16{
+				0x3000: 0b0001_000_000_1_00001,
+				0x3001: 0b0000_111_111111111,
+				0x3002: 0b1001_010_010_111111,
+				0x3003: 0b0001_010_010_1_00001,
+				0x3004: 0b0001_000_001_0_00_010,
+				0x3005: 0b1111_0000_00100101,
+			},
+			SymTable: &assembler.SymTable{
+				Symbols: map[uint16]int64{
+					0x3000: 13,
+					0x3001: 29,
+					0x3002: 47,
+					0x3005: 64,
+				},
+				Labels: map[uint16]string{
+					0x3001: "LOOP",
+				},
+				SourceMap: map[uint16]assembler.Cursor{
+					0x3000: {Line: 2, Column: 2}, // ADD
+					0x3001: {Line: 3, Column: 7}, // BRnzp
+					0x3002: {Line: 5, Column: 3}, // SUB
+					0x3005: {Line: 6, Column: 2}, // HALT
+				},
+			},
+		},
+		{
+			Name: "Symtable Data",
+			/*
+				+ 13	.ORIG 0x3000
+				+  9	.FILL #1
+				+ 14	.STRINGZ "AB"
+				+ 11	.ASCII "C"
+				+  9	.BLKW #2
+				+  4	RET
+			*/
+			Input: (".ORIG 0x3000\n" +
+				".FILL #1\n" +
+				".STRINGZ \"AB\"\n" +
+				".ASCII \"C\"\n" +
+				".BLKW #2\n" +
+				"RET"),
+			Output: map[uint16]uint16{
+				0x3000: 0x0001,
+				0x3001: 'A',
+				0x3002: 'B',
+				0x3004: 'C',
+				0x3007: 0b1100_000_111_000000,
+			},
+			SymTable: &assembler.SymTable{
+				Symbols: map[uint16]int64{
+					0x3000: 13, // .FILL
+					0x3001: 22, // .STRINGZ
+					0x3004: 36, // .ASCII
+					0x3005: 47, // .BLKW
+					0x3007: 56, // RET
+				},
+				Labels: map[uint16]string{},
+			},
+		},
+		{
+			Name: "Source Map Data",
+			Input: (".ORIG x3000\n" +
+				"\tADD R0, R0, #1\n" +
+				"X\t.FILL x5\n" +
+				"Y\t.FILL x6\n" +
+				"\tHALT"),
+			Output: map[uint16]uint16{
+				0x3000: 0b0001_000_000_1_00001,
+				0x3001: 0x0005,
+				0x3002: 0x0006,
+				0x3003: 0b1111_0000_00100101,
+			},
+			SymTable: &assembler.SymTable{
+				Symbols: map[uint16]int64{
+					0x3000: 12, // ADD
+					0x3001: 28, // X .FILL
+					0x3002: 39, // Y .FILL
+					0x3003: 50, // HALT
+				},
+				Labels: map[uint16]string{
+					0x3001: "X",
+					0x3002: "Y",
+				},
+				SourceMap: map[uint16]assembler.Cursor{
+					0x3000: {Line: 2, Column: 2}, // ADD
+					0x3001: {Line: 3, Column: 3}, // .FILL
+					0x3002: {Line: 4, Column: 3}, // .FILL
+					0x3003: {Line: 5, Column: 2}, // HALT
+				},
+			},
+		},
+	})
+}
+
+func TestSymtableUnknownIdentifier(t *testing.T) {
+	var symtable assembler.SymTable
+
+	assembled := assembler.AssembleLC3Source(
+		strings.NewReader(".ORIG x3000\nFOO BAR\n.END\n"),
+		assembler.WithSymTable(&symtable),
+	)
+
+	if len(assembled.Errors) != 1 ||
+		!errors.Is(assembled.Errors[0], assembler.ErrUnknownIdentifier) {
+		t.Fatalf(
+			"Expected a single unknown identifier error, have:%v",
+			assembled.Errors,
+		)
+	}
+
+	if len(symtable.SourceMap) != 0 {
+		t.Fatalf("Unexpected source map entries: %v", symtable.SourceMap)
+	}
+}
+
+func TestFindNearest(t *testing.T) {
+	var symtable assembler.SymTable
+
+	symtable.Labels = map[uint16]string{0x3000: "START"}
+
+	symtable.AddSymbol(0x3010, 30)
+	symtable.AddSymbol(0x3000, 10)
+	symtable.AddSymbol(0x3008, 20)
+
+	for _, test := range []struct {
+		Name  string
+		Addr  uint16
+		Found bool
+		Want  uint16
+		Label string
+	}{
+		{"Below", 0x2FFF, false, 0x0000, ""},
+		{"Exact", 0x3000, true, 0x3000, "START"},
+		{"Between", 0x3002, true, 0x3000, "START"},
+		{"Between Unlabeled", 0x300F, true, 0x3008, ""},
+		{"Above", 0x3100, true, 0x3010, ""},
+	} {
+		t.Run(test.Name, func(t *testing.T) {
+			have, label, found := symtable.FindNearest(test.Addr)
+
+			if found != test.Found || have != test.Want || label != test.Label {
+				t.Fatalf(
+					"Invalid nearest symbol for %#04x"+
+						"\nwant:%#04x %q %t\nhave:%#04x %q %t",
+					test.Addr,
+					test.Want,
+					test.Label,
+					test.Found,
+					have,
+					label,
+					found,
+				)
+			}
+		})
+	}
+}
+
+func TestLookup(t *testing.T) {
+	symtable := assembler.SymTable{
+		Labels: map[uint16]string{0x3000: "START", 0x3008: "LOOP"},
+	}
+
+	t.Run("Known Label", func(t *testing.T) {
+		if addr, ok := symtable.Lookup("LOOP"); !ok || addr != 0x3008 {
+			t.Fatalf("Invalid lookup\nwant:0x3008 true\nhave:%#04x %t", addr, ok)
+		}
+	})
+
+	t.Run("Unknown Label", func(t *testing.T) {
+		if addr, ok := symtable.Lookup("MISSING"); ok {
+			t.Fatalf("Unexpected lookup of unknown label: %#04x", addr)
+		}
+
+		if label, ok := symtable.LookupAddr(0x3001); ok {
+			t.Fatalf("Unexpected label at 0x3001: %s", label)
+		}
+	})
+
+	t.Run("Round Trip", func(t *testing.T) {
+		for _, name := range []string{"START", "LOOP"} {
+			addr, _ := symtable.Lookup(name)
+
+			if label, ok := symtable.LookupAddr(addr); !ok || label != name {
+				t.Fatalf("Lookup did not round-trip\nwant:%s\nhave:%s", name, label)
+			}
+		}
+	})
+}
+
+func TestReadSymTable(t *testing.T) {
+	symtable := assembler.SymTable{
+		Source:  "program.asm",
+		Symbols: map[uint16]int64{0x3000: 13, 0x3001: 24},
+		Labels:  map[uint16]string{0x3000: "START"},
+	}
+
+	tests := []struct {
+		Name   string
+		Encode func(io.Writer, interface{}) error
+		Read   func(io.Reader) (*assembler.SymTable, error)
+	}{
+		{
+			"Gob",
+			func(w io.Writer, v interface{}) error {
+				return gob.NewEncoder(w).Encode(v)
+			},
+			assembler.ReadSymTable,
+		},
+		{
+			"JSON",
+			func(w io.Writer, v interface{}) error {
+				return json.NewEncoder(w).Encode(v)
+			},
+			assembler.ReadSymTableJSON,
+		},
+		{
+			"JSON Detected",
+			func(w io.Writer, v interface{}) error {
+				return json.NewEncoder(w).Encode(v)
+			},
+			assembler.ReadSymTable,
+		},
+		{
+			"JSON Decimal",
+			func(w io.Writer, v interface{}) error {
+				_, err := io.WriteString(w, `{"Source": "program.asm",
+					"Symbols": {"12288": 13, "12289": 24},
+					"Labels": {"12288": "START"}}`)
+				return err
+			},
+			assembler.ReadSymTable,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			reader, writer, err := os.Pipe()
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer reader.Close()
+
+			go func() {
+				test.Encode(writer, symtable)
+				writer.Close()
+			}()
+
+			have, err := test.Read(reader)
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if have.Labels[0x3000] != "START" {
+				t.Fatalf(
+					"Label mismatch\nwant:START\nhave:%q", have.Labels[0x3000],
+				)
+			}
+
+			if !reflect.DeepEqual(have.Symbols, symtable.Symbols) ||
+				have.Source != symtable.Source {
+				t.Fatalf(
+					"Symbol table mismatch\nwant:%+v\nhave:%+v", symtable, *have,
+				)
+			}
+		})
+	}
+}
+
+func TestSymTableJSON(t *testing.T) {
+	symtable := assembler.SymTable{
+		Source:    "program.asm",
+		Symbols:   map[uint16]int64{0x3000: 13},
+		Labels:    map[uint16]string{0x3000: "START"},
+		SourceMap: map[uint16]assembler.Cursor{0x3000: {Line: 2, Column: 1}},
+	}
+
+	data, err := json.Marshal(symtable)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := `{"source":"program.asm","symbols":{"0x3000":13},` +
+		`"labels":{"0x3000":"START"},"sourceMap":{"0x3000":{"line":2,` +
+		`"column":1,"byte":0,"size":0,"lineByte":0}}}`
+
+	if string(data) != want {
+		t.Fatalf("JSON mismatch\nwant:%s\nhave:%s", want, data)
+	}
+
+	var have assembler.SymTable
+
+	if err := json.Unmarshal(data, &have); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(have, symtable) {
+		t.Fatalf("Round trip mismatch\nwant:%+v\nhave:%+v", symtable, have)
+	}
+
+	if err := json.Unmarshal(
+		[]byte(`{"labels":{"LOOP":"LOOP"}}`), &have,
+	); err == nil {
+		t.Fatal("Expected error for invalid address")
+	}
+}
+
+func TestSymTableWriteTo(t *testing.T) {
+	symtable := assembler.SymTable{
+		Labels: map[uint16]string{0x3004: "LOOP", 0x3000: "START"},
+	}
+
+	for _, test := range []struct {
+		Name     string
+		Format   string
+		SymTable assembler.SymTable
+		Want     string
+	}{
+		{"Text", "text", symtable, "START  0x3000\nLOOP   0x3004\n"},
+		{"CSV", "csv", symtable, "label,address\nSTART,0x3000\nLOOP,0x3004\n"},
+		{
+			"JSON", "json", symtable,
+			`{"source":"","symbols":{},"labels":{"0x3000":"START",` +
+				`"0x3004":"LOOP"}}` + "\n",
+		},
+		{"Empty Text", "text", assembler.SymTable{}, ""},
+		{"Empty CSV", "csv", assembler.SymTable{}, "label,address\n"},
+		{
+			"Empty JSON", "json", assembler.SymTable{},
+			`{"source":"","symbols":{},"labels":{}}` + "\n",
+		},
+	} {
+		t.Run(test.Name, func(t *testing.T) {
+			var buffer bytes.Buffer
+
+			if err := test.SymTable.WriteTo(&buffer, test.Format); err != nil {
+				t.Fatal(err)
+			}
+
+			if have := buffer.String(); have != test.Want {
+				t.Fatalf("Output mismatch\nwant:%q\nhave:%q", test.Want, have)
+			}
+		})
+	}
+
+	t.Run("Unknown Format", func(t *testing.T) {
+		err := symtable.WriteTo(io.Discard, "xml")
+
+		if _, ok := err.(*assembler.UnknownSymTableFormatError); !ok {
+			t.Fatalf(
+				"Unexpected error type\nwant:%T\nhave:%T",
+				&assembler.UnknownSymTableFormatError{},
+				err,
+			)
+		}
+	})
+
+	t.Run("Text Round Trip", func(t *testing.T) {
+		var buffer bytes.Buffer
+
+		if err := symtable.WriteTo(&buffer, "text"); err != nil {
+			t.Fatal(err)
+		}
+
+		have, err := assembler.ReadSymTableText(&buffer)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !reflect.DeepEqual(have.Labels, symtable.Labels) {
+			t.Fatalf(
+				"Label mismatch\nwant:%v\nhave:%v", symtable.Labels, have.Labels,
+			)
+		}
+	})
+
+	t.Run("Invalid Text", func(t *testing.T) {
+		_, err := assembler.ReadSymTableText(
+			strings.NewReader("START  0x3000\nLOOP\n"),
+		)
+
+		if _, ok := err.(*assembler.InvalidSymTableLineError); !ok {
+			t.Fatalf(
+				"Unexpected error type\nwant:%T\nhave:%T",
+				&assembler.InvalidSymTableLineError{},
+				err,
+			)
+		}
+	})
+}
+
+func TestErrorsIs(t *testing.T) {
+	assembled := assembler.AssembleLC3Source(
+		strings.NewReader("JSR MISSING\n.BLKW #0"),
+	)
+
+	if len(assembled.Errors) != 1 || len(assembled.Warnings) != 1 {
+		t.Fatalf(
+			"Unexpected diagnostics\nerrors:%v\nwarnings:%v",
+			assembled.Errors,
+			assembled.Warnings,
+		)
+	}
+
+	err := fmt.Errorf("wrapped: %w", assembled.Errors[0])
+
+	if !errors.Is(err, assembler.ErrUnknownLabel) {
+		t.Fatalf("%v does not match ErrUnknownLabel", err)
+	}
+
+	if errors.Is(err, assembler.ErrRedeclaredLabel) {
+		t.Fatalf("%v matches ErrRedeclaredLabel", err)
+	}
+
+	other := &assembler.UnknownLabelError{Received: "OTHER"}
+
+	if errors.Is(err, other) {
+		t.Fatalf("%v matches %v", err, other)
+	}
+
+	if !errors.Is(assembled.Warnings[0], assembler.ErrZeroSizedBlock) {
+		t.Fatalf("%v does not match ErrZeroSizedBlock", assembled.Warnings[0])
+	}
+
+	var labelErr *assembler.UnknownLabelError
+
+	if !errors.As(err, &labelErr) || labelErr.Received != "MISSING" {
+		t.Fatalf("Unable to extract UnknownLabelError from %v", err)
+	}
+}
+
+func TestTokenize(t *testing.T) {
+	tokens, errs := assembler.Tokenize(".FILL 0xff ; comment")
+
+	if len(errs) != 0 {
+		t.Fatalf("Unexpected errors: %v", errs)
+	}
+
+	if len(tokens) != 2 {
+		t.Fatalf("Token count mismatch\nwant:2\nhave:%d", len(tokens))
+	}
+
+	literal := tokens[1]
+
+	if literal.Type != assembler.TOKEN_LITERAL {
+		t.Fatalf(
+			"Token type mismatch\nwant:%d\nhave:%d",
+			assembler.TOKEN_LITERAL,
+			literal.Type,
+		)
+	}
+
+	if literal.Raw != "0xff" || literal.Value != "0xff" {
+		t.Fatalf(
+			"Token text mismatch\nwant:0xff 0xff\nhave:%s %s",
+			literal.Raw,
+			literal.Value,
+		)
+	}
+
+	if want := "01:07"; literal.Position.String() != want {
+		t.Fatalf(
+			"Token position mismatch\nwant:%s\nhave:%s",
+			want,
+			literal.Position,
+		)
+	}
+}
+
+func TestTokenizeMultibyteEnd(t *testing.T) {
+	opt := assembler.WithInputCharset(assembler.CHARSET_UTF8)
+
+	tokens, errs := assembler.Tokenize(`.STRINGZ "Grüß"`, opt)
+
+	if len(errs) != 0 {
+		t.Fatalf("Unexpected errors: %v", errs)
+	}
+
+	if len(tokens) != 2 || tokens[1].Raw != `"Grüß"` {
+		t.Fatalf("Token mismatch\nwant:[.STRINGZ \"Grüß\"]\nhave:%v", tokens)
+	}
+
+	tokens, errs = assembler.Tokenize(`LABEL Grüß`)
+
+	if len(tokens) != 2 || tokens[1].Raw != "Grüß" {
+		t.Fatalf("Token mismatch\nwant:[LABEL Grüß]\nhave:%v", tokens)
+	}
+
+	if len(errs) == 0 {
+		t.Fatalf("Expected OversizedCharacterError")
+	}
+
+	_, errs = assembler.Tokenize(`.STRINGZ "Grü`, opt)
+
+	if len(errs) != 1 || !errors.Is(errs[0], assembler.ErrInvalidString) {
+		t.Fatalf(
+			"Error mismatch\nwant:%v\nhave:%v",
+			&assembler.InvalidStringError{},
+			errs,
+		)
+	}
+}
+
+func TestCursor(t *testing.T) {
+	t.Run("String", func(t *testing.T) {
+		cursor := assembler.Cursor{Line: 5, Column: 12, Byte: 42, Size: 3}
+
+		if have, want := cursor.String(), "05:12"; have != want {
+			t.Fatalf("Cursor string mismatch\nwant:%s\nhave:%s", want, have)
+		}
+
+		if have, want := cursor.Full(), "05:12 (byte 42, size 3)"; have != want {
+			t.Fatalf("Cursor string mismatch\nwant:%s\nhave:%s", want, have)
+		}
+	})
+
+	t.Run("Contains", func(t *testing.T) {
+		outer := assembler.Cursor{Byte: 10, Size: 10}
+
+		tests := []struct {
+			Name  string
+			Inner assembler.Cursor
+			Want  bool
+		}{
+			{"Identical", assembler.Cursor{Byte: 10, Size: 10}, true},
+			{"Inside", assembler.Cursor{Byte: 12, Size: 4}, true},
+			{"Start Edge", assembler.Cursor{Byte: 10, Size: 0}, true},
+			{"End Edge", assembler.Cursor{Byte: 20, Size: 0}, true},
+			{"Before", assembler.Cursor{Byte: 9, Size: 2}, false},
+			{"After", assembler.Cursor{Byte: 19, Size: 2}, false},
+			{"Surrounding", assembler.Cursor{Byte: 5, Size: 20}, false},
+		}
+
+		for _, test := range tests {
+			t.Run(test.Name, func(t *testing.T) {
+				if have := outer.Contains(test.Inner); have != test.Want {
+					t.Fatalf(
+						"Cursor containment mismatch\nwant:%t\nhave:%t",
+						test.Want,
+						have,
+					)
+				}
+			})
+		}
+	})
+}
+
+func TestDisassemble(t *testing.T) {
+	const source = `
+	.ORIG 0x3000
+	START
+	ADD R0, R1, R2
+	ADD R3, R4, #-16
+	AND R5, R6, R7
+	AND R7, R0, #15
+	BR START
+	BRn START
+	BRz START
+	BRp START
+	BRnz FORWARD
+	BRnp FORWARD
+	BRzp FORWARD
+	BRnzp FORWARD
+	JMP R3
+	JMPT R4
+	RET
+	RTT
+	JSR FORWARD
+	JSRR R5
+	LD R0, DATA
+	LDI R1, DATA
+	LDR R2, R3, #-32
+	LEA R4, DATA
+	NOT R5, R6
+	RTI
+	ST R6, DATA
+	STI R7, DATA
+	STR R0, R1, #31
+	FORWARD
+	TRAP 0x26
+	GETC
+	OUT
+	PUTS
+	IN
+	PUTSP
+	HALT
+	DATA .FILL 0xD000
+	`
+
+	assembled := assembler.AssembleLC3Source(strings.NewReader(source))
+
+	if !assembled.Success() {
+		t.Fatalf("Unexpected errors: %v", assembled.Errors)
+	}
+
+	want := assembled.Memory
+	start, end := assembler.ProgramBounds(want)
+
+	t.Run("Offsets", func(t *testing.T) {
+		disassembly := assembler.Disassemble(
+			want[start:end], uint16(start), nil,
+		)
+
+		lines := strings.Split(disassembly, "\n")
+
+		if have := lines[5]; have != "BR #-5                   ; 0x3004" {
+			t.Fatalf("Invalid offset disassembly: %q", have)
+		}
+
+		if have := lines[35]; have != ".FILL 0xd000             ; 0x3022" {
+			t.Fatalf("Invalid reserved disassembly: %q", have)
+		}
+	})
+}
+
+func TestDisassembleBinary(t *testing.T) {
+	t.Run("Leading Zeros", func(t *testing.T) {
+		have, err := assembler.DisassembleBinary(
+			bytes.NewReader([]byte{0x00, 0x00, 0xF0, 0x25, 0x00, 0x00}),
+			0x3000,
+			nil,
+		)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := assembler.Disassemble([]uint16{0x0000, 0xF025}, 0x3000, nil)
+
+		if have != want {
+			t.Fatalf("Disassembly mismatch\nwant:\n%s\nhave:\n%s", want, have)
+		}
+	})
+
+	t.Run("Odd Size", func(t *testing.T) {
+		_, err := assembler.DisassembleBinary(
+			bytes.NewReader([]byte{0xF0, 0x25, 0x00}), 0x3000, nil,
+		)
+
+		if !errors.Is(err, assembler.ErrOddBinarySize) {
+			t.Fatalf(
+				"Expected error\nwant:%v\nhave:%v", assembler.ErrOddBinarySize, err,
+			)
+		}
+	})
 }
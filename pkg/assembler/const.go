@@ -69,6 +69,13 @@ const (
 	INSTRUCTION_IN
 	INSTRUCTION_PUTSP
 	INSTRUCTION_HALT
+
+	// Pseudo-instructions. SUB and OR modify their source registers in place,
+	// leaving SR2 negated and both SR1 and SR2 complemented respectively
+	INSTRUCTION_NOP // BR #0
+	INSTRUCTION_SUB // NOT SR2, SR2; ADD SR2, SR2, #1; ADD DR, SR1, SR2
+	INSTRUCTION_NEG // NOT DR, SR; ADD DR, DR, #1
+	INSTRUCTION_OR  // NOT SR1, SR1; NOT SR2, SR2; AND DR, SR1, SR2; NOT DR, DR
 )
 
 const (
@@ -77,5 +84,24 @@ const (
 	DIRECTIVE_FILL
 	DIRECTIVE_BLKW
 	DIRECTIVE_STRINGZ
+	DIRECTIVE_STRINGZW
 	DIRECTIVE_END
+	DIRECTIVE_MACRO
+	DIRECTIVE_ENDM
+	DIRECTIVE_EQU
+	DIRECTIVE_SET
+	DIRECTIVE_ASCII
+)
+
+const (
+	SECTION_TEXT SectionType = iota
+	SECTION_DATA
+	SECTION_BSS
+)
+
+const (
+	// Only ASCII characters are permitted
+	CHARSET_ASCII Charset = iota
+	// UTF-8 characters are permitted within strings
+	CHARSET_UTF8
 )
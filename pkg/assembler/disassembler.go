@@ -0,0 +1,273 @@
+// Copyright (C) 2021  Antonio Lassandro
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+
+// You should have received a copy of the GNU General Public License along
+// with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package assembler
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/lassandro/golc3/pkg/encoding"
+)
+
+// Disassembles memory beginning at origin into source which the assembler
+// accepts, one statement per line and each annotated with its address.
+//
+// When symtable is given, labels are declared ahead of the words they address
+// and PC-relative operands are written as the label of their target. Without
+// a symbol table PC-relative operands are written as a base-10 offset (i.e.
+// BR #-3), which is readable but cannot be re-assembled as the assembler only
+// accepts labels. Words which do not encode a valid instruction, or whose
+// target has no label, are written with .FILL
+func Disassemble(memory []uint16, origin uint16, symtable *SymTable) string {
+	var builder strings.Builder
+
+	fmt.Fprintf(&builder, ".ORIG %#04x\n", origin)
+
+	for i, word := range memory {
+		addr := origin + uint16(i)
+
+		if symtable != nil {
+			if label, exists := symtable.Labels[addr]; exists {
+				fmt.Fprintln(&builder, label)
+			}
+		}
+
+		fmt.Fprintf(
+			&builder, "%-24s ; %#04x\n", DisassembleWord(word, addr, symtable),
+			addr,
+		)
+	}
+
+	// A label may address the word following the program, i.e. a label
+	// declared on the last line of the source
+	if end := int(origin) + len(memory); symtable != nil && end <= 0xFFFF {
+		if label, exists := symtable.Labels[uint16(end)]; exists {
+			fmt.Fprintln(&builder, label)
+		}
+	}
+
+	return builder.String()
+}
+
+var ErrOddBinarySize = errors.New("Binary size is not a multiple of two bytes")
+
+// Disassembles a raw big-endian binary loaded at origin. Leading zero words are
+// kept as they may be part of the program, trailing zero words are omitted
+func DisassembleBinary(
+	input io.Reader, origin uint16, symtable *SymTable,
+) (string, error) {
+	data, err := io.ReadAll(input)
+
+	if err != nil {
+		return "", err
+	}
+
+	if len(data)%2 != 0 {
+		return "", fmt.Errorf("%w (%d bytes)", ErrOddBinarySize, len(data))
+	}
+
+	memory := make([]uint16, len(data)/2)
+
+	if err := binary.Read(
+		bytes.NewReader(data), binary.BigEndian, memory,
+	); err != nil {
+		return "", err
+	}
+
+	_, end := ProgramBounds(memory)
+
+	return Disassemble(memory[:end], origin, symtable), nil
+}
+
+// Disassembles a single word at addr into a statement as written by
+// Disassemble, without its label or annotation
+func DisassembleWord(word, addr uint16, symtable *SymTable) string {
+	statement, ok := disassembleWord(word, addr, symtable)
+
+	if !ok {
+		statement = fmt.Sprintf(".FILL %#04x", word)
+	}
+
+	return statement
+}
+
+func disassembleWord(word, addr uint16, symtable *SymTable) (string, bool) {
+	opcode := word >> 12
+	dr := (word >> 9) & 0x7
+	sr := (word >> 6) & 0x7
+
+	// Writes the target of a PC-relative operand, which is a label when a
+	// symbol table is given
+	pcoffset := func(bits uint16) (string, bool) {
+		offset := encoding.SignExtend(word&((1<<bits)-1), bits)
+
+		if symtable == nil {
+			return fmt.Sprintf("#%d", int16(offset)), true
+		}
+
+		label, exists := symtable.Labels[addr+1+offset]
+
+		return label, exists
+	}
+
+	switch opcode {
+	// ADD  |0001    |DR   |SR1  |0|00 |SR2   | Register  addition
+	// ADD  |0001    |DR   |SR1  |1|imm5      | Immediate addition
+	// AND  |0101    |DR   |SR1  |0|00 |SR2   | Register  bitwise
+	// AND  |0101    |DR   |SR1  |1|imm5      | Immediate bitwise
+	case 0b0001, 0b0101:
+		mnemonic := "ADD"
+
+		if opcode == 0b0101 {
+			mnemonic = "AND"
+		}
+
+		if (word>>5)&0x1 == 1 {
+			imm5 := int16(encoding.SignExtend(word&0x1F, 5))
+
+			return fmt.Sprintf("%s R%d, R%d, #%d", mnemonic, dr, sr, imm5), true
+		} else if (word>>3)&0x3 == 0 {
+			return fmt.Sprintf("%s R%d, R%d, R%d", mnemonic, dr, sr, word&0x7), true
+		}
+
+	// BR   |0000    |n|z|p|PCoffset9         | Conditional branch
+	case 0b0000:
+		target, ok := pcoffset(9)
+
+		if !ok {
+			break
+		}
+
+		mnemonic := "BR"
+
+		if dr&0x4 != 0 {
+			mnemonic += "n"
+		}
+
+		if dr&0x2 != 0 {
+			mnemonic += "z"
+		}
+
+		if dr&0x1 != 0 {
+			mnemonic += "p"
+		}
+
+		return fmt.Sprintf("%s %s", mnemonic, target), true
+
+	// JMP  |1100    |000  |BaseR|000000      | Jump
+	// JMPT |1100    |000  |BaseR|000001      | Jump (Clear Privilege)
+	// RET  |1100    |000  |111  |000000      | Return
+	// RTT  |1100    |000  |111  |000001      | Return (Clear Privilege)
+	case 0b1100:
+		if dr != 0 || word&0x3E != 0 {
+			break
+		}
+
+		switch {
+		case word&0x1 == 0 && sr == 7:
+			return "RET", true
+		case word&0x1 == 0:
+			return fmt.Sprintf("JMP R%d", sr), true
+		case sr == 7:
+			return "RTT", true
+		default:
+			return fmt.Sprintf("JMPT R%d", sr), true
+		}
+
+	// JSR  |0100    |1|PCoffset11            | Jump to subroutine
+	// JSRR |0100    |0|00 |BaseR|000000      | Jump to subroutine register
+	case 0b0100:
+		if (word>>11)&0x1 == 1 {
+			if target, ok := pcoffset(11); ok {
+				return fmt.Sprintf("JSR %s", target), true
+			}
+		} else if (word>>9)&0x3 == 0 && word&0x3F == 0 {
+			return fmt.Sprintf("JSRR R%d", sr), true
+		}
+
+	// LD   |0010    |DR   |PCoffset9         | Load
+	// LDI  |1010    |DR   |PCoffset9         | Load indirect
+	// ST   |0011    |SR   |PCoffset9         | Store
+	// STI  |1011    |SR   |PCoffset9         | Store indirect
+	// LEA  |1110    |DR   |PCoffset9         | Load effective address
+	case 0b0010, 0b1010, 0b0011, 0b1011, 0b1110:
+		mnemonic := map[uint16]string{
+			0b0010: "LD",
+			0b1010: "LDI",
+			0b0011: "ST",
+			0b1011: "STI",
+			0b1110: "LEA",
+		}[opcode]
+
+		if target, ok := pcoffset(9); ok {
+			return fmt.Sprintf("%s R%d, %s", mnemonic, dr, target), true
+		}
+
+	// LDR  |0110    |DR   |BaseR|offset6     | Load base+offset
+	// STR  |0111    |SR   |BaseR|offset6     | Store base+offset
+	case 0b0110, 0b0111:
+		mnemonic := "LDR"
+
+		if opcode == 0b0111 {
+			mnemonic = "STR"
+		}
+
+		offset6 := int16(encoding.SignExtend(word&0x3F, 6))
+
+		return fmt.Sprintf("%s R%d, R%d, #%d", mnemonic, dr, sr, offset6), true
+
+	// NOT  |1001    |DR   |SR   |111111      | Bitwise complement
+	case 0b1001:
+		if word&0x3F == 0x3F {
+			return fmt.Sprintf("NOT R%d, R%d", dr, sr), true
+		}
+
+	// RTI  |1000    |000000000000            | Return from interrupt
+	case 0b1000:
+		if word&0xFFF == 0 {
+			return "RTI", true
+		}
+
+	// TRAP |1111    |0000   |trapvect8       | Trap
+	case 0b1111:
+		if (word>>8)&0xF != 0 {
+			break
+		}
+
+		switch vector := word & 0xFF; vector {
+		case 0x20:
+			return "GETC", true
+		case 0x21:
+			return "OUT", true
+		case 0x22:
+			return "PUTS", true
+		case 0x23:
+			return "IN", true
+		case 0x24:
+			return "PUTSP", true
+		case 0x25:
+			return "HALT", true
+		default:
+			return fmt.Sprintf("TRAP %#02x", vector), true
+		}
+	}
+
+	return "", false
+}
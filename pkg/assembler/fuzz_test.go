@@ -0,0 +1,143 @@
+// Copyright (C) 2021  Antonio Lassandro
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+
+// You should have received a copy of the GNU General Public License along
+// with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+//go:build go1.18
+// +build go1.18
+
+package assembler_test
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lassandro/golc3/pkg/assembler"
+)
+
+// Longest an input may take to assemble before it is considered to never
+// return
+const fuzzTimeout = 5 * time.Second
+
+// Returns the Input of every test case in assembler_test.go, along with the
+// example programs in etc/
+func fuzzSeeds(f *testing.F) []string {
+	var seeds []string
+
+	file, err := parser.ParseFile(
+		token.NewFileSet(), "assembler_test.go", nil, 0,
+	)
+
+	if err != nil {
+		f.Fatal(err)
+	}
+
+	ast.Inspect(file, func(node ast.Node) bool {
+		field, ok := node.(*ast.KeyValueExpr)
+
+		if !ok {
+			return true
+		}
+
+		if key, ok := field.Key.(*ast.Ident); !ok || key.Name != "Input" {
+			return true
+		}
+
+		lit, ok := field.Value.(*ast.BasicLit)
+
+		if !ok || lit.Kind != token.STRING {
+			return true
+		}
+
+		if input, err := strconv.Unquote(lit.Value); err == nil {
+			seeds = append(seeds, input)
+		}
+
+		return true
+	})
+
+	examples, _ := filepath.Glob("../../etc/*.asm")
+
+	for _, example := range examples {
+		if data, err := os.ReadFile(example); err == nil {
+			seeds = append(seeds, string(data))
+		}
+	}
+
+	return seeds
+}
+
+// Options toggled by each bit of the fuzzed flags, so that the paths taken by
+// golc3-asm flags such as -debug and -sourcemap are also exercised
+var fuzzOptions = []func() assembler.AssemblerOption{
+	func() assembler.AssemblerOption {
+		return assembler.WithSymTable(&assembler.SymTable{})
+	},
+	assembler.AllowMnemonicLabels,
+	assembler.WithRegisterAliases,
+	assembler.AllowUnderscoreLabels,
+	func() assembler.AssemblerOption {
+		return assembler.WithInputCharset(assembler.CHARSET_UTF8)
+	},
+	func() assembler.AssemblerOption {
+		return assembler.WithSectionSizes(&assembler.SectionSizes{})
+	},
+	func() assembler.AssemblerOption {
+		return assembler.WithSections(&[]assembler.Section{})
+	},
+}
+
+func FuzzAssembleLC3Source(f *testing.F) {
+	for _, seed := range fuzzSeeds(f) {
+		f.Add(seed, uint8(0))
+		f.Add(seed, uint8(1<<len(fuzzOptions)-1))
+	}
+
+	f.Fuzz(func(t *testing.T, input string, flags uint8) {
+		var opts []assembler.AssemblerOption
+
+		for i, option := range fuzzOptions {
+			if flags&(1<<i) != 0 {
+				opts = append(opts, option())
+			}
+		}
+
+		done := make(chan assembler.AssemblerResult, 1)
+
+		go func() {
+			done <- assembler.AssembleLC3Source(
+				strings.NewReader(input), opts...,
+			)
+		}()
+
+		select {
+		case assembled := <-done:
+			if assembled.Success() && len(assembled.Memory) != 1<<16 {
+				t.Fatalf(
+					"Invalid buffer length\nwant:%d\nhave:%d",
+					1<<16,
+					len(assembled.Memory),
+				)
+			}
+		case <-time.After(fuzzTimeout):
+			t.Fatalf("Assembling did not return within %s", fuzzTimeout)
+		}
+	})
+}
@@ -24,6 +24,8 @@ type LiteralType uint
 type TokenType uint
 type InstructionType uint
 type DirectiveType uint
+type SectionType uint
+type Charset uint
 
 type Cursor struct {
 	Line     int
@@ -33,22 +35,157 @@ type Cursor struct {
 	LineByte int64
 }
 
+// Formats the cursor as line:column
+func (c Cursor) String() string {
+	return fmt.Sprintf("%02d:%02d", c.Line, c.Column)
+}
+
+// Formats the cursor as line:column, including its byte offset and size
+func (c Cursor) Full() string {
+	return fmt.Sprintf("%s (byte %d, size %d)", c, c.Byte, c.Size)
+}
+
+// Reports whether the byte range of other lies entirely within that of c
+func (c Cursor) Contains(other Cursor) bool {
+	return other.Byte >= c.Byte && other.Byte+other.Size <= c.Byte+c.Size
+}
+
 type Token struct {
 	Type     TokenType
 	Position Cursor
 	Value    string
+
+	// Exact source text of the token, which unlike Value is never normalised
+	Raw string
 }
 
 type SymTable struct {
 	Source string
 	Symbols map[uint16]int64
 	Labels map[uint16]string
+
+	// Position of the instruction assembled at each address, for mapping
+	// addresses back to a line and column of the source file
+	SourceMap map[uint16]Cursor
+
+	// Values of constants declared by .EQU and .SET, kept apart from Labels as
+	// they are not addresses
+	Constants map[string]uint16
+
+	// Sorted keys of Symbols, maintained by AddSymbol
+	sortedKeys []uint16
+}
+
+// Approximate size of each section of an assembled program, in words
+type SectionSizes struct {
+	Text int
+	Data int
+	Bss  int
+}
+
+func (s SectionSizes) Total() int {
+	return s.Text + s.Data + s.Bss
+}
+
+func (s SectionSizes) String() string {
+	return fmt.Sprintf(
+		"text: %d words (%d bytes), data: %d words, bss: %d words, "+
+			"total: %d words",
+		s.Text, s.Text*2, s.Data, s.Bss, s.Total(),
+	)
+}
+
+// A contiguous run of words emitted by a single statement
+type Section struct {
+	Type SectionType
+	Addr uint16
+	Size uint32
+}
+
+type AssemblerOption func(*assemblerConfig)
+
+type assemblerConfig struct {
+	allowMnemonicLabels   bool
+	allowUnderscoreLabels bool
+	registerAliases       bool
+	charset               Charset
+	sectionSizes          *SectionSizes
+	sections              *[]Section
+	symtable              *SymTable
+	defines               []define
+}
+
+// A constant given by WithDefine, as if declared by .EQU before the source
+type define struct {
+	Name  string
+	Value string
+}
+
+// Output of AssembleLC3Source
+type AssemblerResult struct {
+	Memory   []uint16
+	Errors   []error
+	Warnings []error
+
+	// Symbol table given by WithSymTable, or nil if none was given
+	SymTable *SymTable
+
+	// Address given by the first .ORIG, or 0x0000 if there is none
+	Origin uint16
+}
+
+// Reports whether the program assembled without any errors, ignoring warnings
+func (r AssemblerResult) Success() bool {
+	return len(r.Errors) == 0
 }
 
 type TokenError interface {
 	GetPosition() Cursor
 }
 
+// Warnings are reported alongside errors, but do not prevent the program from
+// being assembled
+type Warning interface {
+	error
+	IsWarning() bool
+}
+
+// Zero values of each error type, for use as errors.Is targets. Every error
+// of a given type matches its sentinel regardless of its fields, while other
+// values of the type only match themselves
+var (
+	ErrInvalidOperand        = &InvalidOperandError{}
+	ErrInvalidNumArguments   = &InvalidNumArgumentsError{}
+	ErrOversizedLabel        = &OversizedLabelError{}
+	ErrInvalidLiteral        = &InvalidLiteralError{}
+	ErrInvalidString         = &InvalidStringError{}
+	ErrOversizedLiteral      = &OversizedLiteralError{}
+	ErrInvalidRegister       = &InvalidRegisterError{}
+	ErrAliasedRegister       = &AliasedRegisterError{}
+	ErrUnexpectedCharacter   = &UnexpectedCharacterError{}
+	ErrOversizedCharacter    = &OversizedCharacterError{}
+	ErrRedeclaredLabel       = &RedeclaredLabelError{}
+	ErrUnknownLabel          = &UnknownLabelError{}
+	ErrUnknownIdentifier     = &UnknownIdentifierError{}
+	ErrUndefinedMacro        = &UndefinedMacroError{}
+	ErrRedeclaredMacro       = &RedeclaredMacroError{}
+	ErrKeywordMacro          = &KeywordMacroError{}
+	ErrRecursiveMacro        = &RecursiveMacroError{}
+	ErrNestedMacro           = &NestedMacroError{}
+	ErrUnterminatedMacro     = &UnterminatedMacroError{}
+	ErrUnexpectedMacroEnd    = &UnexpectedMacroEndError{}
+	ErrUnknownSymTableFormat = &UnknownSymTableFormatError{}
+	ErrInvalidSymTableLine   = &InvalidSymTableLineError{}
+	ErrOversizedBinary       = &OversizedBinaryError{}
+	ErrZeroSizedBlock        = &ZeroSizedBlockWarning{}
+	ErrEmptyString           = &EmptyStringWarning{}
+	ErrMnemonicShadow        = &MnemonicShadowWarning{}
+	ErrMnemonicLabel         = &MnemonicLabelError{}
+	ErrInvalidLabelName      = &InvalidLabelNameError{}
+	ErrUnderscoreLabel       = &UnderscoreLabelWarning{}
+	ErrRegisterConstant      = &RegisterConstantError{}
+)
+
 type InvalidOperandError struct {
 	Position Cursor
 	Required []TokenType
@@ -104,14 +241,17 @@ func (err *InvalidOperandError) Error() string {
 	}
 
 	return fmt.Sprintf(
-		"%02d:%02d: Invalid operands\n\twant:%s\n\thave:%s",
-		err.Position.Line,
-		err.Position.Column,
+		"%s: Invalid operands\n\twant:%s\n\thave:%s",
+		err.Position.String(),
 		requiredString,
 		receivedString,
 	)
 }
 
+func (err *InvalidOperandError) Is(target error) bool {
+	return target == ErrInvalidOperand
+}
+
 type InvalidNumArgumentsError struct {
 	Position Cursor
 	Required int
@@ -124,14 +264,17 @@ func (err *InvalidNumArgumentsError) GetPosition() Cursor {
 
 func (err *InvalidNumArgumentsError) Error() string {
 	return fmt.Sprintf(
-		"%02d:%02d: Invalid number of arguments\n\twant:%d\n\thave:%v",
-		err.Position.Line,
-		err.Position.Column,
+		"%s: Invalid number of arguments\n\twant:%d\n\thave:%v",
+		err.Position.String(),
 		err.Required,
 		err.Received,
 	)
 }
 
+func (err *InvalidNumArgumentsError) Is(target error) bool {
+	return target == ErrInvalidNumArguments
+}
+
 type OversizedLabelError struct {
 	Position Cursor
 	Required int64
@@ -144,14 +287,17 @@ func (err *OversizedLabelError) GetPosition() Cursor {
 
 func (err *OversizedLabelError) Error() string {
 	return fmt.Sprintf(
-		"%02d:%02d: Label exceeds allowed distance\n\twant:%d\n\thave:%d",
-		err.Position.Line,
-		err.Position.Column,
+		"%s: Label exceeds allowed distance\n\twant:%d\n\thave:%d",
+		err.Position.String(),
 		err.Required,
 		err.Received,
 	)
 }
 
+func (err *OversizedLabelError) Is(target error) bool {
+	return target == ErrOversizedLabel
+}
+
 type InvalidLiteralError struct {
 	Position Cursor
 }
@@ -162,12 +308,15 @@ func (err *InvalidLiteralError) GetPosition() Cursor {
 
 func (err *InvalidLiteralError) Error() string {
 	return fmt.Sprintf(
-		"%02d:%02d: Invalid numeric literal",
-		err.Position.Line,
-		err.Position.Column,
+		"%s: Invalid numeric literal",
+		err.Position.String(),
 	)
 }
 
+func (err *InvalidLiteralError) Is(target error) bool {
+	return target == ErrInvalidLiteral
+}
+
 type InvalidStringError struct {
 	Position Cursor
 }
@@ -178,12 +327,15 @@ func (err *InvalidStringError) GetPosition() Cursor {
 
 func (err *InvalidStringError) Error() string {
 	return fmt.Sprintf(
-		"%02d:%02d: Invalid string literal",
-		err.Position.Line,
-		err.Position.Column,
+		"%s: Invalid string literal",
+		err.Position.String(),
 	)
 }
 
+func (err *InvalidStringError) Is(target error) bool {
+	return target == ErrInvalidString
+}
+
 type OversizedLiteralError struct {
 	Position Cursor
 	Required interface{}
@@ -196,14 +348,17 @@ func (err *OversizedLiteralError) GetPosition() Cursor {
 
 func (err *OversizedLiteralError) Error() string {
 	return fmt.Sprintf(
-		"%02d:%02d: Literal exceeds allowed size\n\twant:%d\n\thave:%d",
-		err.Position.Line,
-		err.Position.Column,
+		"%s: Literal exceeds allowed size\n\twant:%d\n\thave:%d",
+		err.Position.String(),
 		err.Required,
 		err.Received,
 	)
 }
 
+func (err *OversizedLiteralError) Is(target error) bool {
+	return target == ErrOversizedLiteral
+}
+
 type InvalidRegisterError struct {
 	Position Cursor
 }
@@ -214,12 +369,36 @@ func (err *InvalidRegisterError) GetPosition() Cursor {
 
 func (err *InvalidRegisterError) Error() string {
 	return fmt.Sprintf(
-		"%02d:%02d: Invalid register identifier",
-		err.Position.Line,
-		err.Position.Column,
+		"%s: Invalid register identifier",
+		err.Position.String(),
 	)
 }
 
+func (err *InvalidRegisterError) Is(target error) bool {
+	return target == ErrInvalidRegister
+}
+
+type AliasedRegisterError struct {
+	Position Cursor
+	Received string
+}
+
+func (err *AliasedRegisterError) GetPosition() Cursor {
+	return err.Position
+}
+
+func (err *AliasedRegisterError) Error() string {
+	return fmt.Sprintf(
+		"%s: Source registers of '%s' must be different registers",
+		err.Position.String(),
+		err.Received,
+	)
+}
+
+func (err *AliasedRegisterError) Is(target error) bool {
+	return target == ErrAliasedRegister
+}
+
 type UnexpectedCharacterError struct {
 	Position Cursor
 	Received rune
@@ -231,13 +410,16 @@ func (err *UnexpectedCharacterError) GetPosition() Cursor {
 
 func (err *UnexpectedCharacterError) Error() string {
 	return fmt.Sprintf(
-		"%02d:%02d: Unexpected character %c",
-		err.Position.Line,
-		err.Position.Column,
+		"%s: Unexpected character %c",
+		err.Position.String(),
 		err.Received,
 	)
 }
 
+func (err *UnexpectedCharacterError) Is(target error) bool {
+	return target == ErrUnexpectedCharacter
+}
+
 type OversizedCharacterError struct {
 	Position Cursor
 }
@@ -248,15 +430,19 @@ func (err *OversizedCharacterError) GetPosition() Cursor {
 
 func (err *OversizedCharacterError) Error() string {
 	return fmt.Sprintf(
-		"%02d:%02d: Character exceeds ASCII limit",
-		err.Position.Line,
-		err.Position.Column,
+		"%s: Character exceeds ASCII limit",
+		err.Position.String(),
 	)
 }
 
+func (err *OversizedCharacterError) Is(target error) bool {
+	return target == ErrOversizedCharacter
+}
+
 type RedeclaredLabelError struct {
-	Position Cursor
-	Received string
+	Position      Cursor
+	Received      string
+	FirstPosition Cursor
 }
 
 func (err *RedeclaredLabelError) GetPosition() Cursor {
@@ -265,16 +451,23 @@ func (err *RedeclaredLabelError) GetPosition() Cursor {
 
 func (err *RedeclaredLabelError) Error() string {
 	return fmt.Sprintf(
-		"%02d:%02d: Redeclaration of label '%s'",
-		err.Position.Line,
-		err.Position.Column,
+		"%s: Redeclaration of label '%s'\n\tfirst declared at %s",
+		err.Position.String(),
 		err.Received,
+		err.FirstPosition.String(),
 	)
 }
 
+func (err *RedeclaredLabelError) Is(target error) bool {
+	return target == ErrRedeclaredLabel
+}
+
 type UnknownLabelError struct {
 	Position Cursor
 	Received string
+
+	// Declared labels with similar spellings, in alphabetical order
+	Suggestions []string
 }
 
 func (err *UnknownLabelError) GetPosition() Cursor {
@@ -282,12 +475,34 @@ func (err *UnknownLabelError) GetPosition() Cursor {
 }
 
 func (err *UnknownLabelError) Error() string {
-	return fmt.Sprintf(
-		"%02d:%02d: Unknown label '%s'",
-		err.Position.Line,
-		err.Position.Column,
+	message := fmt.Sprintf(
+		"%s: Unknown label '%s'",
+		err.Position.String(),
 		err.Received,
 	)
+
+	if count := len(err.Suggestions); count > 0 {
+		quoted := make([]string, count)
+
+		for i, suggestion := range err.Suggestions {
+			quoted[i] = "'" + suggestion + "'"
+		}
+
+		candidates := quoted[0]
+
+		if count > 1 {
+			candidates = strings.Join(quoted[:count-1], ", ") + " or " +
+				quoted[count-1]
+		}
+
+		message += fmt.Sprintf(", did you mean %s?", candidates)
+	}
+
+	return message
+}
+
+func (err *UnknownLabelError) Is(target error) bool {
+	return target == ErrUnknownLabel
 }
 
 type UnknownIdentifierError struct {
@@ -301,15 +516,357 @@ func (err *UnknownIdentifierError) GetPosition() Cursor {
 
 func (err *UnknownIdentifierError) Error() string {
 	return fmt.Sprintf(
-		"%02d:%02d: Unknown identifier '%s'",
-		err.Position.Line,
-		err.Position.Column,
+		"%s: Unknown identifier '%s'",
+		err.Position.String(),
+		err.Received,
+	)
+}
+
+func (err *UnknownIdentifierError) Is(target error) bool {
+	return target == ErrUnknownIdentifier
+}
+
+type UndefinedMacroError struct {
+	Position Cursor
+	Received string
+}
+
+func (err *UndefinedMacroError) GetPosition() Cursor {
+	return err.Position
+}
+
+func (err *UndefinedMacroError) Error() string {
+	return fmt.Sprintf(
+		"%s: Undefined macro '%s'",
+		err.Position.String(),
 		err.Received,
 	)
 }
 
-type OversizedBinaryError struct{}
+func (err *UndefinedMacroError) Is(target error) bool {
+	return target == ErrUndefinedMacro
+}
+
+type RedeclaredMacroError struct {
+	Position Cursor
+	Received string
+}
+
+func (err *RedeclaredMacroError) GetPosition() Cursor {
+	return err.Position
+}
+
+func (err *RedeclaredMacroError) Error() string {
+	return fmt.Sprintf(
+		"%s: Redeclaration of macro '%s'",
+		err.Position.String(),
+		err.Received,
+	)
+}
+
+func (err *RedeclaredMacroError) Is(target error) bool {
+	return target == ErrRedeclaredMacro
+}
+
+type KeywordMacroError struct {
+	Position Cursor
+	Received string
+}
+
+func (err *KeywordMacroError) GetPosition() Cursor {
+	return err.Position
+}
+
+func (err *KeywordMacroError) Error() string {
+	return fmt.Sprintf(
+		"%s: Macro '%s' cannot be named after a mnemonic or directive",
+		err.Position.String(),
+		err.Received,
+	)
+}
+
+func (err *KeywordMacroError) Is(target error) bool {
+	return target == ErrKeywordMacro
+}
+
+type RecursiveMacroError struct {
+	Position Cursor
+	Received string
+}
+
+func (err *RecursiveMacroError) GetPosition() Cursor {
+	return err.Position
+}
+
+func (err *RecursiveMacroError) Error() string {
+	return fmt.Sprintf(
+		"%s: Recursive call to macro '%s'",
+		err.Position.String(),
+		err.Received,
+	)
+}
+
+func (err *RecursiveMacroError) Is(target error) bool {
+	return target == ErrRecursiveMacro
+}
+
+type NestedMacroError struct {
+	Position Cursor
+}
+
+func (err *NestedMacroError) GetPosition() Cursor {
+	return err.Position
+}
+
+func (err *NestedMacroError) Error() string {
+	return fmt.Sprintf(
+		"%s: Macros cannot be defined within a macro",
+		err.Position.String(),
+	)
+}
+
+func (err *NestedMacroError) Is(target error) bool {
+	return target == ErrNestedMacro
+}
+
+type UnterminatedMacroError struct {
+	Position Cursor
+	Received string
+}
+
+func (err *UnterminatedMacroError) GetPosition() Cursor {
+	return err.Position
+}
+
+func (err *UnterminatedMacroError) Error() string {
+	return fmt.Sprintf(
+		"%s: Macro '%s' is missing .ENDM",
+		err.Position.String(),
+		err.Received,
+	)
+}
+
+func (err *UnterminatedMacroError) Is(target error) bool {
+	return target == ErrUnterminatedMacro
+}
+
+type UnexpectedMacroEndError struct {
+	Position Cursor
+}
+
+func (err *UnexpectedMacroEndError) GetPosition() Cursor {
+	return err.Position
+}
+
+func (err *UnexpectedMacroEndError) Error() string {
+	return fmt.Sprintf(
+		"%s: .ENDM without matching .MACRO",
+		err.Position.String(),
+	)
+}
+
+func (err *UnexpectedMacroEndError) Is(target error) bool {
+	return target == ErrUnexpectedMacroEnd
+}
+
+type UnknownSymTableFormatError struct {
+	Format string
+}
+
+func (err *UnknownSymTableFormatError) Error() string {
+	return fmt.Sprintf("Unknown symbol table format '%s'", err.Format)
+}
+
+func (err *UnknownSymTableFormatError) Is(target error) bool {
+	return target == ErrUnknownSymTableFormat
+}
+
+type InvalidSymTableLineError struct {
+	Line int
+	Text string
+}
+
+func (err *InvalidSymTableLineError) Error() string {
+	return fmt.Sprintf(
+		"%02d: Invalid symbol table entry '%s'", err.Line, err.Text,
+	)
+}
+
+func (err *InvalidSymTableLineError) Is(target error) bool {
+	return target == ErrInvalidSymTableLine
+}
+
+type OversizedBinaryError struct {
+	WordsEmitted uint32
+}
 
 func (err *OversizedBinaryError) Error() string {
-	return "Binary exceeds allowed size"
+	return fmt.Sprintf(
+		"Binary exceeds allowed size (%d words, emitted %d)",
+		1<<16,
+		err.WordsEmitted,
+	)
+}
+
+func (err *OversizedBinaryError) Is(target error) bool {
+	return target == ErrOversizedBinary
+}
+
+type ZeroSizedBlockWarning struct {
+	Position Cursor
+}
+
+func (err *ZeroSizedBlockWarning) GetPosition() Cursor {
+	return err.Position
+}
+
+func (err *ZeroSizedBlockWarning) IsWarning() bool {
+	return true
+}
+
+func (err *ZeroSizedBlockWarning) Error() string {
+	return fmt.Sprintf(
+		"%s: Block allocates zero words",
+		err.Position.String(),
+	)
+}
+
+func (err *ZeroSizedBlockWarning) Is(target error) bool {
+	return target == ErrZeroSizedBlock
+}
+
+type EmptyStringWarning struct {
+	Position Cursor
+}
+
+func (err *EmptyStringWarning) GetPosition() Cursor {
+	return err.Position
+}
+
+func (err *EmptyStringWarning) IsWarning() bool {
+	return true
+}
+
+func (err *EmptyStringWarning) Error() string {
+	return fmt.Sprintf(
+		"%s: String literal is empty",
+		err.Position.String(),
+	)
+}
+
+func (err *EmptyStringWarning) Is(target error) bool {
+	return target == ErrEmptyString
+}
+
+type MnemonicShadowWarning struct {
+	Position Cursor
+	Received string
+}
+
+func (err *MnemonicShadowWarning) GetPosition() Cursor {
+	return err.Position
+}
+
+func (err *MnemonicShadowWarning) IsWarning() bool {
+	return true
+}
+
+func (err *MnemonicShadowWarning) Error() string {
+	return fmt.Sprintf(
+		"%s: Label '%s' shadows a mnemonic",
+		err.Position.String(),
+		err.Received,
+	)
+}
+
+func (err *MnemonicShadowWarning) Is(target error) bool {
+	return target == ErrMnemonicShadow
+}
+
+type MnemonicLabelError struct {
+	Position Cursor
+	Received string
+}
+
+func (err *MnemonicLabelError) GetPosition() Cursor {
+	return err.Position
+}
+
+func (err *MnemonicLabelError) Error() string {
+	return fmt.Sprintf(
+		"%s: Expected label, found mnemonic '%s'",
+		err.Position.String(),
+		err.Received,
+	)
+}
+
+func (err *MnemonicLabelError) Is(target error) bool {
+	return target == ErrMnemonicLabel
+}
+
+type InvalidLabelNameError struct {
+	Position Cursor
+	Received string
+}
+
+func (err *InvalidLabelNameError) GetPosition() Cursor {
+	return err.Position
+}
+
+func (err *InvalidLabelNameError) Error() string {
+	return fmt.Sprintf(
+		"%s: Label '%s' cannot begin with a digit",
+		err.Position.String(),
+		err.Received,
+	)
+}
+
+func (err *InvalidLabelNameError) Is(target error) bool {
+	return target == ErrInvalidLabelName
+}
+
+type UnderscoreLabelWarning struct {
+	Position Cursor
+	Received string
+}
+
+func (err *UnderscoreLabelWarning) GetPosition() Cursor {
+	return err.Position
+}
+
+func (err *UnderscoreLabelWarning) IsWarning() bool {
+	return true
+}
+
+func (err *UnderscoreLabelWarning) Error() string {
+	return fmt.Sprintf(
+		"%s: Label '%s' begins with an underscore",
+		err.Position.String(),
+		err.Received,
+	)
+}
+
+func (err *UnderscoreLabelWarning) Is(target error) bool {
+	return target == ErrUnderscoreLabel
+}
+
+type RegisterConstantError struct {
+	Position Cursor
+	Received string
+}
+
+func (err *RegisterConstantError) GetPosition() Cursor {
+	return err.Position
+}
+
+func (err *RegisterConstantError) Error() string {
+	return fmt.Sprintf(
+		"%s: Constant '%s' cannot be named after a register",
+		err.Position.String(),
+		err.Received,
+	)
+}
+
+func (err *RegisterConstantError) Is(target error) bool {
+	return target == ErrRegisterConstant
 }
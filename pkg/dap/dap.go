@@ -0,0 +1,638 @@
+// Copyright (C) 2021  Antonio Lassandro
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+
+// You should have received a copy of the GNU General Public License along
+// with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package dap
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/lassandro/golc3/pkg/assembler"
+	"github.com/lassandro/golc3/pkg/debugger"
+	"github.com/lassandro/golc3/pkg/machine"
+)
+
+// The machine has a single thread of execution, reported to clients by id
+const threadId = 1
+
+// Variables reference of the Registers scope, zero is reserved by the protocol
+const registersReference = 1
+
+// Reads the next message, returning its JSON body with the header removed
+func ReadMessage(reader *bufio.Reader) ([]byte, error) {
+	length := -1
+
+	for {
+		line, err := reader.ReadString('\n')
+
+		if err != nil {
+			if err == io.EOF && line != "" {
+				err = io.ErrUnexpectedEOF
+			}
+
+			return nil, err
+		}
+
+		line = strings.TrimRight(line, "\r\n")
+
+		if line == "" {
+			break
+		}
+
+		name, value, found := cut(line, ":")
+
+		if !found {
+			return nil, &InvalidHeaderError{line}
+		}
+
+		if strings.EqualFold(name, "Content-Length") {
+			length, err = strconv.Atoi(strings.TrimSpace(value))
+
+			if err != nil || length < 0 {
+				return nil, &InvalidHeaderError{line}
+			}
+		}
+	}
+
+	if length == -1 {
+		return nil, &InvalidHeaderError{""}
+	}
+
+	body := make([]byte, length)
+
+	if _, err := io.ReadFull(reader, body); err != nil {
+		return nil, err
+	}
+
+	return body, nil
+}
+
+// Writes the message as JSON preceded by its Content-Length header
+func WriteMessage(writer io.Writer, message interface{}) error {
+	body, err := json.Marshal(message)
+
+	if err != nil {
+		return err
+	}
+
+	if _, err := fmt.Fprintf(
+		writer, "Content-Length: %d\r\n\r\n", len(body),
+	); err != nil {
+		return err
+	}
+
+	_, err = writer.Write(body)
+	return err
+}
+
+func cut(s, sep string) (before, after string, found bool) {
+	if i := strings.Index(s, sep); i >= 0 {
+		return s[:i], s[i+len(sep):], true
+	}
+
+	return s, "", false
+}
+
+// Serves a single debug session, running the launched program on a machine
+// with a debugger attached. Requests continue to be handled while the program
+// runs, between steps
+type Server struct {
+	reader *bufio.Reader
+	writer io.Writer
+	seq    int
+
+	mc  *machine.Machine
+	dbg *debugger.Debugger
+
+	// Contents and path of the program's source, used to map lines to
+	// addresses via the symbol table
+	source     []byte
+	sourcePath string
+
+	stopOnEntry bool
+	running     bool
+	stopReason  string
+
+	// Events to send once the response to the current request is sent
+	events []Event
+}
+
+type message struct {
+	request Request
+	err     error
+}
+
+func NewServer(reader io.Reader, writer io.Writer) *Server {
+	return &Server{
+		reader: bufio.NewReader(reader),
+		writer: writer,
+	}
+}
+
+// Handles requests until the client disconnects or the input is closed
+func (s *Server) Serve() error {
+	requests := make(chan message)
+
+	go func() {
+		for {
+			var msg message
+			var body []byte
+
+			if body, msg.err = ReadMessage(s.reader); msg.err == nil {
+				msg.err = json.Unmarshal(body, &msg.request)
+			}
+
+			requests <- msg
+
+			if msg.err != nil {
+				return
+			}
+		}
+	}()
+
+	for {
+		var msg message
+
+		if s.running {
+			select {
+			case msg = <-requests:
+			default:
+				if err := s.step(); err != nil {
+					return err
+				}
+
+				continue
+			}
+		} else {
+			msg = <-requests
+		}
+
+		if msg.err == io.EOF {
+			return nil
+		} else if msg.err != nil {
+			return msg.err
+		}
+
+		if done, err := s.handle(msg.request); err != nil || done {
+			return err
+		}
+	}
+}
+
+func (s *Server) nextSeq() int {
+	s.seq++
+	return s.seq
+}
+
+func (s *Server) queueEvent(event string, body interface{}) {
+	s.events = append(s.events, Event{Type: "event", Event: event, Body: body})
+}
+
+func (s *Server) flushEvents() error {
+	for _, event := range s.events {
+		event.Seq = s.nextSeq()
+
+		if err := WriteMessage(s.writer, &event); err != nil {
+			return err
+		}
+	}
+
+	s.events = s.events[:0]
+	return nil
+}
+
+// Responds to the request, reporting true once the session has ended
+func (s *Server) handle(request Request) (bool, error) {
+	body, err := s.dispatch(request)
+
+	response := Response{
+		Seq:        s.nextSeq(),
+		Type:       "response",
+		RequestSeq: request.Seq,
+		Success:    err == nil,
+		Command:    request.Command,
+		Body:       body,
+	}
+
+	if err != nil {
+		response.Message = err.Error()
+	}
+
+	if err := WriteMessage(s.writer, &response); err != nil {
+		return false, err
+	}
+
+	if err := s.flushEvents(); err != nil {
+		return false, err
+	}
+
+	return request.Command == "disconnect", nil
+}
+
+func (s *Server) dispatch(request Request) (interface{}, error) {
+	switch request.Command {
+	case "initialize":
+		return map[string]bool{
+			"supportsConfigurationDoneRequest": true,
+			"supportsConditionalBreakpoints":   true,
+		}, nil
+
+	case "launch":
+		var args LaunchArguments
+
+		if err := json.Unmarshal(request.Arguments, &args); err != nil {
+			return nil, err
+		}
+
+		return nil, s.launch(args)
+
+	case "disconnect":
+		s.running = false
+		return nil, nil
+	}
+
+	if s.mc == nil {
+		return nil, &NotLaunchedError{request.Command}
+	}
+
+	switch request.Command {
+	case "setBreakpoints":
+		var args SetBreakpointsArguments
+
+		if err := json.Unmarshal(request.Arguments, &args); err != nil {
+			return nil, err
+		}
+
+		breakpoints, err := s.setBreakpoints(args)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return map[string][]Breakpoint{"breakpoints": breakpoints}, nil
+
+	case "configurationDone":
+		if s.stopOnEntry {
+			s.queueEvent("stopped", s.stoppedBody("entry"))
+		} else {
+			s.running = true
+		}
+
+		return nil, nil
+
+	case "threads":
+		return map[string][]Thread{
+			"threads": {{Id: threadId, Name: "LC-3"}},
+		}, nil
+
+	case "stackTrace":
+		return map[string]interface{}{
+			"stackFrames": []StackFrame{s.stackFrame()},
+			"totalFrames": 1,
+		}, nil
+
+	case "scopes":
+		return map[string][]Scope{
+			"scopes": {{Name: "Registers", VariablesReference: registersReference}},
+		}, nil
+
+	case "variables":
+		var args VariablesArguments
+
+		if err := json.Unmarshal(request.Arguments, &args); err != nil {
+			return nil, err
+		}
+
+		if args.VariablesReference != registersReference {
+			return map[string][]Variable{"variables": {}}, nil
+		}
+
+		return map[string][]Variable{"variables": s.registers()}, nil
+
+	case "evaluate":
+		var args EvaluateArguments
+
+		if err := json.Unmarshal(request.Arguments, &args); err != nil {
+			return nil, err
+		}
+
+		value, err := debugger.EvaluateExpression(args.Expression, s.mc)
+
+		if err != nil {
+			return nil, err
+		}
+
+		return map[string]interface{}{
+			"result":             formatWord(value),
+			"variablesReference": 0,
+		}, nil
+
+	case "continue":
+		s.dbg.Break = false
+		s.running = true
+		return map[string]bool{"allThreadsContinued": true}, nil
+
+	case "next":
+		s.dbg.StepOver(s.mc)
+		s.running = true
+		return nil, nil
+
+	case "stepIn":
+		s.dbg.Break = true
+		s.running = true
+		return nil, nil
+
+	case "stepOut":
+		s.dbg.StepOut(s.mc)
+		s.running = true
+		return nil, nil
+	}
+
+	return nil, &UnsupportedCommandError{request.Command}
+}
+
+func (s *Server) launch(args LaunchArguments) error {
+	file, err := os.Open(args.Program)
+
+	if err != nil {
+		return err
+	}
+
+	defer file.Close()
+
+	var mc machine.Machine
+	var dbg debugger.Debugger
+
+	// Output is forwarded to the client, there is no keyboard as input is
+	// reserved for the protocol
+	mc.Devices = &machine.DeviceHandler{
+		Display: bufio.NewWriter(&outputWriter{s}),
+	}
+
+	if _, err := mc.LoadBin(file, 0); err != nil {
+		return err
+	}
+
+	if args.SymbolFile != "" {
+		symfile, err := os.Open(args.SymbolFile)
+
+		if err != nil {
+			return err
+		}
+
+		defer symfile.Close()
+
+		if dbg.SymTable, err = assembler.ReadSymTable(symfile); err != nil {
+			return err
+		}
+	}
+
+	dbg.HandleBreak = func(dbg *debugger.Debugger, mc *machine.Machine) {
+		if dbg.Break {
+			s.stopReason = "step"
+		} else {
+			s.stopReason = "breakpoint"
+		}
+	}
+	dbg.HandleRead = func(uint16, *debugger.Debugger, *machine.Machine) {
+		s.stopReason = "data breakpoint"
+	}
+	dbg.HandleWrite = func(uint16, *debugger.Debugger, *machine.Machine) {
+		s.stopReason = "data breakpoint"
+	}
+
+	mc.Debugger = &dbg
+
+	s.mc = &mc
+	s.dbg = &dbg
+	s.stopOnEntry = args.StopOnEntry
+
+	s.queueEvent("initialized", nil)
+	return nil
+}
+
+// Replaces every breakpoint with those given, verifying only lines which
+// assembled to an instruction
+func (s *Server) setBreakpoints(
+	args SetBreakpointsArguments,
+) ([]Breakpoint, error) {
+	if s.dbg.SymTable == nil {
+		breakpoints := make([]Breakpoint, len(args.Breakpoints))
+
+		for i, breakpoint := range args.Breakpoints {
+			breakpoints[i] = Breakpoint{
+				Line:    breakpoint.Line,
+				Message: "No symbol table loaded",
+			}
+		}
+
+		return breakpoints, nil
+	}
+
+	if err := s.loadSource(args.Source.Path); err != nil {
+		return nil, err
+	}
+
+	s.dbg.Breakpoints = s.dbg.Breakpoints[:0]
+	breakpoints := make([]Breakpoint, len(args.Breakpoints))
+
+	for i, breakpoint := range args.Breakpoints {
+		breakpoints[i].Line = breakpoint.Line
+
+		addr, ok := s.addressForLine(breakpoint.Line)
+
+		if !ok {
+			breakpoints[i].Message = "No instruction on this line"
+			continue
+		}
+
+		if _, err := s.dbg.AddConditionalBreakpoint(
+			addr, breakpoint.Condition,
+		); err != nil {
+			breakpoints[i].Message = err.Error()
+			continue
+		}
+
+		breakpoints[i].Verified = true
+	}
+
+	return breakpoints, nil
+}
+
+func (s *Server) loadSource(path string) error {
+	if path == "" {
+		path = s.dbg.SymTable.Source
+	}
+
+	if path == s.sourcePath && s.source != nil {
+		return nil
+	}
+
+	source, err := os.ReadFile(path)
+
+	if err != nil {
+		return err
+	}
+
+	s.source = source
+	s.sourcePath = path
+	return nil
+}
+
+// Finds the address assembled from the 1-based line of the source
+func (s *Server) addressForLine(line int) (uint16, bool) {
+	if line < 1 {
+		return 0, false
+	}
+
+	var offset int64
+
+	for ; line > 1; line-- {
+		i := bytes.IndexByte(s.source[offset:], '\n')
+
+		if i == -1 {
+			return 0, false
+		}
+
+		offset += int64(i) + 1
+	}
+
+	for addr, symbol := range s.dbg.SymTable.Symbols {
+		if symbol == offset {
+			return addr, true
+		}
+	}
+
+	return 0, false
+}
+
+// Finds the 1-based line of the source assembled to addr, or zero if unknown
+func (s *Server) lineForAddress(addr uint16) int {
+	if s.dbg.SymTable == nil || s.loadSource(s.sourcePath) != nil {
+		return 0
+	}
+
+	offset, ok := s.dbg.SymTable.Symbols[addr]
+
+	if !ok || offset > int64(len(s.source)) {
+		return 0
+	}
+
+	return bytes.Count(s.source[:offset], []byte{'\n'}) + 1
+}
+
+func (s *Server) stackFrame() StackFrame {
+	frame := StackFrame{
+		Name: "main",
+		Line: s.lineForAddress(s.mc.State.Program),
+
+		InstructionPointerReference: formatWord(s.mc.State.Program),
+	}
+
+	if s.dbg.SymTable != nil {
+		if _, label, ok := s.dbg.SymTable.FindNearest(
+			s.mc.State.Program,
+		); ok {
+			frame.Name = label
+		}
+	}
+
+	if frame.Line != 0 {
+		frame.Column = 1
+		frame.Source = &Source{
+			Name: filepath.Base(s.sourcePath),
+			Path: s.sourcePath,
+		}
+	}
+
+	return frame
+}
+
+func (s *Server) registers() []Variable {
+	variables := make([]Variable, 0, 10)
+
+	for i, value := range s.mc.State.Registers {
+		variables = append(variables, Variable{
+			Name:  fmt.Sprintf("R%d", i),
+			Value: formatWord(value),
+		})
+	}
+
+	return append(variables,
+		Variable{Name: "PC", Value: formatWord(s.mc.State.Program)},
+		Variable{Name: "PSR", Value: formatWord(s.mc.State.Procstat)},
+	)
+}
+
+func (s *Server) stoppedBody(reason string) map[string]interface{} {
+	return map[string]interface{}{
+		"reason":            reason,
+		"threadId":          threadId,
+		"allThreadsStopped": true,
+	}
+}
+
+// Executes a single instruction, reporting to the client when execution stops
+func (s *Server) step() error {
+	err := s.mc.RunN(1)
+	s.mc.Devices.Display.Flush()
+
+	switch {
+	case err != nil:
+		s.running = false
+		s.queueEvent("output", map[string]string{
+			"category": "stderr",
+			"output":   err.Error() + "\n",
+		})
+		s.queueEvent("terminated", nil)
+
+	case s.stopReason != "":
+		s.running = false
+		s.queueEvent("stopped", s.stoppedBody(s.stopReason))
+		s.stopReason = ""
+
+	case s.mc.IsHalted():
+		s.running = false
+		s.queueEvent("exited", map[string]int{"exitCode": 0})
+		s.queueEvent("terminated", nil)
+	}
+
+	return s.flushEvents()
+}
+
+// Forwards writes to the display as output events
+type outputWriter struct {
+	s *Server
+}
+
+func (w *outputWriter) Write(p []byte) (int, error) {
+	w.s.queueEvent("output", map[string]string{
+		"category": "stdout",
+		"output":   string(p),
+	})
+
+	return len(p), nil
+}
+
+func formatWord(value uint16) string {
+	return fmt.Sprintf("0x%04X", value)
+}
@@ -0,0 +1,358 @@
+// Copyright (C) 2021  Antonio Lassandro
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+
+// You should have received a copy of the GNU General Public License along
+// with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package dap_test
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/gob"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/lassandro/golc3/pkg/assembler"
+	"github.com/lassandro/golc3/pkg/dap"
+)
+
+const traceSource = `.ORIG 0x3000
+AND R0, R0, #0
+JSR DOUBLE
+ADD R0, R0, #1
+AND R2, R2, #0
+LD R1, MCR
+STR R2, R1, #0
+DOUBLE ADD R0, R0, #2
+RET
+MCR .FILL xFFFE
+.END
+`
+
+// Each request is sent in turn, followed by the messages expected in reply.
+// Only the fields present in an expected message are compared
+var traceFixtures = []struct {
+	Request string
+	Want    []string
+}{
+	{
+		`{"seq":1,"type":"request","command":"initialize","arguments":{"adapterID":"golc3"}}`,
+		[]string{
+			`{"type":"response","request_seq":1,"success":true,"command":"initialize","body":{"supportsConfigurationDoneRequest":true}}`,
+		},
+	},
+	{
+		`{"seq":2,"type":"request","command":"launch","arguments":{"program":"$PROGRAM","symbolFile":"$SYMBOLS"}}`,
+		[]string{
+			`{"type":"response","request_seq":2,"success":true,"command":"launch"}`,
+			`{"type":"event","event":"initialized"}`,
+		},
+	},
+	{
+		`{"seq":3,"type":"request","command":"setBreakpoints","arguments":{"source":{"path":"$SOURCE"},"breakpoints":[{"line":3},{"line":1}]}}`,
+		[]string{
+			`{"type":"response","request_seq":3,"success":true,"body":{"breakpoints":[{"verified":true,"line":3},{"verified":false,"line":1}]}}`,
+		},
+	},
+	{
+		`{"seq":4,"type":"request","command":"configurationDone"}`,
+		[]string{
+			`{"type":"response","request_seq":4,"success":true}`,
+			`{"type":"event","event":"stopped","body":{"reason":"breakpoint","threadId":1}}`,
+		},
+	},
+	{
+		`{"seq":5,"type":"request","command":"stackTrace","arguments":{"threadId":1}}`,
+		[]string{
+			`{"type":"response","request_seq":5,"success":true,"body":{"stackFrames":[{"line":3,"instructionPointerReference":"0x3001"}]}}`,
+		},
+	},
+	{
+		`{"seq":6,"type":"request","command":"stepIn","arguments":{"threadId":1}}`,
+		[]string{
+			`{"type":"response","request_seq":6,"success":true}`,
+			`{"type":"event","event":"stopped","body":{"reason":"step"}}`,
+		},
+	},
+	{
+		`{"seq":7,"type":"request","command":"stackTrace","arguments":{"threadId":1}}`,
+		[]string{
+			`{"type":"response","request_seq":7,"success":true,"body":{"stackFrames":[{"name":"DOUBLE","line":8,"instructionPointerReference":"0x3006"}]}}`,
+		},
+	},
+	{
+		`{"seq":8,"type":"request","command":"stepOut","arguments":{"threadId":1}}`,
+		[]string{
+			`{"type":"response","request_seq":8,"success":true}`,
+			`{"type":"event","event":"stopped","body":{"reason":"step"}}`,
+		},
+	},
+	{
+		`{"seq":9,"type":"request","command":"evaluate","arguments":{"expression":"PC"}}`,
+		[]string{
+			`{"type":"response","request_seq":9,"success":true,"body":{"result":"0x3002"}}`,
+		},
+	},
+	{
+		`{"seq":10,"type":"request","command":"next","arguments":{"threadId":1}}`,
+		[]string{
+			`{"type":"response","request_seq":10,"success":true}`,
+			`{"type":"event","event":"stopped","body":{"reason":"step"}}`,
+		},
+	},
+	{
+		`{"seq":11,"type":"request","command":"scopes","arguments":{"frameId":0}}`,
+		[]string{
+			`{"type":"response","request_seq":11,"success":true,"body":{"scopes":[{"name":"Registers","variablesReference":1}]}}`,
+		},
+	},
+	{
+		`{"seq":12,"type":"request","command":"variables","arguments":{"variablesReference":1}}`,
+		[]string{
+			`{"type":"response","request_seq":12,"success":true,"body":{"variables":[{"name":"R0","value":"0x0003"},{"name":"R1","value":"0x0000"}]}}`,
+		},
+	},
+	{
+		`{"seq":13,"type":"request","command":"evaluate","arguments":{"expression":"R0==3"}}`,
+		[]string{
+			`{"type":"response","request_seq":13,"success":true,"body":{"result":"0x0001"}}`,
+		},
+	},
+	{
+		`{"seq":14,"type":"request","command":"evaluate","arguments":{"expression":"R9"}}`,
+		[]string{
+			`{"type":"response","request_seq":14,"success":false,"command":"evaluate"}`,
+		},
+	},
+	{
+		`{"seq":15,"type":"request","command":"restart"}`,
+		[]string{
+			`{"type":"response","request_seq":15,"success":false,"message":"Unsupported command 'restart'"}`,
+		},
+	},
+	{
+		`{"seq":16,"type":"request","command":"continue","arguments":{"threadId":1}}`,
+		[]string{
+			`{"type":"response","request_seq":16,"success":true,"body":{"allThreadsContinued":true}}`,
+			`{"type":"event","event":"exited","body":{"exitCode":0}}`,
+			`{"type":"event","event":"terminated"}`,
+		},
+	},
+	{
+		`{"seq":17,"type":"request","command":"disconnect"}`,
+		[]string{
+			`{"type":"response","request_seq":17,"success":true,"command":"disconnect"}`,
+		},
+	},
+}
+
+// Reports whether every field of want is present and equal in have
+func matches(want, have interface{}) bool {
+	switch want := want.(type) {
+	case map[string]interface{}:
+		have, ok := have.(map[string]interface{})
+
+		if !ok {
+			return false
+		}
+
+		for key, value := range want {
+			if !matches(value, have[key]) {
+				return false
+			}
+		}
+
+		return true
+
+	case []interface{}:
+		have, ok := have.([]interface{})
+
+		if !ok || len(have) < len(want) {
+			return false
+		}
+
+		for i := range want {
+			if !matches(want[i], have[i]) {
+				return false
+			}
+		}
+
+		return true
+	}
+
+	return reflect.DeepEqual(want, have)
+}
+
+func writeTraceProgram(t *testing.T) (source, program, symbols string) {
+	dir := t.TempDir()
+	source = filepath.Join(dir, "trace.asm")
+	program = filepath.Join(dir, "trace.bin")
+	symbols = filepath.Join(dir, "trace.lc3db")
+
+	if err := os.WriteFile(source, []byte(traceSource), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	symtable := assembler.SymTable{
+		Source:  source,
+		Symbols: make(map[uint16]int64),
+		Labels:  make(map[uint16]string),
+	}
+
+	assembled := assembler.AssembleLC3Source(
+		strings.NewReader(traceSource), assembler.WithSymTable(&symtable),
+	)
+
+	if !assembled.Success() {
+		t.Fatalf("Unexpected errors: %v", assembled.Errors)
+	}
+
+	result := assembled.Memory
+
+	binfile, err := os.Create(program)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer binfile.Close()
+
+	if err := binary.Write(binfile, binary.BigEndian, result); err != nil {
+		t.Fatal(err)
+	}
+
+	symfile, err := os.Create(symbols)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer symfile.Close()
+
+	if err := gob.NewEncoder(symfile).Encode(&symtable); err != nil {
+		t.Fatal(err)
+	}
+
+	return source, program, symbols
+}
+
+func TestServeTrace(t *testing.T) {
+	source, program, symbols := writeTraceProgram(t)
+
+	replacer := strings.NewReplacer(
+		"$SOURCE", filepath.ToSlash(source),
+		"$PROGRAM", filepath.ToSlash(program),
+		"$SYMBOLS", filepath.ToSlash(symbols),
+	)
+
+	clientReader, serverWriter := io.Pipe()
+	serverReader, clientWriter := io.Pipe()
+
+	served := make(chan error, 1)
+
+	go func() {
+		served <- dap.NewServer(serverReader, serverWriter).Serve()
+		serverWriter.Close()
+	}()
+
+	messages := make(chan []byte)
+
+	go func() {
+		reader := bufio.NewReader(clientReader)
+
+		for {
+			body, err := dap.ReadMessage(reader)
+
+			if err != nil {
+				close(messages)
+				return
+			}
+
+			messages <- body
+		}
+	}()
+
+	for _, fixture := range traceFixtures {
+		request := replacer.Replace(fixture.Request)
+
+		if err := dap.WriteMessage(
+			clientWriter, json.RawMessage(request),
+		); err != nil {
+			t.Fatalf("Error sending request: %s", err)
+		}
+
+		for _, want := range fixture.Want {
+			var body []byte
+
+			select {
+			case body = <-messages:
+			case <-time.After(5 * time.Second):
+				t.Fatalf("Timed out awaiting reply to %s", request)
+			}
+
+			var wantValue, haveValue interface{}
+
+			if err := json.Unmarshal([]byte(want), &wantValue); err != nil {
+				t.Fatalf("Invalid fixture %s: %s", want, err)
+			}
+
+			if err := json.Unmarshal(body, &haveValue); err != nil {
+				t.Fatalf("Invalid message %s: %s", body, err)
+			}
+
+			if !matches(wantValue, haveValue) {
+				t.Fatalf(
+					"Message mismatch for %s\nwant:%s\nhave:%s",
+					request, want, body,
+				)
+			}
+		}
+	}
+
+	if err := <-served; err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+}
+
+func TestReadMessage(t *testing.T) {
+	reader := bufio.NewReader(strings.NewReader(
+		"Content-Length: 2\r\nContent-Type: json\r\n\r\n{}" +
+			"Content-Length: 4\r\n\r\n{}",
+	))
+
+	body, err := dap.ReadMessage(reader)
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if string(body) != "{}" {
+		t.Fatalf("Body mismatch\nwant:{}\nhave:%s", body)
+	}
+
+	if _, err := dap.ReadMessage(reader); err != io.ErrUnexpectedEOF {
+		t.Fatalf("Expected io.ErrUnexpectedEOF, have %v", err)
+	}
+
+	reader = bufio.NewReader(strings.NewReader("Content-Length two\r\n\r\n"))
+
+	if _, err := dap.ReadMessage(reader); err == nil {
+		t.Fatal("Expected error for invalid header")
+	}
+}
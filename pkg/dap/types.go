@@ -0,0 +1,136 @@
+// Copyright (C) 2021  Antonio Lassandro
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+
+// You should have received a copy of the GNU General Public License along
+// with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package dap
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Messages follow the Debug Adapter Protocol base protocol, each a JSON object
+// preceded by a Content-Length header, i.e.
+// Content-Length: 58\r\n\r\n{"seq":1,"type":"request","command":"initialize"}
+type Request struct {
+	Seq       int             `json:"seq"`
+	Type      string          `json:"type"`
+	Command   string          `json:"command"`
+	Arguments json.RawMessage `json:"arguments,omitempty"`
+}
+
+type Response struct {
+	Seq        int         `json:"seq"`
+	Type       string      `json:"type"`
+	RequestSeq int         `json:"request_seq"`
+	Success    bool        `json:"success"`
+	Command    string      `json:"command"`
+	Message    string      `json:"message,omitempty"`
+	Body       interface{} `json:"body,omitempty"`
+}
+
+type Event struct {
+	Seq   int         `json:"seq"`
+	Type  string      `json:"type"`
+	Event string      `json:"event"`
+	Body  interface{} `json:"body,omitempty"`
+}
+
+type Source struct {
+	Name string `json:"name,omitempty"`
+	Path string `json:"path,omitempty"`
+}
+
+type LaunchArguments struct {
+	// Path to a memory image as written by golc3-asm
+	Program string `json:"program"`
+	// Path to the symbol table of the program, required for source breakpoints
+	SymbolFile  string `json:"symbolFile,omitempty"`
+	StopOnEntry bool   `json:"stopOnEntry,omitempty"`
+}
+
+type SourceBreakpoint struct {
+	Line      int    `json:"line"`
+	Condition string `json:"condition,omitempty"`
+}
+
+type SetBreakpointsArguments struct {
+	Source      Source             `json:"source"`
+	Breakpoints []SourceBreakpoint `json:"breakpoints"`
+}
+
+type Breakpoint struct {
+	Verified bool   `json:"verified"`
+	Line     int    `json:"line,omitempty"`
+	Message  string `json:"message,omitempty"`
+}
+
+type StackFrame struct {
+	Id     int     `json:"id"`
+	Name   string  `json:"name"`
+	Source *Source `json:"source,omitempty"`
+	Line   int     `json:"line"`
+	Column int     `json:"column"`
+
+	InstructionPointerReference string `json:"instructionPointerReference"`
+}
+
+type Scope struct {
+	Name               string `json:"name"`
+	VariablesReference int    `json:"variablesReference"`
+	Expensive          bool   `json:"expensive"`
+}
+
+type VariablesArguments struct {
+	VariablesReference int `json:"variablesReference"`
+}
+
+type Variable struct {
+	Name               string `json:"name"`
+	Value              string `json:"value"`
+	VariablesReference int    `json:"variablesReference"`
+}
+
+type EvaluateArguments struct {
+	Expression string `json:"expression"`
+}
+
+type Thread struct {
+	Id   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type InvalidHeaderError struct {
+	Header string
+}
+
+func (err *InvalidHeaderError) Error() string {
+	return fmt.Sprintf("Invalid message header '%s'", err.Header)
+}
+
+type UnsupportedCommandError struct {
+	Command string
+}
+
+func (err *UnsupportedCommandError) Error() string {
+	return fmt.Sprintf("Unsupported command '%s'", err.Command)
+}
+
+type NotLaunchedError struct {
+	Command string
+}
+
+func (err *NotLaunchedError) Error() string {
+	return fmt.Sprintf("Cannot '%s' before a program is launched", err.Command)
+}
@@ -0,0 +1,178 @@
+// Copyright (C) 2021  Antonio Lassandro
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+
+// You should have received a copy of the GNU General Public License along
+// with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package debugger
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/lassandro/golc3/pkg/encoding"
+	"github.com/lassandro/golc3/pkg/machine"
+)
+
+type operandKind uint
+
+const (
+	operandLiteral operandKind = iota
+	operandRegister
+	operandProgram
+	operandMemory
+)
+
+type operand struct {
+	kind  operandKind
+	value uint16
+}
+
+// A comparison of two operands, each either a register (R0-R7), the program
+// counter (PC), a word of memory (MEM[0x####]) or a literal (0x####, #-1, 10)
+type Condition struct {
+	left  operand
+	right operand
+	op    string
+}
+
+// Operators in order of matching, so that == is not mistaken for a shorter
+// operator
+var conditionOps = []string{"==", "!=", "<", ">"}
+
+// Parses an expression such as R0==0 or MEM[0x3100] != PC, whitespace between
+// operands and the operator is ignored
+func ParseCondition(expr string) (*Condition, error) {
+	for _, op := range conditionOps {
+		i := strings.Index(expr, op)
+
+		if i == -1 {
+			continue
+		}
+
+		left, err := parseOperand(strings.TrimSpace(expr[:i]))
+
+		if err != nil {
+			return nil, &InvalidConditionError{expr, err.Error()}
+		}
+
+		right, err := parseOperand(strings.TrimSpace(expr[i+len(op):]))
+
+		if err != nil {
+			return nil, &InvalidConditionError{expr, err.Error()}
+		}
+
+		return &Condition{left, right, op}, nil
+	}
+
+	return nil, &InvalidConditionError{expr, "missing operator"}
+}
+
+func parseOperand(s string) (operand, error) {
+	upper := strings.ToUpper(s)
+
+	switch {
+	case len(upper) == 2 && upper[0] == 'R' && upper[1] >= '0' && upper[1] <= '7':
+		return operand{operandRegister, uint16(upper[1] - '0')}, nil
+
+	case upper == "PC":
+		return operand{operandProgram, 0}, nil
+
+	case strings.HasPrefix(upper, "MEM[") && strings.HasSuffix(upper, "]"):
+		addr, err := encoding.DecodeHex(s[4 : len(s)-1])
+
+		if err != nil {
+			return operand{}, &InvalidOperandError{s}
+		}
+
+		return operand{operandMemory, addr}, nil
+
+	case strings.ContainsAny(upper, "X"):
+		value, err := encoding.DecodeHex(s)
+
+		if err != nil {
+			return operand{}, &InvalidOperandError{s}
+		}
+
+		return operand{operandLiteral, value}, nil
+	}
+
+	value, err := strconv.ParseInt(strings.TrimPrefix(s, "#"), 10, 32)
+
+	if err != nil || value < -(1<<15) || value > (1<<16)-1 {
+		return operand{}, &InvalidOperandError{s}
+	}
+
+	return operand{operandLiteral, uint16(value)}, nil
+}
+
+func (op operand) resolve(mc *machine.Machine) uint16 {
+	switch op.kind {
+	case operandRegister:
+		return mc.State.Registers[op.value]
+	case operandProgram:
+		return mc.State.Program
+	case operandMemory:
+		// Read directly so watchpoints and device registers are unaffected
+		return mc.State.Memory[op.value]
+	default:
+		return op.value
+	}
+}
+
+// Reports whether the condition holds for the machine, < and > compare the
+// operands as signed values
+func (cond *Condition) Evaluate(mc *machine.Machine) bool {
+	left := cond.left.resolve(mc)
+	right := cond.right.resolve(mc)
+
+	switch cond.op {
+	case "==":
+		return left == right
+	case "!=":
+		return left != right
+	case "<":
+		return int16(left) < int16(right)
+	default:
+		return int16(left) > int16(right)
+	}
+}
+
+// Evaluates an operand such as R0 or MEM[0x3100] to its value, or a condition
+// such as R0==0 to 1 if it holds and 0 otherwise
+func EvaluateExpression(expr string, mc *machine.Machine) (uint16, error) {
+	for _, op := range conditionOps {
+		if !strings.Contains(expr, op) {
+			continue
+		}
+
+		cond, err := ParseCondition(expr)
+
+		if err != nil {
+			return 0, err
+		}
+
+		if cond.Evaluate(mc) {
+			return 1, nil
+		}
+
+		return 0, nil
+	}
+
+	value, err := parseOperand(strings.TrimSpace(expr))
+
+	if err != nil {
+		return 0, err
+	}
+
+	return value.resolve(mc), nil
+}
@@ -0,0 +1,161 @@
+// Copyright (C) 2021  Antonio Lassandro
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+
+// You should have received a copy of the GNU General Public License along
+// with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package debugger_test
+
+import (
+	"testing"
+
+	"github.com/lassandro/golc3/pkg/debugger"
+	"github.com/lassandro/golc3/pkg/machine"
+)
+
+func TestCondition(t *testing.T) {
+	var mc machine.Machine
+
+	mc.State.Program = 0x3005
+	mc.State.Registers[0] = 0x0000
+	mc.State.Registers[1] = 0xFFFF // #-1
+	mc.State.Memory[0x3100] = 0x3005
+
+	tests := []struct {
+		Expr string
+		Want bool
+	}{
+		{"R0==0", true},
+		{"R0 == 0", true},
+		{"r0!=0", false},
+		{"R1<R0", true},
+		{"R1>#-2", true},
+		{"R1==0xFFFF", true},
+		{"PC==0x3005", true},
+		{"MEM[0x3100]==PC", true},
+		{"MEM[x3100]!=PC", false},
+		{"PC<10", false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Expr, func(t *testing.T) {
+			cond, err := debugger.ParseCondition(test.Expr)
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			if have := cond.Evaluate(&mc); have != test.Want {
+				t.Fatalf(
+					"Evaluation mismatch\nwant:%t\nhave:%t", test.Want, have,
+				)
+			}
+		})
+	}
+
+	fails := []string{
+		"R0",
+		"R8==0",
+		"R0=0",
+		"MEM[3100]==0",
+		"PC==",
+		"R0==70000",
+	}
+
+	for _, expr := range fails {
+		t.Run(expr, func(t *testing.T) {
+			_, err := debugger.ParseCondition(expr)
+
+			if _, ok := err.(*debugger.InvalidConditionError); !ok {
+				t.Fatalf(
+					"Error mismatch\nwant:%T\nhave:%T",
+					&debugger.InvalidConditionError{},
+					err,
+				)
+			}
+		})
+	}
+}
+
+func TestConditionalBreakpoint(t *testing.T) {
+	var mc machine.Machine
+	var dbg debugger.Debugger
+
+	breaks := 0
+	dbg.HandleBreak = func(*debugger.Debugger, *machine.Machine) {
+		breaks++
+	}
+
+	if _, err := dbg.AddConditionalBreakpoint(0x3005, "R0=="); err == nil {
+		t.Fatal("Expected error adding an invalid condition")
+	}
+
+	if _, err := dbg.AddConditionalBreakpoint(0x3005, "R0==0"); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	mc.State.Program = 0x3005
+	mc.State.Registers[0] = 1
+	dbg.Step(&mc)
+
+	if breaks != 0 {
+		t.Fatal("Breakpoint halted while its condition was false")
+	}
+
+	mc.State.Registers[0] = 0
+	dbg.Step(&mc)
+
+	if breaks != 1 {
+		t.Fatal("Breakpoint did not halt while its condition was true")
+	}
+}
+
+func TestEvaluateExpression(t *testing.T) {
+	var mc machine.Machine
+
+	mc.State.Program = 0x3005
+	mc.State.Registers[2] = 0x0042
+	mc.State.Memory[0x3100] = 0xBEEF
+
+	tests := []struct {
+		Expr string
+		Want uint16
+	}{
+		{"R2", 0x0042},
+		{" pc ", 0x3005},
+		{"MEM[0x3100]", 0xBEEF},
+		{"#-1", 0xFFFF},
+		{"R2==0x42", 1},
+		{"R2 > PC", 0},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Expr, func(t *testing.T) {
+			have, err := debugger.EvaluateExpression(test.Expr, &mc)
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			if have != test.Want {
+				t.Fatalf(
+					"Evaluation mismatch\nwant:%#04x\nhave:%#04x",
+					test.Want, have,
+				)
+			}
+		})
+	}
+
+	if _, err := debugger.EvaluateExpression("R8", &mc); err == nil {
+		t.Fatal("Expected error for invalid operand")
+	}
+}
@@ -20,3 +20,8 @@ const (
 	ReadWatch
 	ReadWriteWatch
 )
+
+const (
+	ColorAlways ColorMode = iota
+	ColorNever
+)
@@ -17,33 +17,114 @@ package debugger
 
 import (
 	"bufio"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"strconv"
+	"strings"
 
+	"github.com/lassandro/golc3/pkg/assembler"
+	"github.com/lassandro/golc3/pkg/encoding"
 	"github.com/lassandro/golc3/pkg/machine"
 )
 
 func (dbg *Debugger) Step(mc *machine.Machine) {
+	if dbg.TraceWriter != nil {
+		dbg.trace(mc)
+	}
+
 	if dbg.Break {
 		dbg.HandleBreak(dbg, mc)
 		return
 	}
 
+	for i := range dbg.Breakpoints {
+		breakpoint := &dbg.Breakpoints[i]
+
+		if mc.State.Program != breakpoint.Addr {
+			continue
+		}
+
+		// Breakpoints given a condition without AddConditionalBreakpoint are
+		// parsed when first reached, one which fails to parse still halts
+		// rather than being silently skipped
+		if breakpoint.Condition != "" && breakpoint.parsed == nil {
+			breakpoint.parsed, _ = ParseCondition(breakpoint.Condition)
+		}
+
+		if breakpoint.parsed != nil && !breakpoint.parsed.Evaluate(mc) {
+			continue
+		}
+
+		// Stepping over an instruction halts as if it were a single step
+		if breakpoint.OneShot {
+			dbg.Break = true
+		}
+
+		dbg.clearOneShots()
+		dbg.HandleBreak(dbg, mc)
+		break
+	}
+}
+
+// Removes every one-shot breakpoint, such that a step over which halts early
+// at another breakpoint does not halt again once the step completes
+func (dbg *Debugger) clearOneShots() {
+	breakpoints := dbg.Breakpoints[:0]
+
 	for _, breakpoint := range dbg.Breakpoints {
-		if mc.State.Program == breakpoint.Addr {
-			dbg.HandleBreak(dbg, mc)
-			break
+		if !breakpoint.OneShot {
+			breakpoints = append(breakpoints, breakpoint)
 		}
 	}
+
+	dbg.Breakpoints = breakpoints
+}
+
+// Prepares to execute the next instruction, halting once it completes. Calls
+// to subroutines via JSR and JSRR are run to completion by a one-shot
+// breakpoint at their return address, rather than halting inside them
+func (dbg *Debugger) StepOver(mc *machine.Machine) {
+	instruction := mc.State.Memory[mc.State.Program]
+
+	if instruction>>12 != machine.OP_JSR {
+		dbg.Break = true
+		return
+	}
+
+	dbg.Break = false
+	dbg.Breakpoints = append(dbg.Breakpoints, Breakpoint{
+		Addr:    mc.State.Program + 1,
+		OneShot: true,
+	})
+}
+
+// Resumes execution until the current subroutine returns, halting at its
+// return address. Subroutines return via R7, so a one-shot breakpoint is set at
+// the address it holds
+func (dbg *Debugger) StepOut(mc *machine.Machine) {
+	dbg.Break = false
+	dbg.Breakpoints = append(dbg.Breakpoints, Breakpoint{
+		Addr:    mc.State.Registers[7],
+		OneShot: true,
+	})
 }
 
 func (dbg *Debugger) Read(addr uint16, mc *machine.Machine) {
-	for _, watchpoint := range dbg.Watchpoints {
+	for i := range dbg.Watchpoints {
+		watchpoint := &dbg.Watchpoints[i]
+
 		if watchpoint.Type == WriteWatch {
 			continue
 		}
 
 		if addr == watchpoint.Addr {
+			if !watchpoint.hit() {
+				continue
+			}
+
+			dbg.clearOneShots()
 			dbg.HandleRead(addr, dbg, mc)
 			break
 		}
@@ -51,19 +132,116 @@ func (dbg *Debugger) Read(addr uint16, mc *machine.Machine) {
 }
 
 func (dbg *Debugger) Write(addr uint16, mc *machine.Machine) {
-	for _, watchpoint := range dbg.Watchpoints {
+	for i := range dbg.Watchpoints {
+		watchpoint := &dbg.Watchpoints[i]
+
 		if watchpoint.Type == ReadWatch {
 			continue
 		}
 
 		if addr == watchpoint.Addr {
+			if !watchpoint.hit() {
+				continue
+			}
+
+			dbg.clearOneShots()
 			dbg.HandleWrite(addr, dbg, mc)
 			break
 		}
 	}
 }
 
-func (dbg *Debugger) PrintSource(addr uint16, count uint16) {
+// Records a trigger of the watchpoint, reporting whether execution should halt
+func (watchpoint *Watchpoint) hit() bool {
+	watchpoint.HitCount++
+
+	return watchpoint.MaxHits == 0 || watchpoint.HitCount <= watchpoint.MaxHits
+}
+
+// Reports whether addr lies within the memory mapped device register space,
+// which begins at the keyboard status register
+func IsDeviceAddress(addr uint16) bool {
+	return addr >= machine.MEMSPACE_DEVICES
+}
+
+// Adds a breakpoint at addr, returning false if one already exists
+func (dbg *Debugger) AddBreakpoint(addr uint16) (bool, error) {
+	return dbg.AddConditionalBreakpoint(addr, "")
+}
+
+// Adds a breakpoint at addr which only halts when the condition holds,
+// returning false if one with the same condition already exists. The condition
+// is parsed up front so that errors are reported when it is added
+func (dbg *Debugger) AddConditionalBreakpoint(
+	addr uint16,
+	condition string,
+) (bool, error) {
+	var parsed *Condition
+
+	if condition != "" {
+		var err error
+
+		if parsed, err = ParseCondition(condition); err != nil {
+			return false, err
+		}
+	}
+
+	for _, breakpoint := range dbg.Breakpoints {
+		if breakpoint.Addr == addr && breakpoint.Condition == condition {
+			return false, nil
+		}
+	}
+
+	if dbg.MaxBreakpoints > 0 && len(dbg.Breakpoints) >= dbg.MaxBreakpoints {
+		return false, &TooManyBreakpointsError{dbg.MaxBreakpoints}
+	}
+
+	dbg.Breakpoints = append(dbg.Breakpoints, Breakpoint{
+		Addr:      addr,
+		Condition: condition,
+		parsed:    parsed,
+	})
+
+	return true, nil
+}
+
+// Adds the watchpoint, returning false if one of the same address and type
+// already exists
+func (dbg *Debugger) AddWatchpoint(watchpoint Watchpoint) (bool, error) {
+	for _, existing := range dbg.Watchpoints {
+		if existing.Addr == watchpoint.Addr && existing.Type == watchpoint.Type {
+			return false, nil
+		}
+	}
+
+	if dbg.MaxWatchpoints > 0 && len(dbg.Watchpoints) >= dbg.MaxWatchpoints {
+		return false, &TooManyWatchpointsError{dbg.MaxWatchpoints}
+	}
+
+	dbg.Watchpoints = append(dbg.Watchpoints, watchpoint)
+
+	return true, nil
+}
+
+// Sets the writer that commands are recorded to, a nil writer disables
+// recording
+func (dbg *Debugger) RecordSession(w io.Writer) {
+	dbg.recorder = w
+}
+
+// Writes the command to the session recording as a single line
+func (dbg *Debugger) RecordCommand(args []string) error {
+	if dbg.recorder == nil {
+		return nil
+	}
+
+	_, err := fmt.Fprintln(dbg.recorder, strings.Join(args, " "))
+	return err
+}
+
+// Prints count lines of source starting from the instruction at addr, the
+// line of the instruction at highlight is marked as the current line
+func (dbg *Debugger) PrintSource(addr, highlight uint16, count uint16) {
 	if dbg.Source == nil {
 		fmt.Println("No source file loaded")
 		return
@@ -74,13 +252,36 @@ func (dbg *Debugger) PrintSource(addr uint16, count uint16) {
 		return
 	}
 
-	if offset, exists := dbg.SymTable.Symbols[addr]; exists {
+	color := dbg.Color != ColorNever
+
+	offset, exists := dbg.SymTable.Symbols[addr]
+
+	if !exists {
+		if nearest, _, found := dbg.SymTable.FindNearest(addr); found {
+			fmt.Printf("[%#04x+%d]\n", nearest, addr-nearest)
+			offset, exists = dbg.SymTable.Symbols[nearest], true
+		}
+	}
+
+	if exists {
 		if _, err := dbg.Source.Seek(offset, os.SEEK_SET); err != nil {
 			panic(err)
 		}
 
+		// Lines may end in CRLF, so the offset of the next line is advanced by
+		// the bytes consumed rather than the length of the line
+		var consumed int
+
 		scanner := bufio.NewScanner(dbg.Source)
-		scanner.Split(bufio.ScanLines)
+		scanner.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+			advance, token, err := bufio.ScanLines(data, atEOF)
+
+			if token != nil {
+				consumed = advance
+			}
+
+			return advance, token, err
+		})
 
 		for i := uint16(0); i < count; i++ {
 			if !scanner.Scan() {
@@ -90,21 +291,41 @@ func (dbg *Debugger) PrintSource(addr uint16, count uint16) {
 			line := scanner.Text()
 
 			foundaddr := false
+			current := false
 			for lineaddr, linebyte := range dbg.SymTable.Symbols {
 				if linebyte == offset {
-					fmt.Printf("\033[1m[%#04x]\033[0m ", lineaddr)
+					current = lineaddr == highlight
+
+					if current && color {
+						fmt.Printf("\033[1;33m→ [%#04x]\033[0;33m ", lineaddr)
+					} else if current {
+						fmt.Printf("→ [%#04x] ", lineaddr)
+					} else if color {
+						fmt.Printf("\033[1m[%#04x]\033[0m ", lineaddr)
+					} else {
+						fmt.Printf("[%#04x] ", lineaddr)
+					}
+
 					foundaddr = true
 					break
 				}
 			}
 
 			if !foundaddr {
-				fmt.Print("\033[1;30m~~~~~~~~\033[0m ")
+				if color {
+					fmt.Print("\033[1;30m~~~~~~~~\033[0m ")
+				} else {
+					fmt.Print("~~~~~~~~ ")
+				}
 			}
 
-			fmt.Println(line)
+			if current && color {
+				fmt.Println(line + "\033[0m")
+			} else {
+				fmt.Println(line)
+			}
 
-			offset += int64(len(line) + 1)
+			offset += int64(consumed)
 		}
 
 		if err := scanner.Err(); err != nil {
@@ -115,23 +336,153 @@ func (dbg *Debugger) PrintSource(addr uint16, count uint16) {
 	}
 }
 
+// Prints count instructions disassembled from memory starting at addr in the
+// format of PrintSource, marking the instruction at the program counter. Labels
+// from the symbol table are used when loaded, but no source file is needed
+func (dbg *Debugger) PrintDisasm(mc *machine.MachineState, addr, count uint16) {
+	color := dbg.Color != ColorNever
+
+	for i := uint16(0); i < count; i++ {
+		lineaddr := addr + i
+		line := assembler.DisassembleWord(
+			mc.Memory[lineaddr], lineaddr, dbg.SymTable,
+		)
+
+		if dbg.SymTable != nil {
+			if label, exists := dbg.SymTable.Labels[lineaddr]; exists {
+				line = label + " " + line
+			}
+		}
+
+		current := lineaddr == mc.Program
+
+		if current && color {
+			fmt.Printf(
+				"\033[1;33m→ [%#04x]\033[0;33m %s\033[0m\n", lineaddr, line,
+			)
+		} else if current {
+			fmt.Printf("→ [%#04x] %s\n", lineaddr, line)
+		} else if color {
+			fmt.Printf("\033[1m[%#04x]\033[0m %s\n", lineaddr, line)
+		} else {
+			fmt.Printf("[%#04x] %s\n", lineaddr, line)
+		}
+	}
+}
+
+// Prints count words of the stack starting at the stack pointer (R6), which is
+// marked. In supervisor mode the words are labelled in pairs as the program
+// counter and processor status pushed by an interrupt or exception
+func (dbg *Debugger) PrintStack(mc *machine.MachineState, count uint16) {
+	color := dbg.Color != ColorNever
+	supervisor := mc.Procstat>>machine.PSR_PRIV_BIT == 1
+	sp := mc.Registers[machine.SP_REG]
+
+	for i := uint16(0); i < count; i++ {
+		addr := sp + i
+		line := fmt.Sprintf("%#04x", mc.Memory[addr])
+
+		if supervisor && i%2 == 0 {
+			line += " PC"
+		} else if supervisor {
+			line += " PSR"
+		}
+
+		if dbg.SymTable != nil {
+			if label, exists := dbg.SymTable.Labels[addr]; exists {
+				line += " " + label
+			}
+		}
+
+		if i == 0 && color {
+			fmt.Printf(
+				"\033[1;33m→ [%#04x]\033[0;33m %s\033[0m\n", addr, line,
+			)
+		} else if i == 0 {
+			fmt.Printf("→ [%#04x] %s\n", addr, line)
+		} else if color {
+			fmt.Printf("\033[1m[%#04x]\033[0m %s\n", addr, line)
+		} else {
+			fmt.Printf("[%#04x] %s\n", addr, line)
+		}
+	}
+}
+
 func (dbg *Debugger) PrintMem(mc *machine.MachineState, addr, count uint16) {
+	color := dbg.Color != ColorNever
+
 	for i := addr; i < addr+count; i++ {
-		if i == addr {
-			fmt.Printf("\033[1m[%#04x]\033[0m ", i)
-		} else if (i-addr)%4 == 0 {
+		if i != addr && (i-addr)%4 == 0 {
 			fmt.Println()
+		}
+
+		if (i-addr)%4 == 0 && color {
 			fmt.Printf("\033[1m[%#04x]\033[0m ", i)
+		} else if (i-addr)%4 == 0 {
+			fmt.Printf("[%#04x] ", i)
 		}
 
 		result := mc.Memory[i]
+		text := string([]byte{
+			printable(byte(result >> 8)), printable(byte(result)),
+		})
 
-		if result == 0 {
-			fmt.Printf("\033[1;30m%#04x\033[0m ", result)
+		if result == 0 && color {
+			fmt.Printf("\033[1;30m%#04x [%s]\033[0m ", result, text)
 		} else {
-			fmt.Printf("%#04x ", result)
+			fmt.Printf("%#04x [%s] ", result, text)
 		}
 	}
 
 	fmt.Println()
 }
+
+// Returns the byte if it is printable ASCII, otherwise a placeholder dot
+func printable(b byte) byte {
+	if b < 0x20 || b > 0x7E {
+		return '.'
+	}
+
+	return b
+}
+
+// Prints memory according to the arguments of the memory command:
+// [0x####|#] [#], where the address defaults to the program counter and the
+// count defaults to a single word
+func (dbg *Debugger) PrintMemRange(mc *machine.MachineState, args []string) error {
+	if len(args) > 2 {
+		return errors.New("Too many arguments")
+	}
+
+	var count uint16 = 1
+	var addr uint16 = mc.Program
+
+	if len(args) > 0 {
+		var err error
+		addr, err = encoding.DecodeHex(args[0])
+
+		if err != nil {
+			value, err := strconv.ParseInt(args[0], 10, 16)
+
+			if err != nil {
+				return err
+			}
+
+			addr = mc.Program
+			count = uint16(value)
+		}
+	}
+
+	if len(args) > 1 {
+		value, err := strconv.ParseInt(args[1], 10, 16)
+
+		if err != nil {
+			return err
+		}
+
+		count = uint16(value)
+	}
+
+	dbg.PrintMem(mc, addr, count)
+	return nil
+}
@@ -0,0 +1,702 @@
+// Copyright (C) 2021  Antonio Lassandro
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+
+// You should have received a copy of the GNU General Public License along
+// with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package debugger_test
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/lassandro/golc3/pkg/assembler"
+	"github.com/lassandro/golc3/pkg/debugger"
+	"github.com/lassandro/golc3/pkg/machine"
+)
+
+func TestRecordSession(t *testing.T) {
+	commands := [][]string{
+		{"break", "add", "0x3000"},
+		{"watch", "add", "0xFE06", "write"},
+		{"register", "R0", "0xCAFE"},
+		{"memory", "0x3000", "4"},
+		{"continue"},
+	}
+
+	t.Run("Record", func(t *testing.T) {
+		var dbg debugger.Debugger
+		var recording bytes.Buffer
+
+		dbg.RecordSession(&recording)
+
+		for _, args := range commands {
+			if err := dbg.RecordCommand(args); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		scanner := bufio.NewScanner(&recording)
+
+		for i := 0; scanner.Scan(); i++ {
+			if i >= len(commands) {
+				t.Fatalf("Unexpected recorded command\nhave:%s", scanner.Text())
+			}
+
+			want := strings.Join(commands[i], " ")
+			have := scanner.Text()
+
+			if have != want {
+				t.Fatalf(
+					"Recorded command mismatch\nwant:%s (commands[%d])\nhave:%s",
+					want,
+					i,
+					have,
+				)
+			}
+		}
+	})
+
+	t.Run("Disabled", func(t *testing.T) {
+		var dbg debugger.Debugger
+		var recording bytes.Buffer
+
+		dbg.RecordSession(&recording)
+		dbg.RecordSession(nil)
+
+		for _, args := range commands {
+			if err := dbg.RecordCommand(args); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if recording.Len() != 0 {
+			t.Fatalf("Unexpected recording\nhave:%s", recording.String())
+		}
+	})
+}
+
+// Runs fn with stdout redirected, returning each line written
+func captureStdout(t *testing.T, fn func()) []string {
+	output, err := os.CreateTemp(t.TempDir(), "output")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer output.Close()
+
+	stdout := os.Stdout
+	os.Stdout = output
+	fn()
+	os.Stdout = stdout
+
+	if _, err := output.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+
+	var lines []string
+
+	scanner := bufio.NewScanner(output)
+
+	for scanner.Scan() {
+		lines = append(lines, scanner.Text())
+	}
+
+	return lines
+}
+
+func TestPrintSource(t *testing.T) {
+	tests := []struct {
+		Name    string
+		Newline string
+	}{
+		{"LF", "\n"},
+		{"CRLF", "\r\n"},
+	}
+
+	for _, test := range tests {
+		source := "ADD R0, R0, #1" + test.Newline + "RET" + test.Newline
+
+		t.Run(test.Name, func(t *testing.T) {
+			symtable := assembler.SymTable{
+				Symbols: make(map[uint16]int64),
+				Labels:  make(map[uint16]string),
+			}
+
+			if assembled := assembler.AssembleLC3Source(
+				strings.NewReader(source), assembler.WithSymTable(&symtable),
+			); !assembled.Success() {
+				t.Fatalf("Unexpected errors: %v", assembled.Errors)
+			}
+
+			file, err := os.CreateTemp(t.TempDir(), "source")
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			defer file.Close()
+
+			if _, err := file.WriteString(source); err != nil {
+				t.Fatal(err)
+			}
+
+			dbg := debugger.Debugger{
+				Color:    debugger.ColorNever,
+				Source:   file,
+				SymTable: &symtable,
+			}
+
+			lines := captureStdout(t, func() {
+				dbg.PrintSource(0x0000, 0x0001, 2)
+			})
+
+			want := []string{
+				"[0x0000] ADD R0, R0, #1",
+				"→ [0x0001] RET",
+			}
+
+			if len(lines) != len(want) {
+				t.Fatalf("Unexpected output\nwant:%q\nhave:%q", want, lines)
+			}
+
+			highlighted := 0
+
+			for i, line := range lines {
+				if line != want[i] {
+					t.Fatalf(
+						"Output mismatch\nwant:%s (line %d)\nhave:%s",
+						want[i], i, line,
+					)
+				}
+
+				if strings.HasPrefix(line, "→") {
+					highlighted++
+				}
+			}
+
+			if highlighted != 1 {
+				t.Fatalf(
+					"Unexpected highlighted lines\nwant:1\nhave:%d", highlighted,
+				)
+			}
+		})
+	}
+}
+
+func TestPrintDisasm(t *testing.T) {
+	const source = ".ORIG 0x3000\nLOOP ADD R0, R0, #-1\nBRp LOOP\nHALT\n"
+
+	symtable := assembler.SymTable{
+		Symbols: make(map[uint16]int64),
+		Labels:  make(map[uint16]string),
+	}
+
+	assembled := assembler.AssembleLC3Source(
+		strings.NewReader(source), assembler.WithSymTable(&symtable),
+	)
+
+	if !assembled.Success() {
+		t.Fatalf("Unexpected errors: %v", assembled.Errors)
+	}
+
+	result := assembled.Memory
+
+	var state machine.MachineState
+	copy(state.Memory[:], result)
+	state.Program = 0x3001
+
+	dbg := debugger.Debugger{Color: debugger.ColorNever}
+
+	t.Run("Symbol Table", func(t *testing.T) {
+		dbg.SymTable = &symtable
+
+		lines := captureStdout(t, func() {
+			dbg.PrintDisasm(&state, 0x3000, 3)
+		})
+
+		want := []string{
+			"[0x3000] LOOP ADD R0, R0, #-1",
+			"→ [0x3001] BRp LOOP",
+			"[0x3002] HALT",
+		}
+
+		if !reflect.DeepEqual(lines, want) {
+			t.Fatalf("Unexpected output\nwant:%q\nhave:%q", want, lines)
+		}
+	})
+
+	t.Run("No Symbol Table", func(t *testing.T) {
+		dbg.SymTable = nil
+
+		lines := captureStdout(t, func() {
+			dbg.PrintDisasm(&state, 0x3001, 1)
+		})
+
+		if want := []string{"→ [0x3001] BRp #-2"}; !reflect.DeepEqual(lines, want) {
+			t.Fatalf("Unexpected output\nwant:%q\nhave:%q", want, lines)
+		}
+	})
+}
+
+func TestPrintSourceNearest(t *testing.T) {
+	const source = "ADD R0, R0, #1\n.BLKW #4\nRET\n"
+
+	symtable := assembler.SymTable{
+		Symbols: make(map[uint16]int64),
+		Labels:  make(map[uint16]string),
+	}
+
+	if assembled := assembler.AssembleLC3Source(
+		strings.NewReader(source), assembler.WithSymTable(&symtable),
+	); !assembled.Success() {
+		t.Fatalf("Unexpected errors: %v", assembled.Errors)
+	}
+
+	file, err := os.CreateTemp(t.TempDir(), "source")
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	if _, err := file.WriteString(source); err != nil {
+		t.Fatal(err)
+	}
+
+	dbg := debugger.Debugger{
+		Color:    debugger.ColorNever,
+		Source:   file,
+		SymTable: &symtable,
+	}
+
+	lines := captureStdout(t, func() {
+		dbg.PrintSource(0x0003, 0x0003, 1)
+	})
+
+	// The address lies within the block reserved by .BLKW
+	want := []string{"[0x0001+2]", "[0x0001] .BLKW #4"}
+
+	if !reflect.DeepEqual(lines, want) {
+		t.Fatalf("Unexpected output\nwant:%q\nhave:%q", want, lines)
+	}
+}
+
+func TestWatchpointMaxHits(t *testing.T) {
+	var mc machine.Machine
+	var dbg debugger.Debugger
+
+	handled := 0
+
+	dbg.HandleWrite = func(uint16, *debugger.Debugger, *machine.Machine) {
+		handled++
+	}
+
+	dbg.Watchpoints = []debugger.Watchpoint{
+		{Addr: 0x3010, Type: debugger.WriteWatch, MaxHits: 2},
+	}
+
+	mc.State.Reset()
+	mc.State.Program = 0x3000
+	mc.State.Registers[1] = 5
+	mc.State.Memory[0x3000] = 0b0011_000_000001111   // ST R0, #15
+	mc.State.Memory[0x3001] = 0b0001_001_001_1_11111 // ADD R1, R1, #-1
+	mc.State.Memory[0x3002] = 0b0000_001_111111101   // BRp #-3
+	mc.Debugger = &dbg
+
+	for i := 0; i < 5*3; i++ {
+		mc.Step()
+	}
+
+	if have := dbg.Watchpoints[0].HitCount; have != 5 {
+		t.Fatalf("Watchpoint hit count mismatch\nwant:5\nhave:%d", have)
+	}
+
+	if handled != 2 {
+		t.Fatalf("HandleWrite call count mismatch\nwant:2\nhave:%d", handled)
+	}
+}
+
+func TestWatchpointSetMemory(t *testing.T) {
+	var mc machine.Machine
+	var dbg debugger.Debugger
+
+	var handled []uint16
+
+	dbg.HandleRead = func(addr uint16, _ *debugger.Debugger, _ *machine.Machine) {
+		handled = append(handled, addr)
+	}
+
+	dbg.HandleWrite = dbg.HandleRead
+
+	dbg.Watchpoints = []debugger.Watchpoint{
+		{Addr: 0x3010, Type: debugger.WriteWatch},
+		{Addr: 0x3020, Type: debugger.ReadWatch},
+	}
+
+	mc.Debugger = &dbg
+
+	mc.SetMemory(0x3010, 0x1234)
+	mc.GetMemory(0x3020)
+
+	if !reflect.DeepEqual(handled, []uint16{0x3010, 0x3020}) {
+		t.Fatalf(
+			"Watchpoint mismatch\nwant:[0x3010 0x3020]\nhave:%#04x", handled,
+		)
+	}
+}
+
+func TestPrintMemRange(t *testing.T) {
+	var mc machine.MachineState
+	dbg := debugger.Debugger{Color: debugger.ColorNever}
+
+	mc.Program = 0x3000
+
+	for i := uint16(0); i < 8; i++ {
+		mc.Memory[0x3000+i] = 0x1000 + i
+	}
+
+	tests := []struct {
+		Name   string
+		Args   []string
+		Output []string
+	}{
+		{
+			Name:   "Default",
+			Args:   []string{},
+			Output: []string{"[0x3000] 0x1000 [..] "},
+		},
+		{
+			Name: "Count",
+			Args: []string{"5"},
+			Output: []string{
+				"[0x3000] 0x1000 [..] 0x1001 [..] 0x1002 [..] 0x1003 [..] ",
+				"[0x3004] 0x1004 [..] ",
+			},
+		},
+		{
+			Name:   "Address",
+			Args:   []string{"0x3002", "2"},
+			Output: []string{"[0x3002] 0x1002 [..] 0x1003 [..] "},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			var err error
+
+			have := captureStdout(t, func() {
+				err = dbg.PrintMemRange(&mc, test.Args)
+			})
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if strings.Join(have, "\n") != strings.Join(test.Output, "\n") {
+				t.Fatalf(
+					"Output mismatch\nwant:%q\nhave:%q", test.Output, have,
+				)
+			}
+		})
+	}
+
+	t.Run("Invalid", func(t *testing.T) {
+		if err := dbg.PrintMemRange(&mc, []string{"foo"}); err == nil {
+			t.Fatal("Expected error for invalid argument")
+		}
+	})
+}
+
+func TestPrintMemASCII(t *testing.T) {
+	var mc machine.MachineState
+	dbg := debugger.Debugger{Color: debugger.ColorNever}
+
+	// "Hello\0" packed two characters per word
+	mc.Memory[0x3000] = 0x4865
+	mc.Memory[0x3001] = 0x6C6C
+	mc.Memory[0x3002] = 0x6F00
+
+	have := captureStdout(t, func() {
+		dbg.PrintMem(&mc, 0x3000, 3)
+	})
+
+	want := []string{"[0x3000] 0x4865 [He] 0x6c6c [ll] 0x6f00 [o.] "}
+
+	if !reflect.DeepEqual(have, want) {
+		t.Fatalf("Output mismatch\nwant:%q\nhave:%q", want, have)
+	}
+}
+
+func TestPrintStack(t *testing.T) {
+	var mc machine.MachineState
+
+	// Two frames pushed by subroutines saving their return address, i.e.
+	// ADD R6, R6, #-1; STR R7, R6, #0 following a JSR
+	mc.Registers[6] = 0x2FFE
+	mc.Memory[0x2FFE] = 0x3010
+	mc.Memory[0x2FFF] = 0x3001
+
+	dbg := debugger.Debugger{
+		Color: debugger.ColorNever,
+		SymTable: &assembler.SymTable{
+			Labels: map[uint16]string{0x2FFF: "STACK_BASE"},
+		},
+	}
+
+	t.Run("User", func(t *testing.T) {
+		have := captureStdout(t, func() {
+			dbg.PrintStack(&mc, 3)
+		})
+
+		want := []string{
+			"→ [0x2ffe] 0x3010",
+			"[0x2fff] 0x3001 STACK_BASE",
+			"[0x3000] 0x0000",
+		}
+
+		if !reflect.DeepEqual(have, want) {
+			t.Fatalf("Output mismatch\nwant:%q\nhave:%q", want, have)
+		}
+	})
+
+	t.Run("Supervisor", func(t *testing.T) {
+		mc.Procstat = 1 << machine.PSR_PRIV_BIT
+
+		have := captureStdout(t, func() {
+			dbg.PrintStack(&mc, 2)
+		})
+
+		want := []string{
+			"→ [0x2ffe] 0x3010 PC",
+			"[0x2fff] 0x3001 PSR STACK_BASE",
+		}
+
+		if !reflect.DeepEqual(have, want) {
+			t.Fatalf("Output mismatch\nwant:%q\nhave:%q", want, have)
+		}
+	})
+}
+
+func TestMaxBreakpoints(t *testing.T) {
+	t.Run("Limited", func(t *testing.T) {
+		dbg := debugger.Debugger{MaxBreakpoints: 1}
+
+		if _, err := dbg.AddBreakpoint(0x3000); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := dbg.AddBreakpoint(0x3001)
+
+		if _, ok := err.(*debugger.TooManyBreakpointsError); !ok {
+			t.Fatalf(
+				"Invalid error\nwant:%T\nhave:%T",
+				&debugger.TooManyBreakpointsError{},
+				err,
+			)
+		}
+
+		if len(dbg.Breakpoints) != 1 {
+			t.Fatalf("Invalid breakpoint count %d", len(dbg.Breakpoints))
+		}
+	})
+
+	t.Run("Unlimited", func(t *testing.T) {
+		var dbg debugger.Debugger
+
+		for addr := uint16(0x3000); addr < 0x3100; addr++ {
+			if _, err := dbg.AddBreakpoint(addr); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if len(dbg.Breakpoints) != 0x100 {
+			t.Fatalf("Invalid breakpoint count %d", len(dbg.Breakpoints))
+		}
+	})
+}
+
+func TestMaxWatchpoints(t *testing.T) {
+	t.Run("Limited", func(t *testing.T) {
+		dbg := debugger.Debugger{MaxWatchpoints: 1}
+
+		if _, err := dbg.AddWatchpoint(debugger.Watchpoint{
+			Addr: 0x3000, Type: debugger.ReadWatch,
+		}); err != nil {
+			t.Fatal(err)
+		}
+
+		_, err := dbg.AddWatchpoint(debugger.Watchpoint{
+			Addr: 0x3000, Type: debugger.WriteWatch,
+		})
+
+		if _, ok := err.(*debugger.TooManyWatchpointsError); !ok {
+			t.Fatalf(
+				"Invalid error\nwant:%T\nhave:%T",
+				&debugger.TooManyWatchpointsError{},
+				err,
+			)
+		}
+	})
+
+	t.Run("Unlimited", func(t *testing.T) {
+		var dbg debugger.Debugger
+
+		for addr := uint16(0x3000); addr < 0x3100; addr++ {
+			if _, err := dbg.AddWatchpoint(debugger.Watchpoint{
+				Addr: addr, Type: debugger.ReadWatch,
+			}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if len(dbg.Watchpoints) != 0x100 {
+			t.Fatalf("Invalid watchpoint count %d", len(dbg.Watchpoints))
+		}
+	})
+}
+
+func TestIsDeviceAddress(t *testing.T) {
+	for _, test := range []struct {
+		Addr uint16
+		Want bool
+	}{
+		{0x3000, false},
+		{0xFDFF, false},
+		{machine.DEV_KBSR, true},
+		{machine.DEV_DDR, true},
+		{machine.DEV_MCR, true},
+		{0xFFFF, true},
+	} {
+		if have := debugger.IsDeviceAddress(test.Addr); have != test.Want {
+			t.Fatalf(
+				"Invalid result for %#04x\nwant:%t\nhave:%t",
+				test.Addr,
+				test.Want,
+				have,
+			)
+		}
+	}
+}
+
+func TestStepOver(t *testing.T) {
+	var mc machine.Machine
+	var dbg debugger.Debugger
+
+	var stops []uint16
+	dbg.HandleBreak = func(dbg *debugger.Debugger, mc *machine.Machine) {
+		stops = append(stops, mc.State.Program)
+	}
+
+	mc.State.Reset()
+	mc.State.Program = 0x3000
+	mc.State.Memory[0x3000] = 0b0100_1_00000000011   // JSR #3
+	mc.State.Memory[0x3001] = 0b0001_000_000_1_00001 // ADD R0, R0, #1
+	mc.State.Memory[0x3004] = 0b0001_001_001_1_00001 // ADD R1, R1, #1
+	mc.State.Memory[0x3005] = 0b1100_000_111_000000  // RET
+	mc.Debugger = &dbg
+
+	t.Run("Subroutine", func(t *testing.T) {
+		dbg.StepOver(&mc)
+
+		for i := 0; i < 3 && len(stops) == 0; i++ {
+			mc.Step()
+		}
+
+		if !reflect.DeepEqual(stops, []uint16{0x3001}) {
+			t.Fatalf("Step over mismatch\nwant:[0x3001]\nhave:%#04x", stops)
+		}
+
+		if mc.State.Registers[1] != 1 {
+			t.Fatal("Subroutine was not executed")
+		}
+
+		if len(dbg.Breakpoints) != 0 {
+			t.Fatalf("One-shot breakpoint was not removed %v", dbg.Breakpoints)
+		}
+	})
+
+	t.Run("Instruction", func(t *testing.T) {
+		stops = nil
+		dbg.StepOver(&mc)
+		mc.Step()
+
+		if !reflect.DeepEqual(stops, []uint16{0x3002}) {
+			t.Fatalf("Step mismatch\nwant:[0x3002]\nhave:%#04x", stops)
+		}
+	})
+
+	t.Run("Earlier Breakpoint", func(t *testing.T) {
+		stops = nil
+		dbg.Break = false
+		mc.State.Program = 0x3000
+
+		if _, err := dbg.AddBreakpoint(0x3004); err != nil {
+			t.Fatal(err)
+		}
+
+		dbg.StepOver(&mc)
+
+		for i := 0; i < 4; i++ {
+			mc.Step()
+			dbg.Break = false
+		}
+
+		// The one-shot breakpoint is discarded by halting inside the call
+		if !reflect.DeepEqual(stops, []uint16{0x3004}) {
+			t.Fatalf("Step over mismatch\nwant:[0x3004]\nhave:%#04x", stops)
+		}
+	})
+}
+
+func TestStepOut(t *testing.T) {
+	var mc machine.Machine
+	var dbg debugger.Debugger
+
+	var stops []uint16
+	dbg.HandleBreak = func(dbg *debugger.Debugger, mc *machine.Machine) {
+		stops = append(stops, mc.State.Program)
+	}
+
+	mc.State.Reset()
+	mc.State.Program = 0x3004
+	mc.State.Registers[7] = 0x3001
+	mc.State.Memory[0x3001] = 0b0001_000_000_1_00001 // ADD R0, R0, #1
+	mc.State.Memory[0x3004] = 0b0001_001_001_1_00001 // ADD R1, R1, #1
+	mc.State.Memory[0x3005] = 0b1100_000_111_000000  // RET
+	mc.Debugger = &dbg
+
+	dbg.StepOut(&mc)
+
+	for i := 0; i < 3 && len(stops) == 0; i++ {
+		mc.Step()
+	}
+
+	if !reflect.DeepEqual(stops, []uint16{0x3001}) {
+		t.Fatalf("Step out mismatch\nwant:[0x3001]\nhave:%#04x", stops)
+	}
+
+	if mc.State.Registers[1] != 1 {
+		t.Fatal("Subroutine was not executed")
+	}
+
+	if len(dbg.Breakpoints) != 0 {
+		t.Fatalf("One-shot breakpoint was not removed %v", dbg.Breakpoints)
+	}
+}
@@ -0,0 +1,157 @@
+// Copyright (C) 2021  Antonio Lassandro
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+
+// You should have received a copy of the GNU General Public License along
+// with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package debugger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/lassandro/golc3/pkg/assembler"
+	"github.com/lassandro/golc3/pkg/encoding"
+	"github.com/lassandro/golc3/pkg/machine"
+)
+
+type jsonBreakpoint struct {
+	Addr      string `json:"addr"`
+	Condition string `json:"condition,omitempty"`
+	OneShot   bool   `json:"oneShot,omitempty"`
+}
+
+type jsonWatchpoint struct {
+	Addr     string `json:"addr"`
+	Type     string `json:"type"`
+	HitCount uint64 `json:"hitCount,omitempty"`
+	MaxHits  uint64 `json:"maxHits,omitempty"`
+}
+
+type jsonSession struct {
+	Machine     *machine.MachineState `json:"machine"`
+	Breakpoints []jsonBreakpoint      `json:"breakpoints"`
+	Watchpoints []jsonWatchpoint      `json:"watchpoints"`
+	SymTable    *assembler.SymTable   `json:"symtable,omitempty"`
+}
+
+var watchpointTypeNames = map[WatchpointType]string{
+	WriteWatch:     "write",
+	ReadWatch:      "read",
+	ReadWriteWatch: "readwrite",
+}
+
+func formatWord(value uint16) string {
+	return fmt.Sprintf("0x%04X", value)
+}
+
+// Writes the machine state along with the breakpoints, watchpoints and symbol
+// table of the session as JSON, i.e. {"machine": {...}, "breakpoints":
+// [{"addr": "0x3000"}], "watchpoints": [{"addr": "0x3100", "type": "write"}]}
+func ExportJSON(dbg *Debugger, mc *machine.Machine, w io.Writer) error {
+	session := jsonSession{
+		Machine:     &mc.State,
+		Breakpoints: make([]jsonBreakpoint, 0, len(dbg.Breakpoints)),
+		Watchpoints: make([]jsonWatchpoint, 0, len(dbg.Watchpoints)),
+		SymTable:    dbg.SymTable,
+	}
+
+	for _, breakpoint := range dbg.Breakpoints {
+		session.Breakpoints = append(session.Breakpoints, jsonBreakpoint{
+			Addr:      formatWord(breakpoint.Addr),
+			Condition: breakpoint.Condition,
+			OneShot:   breakpoint.OneShot,
+		})
+	}
+
+	for _, watchpoint := range dbg.Watchpoints {
+		session.Watchpoints = append(session.Watchpoints, jsonWatchpoint{
+			Addr:     formatWord(watchpoint.Addr),
+			Type:     watchpointTypeNames[watchpoint.Type],
+			HitCount: watchpoint.HitCount,
+			MaxHits:  watchpoint.MaxHits,
+		})
+	}
+
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(&session)
+}
+
+// Restores a session written by ExportJSON. The returned debugger has no
+// handlers set, such that they may be kept from the debugger being replaced
+func ImportJSON(r io.Reader) (Debugger, machine.MachineState, error) {
+	var dbg Debugger
+	var state machine.MachineState
+
+	session := jsonSession{Machine: &state}
+
+	if err := json.NewDecoder(r).Decode(&session); err != nil {
+		return dbg, state, err
+	}
+
+	for _, breakpoint := range session.Breakpoints {
+		addr, err := encoding.DecodeHex(breakpoint.Addr)
+
+		if err != nil {
+			return dbg, state, err
+		}
+
+		var parsed *Condition
+
+		if breakpoint.Condition != "" {
+			if parsed, err = ParseCondition(breakpoint.Condition); err != nil {
+				return dbg, state, err
+			}
+		}
+
+		dbg.Breakpoints = append(dbg.Breakpoints, Breakpoint{
+			Addr:      addr,
+			Condition: breakpoint.Condition,
+			OneShot:   breakpoint.OneShot,
+			parsed:    parsed,
+		})
+	}
+
+	for _, watchpoint := range session.Watchpoints {
+		addr, err := encoding.DecodeHex(watchpoint.Addr)
+
+		if err != nil {
+			return dbg, state, err
+		}
+
+		found := false
+		imported := Watchpoint{
+			Addr:     addr,
+			HitCount: watchpoint.HitCount,
+			MaxHits:  watchpoint.MaxHits,
+		}
+
+		for kind, name := range watchpointTypeNames {
+			if name == watchpoint.Type {
+				imported.Type = kind
+				found = true
+			}
+		}
+
+		if !found {
+			return dbg, state, &InvalidWatchpointTypeError{watchpoint.Type}
+		}
+
+		dbg.Watchpoints = append(dbg.Watchpoints, imported)
+	}
+
+	dbg.SymTable = session.SymTable
+
+	return dbg, state, nil
+}
@@ -0,0 +1,107 @@
+// Copyright (C) 2021  Antonio Lassandro
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+
+// You should have received a copy of the GNU General Public License along
+// with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package debugger_test
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/lassandro/golc3/pkg/assembler"
+	"github.com/lassandro/golc3/pkg/debugger"
+	"github.com/lassandro/golc3/pkg/machine"
+)
+
+func TestExportJSON(t *testing.T) {
+	var mc machine.Machine
+	mc.State.Reset()
+	mc.State.Registers[0] = 0x0042
+	mc.State.Registers[6] = 0x2FFF
+	mc.State.Program = 0x3001
+	mc.State.Memory[0x3000] = 0x1021
+	mc.State.Memory[0x3001] = 0xF025
+
+	dbg := debugger.Debugger{
+		Breakpoints: []debugger.Breakpoint{
+			{Addr: 0x3000},
+			{Addr: 0x3001, Condition: "R0==0x42"},
+		},
+		Watchpoints: []debugger.Watchpoint{
+			{Addr: 0x3100, Type: debugger.ReadWatch, HitCount: 2},
+			{Addr: 0x3101, Type: debugger.ReadWriteWatch, MaxHits: 1},
+		},
+		SymTable: &assembler.SymTable{
+			Source:  "main.asm",
+			Symbols: map[uint16]int64{0x3000: 13, 0x3001: 28},
+			Labels:  map[uint16]string{0x3000: "MAIN"},
+		},
+	}
+
+	var exported bytes.Buffer
+
+	if err := debugger.ExportJSON(&dbg, &mc, &exported); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	imported, state, err := debugger.ImportJSON(
+		bytes.NewReader(exported.Bytes()),
+	)
+
+	if err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if deltas := mc.State.Diff(state); len(deltas) != 0 {
+		t.Fatalf("State mismatch: %v", deltas)
+	}
+
+	if imported.SymTable == nil || imported.SymTable.Labels[0x3000] != "MAIN" {
+		t.Fatalf("Symbol table mismatch: %+v", imported.SymTable)
+	}
+
+	restored := machine.Machine{State: state}
+	var reexported bytes.Buffer
+
+	if err := debugger.ExportJSON(&imported, &restored, &reexported); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if exported.String() != reexported.String() {
+		t.Fatalf(
+			"Round trip mismatch\nwant:%s\nhave:%s",
+			exported.String(), reexported.String(),
+		)
+	}
+}
+
+func TestImportJSONInvalidWatchpoint(t *testing.T) {
+	const session = `{"machine": {"program": "0x3000", "procstat": "0x0000",
+		"stack": "0x0000"}, "watchpoints": [{"addr": "0x3000", "type": "exec"}]}`
+
+	if _, _, err := debugger.ImportJSON(strings.NewReader(session)); err == nil {
+		t.Fatal("Expected error for invalid watchpoint type")
+	}
+}
+
+func TestImportJSONInvalidCondition(t *testing.T) {
+	const session = `{"machine": {"program": "0x3000", "procstat": "0x0000",
+		"stack": "0x0000"}, "breakpoints": [{"addr": "0x3000",
+		"condition": "R8==0"}]}`
+
+	if _, _, err := debugger.ImportJSON(strings.NewReader(session)); err == nil {
+		t.Fatal("Expected error for invalid breakpoint condition")
+	}
+}
@@ -0,0 +1,215 @@
+// Copyright (C) 2021  Antonio Lassandro
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+
+// You should have received a copy of the GNU General Public License along
+// with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package debugger
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Previously entered commands, oldest first
+type History struct {
+	Lines []string
+
+	// Limit on the number of lines kept, zero is unlimited
+	Max int
+}
+
+// Appends a line, ignoring blank lines and repeats of the last line
+func (h *History) Add(line string) {
+	line = strings.TrimSpace(line)
+
+	if line == "" {
+		return
+	}
+
+	if n := len(h.Lines); n > 0 && h.Lines[n-1] == line {
+		return
+	}
+
+	h.Lines = append(h.Lines, line)
+
+	if h.Max > 0 && len(h.Lines) > h.Max {
+		h.Lines = h.Lines[len(h.Lines)-h.Max:]
+	}
+}
+
+// Returns the most recent line, or an empty string if there is none
+func (h *History) Last() string {
+	if len(h.Lines) == 0 {
+		return ""
+	}
+
+	return h.Lines[len(h.Lines)-1]
+}
+
+// Returns the command to run for an entered line, such that an empty line
+// repeats the last command. Other lines are added to the history
+func (h *History) Resolve(line string) string {
+	line = strings.TrimSpace(line)
+
+	if line == "" {
+		return h.Last()
+	}
+
+	h.Add(line)
+	return line
+}
+
+// Appends each line read from r
+func (h *History) Load(r io.Reader) error {
+	scanner := bufio.NewScanner(r)
+
+	for scanner.Scan() {
+		h.Add(scanner.Text())
+	}
+
+	return scanner.Err()
+}
+
+// Writes each line, oldest first
+func (h *History) Save(w io.Writer) error {
+	for _, line := range h.Lines {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Reads lines from a terminal with echo and canonical mode disabled. The up
+// and down arrows cycle through the history, ^U clears the line and ^W deletes
+// the last word
+type LineEditor struct {
+	Input   *bufio.Reader
+	Output  io.Writer
+	History *History
+}
+
+const (
+	keyInterrupt = 0x03
+	keyEOF       = 0x04
+	keyBackspace = 0x08
+	keyClearLine = 0x15
+	keyClearWord = 0x17
+	keyEscape    = 0x1b
+	keyDelete    = 0x7f
+)
+
+// Reads a line following the prompt, returning io.EOF if ^D is entered on an
+// empty line
+func (ed *LineEditor) ReadLine(prompt string) (string, error) {
+	var line []byte
+	var pending []byte
+
+	index := len(ed.History.Lines)
+
+	redraw := func() {
+		fmt.Fprintf(ed.Output, "\r\033[K%s%s", prompt, line)
+	}
+
+	fmt.Fprint(ed.Output, prompt)
+
+	for {
+		key, err := ed.Input.ReadByte()
+
+		if err != nil {
+			return "", err
+		}
+
+		switch key {
+		case '\r', '\n':
+			fmt.Fprintln(ed.Output)
+			return string(line), nil
+
+		case keyEOF:
+			if len(line) == 0 {
+				fmt.Fprintln(ed.Output)
+				return "", io.EOF
+			}
+
+		case keyInterrupt:
+			line = line[:0]
+			fmt.Fprintln(ed.Output, "^C")
+			fmt.Fprint(ed.Output, prompt)
+
+		case keyBackspace, keyDelete:
+			if len(line) > 0 {
+				line = line[:len(line)-1]
+				redraw()
+			}
+
+		case keyClearLine:
+			line = line[:0]
+			redraw()
+
+		case keyClearWord:
+			end := len(strings.TrimRight(string(line), " "))
+			start := strings.LastIndexByte(string(line[:end]), ' ') + 1
+			line = line[:start]
+			redraw()
+
+		case keyEscape:
+			// Arrow keys are sent as ESC [ A through ESC [ D
+			if next, err := ed.Input.ReadByte(); err != nil {
+				return "", err
+			} else if next != '[' {
+				continue
+			}
+
+			arrow, err := ed.Input.ReadByte()
+
+			if err != nil {
+				return "", err
+			}
+
+			switch {
+			case arrow == 'A' && index > 0:
+				// The line being entered is kept for when the end of the
+				// history is reached again
+				if index == len(ed.History.Lines) {
+					pending = append(pending[:0], line...)
+				}
+
+				index--
+				line = append(line[:0], ed.History.Lines[index]...)
+				redraw()
+
+			case arrow == 'B' && index < len(ed.History.Lines):
+				index++
+
+				if index == len(ed.History.Lines) {
+					line = append(line[:0], pending...)
+				} else {
+					line = append(line[:0], ed.History.Lines[index]...)
+				}
+
+				redraw()
+			}
+
+		default:
+			if key < ' ' {
+				continue
+			}
+
+			line = append(line, key)
+			ed.Output.Write([]byte{key})
+		}
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright (C) 2021  Antonio Lassandro
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+
+// You should have received a copy of the GNU General Public License along
+// with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package debugger_test
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/lassandro/golc3/pkg/debugger"
+)
+
+func TestHistoryResolve(t *testing.T) {
+	var history debugger.History
+
+	if have := history.Resolve(""); have != "" {
+		t.Fatalf("Expected empty command, have '%s'", have)
+	}
+
+	tests := []struct {
+		Line string
+		Want string
+	}{
+		{"break list", "break list"},
+		{"", "break list"},
+		{"   ", "break list"},
+		{" reg R0 ", "reg R0"},
+		{"", "reg R0"},
+	}
+
+	for _, test := range tests {
+		if have := history.Resolve(test.Line); have != test.Want {
+			t.Fatalf(
+				"Command mismatch for '%s'\nwant:%s\nhave:%s",
+				test.Line, test.Want, have,
+			)
+		}
+	}
+
+	if len(history.Lines) != 2 {
+		t.Fatalf("Expected 2 lines of history, have %v", history.Lines)
+	}
+}
+
+// An empty line repeats the last command whether lines are read by the line
+// editor or from a plain reader, as when replaying a session
+func TestHistoryRepeatLine(t *testing.T) {
+	const input = "next\n\n"
+
+	readers := map[string]func(*debugger.History) func() (string, error){
+		"Editor": func(history *debugger.History) func() (string, error) {
+			ed := debugger.LineEditor{
+				Input:   bufio.NewReader(strings.NewReader(input)),
+				Output:  io.Discard,
+				History: history,
+			}
+
+			return func() (string, error) { return ed.ReadLine("(dbg) ") }
+		},
+		"Scanner": func(history *debugger.History) func() (string, error) {
+			scanner := bufio.NewScanner(strings.NewReader(input))
+
+			return func() (string, error) {
+				if !scanner.Scan() {
+					return "", io.EOF
+				}
+
+				return scanner.Text(), nil
+			}
+		},
+	}
+
+	for name, reader := range readers {
+		t.Run(name, func(t *testing.T) {
+			var history debugger.History
+			readLine := reader(&history)
+
+			for i := 0; i < 2; i++ {
+				line, err := readLine()
+
+				if err != nil {
+					t.Fatalf("Unexpected error: %s", err)
+				}
+
+				if have := history.Resolve(line); have != "next" {
+					t.Fatalf("Command mismatch\nwant:next\nhave:%s", have)
+				}
+			}
+		})
+	}
+}
+
+func TestLineEditor(t *testing.T) {
+	history := debugger.History{
+		Lines: []string{"break list", "reg R0"},
+	}
+
+	tests := []struct {
+		Name  string
+		Input string
+		Want  string
+	}{
+		{"Plain", "next\r", "next"},
+		{"Backspace", "nexx\x7ft\r", "next"},
+		{"Clear Line", "break add\x15next\r", "next"},
+		{"Clear Word", "break add 0x3000 \x17\x17list\r", "break list"},
+		{"Up", "\x1b[A\r", "reg R0"},
+		{"Up Twice", "\x1b[A\x1b[A\x1b[A\r", "break list"},
+		{"Up Down", "mem\x1b[A\x1b[B\r", "mem"},
+		{"Edit History", "\x1b[A\x7f1\r", "reg R1"},
+		{"Ignore Control", "ne\x01xt\r", "next"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			var output bytes.Buffer
+
+			ed := debugger.LineEditor{
+				Input:   bufio.NewReader(strings.NewReader(test.Input)),
+				Output:  &output,
+				History: &history,
+			}
+
+			have, err := ed.ReadLine("(dbg) ")
+
+			if err != nil {
+				t.Fatalf("Unexpected error: %s", err)
+			}
+
+			if have != test.Want {
+				t.Fatalf("Line mismatch\nwant:%s\nhave:%s", test.Want, have)
+			}
+		})
+	}
+
+	ed := debugger.LineEditor{
+		Input:   bufio.NewReader(strings.NewReader("\x04")),
+		Output:  io.Discard,
+		History: &history,
+	}
+
+	if _, err := ed.ReadLine("(dbg) "); err != io.EOF {
+		t.Fatalf("Expected io.EOF, have %v", err)
+	}
+}
+
+func TestHistorySaveLoad(t *testing.T) {
+	history := debugger.History{Max: 2}
+	history.Add("break list")
+	history.Add("next")
+	history.Add("next")
+	history.Add("reg R0")
+
+	var saved bytes.Buffer
+
+	if err := history.Save(&saved); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if want := "next\nreg R0\n"; saved.String() != want {
+		t.Fatalf("History mismatch\nwant:%q\nhave:%q", want, saved.String())
+	}
+
+	var loaded debugger.History
+
+	if err := loaded.Load(&saved); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if loaded.Last() != "reg R0" || len(loaded.Lines) != 2 {
+		t.Fatalf("Loaded history mismatch: %v", loaded.Lines)
+	}
+}
@@ -0,0 +1,90 @@
+// Copyright (C) 2021  Antonio Lassandro
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+
+// You should have received a copy of the GNU General Public License along
+// with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package debugger
+
+import (
+	"encoding/json"
+	"io"
+)
+
+// Commands and responses are exchanged as newline-delimited JSON objects, i.e.
+// {"cmd":"break","args":["add","0x3000"]} -> {"ok":true,"output":"..."}
+type RemoteCommand struct {
+	Cmd  string   `json:"cmd"`
+	Args []string `json:"args"`
+}
+
+type RemoteResponse struct {
+	Ok     bool   `json:"ok"`
+	Output string `json:"output"`
+}
+
+// Runs a remote command, returning the output it produced
+type RemoteHandler func(cmd string, args []string) (string, error)
+
+// Replies to each command read from conn with the result of handle, until conn
+// is closed
+func ServeRemote(conn io.ReadWriter, handle RemoteHandler) error {
+	decoder := json.NewDecoder(conn)
+	encoder := json.NewEncoder(conn)
+
+	for {
+		var command RemoteCommand
+
+		if err := decoder.Decode(&command); err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		var response RemoteResponse
+
+		if output, err := handle(command.Cmd, command.Args); err != nil {
+			response.Output = err.Error()
+		} else {
+			response.Ok = true
+			response.Output = output
+		}
+
+		if err := encoder.Encode(&response); err != nil {
+			return err
+		}
+	}
+}
+
+type RemoteClient struct {
+	decoder *json.Decoder
+	encoder *json.Encoder
+}
+
+func NewRemoteClient(conn io.ReadWriter) *RemoteClient {
+	return &RemoteClient{
+		decoder: json.NewDecoder(conn),
+		encoder: json.NewEncoder(conn),
+	}
+}
+
+// Sends a command to the remote debugger and waits for its response
+func (client *RemoteClient) Send(cmd string, args []string) (RemoteResponse, error) {
+	var response RemoteResponse
+
+	if err := client.encoder.Encode(&RemoteCommand{cmd, args}); err != nil {
+		return response, err
+	}
+
+	err := client.decoder.Decode(&response)
+	return response, err
+}
@@ -0,0 +1,91 @@
+// Copyright (C) 2021  Antonio Lassandro
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+
+// You should have received a copy of the GNU General Public License along
+// with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package debugger_test
+
+import (
+	"fmt"
+	"net"
+	"testing"
+
+	"github.com/lassandro/golc3/pkg/debugger"
+)
+
+func TestRemote(t *testing.T) {
+	var dbg debugger.Debugger
+
+	server, client := net.Pipe()
+	defer client.Close()
+
+	go func() {
+		defer server.Close()
+
+		debugger.ServeRemote(server, func(cmd string, args []string) (string, error) {
+			switch cmd {
+			case "break":
+				dbg.Breakpoints = append(
+					dbg.Breakpoints, debugger.Breakpoint{Addr: 0x3000},
+				)
+				return "Breakpoint added", nil
+			case "continue":
+				dbg.Break = false
+				return "", nil
+			case "next":
+				dbg.Break = true
+				return "", nil
+			}
+
+			return "", fmt.Errorf("'%s' is not a valid command", cmd)
+		})
+	}()
+
+	remote := debugger.NewRemoteClient(client)
+
+	commands := []debugger.RemoteCommand{
+		{Cmd: "break", Args: []string{"add", "0x3000"}},
+		{Cmd: "next"},
+		{Cmd: "continue"},
+	}
+
+	for _, command := range commands {
+		response, err := remote.Send(command.Cmd, command.Args)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !response.Ok {
+			t.Fatalf(
+				"Remote command failed\nwant:ok (%s)\nhave:%s",
+				command.Cmd,
+				response.Output,
+			)
+		}
+	}
+
+	if len(dbg.Breakpoints) != 1 || dbg.Breakpoints[0].Addr != 0x3000 {
+		t.Fatalf("Breakpoint not added\nhave:%v", dbg.Breakpoints)
+	}
+
+	response, err := remote.Send("foo", nil)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if response.Ok {
+		t.Fatal("Expected invalid command to fail")
+	}
+}
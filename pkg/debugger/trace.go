@@ -0,0 +1,135 @@
+// Copyright (C) 2021  Antonio Lassandro
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+
+// You should have received a copy of the GNU General Public License along
+// with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package debugger
+
+import (
+	"io"
+	"strings"
+
+	"github.com/lassandro/golc3/pkg/assembler"
+	"github.com/lassandro/golc3/pkg/encoding"
+	"github.com/lassandro/golc3/pkg/machine"
+)
+
+const hexDigits = "0123456789abcdef"
+
+// Begins writing a line to w for each instruction executed from the current
+// program counter onwards, i.e. PC=0x3000 ADD R0, R1, R2 | R0:0x0003 where the
+// registers listed are those changed by the instruction
+func (dbg *Debugger) StartTrace(w io.Writer, mc *machine.Machine) {
+	dbg.TraceWriter = w
+	dbg.traceProgram = mc.State.Program
+	dbg.traceRegisters = mc.State.Registers
+	dbg.traceErr = nil
+}
+
+// Stops tracing, returning the first error encountered while writing
+func (dbg *Debugger) StopTrace() error {
+	err := dbg.traceErr
+
+	dbg.TraceWriter = nil
+	dbg.traceErr = nil
+
+	return err
+}
+
+// Writes the line for the instruction which has just executed. Called on every
+// step, so the line is built in a buffer held by the debugger and statements
+// are disassembled once per address
+func (dbg *Debugger) trace(mc *machine.Machine) {
+	addr := dbg.traceProgram
+	word := mc.State.Memory[addr]
+
+	// Indexed by address rather than hashed, as a map lookup dominates the
+	// cost of tracing a step
+	if dbg.traceCache == nil {
+		dbg.traceCache = make([]traceEntry, 1<<16)
+	}
+
+	entry := &dbg.traceCache[addr]
+
+	// Disassembly is never empty, so an empty statement is yet to be cached
+	if entry.statement == "" || entry.word != word {
+		*entry = traceEntry{
+			word:      word,
+			statement: assembler.DisassembleWord(word, addr, dbg.SymTable),
+		}
+	}
+
+	line := append(dbg.traceBuffer[:0], "PC="...)
+	line = appendWord(line, addr)
+	line = append(line, ' ')
+	line = append(line, entry.statement...)
+
+	separator := " | "
+
+	for i, value := range mc.State.Registers {
+		if value == dbg.traceRegisters[i] {
+			continue
+		}
+
+		line = append(line, separator...)
+		line = append(line, 'R', '0'+byte(i), ':')
+		line = appendWord(line, value)
+		separator = " "
+	}
+
+	line = append(line, '\n')
+
+	if _, err := dbg.TraceWriter.Write(line); err != nil && dbg.traceErr == nil {
+		dbg.traceErr = err
+	}
+
+	dbg.traceProgram = mc.State.Program
+	dbg.traceRegisters = mc.State.Registers
+}
+
+func appendWord(line []byte, value uint16) []byte {
+	return append(line, '0', 'x',
+		hexDigits[value>>12],
+		hexDigits[(value>>8)&0xF],
+		hexDigits[(value>>4)&0xF],
+		hexDigits[value&0xF],
+	)
+}
+
+// Parses a line written by a trace, returning the address and statement of the
+// executed instruction
+func ParseTraceLine(line string) (uint16, string, error) {
+	if !strings.HasPrefix(line, "PC=") {
+		return 0, "", &InvalidTraceLineError{line}
+	}
+
+	fields := strings.SplitN(line[3:], " ", 2)
+
+	if len(fields) != 2 {
+		return 0, "", &InvalidTraceLineError{line}
+	}
+
+	addr, err := encoding.DecodeHex(fields[0])
+
+	if err != nil {
+		return 0, "", &InvalidTraceLineError{line}
+	}
+
+	statement := fields[1]
+
+	if i := strings.Index(statement, " | "); i != -1 {
+		statement = statement[:i]
+	}
+
+	return addr, statement, nil
+}
@@ -0,0 +1,153 @@
+// Copyright (C) 2021  Antonio Lassandro
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+
+// You should have received a copy of the GNU General Public License along
+// with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package debugger_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/lassandro/golc3/pkg/assembler"
+	"github.com/lassandro/golc3/pkg/debugger"
+	"github.com/lassandro/golc3/pkg/machine"
+)
+
+const traceSource = ".ORIG 0x3000\nAND R0, R0, #0\nLOOP ADD R0, R0, #1\nBRnzp LOOP\n"
+
+func newTraceMachine(t testing.TB) (*machine.Machine, *debugger.Debugger) {
+	symtable := assembler.SymTable{
+		Symbols: make(map[uint16]int64),
+		Labels:  make(map[uint16]string),
+	}
+
+	assembled := assembler.AssembleLC3Source(
+		strings.NewReader(traceSource), assembler.WithSymTable(&symtable),
+	)
+
+	if !assembled.Success() {
+		t.Fatalf("Unexpected errors: %v", assembled.Errors)
+	}
+
+	result := assembled.Memory
+
+	var mc machine.Machine
+	dbg := debugger.Debugger{SymTable: &symtable}
+
+	copy(mc.State.Memory[:], result)
+	mc.State.Program = 0x3000
+	mc.Debugger = &dbg
+
+	return &mc, &dbg
+}
+
+func TestTrace(t *testing.T) {
+	mc, dbg := newTraceMachine(t)
+	mc.State.Registers[0] = 0x0042
+
+	var output bytes.Buffer
+	dbg.StartTrace(&output, mc)
+
+	for i := 0; i < 4; i++ {
+		mc.Step()
+	}
+
+	if err := dbg.StopTrace(); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	// Execution after the trace stops is not written
+	mc.Step()
+
+	want := strings.Join([]string{
+		"PC=0x3000 AND R0, R0, #0 | R0:0x0000",
+		"PC=0x3001 ADD R0, R0, #1 | R0:0x0001",
+		"PC=0x3002 BRnzp LOOP",
+		"PC=0x3001 ADD R0, R0, #1 | R0:0x0002",
+	}, "\n") + "\n"
+
+	if have := output.String(); have != want {
+		t.Fatalf("Trace mismatch\nwant:%s\nhave:%s", want, have)
+	}
+}
+
+func TestTraceAllocations(t *testing.T) {
+	mc, dbg := newTraceMachine(t)
+	dbg.StartTrace(io.Discard, mc)
+
+	// Statements are disassembled once per address on first execution
+	for i := 0; i < 3; i++ {
+		mc.Step()
+	}
+
+	if allocs := testing.AllocsPerRun(1000, mc.Step); allocs != 0 {
+		t.Fatalf("Expected no allocations per step, have %f", allocs)
+	}
+}
+
+func TestParseTraceLine(t *testing.T) {
+	tests := []struct {
+		Line      string
+		Addr      uint16
+		Statement string
+	}{
+		{"PC=0x3000 AND R0, R0, #0 | R0:0x0000", 0x3000, "AND R0, R0, #0"},
+		{"PC=0x3002 BRnzp LOOP", 0x3002, "BRnzp LOOP"},
+	}
+
+	for _, test := range tests {
+		addr, statement, err := debugger.ParseTraceLine(test.Line)
+
+		if err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		if addr != test.Addr || statement != test.Statement {
+			t.Fatalf(
+				"Parse mismatch for '%s'\nwant:%#04x %s\nhave:%#04x %s",
+				test.Line, test.Addr, test.Statement, addr, statement,
+			)
+		}
+	}
+
+	for _, line := range []string{"", "PC=0x3000", "PC=zz ADD", "0x3000 ADD"} {
+		if _, _, err := debugger.ParseTraceLine(line); err == nil {
+			t.Fatalf("Expected error for '%s'", line)
+		}
+	}
+}
+
+func benchmarkStep(b *testing.B, trace bool) {
+	mc, dbg := newTraceMachine(b)
+
+	if trace {
+		dbg.StartTrace(io.Discard, mc)
+	}
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		mc.Step()
+	}
+}
+
+func BenchmarkStep(b *testing.B) {
+	benchmarkStep(b, false)
+}
+
+func BenchmarkStepTrace(b *testing.B) {
+	benchmarkStep(b, true)
+}
@@ -16,6 +16,8 @@
 package debugger
 
 import (
+	"fmt"
+	"io"
 	"os"
 
 	"github.com/lassandro/golc3/pkg/assembler"
@@ -23,27 +25,116 @@ import (
 )
 
 type WatchpointType uint
+type ColorMode uint
 
 type Watchpoint struct {
 	Addr uint16
 	Type WatchpointType
+
+	// Number of times the watchpoint has been triggered
+	HitCount uint64
+	// Halts execution only for the first MaxHits triggers, zero is unlimited
+	MaxHits uint64
 }
 
 type Breakpoint struct {
 	Addr uint16
+
+	// Halts execution only when the condition holds, see ParseCondition. An
+	// empty condition always halts
+	Condition string
+
+	// Condition as parsed when the breakpoint was added, so that it is not
+	// parsed again each time the breakpoint is reached
+	parsed *Condition
+
+	// Removed once execution halts, whether by this breakpoint or another
+	OneShot bool
 }
 
 type Debugger struct {
 	Break bool
+	Color ColorMode
 
 	Breakpoints []Breakpoint
 	Watchpoints []Watchpoint
 
+	// Limits on the number of breakpoints and watchpoints, zero is unlimited
+	MaxBreakpoints int
+	MaxWatchpoints int
+
 	Source   *os.File
 	Binary   *os.File
 	SymTable *assembler.SymTable
 
+	recorder io.Writer
+
+	// Receives a line for each executed instruction while set, see StartTrace
+	TraceWriter io.Writer
+
+	traceProgram   uint16
+	traceRegisters [8]uint16
+	traceCache     []traceEntry
+	traceBuffer    [128]byte
+	traceErr       error
+
 	HandleBreak func(*Debugger, *machine.Machine)
 	HandleRead  func(uint16, *Debugger, *machine.Machine)
 	HandleWrite func(uint16, *Debugger, *machine.Machine)
 }
+
+// Disassembly of a traced instruction, kept until the word at its address
+// changes
+type traceEntry struct {
+	word      uint16
+	statement string
+}
+
+type TooManyBreakpointsError struct {
+	Max int
+}
+
+func (err *TooManyBreakpointsError) Error() string {
+	return fmt.Sprintf("Breakpoint limit reached (%d)", err.Max)
+}
+
+type TooManyWatchpointsError struct {
+	Max int
+}
+
+func (err *TooManyWatchpointsError) Error() string {
+	return fmt.Sprintf("Watchpoint limit reached (%d)", err.Max)
+}
+
+type InvalidConditionError struct {
+	Condition string
+	Reason    string
+}
+
+func (err *InvalidConditionError) Error() string {
+	return fmt.Sprintf("Invalid condition '%s': %s", err.Condition, err.Reason)
+}
+
+type InvalidOperandError struct {
+	Operand string
+}
+
+func (err *InvalidOperandError) Error() string {
+	return fmt.Sprintf("Invalid operand '%s'", err.Operand)
+}
+
+type InvalidWatchpointTypeError struct {
+	Type string
+}
+
+func (err *InvalidWatchpointTypeError) Error() string {
+	return fmt.Sprintf("Invalid watchpoint type '%s'", err.Type)
+}
+
+type InvalidTraceLineError struct {
+	Line string
+}
+
+func (err *InvalidTraceLineError) Error() string {
+	return fmt.Sprintf("Invalid trace line '%s'", err.Line)
+}
@@ -17,11 +17,13 @@ package encoding
 
 import (
 	"errors"
+	"fmt"
 	"strconv"
 	"strings"
 )
 
 // Decodes a hexidecimal string in the formats: 0xFFFF, xFFFF, 0xFF, xFF
+// (either case of x), only a single prefix is accepted so X0xFF is an error
 func DecodeHex(s string) (uint16, error) {
 	if i := strings.IndexAny(s, "xX"); i == 0 {
 		s = "0" + s
@@ -38,6 +40,24 @@ func DecodeHex(s string) (uint16, error) {
 	return uint16(result), nil
 }
 
+// Decodes a binary string in the format 0b0101 (either case of b). The leading
+// zero is required, so that identifiers such as B1 are not read as binary
+func DecodeBin(s string) (uint16, error) {
+	if len(s) > 1 && s[0] == '0' && (s[1] == 'b' || s[1] == 'B') {
+		s = s[2:]
+	} else {
+		return 0, errors.New("Invalid binary string")
+	}
+
+	result, err := strconv.ParseUint(s, 2, 16)
+
+	if err != nil {
+		return 0, err
+	}
+
+	return uint16(result), nil
+}
+
 // Decodes a base-10 string in the formats: #123, 123
 func DecodeInt(s string) (int16, error) {
 	if i := strings.Index(s, "#"); i == 0 {
@@ -53,6 +73,11 @@ func DecodeInt(s string) (int16, error) {
 	return int16(result), nil
 }
 
+// Formats an instruction as its 16 binary digits, i.e. 0001000001000010
+func FormatInstruction(value uint16) string {
+	return fmt.Sprintf("%016b", value)
+}
+
 func SwapEndian(value uint16) uint16 {
 	return (value >> 8) | (value << 8)
 }
@@ -66,9 +91,7 @@ func SignExtend(value uint16, bitcount uint16) uint16 {
 }
 
 func ZeroExtend(value uint16, bitcount uint16) uint16 {
-	if (value>>(bitcount-1))&0x1 == 1 {
-		value |= (0x0000 << bitcount)
-	}
+	value &= (1 << bitcount) - 1
 
 	return value
 }
@@ -0,0 +1,178 @@
+// Copyright (C) 2021  Antonio Lassandro
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+
+// You should have received a copy of the GNU General Public License along
+// with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package encoding_test
+
+import (
+	"testing"
+
+	"github.com/lassandro/golc3/pkg/encoding"
+)
+
+func TestDecodeHex(t *testing.T) {
+	tests := []struct {
+		Name   string
+		Input  string
+		Output uint16
+	}{
+		{"Lowercase Prefix", "0xFFFF", 0xFFFF},
+		{"Uppercase Prefix", "0XFFFF", 0xFFFF},
+		{"Lowercase Short Prefix", "xFFFF", 0xFFFF},
+		{"Uppercase Short Prefix", "XFFFF", 0xFFFF},
+		{"Byte", "0xAB", 0x00AB},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			have, err := encoding.DecodeHex(test.Input)
+
+			if err != nil {
+				t.Fatalf("Unexpected error\nhave:%s", err)
+			}
+
+			if have != test.Output {
+				t.Fatalf(
+					"Decoding mismatch\nwant:%#04x (%q)\nhave:%#04x",
+					test.Output,
+					test.Input,
+					have,
+				)
+			}
+		})
+	}
+
+	fails := []struct {
+		Name  string
+		Input string
+	}{
+		// The leading X is a prefix, leaving "0xAB" as invalid digits
+		{"Repeated Prefix", "X0xAB"},
+		{"Empty", ""},
+		{"Prefix Only", "0x"},
+		{"Misplaced Prefix", "1xFF"},
+		{"Oversized", "0x10000"},
+	}
+
+	for _, test := range fails {
+		t.Run(test.Name, func(t *testing.T) {
+			if have, err := encoding.DecodeHex(test.Input); err == nil {
+				t.Fatalf(
+					"Expected error\nwant:error (%q)\nhave:%#04x",
+					test.Input,
+					have,
+				)
+			}
+		})
+	}
+}
+
+func TestDecodeBin(t *testing.T) {
+	tests := []struct {
+		Name   string
+		Input  string
+		Output uint16
+	}{
+		{"Lowercase Prefix", "0b0101", 0x0005},
+		{"Uppercase Prefix", "0B0101", 0x0005},
+		{"Leading Zeros", "0b0000000000000001", 0x0001},
+		{"Excess Leading Zeros", "0b00000000000000000001", 0x0001},
+		{"All Zeros", "0b0000000000000000", 0x0000},
+		{"All Ones", "0b1111111111111111", 0xFFFF},
+		{"Single Digit", "0b1", 0x0001},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			have, err := encoding.DecodeBin(test.Input)
+
+			if err != nil {
+				t.Fatalf("Unexpected error\nhave:%s", err)
+			}
+
+			if have != test.Output {
+				t.Fatalf(
+					"Decoding mismatch\nwant:%#04x (%q)\nhave:%#04x",
+					test.Output,
+					test.Input,
+					have,
+				)
+			}
+		})
+	}
+
+	fails := []struct {
+		Name  string
+		Input string
+	}{
+		{"Lowercase Short Prefix", "b0101"},
+		{"Uppercase Short Prefix", "B0101"},
+		{"Repeated Prefix", "0b0b01"},
+		{"Empty", ""},
+		{"Prefix Only", "0b"},
+		{"Misplaced Prefix", "1b01"},
+		{"Invalid Digit", "0b0102"},
+		{"No Prefix", "0101"},
+		{"Oversized", "0b10000000000000000"},
+	}
+
+	for _, test := range fails {
+		t.Run(test.Name, func(t *testing.T) {
+			if have, err := encoding.DecodeBin(test.Input); err == nil {
+				t.Fatalf(
+					"Expected error\nwant:error (%q)\nhave:%#04x",
+					test.Input,
+					have,
+				)
+			}
+		})
+	}
+}
+
+func TestZeroExtend(t *testing.T) {
+	tests := []struct {
+		Name     string
+		Value    uint16
+		Bitcount uint16
+		Output   uint16
+	}{
+		{"Zero Bits", 0xFFAB, 0, 0x0000},
+		{"Eight Bits", 0xFFAB, 8, 0x00AB},
+		{"Eight Bits Clear", 0x1234, 8, 0x0034},
+		{"Eight Bits Sign", 0x0080, 8, 0x0080},
+		{"Sixteen Bits", 0xFFAB, 16, 0xFFAB},
+	}
+
+	for _, test := range tests {
+		t.Run(test.Name, func(t *testing.T) {
+			have := encoding.ZeroExtend(test.Value, test.Bitcount)
+
+			if have != test.Output {
+				t.Fatalf(
+					"Extension mismatch\nwant:%#04x (%#04x, %d)\nhave:%#04x",
+					test.Output,
+					test.Value,
+					test.Bitcount,
+					have,
+				)
+			}
+		})
+	}
+}
+
+func TestFormatInstruction(t *testing.T) {
+	if have := encoding.FormatInstruction(0x1042); have != "0001000001000010" {
+		t.Fatalf("Formatting mismatch\nwant:0001000001000010\nhave:%s", have)
+	}
+}
@@ -0,0 +1,244 @@
+// Copyright (C) 2021  Antonio Lassandro
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+
+// You should have received a copy of the GNU General Public License along
+// with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package encoding
+
+import (
+	"bufio"
+	"encoding/binary"
+	"fmt"
+	"io"
+)
+
+// An output format for assembled programs. Write receives the words of the
+// program beginning at the word address origin
+type OutputFormat interface {
+	Write(w io.Writer, data []uint16, origin uint16) error
+	FileExtension() string
+}
+
+// Raw big-endian words, the origin is not recorded
+type RawFormat struct{}
+
+// Intel HEX records, with byte addresses of twice the word address
+type IHEXFormat struct{}
+
+// Motorola S-records, with byte addresses of twice the word address
+type SRECFormat struct{}
+
+// A big-endian 32-bit ELF executable with a single loadable segment, whose
+// byte address is twice the word address
+type ELFFormat struct{}
+
+// Maximum number of data bytes in a single IHEX or SREC record
+const RECORD_DATA_SIZE = 16
+
+func (RawFormat) Write(w io.Writer, data []uint16, origin uint16) error {
+	return binary.Write(w, binary.BigEndian, data)
+}
+
+func (RawFormat) FileExtension() string {
+	return ".bin"
+}
+
+func (IHEXFormat) Write(w io.Writer, data []uint16, origin uint16) error {
+	writer := bufio.NewWriter(w)
+	bytes := wordBytes(data)
+
+	record := func(kind byte, addr uint16, data []byte) {
+		sum := byte(len(data)) + byte(addr>>8) + byte(addr) + kind
+
+		fmt.Fprintf(writer, ":%02X%04X%02X", len(data), addr, kind)
+
+		for _, b := range data {
+			fmt.Fprintf(writer, "%02X", b)
+			sum += b
+		}
+
+		fmt.Fprintf(writer, "%02X\n", byte(-int(sum)))
+	}
+
+	addr := uint32(origin) * 2
+	upper := uint32(0)
+
+	for offset := 0; offset < len(bytes); {
+		if addr>>16 != upper {
+			upper = addr >> 16
+			record(0x04, 0x0000, []byte{byte(upper >> 8), byte(upper)})
+		}
+
+		n := len(bytes) - offset
+
+		if n > RECORD_DATA_SIZE {
+			n = RECORD_DATA_SIZE
+		}
+
+		// Records cannot cross a 64KiB boundary
+		if remaining := int(0x10000 - addr&0xFFFF); n > remaining {
+			n = remaining
+		}
+
+		record(0x00, uint16(addr), bytes[offset:offset+n])
+
+		offset += n
+		addr += uint32(n)
+	}
+
+	record(0x01, 0x0000, nil)
+
+	return writer.Flush()
+}
+
+func (IHEXFormat) FileExtension() string {
+	return ".hex"
+}
+
+func (SRECFormat) Write(w io.Writer, data []uint16, origin uint16) error {
+	writer := bufio.NewWriter(w)
+	bytes := wordBytes(data)
+
+	start := uint32(origin) * 2
+
+	// S1/S9 records hold 16-bit addresses, S2/S8 records hold 24-bit
+	// addresses which are needed beyond the first 64KiB
+	addrsize := 2
+	datakind, endkind := '1', '9'
+
+	if start+uint32(len(bytes)) > 0x10000 {
+		addrsize = 3
+		datakind, endkind = '2', '8'
+	}
+
+	record := func(kind rune, addrsize int, addr uint32, data []byte) {
+		count := byte(addrsize + len(data) + 1)
+		sum := count
+
+		fmt.Fprintf(writer, "S%c%02X", kind, count)
+
+		for i := addrsize - 1; i >= 0; i-- {
+			b := byte(addr >> (8 * uint(i)))
+			fmt.Fprintf(writer, "%02X", b)
+			sum += b
+		}
+
+		for _, b := range data {
+			fmt.Fprintf(writer, "%02X", b)
+			sum += b
+		}
+
+		fmt.Fprintf(writer, "%02X\n", ^sum)
+	}
+
+	record('0', 2, 0x0000, nil)
+
+	for offset := 0; offset < len(bytes); offset += RECORD_DATA_SIZE {
+		end := offset + RECORD_DATA_SIZE
+
+		if end > len(bytes) {
+			end = len(bytes)
+		}
+
+		record(datakind, addrsize, start+uint32(offset), bytes[offset:end])
+	}
+
+	record(endkind, addrsize, start, nil)
+
+	return writer.Flush()
+}
+
+func (SRECFormat) FileExtension() string {
+	return ".srec"
+}
+
+func (ELFFormat) Write(w io.Writer, data []uint16, origin uint16) error {
+	const ehsize = 52
+	const phsize = 32
+
+	type header struct {
+		Ident     [16]byte
+		Type      uint16
+		Machine   uint16
+		Version   uint32
+		Entry     uint32
+		Phoff     uint32
+		Shoff     uint32
+		Flags     uint32
+		Ehsize    uint16
+		Phentsize uint16
+		Phnum     uint16
+		Shentsize uint16
+		Shnum     uint16
+		Shstrndx  uint16
+	}
+
+	type progheader struct {
+		Type   uint32
+		Offset uint32
+		Vaddr  uint32
+		Paddr  uint32
+		Filesz uint32
+		Memsz  uint32
+		Flags  uint32
+		Align  uint32
+	}
+
+	addr := uint32(origin) * 2
+	size := uint32(len(data)) * 2
+
+	elf := header{
+		// Magic, 32-bit class, big-endian data, current version
+		Ident:     [16]byte{0x7F, 'E', 'L', 'F', 1, 2, 1},
+		Type:      2, // ET_EXEC
+		Version:   1,
+		Entry:     addr,
+		Phoff:     ehsize,
+		Ehsize:    ehsize,
+		Phentsize: phsize,
+		Phnum:     1,
+	}
+
+	prog := progheader{
+		Type:   1, // PT_LOAD
+		Offset: ehsize + phsize,
+		Vaddr:  addr,
+		Paddr:  addr,
+		Filesz: size,
+		Memsz:  size,
+		Flags:  0x7, // PF_R | PF_W | PF_X
+		Align:  2,
+	}
+
+	for _, value := range []interface{}{elf, prog, data} {
+		if err := binary.Write(w, binary.BigEndian, value); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (ELFFormat) FileExtension() string {
+	return ".elf"
+}
+
+func wordBytes(data []uint16) []byte {
+	bytes := make([]byte, len(data)*2)
+
+	for i, word := range data {
+		binary.BigEndian.PutUint16(bytes[i*2:], word)
+	}
+
+	return bytes
+}
@@ -0,0 +1,170 @@
+// Copyright (C) 2021  Antonio Lassandro
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+
+// You should have received a copy of the GNU General Public License along
+// with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package encoding_test
+
+import (
+	"bytes"
+	"debug/elf"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/lassandro/golc3/pkg/encoding"
+)
+
+func TestRawFormat(t *testing.T) {
+	var buffer bytes.Buffer
+
+	if err := (encoding.RawFormat{}).Write(
+		&buffer, []uint16{0xF025, 0x1042}, 0x3000,
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []byte{0xF0, 0x25, 0x10, 0x42}
+
+	if have := buffer.Bytes(); !bytes.Equal(have, want) {
+		t.Fatalf("Output mismatch\nwant:%x\nhave:%x", want, have)
+	}
+}
+
+func TestIHEXFormat(t *testing.T) {
+	t.Run("Records", func(t *testing.T) {
+		var buffer bytes.Buffer
+
+		if err := (encoding.IHEXFormat{}).Write(
+			&buffer, []uint16{0xF025}, 0x3000,
+		); err != nil {
+			t.Fatal(err)
+		}
+
+		want := ":02600000F02589\n:00000001FF\n"
+
+		if have := buffer.String(); have != want {
+			t.Fatalf("Output mismatch\nwant:%q\nhave:%q", want, have)
+		}
+	})
+
+	t.Run("Extended Address", func(t *testing.T) {
+		var buffer bytes.Buffer
+
+		if err := (encoding.IHEXFormat{}).Write(
+			&buffer, []uint16{0xF025}, 0x8000,
+		); err != nil {
+			t.Fatal(err)
+		}
+
+		want := ":020000040001F9\n:02000000F025E9\n:00000001FF\n"
+
+		if have := buffer.String(); have != want {
+			t.Fatalf("Output mismatch\nwant:%q\nhave:%q", want, have)
+		}
+	})
+}
+
+func TestSRECFormat(t *testing.T) {
+	t.Run("S1", func(t *testing.T) {
+		var buffer bytes.Buffer
+
+		if err := (encoding.SRECFormat{}).Write(
+			&buffer, []uint16{0xF025}, 0x3000,
+		); err != nil {
+			t.Fatal(err)
+		}
+
+		want := "S0030000FC\nS1056000F02585\nS90360009C\n"
+
+		if have := buffer.String(); have != want {
+			t.Fatalf("Output mismatch\nwant:%q\nhave:%q", want, have)
+		}
+	})
+
+	t.Run("S2", func(t *testing.T) {
+		var buffer bytes.Buffer
+
+		if err := (encoding.SRECFormat{}).Write(
+			&buffer, []uint16{0xF025}, 0x8000,
+		); err != nil {
+			t.Fatal(err)
+		}
+
+		want := "S0030000FC\nS206010000F025E3\n"
+
+		if have := buffer.String(); !strings.HasPrefix(have, want) {
+			t.Fatalf("Invalid S2 record\nwant:%q\nhave:%q", want, have)
+		}
+	})
+}
+
+func TestELFFormat(t *testing.T) {
+	var buffer bytes.Buffer
+
+	data := []uint16{0xF025, 0x1042}
+
+	if err := (encoding.ELFFormat{}).Write(&buffer, data, 0x3000); err != nil {
+		t.Fatal(err)
+	}
+
+	if have := buffer.Bytes()[:4]; !bytes.Equal(have, []byte(elf.ELFMAG)) {
+		t.Fatalf("Invalid magic\nwant:%q\nhave:%q", elf.ELFMAG, have)
+	}
+
+	file, err := elf.NewFile(bytes.NewReader(buffer.Bytes()))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(file.Progs) != 1 {
+		t.Fatalf("Invalid program header count %d", len(file.Progs))
+	}
+
+	prog := file.Progs[0]
+
+	if prog.Vaddr != 0x6000 || file.Entry != 0x6000 {
+		t.Fatalf(
+			"Invalid load address\nwant:0x6000\nhave:%#x (entry %#x)",
+			prog.Vaddr,
+			file.Entry,
+		)
+	}
+
+	segment, err := io.ReadAll(prog.Open())
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if want := []byte{0xF0, 0x25, 0x10, 0x42}; !bytes.Equal(segment, want) {
+		t.Fatalf("Segment mismatch\nwant:%x\nhave:%x", want, segment)
+	}
+}
+
+func TestFileExtension(t *testing.T) {
+	for _, test := range []struct {
+		Format encoding.OutputFormat
+		Want   string
+	}{
+		{encoding.RawFormat{}, ".bin"},
+		{encoding.IHEXFormat{}, ".hex"},
+		{encoding.SRECFormat{}, ".srec"},
+		{encoding.ELFFormat{}, ".elf"},
+	} {
+		if have := test.Format.FileExtension(); have != test.Want {
+			t.Fatalf("Extension mismatch\nwant:%s\nhave:%s", test.Want, have)
+		}
+	}
+}
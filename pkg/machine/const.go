@@ -21,6 +21,42 @@ const (
 	FLAG_NEG  uint16 = 1 << 2
 )
 
+// Number of words loaded between calls to LoadOptions.OnProgress
+const LOAD_PROGRESS_INTERVAL = 1024
+
+// Default number of steps between checks of the context by RunWithContext
+const RUN_CHECK_INTERVAL = 1000
+
+// Size of a TraceRecord in bytes: step number, program counter, instruction
+// and the eight general purpose registers
+const TRACE_RECORD_SIZE = 8 + 2 + 2 + 8*2
+
+// Register used as the stack pointer for both the user and supervisor stacks
+const SP_REG = 6
+
+const (
+	PSR_PRIV_BIT       = 15
+	PSR_PRIORITY_SHIFT = 8
+
+	PSR_PRIORITY_MASK uint16 = 0x0700
+	PSR_COND_MASK     uint16 = 0x0007
+)
+
+// Kinds of StateDelta, registers are indexed 0-7 while the program counter,
+// processor status and saved stack are always index 0
+const (
+	DELTA_REGISTER = "register"
+	DELTA_MEMORY   = "memory"
+	DELTA_PROGRAM  = "program"
+	DELTA_PROCSTAT = "procstat"
+	DELTA_STACK    = "stack"
+)
+
+const (
+	// Clearing this bit of the Machine Control Register stops the clock
+	MCR_CLOCK_ENABLE uint16 = 0x8000
+)
+
 const (
 	TRAP_GETC  uint16 = 0x20
 	TRAP_OUT   uint16 = 0x21
@@ -43,6 +79,20 @@ const (
 	DEV_KBDR        = 0xFE02
 	DEV_DSR         = 0xFE04
 	DEV_DDR         = 0xFE06
+	DEV_TCR         = 0xFE08
+	DEV_TIR         = 0xFE0A
+	DEV_MCR         = 0xFFFE
+)
+
+const (
+	// Setting this bit of the Timer Control Register starts the timer
+	TCR_ENABLE uint16 = 0x8000
+
+	// 0x81 Timer Interrupt Vector -> 0x0181 Interrupt Addr
+	TIMER_VECTOR uint8 = 0x81
+
+	// Priority of timer interrupts unless DeviceHandler.TimerPriority is set
+	TIMER_PRIORITY uint8 = 2
 )
 
 const (
@@ -0,0 +1,55 @@
+// Copyright (C) 2021  Antonio Lassandro
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+
+// You should have received a copy of the GNU General Public License along
+// with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+//go:build go1.18
+// +build go1.18
+
+package machine_test
+
+import (
+	"testing"
+
+	"github.com/lassandro/golc3/pkg/machine"
+)
+
+// Steps a machine without devices or a debugger once, which must not panic
+func FuzzMachineStep(f *testing.F) {
+	for opcode := uint16(0); opcode < 16; opcode++ {
+		f.Add(opcode<<12, uint16(0x0000), true)
+		f.Add(opcode<<12|0x0FFF, uint16(0xFFFF), false)
+	}
+
+	// RTI in user mode raises a privilege violation, swapping to the
+	// supervisor stack
+	f.Add(uint16(0b1000_000000000000), uint16(0x0000), false)
+
+	f.Fuzz(func(t *testing.T, instruction uint16, reg uint16, privileged bool) {
+		var mc machine.Machine
+
+		mc.State.Reset()
+		mc.State.Program = 0x3000
+		mc.State.Memory[0x3000] = instruction
+
+		for i := range mc.State.Registers {
+			mc.State.Registers[i] = reg
+		}
+
+		if !privileged {
+			mc.State.Procstat &^= 1 << machine.PSR_PRIV_BIT
+		}
+
+		mc.Step()
+	})
+}
@@ -16,13 +16,22 @@
 package machine
 
 import (
+	"context"
 	"encoding/binary"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"hash/crc32"
 	"io"
 
 	"github.com/lassandro/golc3/pkg/encoding"
 )
 
+var ErrMemoryOverlap = errors.New("Binary overlaps memory already in use")
+var ErrEmptyBinary = errors.New("Binary is empty")
+var ErrInvalidRegister = errors.New("Invalid register")
+var ErrExecutionLimitReached = errors.New("Execution limit reached")
+
 func (mc *MachineState) Reset() {
 	for i, _ := range mc.Registers {
 		mc.Registers[i] = 0x0000
@@ -34,49 +43,341 @@ func (mc *MachineState) Reset() {
 
 	// Program begins in the supervisor memory space with supervisor privilege
 	mc.Program = MEMSPACE_SUPERVISOR
-	mc.Procstat = 0x8000
+	mc.Procstat = 1 << PSR_PRIV_BIT
 
 	// R6 is SSP, USP is saved in state
-	mc.Registers[6] = MEMSPACE_USER
+	mc.Registers[SP_REG] = MEMSPACE_USER
 	mc.Stack = MEMSPACE_DEVICES
 }
 
-func (mc *Machine) LoadBin(reader io.Reader) error {
+// Returns a copy of the state, including all of memory
+func (mc *MachineState) Clone() MachineState {
+	return *mc
+}
+
+// Returns every position whose value differs between the state (before) and
+// other (after), in the order registers, program counter, processor status,
+// saved stack and then memory by ascending address
+func (mc *MachineState) Diff(other MachineState) []StateDelta {
+	var deltas []StateDelta
+
+	for i, value := range mc.Registers {
+		if value != other.Registers[i] {
+			deltas = append(deltas, StateDelta{
+				DELTA_REGISTER, uint16(i), value, other.Registers[i],
+			})
+		}
+	}
+
+	if mc.Program != other.Program {
+		deltas = append(deltas, StateDelta{
+			DELTA_PROGRAM, 0, mc.Program, other.Program,
+		})
+	}
+
+	if mc.Procstat != other.Procstat {
+		deltas = append(deltas, StateDelta{
+			DELTA_PROCSTAT, 0, mc.Procstat, other.Procstat,
+		})
+	}
+
+	if mc.Stack != other.Stack {
+		deltas = append(deltas, StateDelta{
+			DELTA_STACK, 0, mc.Stack, other.Stack,
+		})
+	}
+
+	for i, value := range mc.Memory {
+		if value != other.Memory[i] {
+			deltas = append(deltas, StateDelta{
+				DELTA_MEMORY, uint16(i), value, other.Memory[i],
+			})
+		}
+	}
+
+	return deltas
+}
+
+// JSON representation of a MachineState, words are written as hex strings and
+// memory only holds non-zero words
+type jsonMachineState struct {
+	Registers [8]uint16         `json:"registers"`
+	Program   string            `json:"program"`
+	Procstat  string            `json:"procstat"`
+	Stack     string            `json:"stack"`
+	Memory    map[string]string `json:"memory"`
+}
+
+func formatWord(value uint16) string {
+	return fmt.Sprintf("0x%04X", value)
+}
+
+// Encodes the state as JSON, i.e. {"registers": [0, ...], "program": "0x3000",
+// "procstat": "0x8002", "stack": "0xFE00", "memory": {"0x3000": "0xABCD"}}
+func (mc *MachineState) MarshalJSON() ([]byte, error) {
+	state := jsonMachineState{
+		Registers: mc.Registers,
+		Program:   formatWord(mc.Program),
+		Procstat:  formatWord(mc.Procstat),
+		Stack:     formatWord(mc.Stack),
+		Memory:    make(map[string]string),
+	}
+
+	for addr, value := range mc.Memory {
+		if value != 0 {
+			state.Memory[formatWord(uint16(addr))] = formatWord(value)
+		}
+	}
+
+	return json.Marshal(state)
+}
+
+// Decodes a state written by MarshalJSON, words absent from memory are zero
+func (mc *MachineState) UnmarshalJSON(data []byte) error {
+	var state jsonMachineState
+
+	if err := json.Unmarshal(data, &state); err != nil {
+		return err
+	}
+
+	var result MachineState
+	var err error
+
+	result.Registers = state.Registers
+
+	if result.Program, err = encoding.DecodeHex(state.Program); err != nil {
+		return err
+	}
+
+	if result.Procstat, err = encoding.DecodeHex(state.Procstat); err != nil {
+		return err
+	}
+
+	if result.Stack, err = encoding.DecodeHex(state.Stack); err != nil {
+		return err
+	}
+
+	for key, word := range state.Memory {
+		addr, err := encoding.DecodeHex(key)
+
+		if err != nil {
+			return err
+		}
+
+		if result.Memory[addr], err = encoding.DecodeHex(word); err != nil {
+			return err
+		}
+	}
+
+	*mc = result
+
+	return nil
+}
+
+// Computes a CRC32 over the registers, program counter, processor status,
+// saved stack and memory, each serialised as big-endian words
+func (mc *MachineState) Checksum() uint32 {
+	hash := crc32.NewIEEE()
+
+	if err := binary.Write(hash, binary.BigEndian, mc); err != nil {
+		panic(err)
+	}
+
+	return hash.Sum32()
+}
+
+// Resets the machine and loads a raw binary into memory starting at origin,
+// returning the number of words loaded. An image of memory as written by
+// golc3-asm is loaded at an origin of 0x0000. A binary without any words
+// returns ErrEmptyBinary
+func (mc *Machine) LoadBin(
+	reader io.Reader, origin uint16,
+) (wordsLoaded int, err error) {
+	mc.reset()
+
+	if wordsLoaded, err = mc.loadBinAt(reader, origin, false); err != nil {
+		return wordsLoaded, err
+	}
+
+	if wordsLoaded == 0 {
+		return 0, ErrEmptyBinary
+	}
+
+	return wordsLoaded, nil
+}
+
+// Resets the machine state along with interrupts, the timer and the step count
+// ahead of loading a binary
+func (mc *Machine) reset() {
 	mc.State.Reset()
+	mc.Halted = false
+	mc.pending = nil
+	mc.timer = 0
+	mc.steps = 0
+}
+
+// Replaces the machine state with a snapshot, i.e. one restored by
+// debugger.ImportJSON. Interrupts, the timer and the step count are not part of
+// the snapshot, so they are reset as when loading a binary
+func (mc *Machine) RestoreState(state MachineState) {
+	mc.reset()
+	mc.State = state
+}
+
+// Loads a raw binary into memory starting at origin, leaving the rest of
+// memory and the machine state untouched
+func (mc *Machine) LoadBinAt(reader io.Reader, origin uint16) error {
+	_, err := mc.loadBinAt(reader, origin, false)
+	return err
+}
+
+// Like LoadBinAt, but returns ErrMemoryOverlap without modifying memory if the
+// binary would overwrite any non-zero word
+func (mc *Machine) LoadBinAtStrict(reader io.Reader, origin uint16) error {
+	_, err := mc.loadBinAt(reader, origin, true)
+	return err
+}
+
+// Loads a raw binary into memory starting at origin, returning the number of
+// words loaded. Memory is only modified once the whole binary has been read
+func (mc *Machine) loadBinAt(
+	reader io.Reader, origin uint16, strict bool,
+) (int, error) {
+	var words []uint16
+
+	scratch := make([]byte, 2)
+
+	for {
+		_, err := io.ReadFull(reader, scratch)
+
+		if err == io.EOF {
+			break
+		} else if err == io.ErrUnexpectedEOF {
+			return 0, errors.New("Error reading binary")
+		} else if err != nil {
+			return 0, err
+		}
+
+		if int(origin)+len(words) >= len(mc.State.Memory) {
+			return 0, errors.New("Binary exceeds memory size")
+		}
+
+		words = append(words, binary.BigEndian.Uint16(scratch))
+	}
+
+	if strict {
+		for i := range words {
+			if mc.State.Memory[int(origin)+i] != 0x0000 {
+				return 0, ErrMemoryOverlap
+			}
+		}
+	}
+
+	for i, word := range words {
+		mc.State.Memory[int(origin)+i] = word
+
+		mc.loadProgress(i + 1)
+	}
+
+	return len(words), nil
+}
+
+// Loads a relocatable binary, whose first word is the address at which the
+// remaining words are loaded
+func (mc *Machine) LoadRelocatable(reader io.Reader) error {
+	mc.reset()
 
 	scratch := make([]byte, 2)
-	index := 0
 
-	for index < (1<<16)-1 {
-		n, err := reader.Read(scratch)
+	if _, err := io.ReadFull(reader, scratch); err != nil {
+		return errors.New("Error reading binary header")
+	}
+
+	origin := int(binary.BigEndian.Uint16(scratch))
+	index := origin
+
+	for {
+		_, err := io.ReadFull(reader, scratch)
 
 		if err == io.EOF {
 			return nil
+		} else if err == io.ErrUnexpectedEOF {
+			return errors.New("Error reading binary")
 		} else if err != nil {
 			return err
-		} else if n != 2 {
-			return errors.New("Error reading binary")
+		}
+
+		if index >= len(mc.State.Memory) {
+			return errors.New("Binary exceeds memory size")
 		}
 
 		mc.State.Memory[index] = binary.BigEndian.Uint16(scratch)
 		index++
+
+		mc.loadProgress(index - origin)
 	}
+}
 
-	return nil
+func (mc *Machine) loadProgress(wordsLoaded int) {
+	if mc.LoadOptions.OnProgress == nil {
+		return
+	}
+
+	if wordsLoaded%LOAD_PROGRESS_INTERVAL == 0 {
+		mc.LoadOptions.OnProgress(wordsLoaded)
+	}
 }
 
+// Memory is word-addressable, so each stack entry occupies a single address
 func (mc *Machine) push(value uint16) {
-	mc.State.Registers[6] -= 2
-	mc.write(mc.State.Registers[6], value)
+	mc.State.Registers[SP_REG] -= 1
+	mc.write(mc.State.Registers[SP_REG], value)
 }
 
 func (mc *Machine) pop() uint16 {
-	result := mc.read(mc.State.Registers[6])
-	mc.State.Registers[6] += 2
+	result := mc.read(mc.State.Registers[SP_REG])
+	mc.State.Registers[SP_REG] += 1
 	return result
 }
 
+// Maps dev to addr, taking priority over memory and the built in device
+// registers for all reads and writes of the address. Registering a device at
+// an address already in use replaces the previous device
+func (mc *Machine) RegisterMMIO(addr uint16, dev MMIODevice) {
+	if mc.mmio == nil {
+		mc.mmio = make(map[uint16]MMIODevice)
+	}
+
+	mc.mmio[addr] = dev
+}
+
+// Removes the device mapped to addr by RegisterMMIO, if any
+func (mc *Machine) UnregisterMMIO(addr uint16) {
+	delete(mc.mmio, addr)
+}
+
 func (mc *Machine) read(addr uint16) uint16 {
+	if len(mc.mmio) > 0 {
+		if dev, ok := mc.mmio[addr]; ok {
+			mc.State.Memory[addr] = dev.OnRead(addr)
+
+			if mc.Debugger != nil {
+				mc.Debugger.Read(addr, mc)
+			}
+
+			return mc.State.Memory[addr]
+		}
+	}
+
+	// Only the device register space requires special handling
+	if addr < MEMSPACE_DEVICES {
+		if mc.Debugger != nil {
+			mc.Debugger.Read(addr, mc)
+		}
+
+		return mc.State.Memory[addr]
+	}
+
 	if addr == DEV_KBSR {
 		var key byte
 		var err error
@@ -107,6 +408,17 @@ func (mc *Machine) read(addr uint16) uint16 {
 		} else {
 			mc.State.Memory[DEV_DSR] = 0
 		}
+	} else if addr == DEV_TCR && mc.Devices != nil {
+		if mc.Devices.TimerEnabled {
+			mc.State.Memory[DEV_TCR] = TCR_ENABLE
+		} else {
+			mc.State.Memory[DEV_TCR] = 0
+		}
+	} else if addr == DEV_TIR && mc.Devices != nil {
+		mc.State.Memory[DEV_TIR] = mc.Devices.TimerInterval
+	} else if addr == DEV_MCR && !mc.Halted {
+		// The clock is always enabled while the machine is running
+		mc.State.Memory[DEV_MCR] |= MCR_CLOCK_ENABLE
 	}
 
 	if mc.Debugger != nil {
@@ -121,7 +433,44 @@ func (mc *Machine) read(addr uint16) uint16 {
 }
 
 func (mc *Machine) write(addr uint16, value uint16) {
-	if addr == DEV_DDR {
+	if len(mc.mmio) > 0 {
+		if dev, ok := mc.mmio[addr]; ok {
+			dev.OnWrite(addr, value)
+			mc.State.Memory[addr] = value
+
+			if mc.Debugger != nil {
+				mc.Debugger.Write(addr, mc)
+			}
+
+			return
+		}
+	}
+
+	// Only the device register space requires special handling
+	if addr < MEMSPACE_DEVICES {
+		mc.State.Memory[addr] = value
+
+		if mc.Debugger != nil {
+			mc.Debugger.Write(addr, mc)
+		}
+
+		return
+	}
+
+	if addr == DEV_MCR && value&MCR_CLOCK_ENABLE == 0 {
+		mc.Halted = true
+	}
+
+	if addr == DEV_TCR && mc.Devices != nil {
+		mc.Devices.TimerEnabled = value&TCR_ENABLE != 0
+	} else if addr == DEV_TIR && mc.Devices != nil {
+		// Restarts the countdown with the new interval
+		mc.Devices.TimerInterval = value
+		mc.timer = 0
+	}
+
+	// Writes are discarded when no display is attached
+	if addr == DEV_DDR && mc.Devices != nil && mc.Devices.Display != nil {
 		err := mc.Devices.Display.WriteByte(byte(value & 0xFF))
 
 		if err != nil {
@@ -144,25 +493,59 @@ func (mc *Machine) write(addr uint16, value uint16) {
 	}
 }
 
+// Reads a word of memory as a load instruction would, triggering device
+// register side effects and debugger watchpoints
+func (mc *Machine) GetMemory(addr uint16) uint16 {
+	return mc.read(addr)
+}
+
+// Writes a word of memory as a store instruction would, triggering device
+// register side effects and debugger watchpoints
+func (mc *Machine) SetMemory(addr uint16, value uint16) {
+	mc.write(addr, value)
+}
+
+// Returns the value of the general purpose register R0-R7, or
+// ErrInvalidRegister for any other register
+func (mc *Machine) GetRegister(r int) (uint16, error) {
+	if r < 0 || r >= len(mc.State.Registers) {
+		return 0, ErrInvalidRegister
+	}
+
+	return mc.State.Registers[r], nil
+}
+
+// Sets the value of the general purpose register R0-R7, or returns
+// ErrInvalidRegister for any other register
+func (mc *Machine) SetRegister(r int, value uint16) error {
+	if r < 0 || r >= len(mc.State.Registers) {
+		return ErrInvalidRegister
+	}
+
+	mc.State.Registers[r] = value
+
+	return nil
+}
+
 func (mc *Machine) setPrivilege(privileged bool) {
 	if privileged != mc.getPrivilege() {
 		// Swap USP/SSP
-		currentStack := mc.State.Registers[6]
-		mc.State.Registers[6] = mc.State.Stack
+		currentStack := mc.State.Registers[SP_REG]
+		mc.State.Registers[SP_REG] = mc.State.Stack
 		mc.State.Stack = currentStack
 	}
 
 	if privileged {
 		// Enable privilege bit, but preserve priority and condition bits
-		mc.State.Procstat |= uint16(0x1 << 15)
+		mc.State.Procstat |= uint16(0x1 << PSR_PRIV_BIT)
 	} else {
 		// Reset privilege bit, but preserve priority and condition bits
-		mc.State.Procstat &= ^uint16(0x1 << 15)
+		mc.State.Procstat &= ^uint16(0x1 << PSR_PRIV_BIT)
 	}
 }
 
 func (mc *Machine) getPrivilege() bool {
-	return mc.State.Procstat>>15 == 1
+	return mc.State.Procstat>>PSR_PRIV_BIT == 1
 }
 
 func (mc *Machine) setPriority(value uint8) {
@@ -170,25 +553,73 @@ func (mc *Machine) setPriority(value uint8) {
 		panic("Invalid priority value")
 	}
 
-	mc.State.Procstat &= ^uint16(0x7 << 8)
-	mc.State.Procstat |= uint16(value&0x7) << 8
+	mc.State.Procstat &= ^PSR_PRIORITY_MASK
+	mc.State.Procstat |= uint16(value&0x7) << PSR_PRIORITY_SHIFT
 }
 
 func (mc *Machine) getPriority() uint8 {
-	return uint8((mc.State.Procstat >> 8) & 0x7)
+	return uint8((mc.State.Procstat & PSR_PRIORITY_MASK) >> PSR_PRIORITY_SHIFT)
 }
 
 func (mc *Machine) raiseException(vector uint8, priority uint8) {
-	mc.push(mc.State.Procstat)
-	mc.push(mc.State.Program)
-	mc.setPriority(priority)
+	// The PSR and PC are saved on the supervisor stack, so switch stacks
+	// before pushing them
+	procstat := mc.State.Procstat
 	mc.setPrivilege(true)
+	mc.setPriority(priority)
+	mc.push(procstat)
+	mc.push(mc.State.Program)
 	mc.State.Program = mc.read(MEMSPACE_INT_TABLE | uint16(vector))
 }
 
+// Queues an interrupt which is serviced at the end of a step once its
+// priority exceeds that of the running process
+func (mc *Machine) InjectInterrupt(vector uint8, priority uint8) {
+	if priority > 0x7 {
+		panic("Invalid priority value")
+	}
+
+	mc.pending = append(mc.pending, Interrupt{vector, priority})
+}
+
+// Reports whether an interrupt with the given vector is awaiting service
+func (mc *Machine) isPending(vector uint8) bool {
+	for _, interrupt := range mc.pending {
+		if interrupt.Vector == vector {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Raises the highest priority pending interrupt, provided it is strictly
+// higher than the current priority
+func (mc *Machine) serviceInterrupts() {
+	next := -1
+
+	for i, interrupt := range mc.pending {
+		if interrupt.Priority <= mc.getPriority() {
+			continue
+		}
+
+		if next == -1 || interrupt.Priority > mc.pending[next].Priority {
+			next = i
+		}
+	}
+
+	if next == -1 {
+		return
+	}
+
+	interrupt := mc.pending[next]
+	mc.pending = append(mc.pending[:next], mc.pending[next+1:]...)
+	mc.raiseException(interrupt.Vector, interrupt.Priority)
+}
+
 func (mc *Machine) setFlags(value uint16) {
 	// Reset condition flags, but preserve privilege and priority bits
-	mc.State.Procstat &= ^uint16(0x7)
+	mc.State.Procstat &= ^PSR_COND_MASK
 
 	if value == 0 {
 		mc.State.Procstat |= FLAG_ZERO
@@ -199,10 +630,38 @@ func (mc *Machine) setFlags(value uint16) {
 	}
 }
 
+// Reports whether the clock has been stopped via the Machine Control Register,
+// after which Step does nothing
+func (mc *Machine) IsHalted() bool {
+	return mc.Halted
+}
+
+// Reports whether MaxSteps steps have been executed, after which Step does
+// nothing
+func (mc *Machine) ExecutionLimitReached() bool {
+	return mc.MaxSteps != 0 && mc.steps >= mc.MaxSteps
+}
+
+// Returns the number of steps executed since the last load of a binary
+func (mc *Machine) StepCount() uint64 {
+	return mc.steps
+}
+
 func (mc *Machine) Step() {
+	if mc.Halted || mc.ExecutionLimitReached() {
+		return
+	}
+
+	mc.steps++
+
 	instruction := mc.read(mc.State.Program)
 	opcode := instruction >> 12
 
+	if mc.Profile != nil {
+		mc.Profile.Counts[opcode]++
+		mc.Profile.Addresses[mc.State.Program]++
+	}
+
 	mc.State.Program++
 
 	switch opcode {
@@ -240,7 +699,7 @@ func (mc *Machine) Step() {
 
 			mc.State.Registers[dest] = mc.State.Registers[src1] & imm5
 		} else {
-			src2 := (instruction & 0x3)
+			src2 := (instruction & 0x7)
 
 			mc.State.Registers[dest] = mc.State.Registers[src1] &
 				mc.State.Registers[src2]
@@ -253,7 +712,7 @@ func (mc *Machine) Step() {
 	case OP_BR:
 		flags := (instruction >> 9) & 0x7
 
-		if flags == 0 || flags&(mc.State.Procstat&0x7) > 0 {
+		if flags == 0 || flags&(mc.State.Procstat&PSR_COND_MASK) > 0 {
 			mc.State.Program += encoding.SignExtend(instruction&0x1FF, 9)
 		}
 
@@ -346,9 +805,14 @@ func (mc *Machine) Step() {
 	// ---- [ _ _ _ _ _ _ _ _ _ _ _ _ _ _ _ _ ]
 	case OP_RTI:
 		if mc.getPrivilege() {
-			mc.setPrivilege(false)
-			mc.State.Program = mc.pop()
-			mc.State.Procstat = mc.pop()
+			// Pop PC then PSR from the supervisor stack before restoring the
+			// privilege level, which may swap back to the user stack
+			program := mc.pop()
+			procstat := mc.pop()
+
+			mc.setPrivilege(procstat>>PSR_PRIV_BIT == 1)
+			mc.State.Program = program
+			mc.State.Procstat = procstat
 		} else {
 			// 0x00 Privilege Violation Vector -> 0x0100 Interrupt Addr
 			mc.raiseException(0x00, mc.getPriority())
@@ -396,15 +860,109 @@ func (mc *Machine) Step() {
 		mc.raiseException(0x01, mc.getPriority())
 	}
 
-	if mc.Devices != nil && mc.Devices.Keyboard != nil {
-		_, err := mc.Devices.Keyboard.Peek(1)
-		if err == nil && mc.getPriority() < 0x4 {
+	// Peeking may read from the underlying device, so it is skipped when the
+	// interrupt could not be taken
+	if mc.Devices != nil && mc.Devices.Keyboard != nil &&
+		mc.getPriority() < 0x4 {
+		if _, err := mc.Devices.Keyboard.Peek(1); err == nil {
 			// 0x80 Keyboard Interrupt Vector -> 0x0180 Interrupt Addr
 			mc.raiseException(0x80, 4)
 		}
 	}
 
+	if mc.Devices != nil && mc.Devices.TimerEnabled &&
+		mc.Devices.TimerInterval > 0 {
+		if mc.timer == 0 {
+			mc.timer = mc.Devices.TimerInterval
+		}
+
+		mc.timer--
+
+		priority := mc.Devices.TimerPriority
+
+		if priority == 0 {
+			priority = TIMER_PRIORITY
+		}
+
+		// An expiry while masked is latched until the priority drops, but
+		// expiries are not counted while one is already pending
+		if mc.timer == 0 && !mc.isPending(TIMER_VECTOR) {
+			mc.InjectInterrupt(TIMER_VECTOR, priority)
+		}
+	}
+
+	mc.serviceInterrupts()
+
 	if mc.Debugger != nil {
 		mc.Debugger.Step(mc)
 	}
 }
+
+// Steps the machine n times, returning early once it halts. Panics raised by
+// an instruction (i.e. writing to a missing display) are returned as errors,
+// and ErrExecutionLimitReached is returned once MaxSteps is reached
+func (mc *Machine) RunN(n uint64) (err error) {
+	defer recoverStep(&err)
+
+	for i := uint64(0); i < n && !mc.IsHalted(); i++ {
+		if mc.ExecutionLimitReached() {
+			return ErrExecutionLimitReached
+		}
+
+		mc.Step()
+	}
+
+	return nil
+}
+
+// Steps the machine until its clock is stopped via the Machine Control
+// Register, or until ctx is cancelled in which case its error is returned.
+// Panics raised by an instruction are returned as errors, and
+// ErrExecutionLimitReached is returned once MaxSteps is reached
+func (mc *Machine) RunUntilHalt(ctx context.Context) error {
+	return mc.run(ctx, 1)
+}
+
+// Like RunUntilHalt, but only checks ctx every CheckInterval steps to reduce
+// the cost of cancellation on long running programs
+func (mc *Machine) RunWithContext(ctx context.Context) error {
+	interval := mc.CheckInterval
+
+	if interval == 0 {
+		interval = RUN_CHECK_INTERVAL
+	}
+
+	return mc.run(ctx, interval)
+}
+
+func (mc *Machine) run(ctx context.Context, interval uint64) (err error) {
+	defer recoverStep(&err)
+
+	for i := uint64(0); !mc.IsHalted(); i++ {
+		if i%interval == 0 {
+			select {
+			case <-ctx.Done():
+				return ctx.Err()
+			default:
+			}
+		}
+
+		if mc.ExecutionLimitReached() {
+			return ErrExecutionLimitReached
+		}
+
+		mc.Step()
+	}
+
+	return nil
+}
+
+func recoverStep(err *error) {
+	if r := recover(); r != nil {
+		if recovered, ok := r.(error); ok {
+			*err = recovered
+		} else {
+			*err = fmt.Errorf("%v", r)
+		}
+	}
+}
@@ -18,8 +18,21 @@ package machine_test
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"sync"
 	"testing"
+	"testing/iotest"
+	"time"
 
+	"github.com/lassandro/golc3/pkg/assembler"
+	"github.com/lassandro/golc3/pkg/encoding"
 	"github.com/lassandro/golc3/pkg/machine"
 )
 
@@ -40,6 +53,7 @@ type testCase struct {
 	Display  string
 	Input    testMachineState
 	Output   testMachineState
+	Profile  *machine.InstructionProfile
 }
 
 func testMachineSuccess(t *testing.T, test *testCase) {
@@ -73,6 +87,8 @@ func testMachineSuccess(t *testing.T, test *testCase) {
 		mc.Devices = &devices
 	}
 
+	mc.Profile = test.Profile
+
 	mc.State.Reset()
 	mc.State.Registers = test.Input.Registers
 	mc.State.Program = test.Input.Program
@@ -90,6 +106,8 @@ func testMachineSuccess(t *testing.T, test *testCase) {
 		mc.State.Memory[addr] = value
 	}
 
+	want := mc.State.Clone()
+
 	if test.Steps == 0 {
 		test.Steps = 1
 	}
@@ -98,26 +116,25 @@ func testMachineSuccess(t *testing.T, test *testCase) {
 		mc.Step()
 	}
 
-	for i := 0; i < 8; i++ {
-		want := test.Output.Registers[i]
-		have := mc.State.Registers[i]
-		if have != want {
-			t.Errorf(
-				"Register mismatch"+
-					"\nwant:%#04x (test.Output.Registers[%d])\nhave:%#04x",
-				want,
-				i,
-				have,
-			)
-		}
+	want.Registers = test.Output.Registers
+	want.Program = test.Output.Program
+	want.Stack = test.Output.Stack
+
+	// The processor status is compared by its fields below
+	want.Procstat = mc.State.Procstat
+
+	for addr, value := range test.Output.Memory {
+		want.Memory[addr] = value
 	}
 
-	if mc.State.Program != test.Output.Program {
+	for _, delta := range want.Diff(mc.State) {
 		t.Errorf(
-			"Program register mismatch"+
-				"\nwant:%#04x (test.Output.Program)\nhave:%#04x",
-			test.Output.Program,
-			mc.State.Program,
+			"State mismatch"+
+				"\nwant:%#04x (%s[%#04x])\nhave:%#04x",
+			delta.Before,
+			delta.Kind,
+			delta.Index,
+			delta.After,
 		)
 	}
 
@@ -153,52 +170,6 @@ func testMachineSuccess(t *testing.T, test *testCase) {
 		)
 	}
 
-	if have := mc.State.Stack; have != test.Output.Stack {
-		t.Errorf(
-			"Saved stack mismtach"+
-				"\nwant:%#04x (test.Output.Stack)\nhave:%#04x",
-			test.Output.Stack,
-			have,
-		)
-	}
-
-	for i, value := range mc.State.Memory {
-		input, expectingInput := test.Input.Memory[uint16(i)]
-		output, expectingOutput := test.Output.Memory[uint16(i)]
-
-		if expectingOutput {
-			// Value was supposed to change
-			if value != output {
-				t.Fatalf(
-					"Memory value mismatch"+
-						"\nwant:%#02x (test.Output.Memory[%#04x])\nhave:%#02x",
-					output,
-					i,
-					value,
-				)
-			}
-		} else if expectingInput {
-			// Value was supposed to remain
-			if value != input {
-				t.Fatalf(
-					"Memory value mismatch"+
-						"\nwant:%#02x (test.Input.Memory[%#04x])\nhave:%#02x",
-					input,
-					i,
-					value,
-				)
-			}
-		} else if value != 0 {
-			// Value was expected to remain unitialized
-			t.Fatalf(
-				"Memory unexpectedly changed"+
-					"\nwant:0x00 (test.Output.Memory[%#04x])\nhave:%#02x",
-				i,
-				value,
-			)
-		}
-	}
-
 	if len(test.Display) > 0 {
 		if have := displayBuf.String(); have != test.Display {
 			t.Errorf(
@@ -225,7 +196,7 @@ func testSuccess(t *testing.T, tests []testCase) {
 // ADD  |0001    |DR   |SR1  |1|imm5      | Immediate addition
 // ---- [ _ _ _ _ _ _ _ _ _ _ _ _ _ _ _ _ ]
 func TestAdd(t *testing.T) {
-	testSuccess(t, []testCase{
+	tests := []testCase{
 		{
 			Name: "ADD SR2 Negative",
 			Input: testMachineState{
@@ -402,6 +373,28 @@ func TestAdd(t *testing.T) {
 				},
 			},
 		},
+	}
+
+	var profile machine.InstructionProfile
+
+	for i := range tests {
+		tests[i].Profile = &profile
+	}
+
+	testSuccess(t, tests)
+
+	t.Run("Profile", func(t *testing.T) {
+		for opcode, count := range profile.Counts {
+			if uint16(opcode) == machine.OP_ADD && count == 0 {
+				t.Fatal("ADD was not counted")
+			} else if uint16(opcode) != machine.OP_ADD && count != 0 {
+				t.Fatalf(
+					"Unexpected count\nwant:0 (opcode %#04b)\nhave:%d",
+					opcode,
+					count,
+				)
+			}
+		}
 	})
 }
 
@@ -479,6 +472,32 @@ func TestAnd(t *testing.T) {
 				},
 			},
 		},
+		{
+			// R5 must not be aliased to R1 by masking only two bits of SR2
+			Name: "AND SR2 High Register",
+			Input: testMachineState{
+				Program: 0x3000,
+				Registers: [8]uint16{
+					0: 0xCAFE, // DR
+					1: 0xFFFF, // Alias of SR2
+					2: 0x00FF, // SR1
+					5: 0x0F0F, // SR2
+				},
+				Memory: map[uint16]uint16{
+					0x3000: 0b0101_000_010_000_101,
+				},
+			},
+			Output: testMachineState{
+				Program:   0x3001,
+				Condition: 0b001,
+				Registers: [8]uint16{
+					0: 0x000F, // DR
+					1: 0xFFFF, // Alias of SR2
+					2: 0x00FF, // SR1
+					5: 0x0F0F, // SR2
+				},
+			},
+		},
 		{
 			Name: "AND imm5 Negative",
 			Input: testMachineState{
@@ -543,6 +562,48 @@ func TestAnd(t *testing.T) {
 			},
 		},
 	})
+
+	var tests []testCase
+
+	for i := uint16(0); i < 32; i++ {
+		const sr1 = 0xA5A5
+
+		dr := sr1 & encoding.SignExtend(i, 5)
+
+		var condition uint16
+		switch {
+		case dr == 0:
+			condition = 0b010
+		case dr>>15 == 1:
+			condition = 0b100
+		default:
+			condition = 0b001
+		}
+
+		tests = append(tests, testCase{
+			Name: fmt.Sprintf("AND imm5 All Values %#02x", i),
+			Input: testMachineState{
+				Program: 0x3000,
+				Registers: [8]uint16{
+					0: 0xCAFE, // DR
+					1: sr1,    // SR1
+				},
+				Memory: map[uint16]uint16{
+					0x3000: 0b0101_000_001_1_00000 | i,
+				},
+			},
+			Output: testMachineState{
+				Program:   0x3001,
+				Condition: condition,
+				Registers: [8]uint16{
+					0: dr,  // DR
+					1: sr1, // SR1
+				},
+			},
+		})
+	}
+
+	testSuccess(t, tests)
 }
 
 func TestBranch(t *testing.T) {
@@ -929,13 +990,13 @@ func TestJump(t *testing.T) {
 				Privilege: true,
 				Program:   0x3000,
 				Priority:  1,
-				Stack:     0xFDFC, // USP
+				Stack:     0xFE00, // USP
 				Registers: [8]uint16{
 					6: 0x2FF9, // SSP
 				},
 				Memory: map[uint16]uint16{
-					0xFDFE: 0x0400, // USP[1], Procstat
-					0xFDFC: 0x6000, // USP[0], Program
+					0x2FFA: 0x0400, // SSP[1], Procstat
+					0x2FF9: 0x6000, // SSP[0], Program
 					0x3000: 0b1000_000000000000,
 				},
 			},
@@ -943,12 +1004,41 @@ func TestJump(t *testing.T) {
 				Privilege: false,
 				Program:   0x6000,
 				Priority:  4,
-				Stack:     0x2FF9, // SSP
+				Stack:     0x2FFB, // SSP
 				Registers: [8]uint16{
 					6: 0xFE00, // USP
 				},
 			},
 		},
+		{
+			// Returning to a supervisor mode process keeps the supervisor
+			// stack active
+			Name: "RTI Supervisor",
+			Input: testMachineState{
+				Privilege: true,
+				Program:   0x3000,
+				Priority:  4,
+				Stack:     0xFE00, // USP
+				Registers: [8]uint16{
+					6: 0x2FF9, // SSP
+				},
+				Memory: map[uint16]uint16{
+					0x2FFA: 0x8201, // SSP[1], Procstat
+					0x2FF9: 0x6000, // SSP[0], Program
+					0x3000: 0b1000_000000000000,
+				},
+			},
+			Output: testMachineState{
+				Privilege: true,
+				Program:   0x6000,
+				Priority:  2,
+				Condition: 0b001,
+				Stack:     0xFE00, // USP
+				Registers: [8]uint16{
+					6: 0x2FFB, // SSP
+				},
+			},
+		},
 		{
 			Name: "RTI Privilege Violation",
 			Input: testMachineState{
@@ -969,14 +1059,14 @@ func TestJump(t *testing.T) {
 				Privilege: true,
 				Program:   0x6000,
 				Priority:  4,
-				Stack:     0xFDFC, // USP
+				Stack:     0xFE00, // USP
 				Registers: [8]uint16{
-					6: 0x2FFD, // SSP
+					6: 0x2FFB, // SSP
 					7: 0xDEAD,
 				},
 				Memory: map[uint16]uint16{
-					0xFDFE: 0x0400, // Procstat
-					0xFDFC: 0x3001, // Program
+					0x2FFC: 0x0400, // Procstat
+					0x2FFB: 0x3001, // Program
 				},
 			},
 		},
@@ -1702,6 +1792,30 @@ func TestTrap(t *testing.T) {
 				},
 			},
 		},
+		{
+			Name: "TRAP 0x00",
+			Input: testMachineState{
+				Program: 0x3000,
+				Stack:   0x2FFD, // SSP
+				Registers: [8]uint16{
+					6: 0xFE00, // USP
+					7: 0xCAFE,
+				},
+				Memory: map[uint16]uint16{
+					0x0000: 0x6000, // TRAP Vector value
+					0x3000: 0b1111_0000_00000000,
+				},
+			},
+			Output: testMachineState{
+				Privilege: true,
+				Program:   0x6000,
+				Stack:     0xFE00, // USP
+				Registers: [8]uint16{
+					6: 0x2FFD, // SSP
+					7: 0x3001,
+				},
+			},
+		},
 	})
 }
 
@@ -1728,13 +1842,44 @@ func TestReserved(t *testing.T) {
 				Privilege: true,
 				Program:   0x6000,
 				Priority:  4,
-				Stack:     0xFDFC, // USP
+				Stack:     0xFE00, // USP
+				Registers: [8]uint16{
+					6: 0x2FFB, // SSP
+				},
+				Memory: map[uint16]uint16{
+					0x2FFC: 0x0400, // Procstat
+					0x2FFB: 0x3001, // Program
+				},
+			},
+		},
+	})
+}
+
+func TestStack(t *testing.T) {
+	testSuccess(t, []testCase{
+		{
+			// Each push is expected to decrement R6 by a single word
+			Name: "Stack Push",
+			Input: testMachineState{
+				Privilege: true,
+				Program:   0x3000,
+				Registers: [8]uint16{
+					6: 0x2FFF, // SSP
+				},
+				Memory: map[uint16]uint16{
+					0x0101: 0x6000,
+					0x3000: 0b1101_000000000000,
+				},
+			},
+			Output: testMachineState{
+				Privilege: true,
+				Program:   0x6000,
 				Registers: [8]uint16{
 					6: 0x2FFD, // SSP
 				},
 				Memory: map[uint16]uint16{
-					0xFDFE: 0x0400, // Procstat
-					0xFDFC: 0x3001, // Program
+					0x2FFE: 0x8000, // Procstat
+					0x2FFD: 0x3001, // Program
 				},
 			},
 		},
@@ -1763,13 +1908,13 @@ func TestInterrupt(t *testing.T) {
 				Privilege: true,
 				Priority:  4,
 				Program:   0x6000,
-				Stack:     0xFDFC, // USP
+				Stack:     0xFE00, // USP
 				Registers: [8]uint16{
-					6: 0x2FFD, // SSP
+					6: 0x2FFB, // SSP
 				},
 				Memory: map[uint16]uint16{
-					0xFDFE: 0x0100, // Procstat
-					0xFDFC: 0x3001, // Program (after BR)
+					0x2FFC: 0x0100, // Procstat
+					0x2FFB: 0x3001, // Program (after BR)
 				},
 			},
 		},
@@ -1797,97 +1942,1713 @@ func TestInterrupt(t *testing.T) {
 				},
 			},
 		},
-	})
-}
-
-func TestKeyboard(t *testing.T) {
-	testSuccess(t, []testCase{
 		{
-			Name:     "Read Keyboard",
-			Steps:    2,
+			// Keyboard interrupts only preempt processes of strictly lower
+			// priority than their own priority of 4
+			Name:     "Interrupt Priority 4 Boundary",
 			Keyboard: "foobar",
 			Input: testMachineState{
-				Priority: 7, // Ignore interrupt
-				Program:  0x3000,
+				Privilege: false,
+				Priority:  4,
+				Program:   0x3000,
 				Registers: [8]uint16{
-					0: 0xDEAD, // LDR[0] DR
-					1: 0xFE00, // LDR[0] BaseR (Keyboard Status Register)
-					2: 0xDEAD, // LDR[1] DR
-					3: 0xFE02, // LDR[1] BaseR (Keyboard Data Register)
+					6: 0xFE00, // USP
 				},
 				Memory: map[uint16]uint16{
-					// LDR R0 R1 0x0
-					0x3000: 0b0110_000_001_000000,
-					// LDR R2 R3 0x0
-					0x3001: 0b0110_010_011_000000,
-					// Uninitialized KBSR
-					0xFE00: 0x0000,
-					// Uninitialized KBDR
-					0xFE02: 0x0000,
+					0x0180: 0x6000,              // Interrupt Handler Address
+					0x3000: 0b0000_000_00000000, // BR 0x0
 				},
 			},
 			Output: testMachineState{
-				Priority:  7,
-				Program:   0x3002,
-				Condition: 0b001, // Positive LDR[1] DR (#102)
+				Privilege: false,
+				Priority:  4,
+				Program:   0x3001,
 				Registers: [8]uint16{
-					0: 0x8000, // LDR[0] DR (KBSR: 1 << 15)
-					1: 0xFE00, // LDR[0] BaseR (Keyboard Status Register)
-					2: 0x0066, // LDR[1] DR (KBDR: 'f', #102)
-					3: 0xFE02, // LDR[1] BaseR (Keyboard Data Register)
-				},
-				Memory: map[uint16]uint16{
-					// KBSR: 1 << 15
-					0xFE00: 0x8000,
-					// KBDR: 'f', #102
-					0xFE02: 0x0066,
+					6: 0xFE00, // USP
 				},
 			},
 		},
-	})
-}
-
-func TestDisplay(t *testing.T) {
-	testSuccess(t, []testCase{
 		{
-			Name:    "Write Display",
-			Steps:   8,
-			Display: "aaa",
+			Name:     "Interrupt Priority 3 Fires",
+			Keyboard: "foobar",
 			Input: testMachineState{
-				Program: 0x3000,
+				Privilege: false,
+				Priority:  3,
+				Program:   0x3000,
+				Stack:     0x2FFD, // SSP
 				Registers: [8]uint16{
-					0: 0xDEAD, // LDR DR
-					1: 0xFE04, // LDR BaseR (Display Status Register)
-					2: 0x0061, // STR SR ('a', #97)
-					3: 0xFE06, // STR BaseR (Display Data Register)
-					4: 0x3000, // JMP BaseR
+					6: 0xFE00, // USP
 				},
 				Memory: map[uint16]uint16{
-					// LDR R0 R1 0x0
-					0x3000: 0b0110_000_001_000000,
-					// STR R2 R3 0x0
-					0x3001: 0b0111_010_011_000000,
-					// JMP R4
-					0x3002: 0b1100_000_100_000000,
+					0x0180: 0x6000,              // Interrupt Handler Address
+					0x3000: 0b0000_000_00000000, // BR 0x0
 				},
 			},
 			Output: testMachineState{
-				Program:   0x3002,
-				Condition: 0b100, // Negative LDR DR (1<<15)
+				Privilege: true,
+				Priority:  4,
+				Program:   0x6000,
+				Stack:     0xFE00, // USP
 				Registers: [8]uint16{
-					0: 0x8000, // LDR DR (DSR: 1 << 15)
-					1: 0xFE04, // LDR BaseR (Display Status Register)
-					2: 0x0061, // STR SR ('a', #97)
-					3: 0xFE06, // STR BaseR (Display Data Register)
-					4: 0x3000, // JMP BaseR
+					6: 0x2FFB, // SSP
 				},
 				Memory: map[uint16]uint16{
-					// DSR: 1 << 15
-					0xFE04: 0x8000,
-					// DDR: Contains last written character
-					0xFE06: 0x0061,
+					0x2FFC: 0x0300, // Procstat
+					0x2FFB: 0x3001, // Program (after BR)
 				},
 			},
 		},
 	})
 }
+
+func TestInterruptNested(t *testing.T) {
+	var mc machine.Machine
+
+	mc.Devices = &machine.DeviceHandler{
+		Keyboard: bufio.NewReader(strings.NewReader("foobar")),
+	}
+
+	// Servicing a keyboard interrupt in supervisor mode at priority 4
+	mc.State.Reset()
+	mc.State.Program = 0x6000
+	mc.State.Procstat = 1<<15 | 4<<8
+	mc.State.Registers[6] = 0x2FFB                // SSP
+	mc.State.Memory[0x0180] = 0x6000              // Keyboard Interrupt Handler Address
+	mc.State.Memory[0x0185] = 0x7000              // Injected Interrupt Handler Address
+	mc.State.Memory[0x6000] = 0b0000_000_00000000 // BR 0x0
+	mc.State.Memory[0x6001] = 0b0000_000_00000000 // BR 0x0
+
+	t.Run("Equal Priority", func(t *testing.T) {
+		mc.Step()
+
+		if mc.State.Program != 0x6001 {
+			t.Fatalf(
+				"Keyboard interrupt preempted handler of equal priority"+
+					"\nwant:0x6001\nhave:%#04x",
+				mc.State.Program,
+			)
+		}
+	})
+
+	t.Run("Higher Priority", func(t *testing.T) {
+		mc.InjectInterrupt(0x85, 5)
+		mc.Step()
+
+		if mc.State.Program != 0x7000 {
+			t.Fatalf(
+				"Interrupt failed to preempt handler of lower priority"+
+					"\nwant:0x7000\nhave:%#04x",
+				mc.State.Program,
+			)
+		}
+
+		if priority := (mc.State.Procstat >> 8) & 0x7; priority != 5 {
+			t.Fatalf("Priority mismatch\nwant:5\nhave:%d", priority)
+		}
+
+		want := map[uint16]uint16{
+			0x2FFA: 1<<15 | 4<<8, // Procstat of the first handler
+			0x2FF9: 0x6002,       // Program of the first handler
+		}
+
+		for addr, value := range want {
+			if have := mc.State.Memory[addr]; have != value {
+				t.Fatalf(
+					"Memory value mismatch\nwant:%#04x ([%#04x])\nhave:%#04x",
+					value,
+					addr,
+					have,
+				)
+			}
+		}
+	})
+}
+
+func TestTimer(t *testing.T) {
+	const interval = 5
+
+	setup := func(devices *machine.DeviceHandler) *machine.Machine {
+		var mc machine.Machine
+
+		mc.Devices = devices
+		mc.State.Reset()
+		mc.State.Program = 0x3000
+		mc.State.Procstat = 0            // User mode, priority 0
+		mc.State.Stack = 0x2FFD          // SSP
+		mc.State.Memory[0x0181] = 0x6000 // Timer Interrupt Handler Address
+
+		for addr := 0x3000; addr < 0x3010; addr++ {
+			mc.State.Memory[addr] = 0b0000_000_00000000 // BR 0x0
+		}
+
+		return &mc
+	}
+
+	t.Run("Interval", func(t *testing.T) {
+		mc := setup(&machine.DeviceHandler{
+			TimerEnabled:  true,
+			TimerInterval: interval,
+		})
+
+		for i := 1; i < interval; i++ {
+			mc.Step()
+
+			if mc.State.Program != 0x3000+uint16(i) {
+				t.Fatalf(
+					"Timer fired early\nwant:%#04x\nhave:%#04x (step %d)",
+					0x3000+i,
+					mc.State.Program,
+					i,
+				)
+			}
+		}
+
+		mc.Step()
+
+		if mc.State.Program != 0x6000 {
+			t.Fatalf(
+				"Timer did not fire\nwant:0x6000\nhave:%#04x",
+				mc.State.Program,
+			)
+		}
+
+		if priority := (mc.State.Procstat >> 8) & 0x7; priority != 2 {
+			t.Fatalf("Priority mismatch\nwant:2\nhave:%d", priority)
+		}
+	})
+
+	t.Run("Programmed", func(t *testing.T) {
+		mc := setup(&machine.DeviceHandler{})
+
+		mc.State.Registers[0] = machine.TCR_ENABLE
+		mc.State.Registers[1] = machine.DEV_TCR
+		mc.State.Registers[2] = 2                       // Interval
+		mc.State.Memory[0x3000] = 0b0111_010_001_000010 // STR R2, R1, #2 (TIR)
+		mc.State.Memory[0x3001] = 0b0111_000_001_000000 // STR R0, R1, #0 (TCR)
+
+		mc.Step()
+		mc.Step()
+
+		if !mc.Devices.TimerEnabled || mc.Devices.TimerInterval != 2 {
+			t.Fatalf(
+				"Timer registers not applied\nwant:true 2\nhave:%t %d",
+				mc.Devices.TimerEnabled,
+				mc.Devices.TimerInterval,
+			)
+		}
+
+		// The step which enables the timer counts towards its interval
+		mc.Step()
+
+		if mc.State.Program != 0x6000 {
+			t.Fatalf(
+				"Timer did not fire\nwant:0x6000\nhave:%#04x",
+				mc.State.Program,
+			)
+		}
+	})
+
+	t.Run("Masked By Priority", func(t *testing.T) {
+		mc := setup(&machine.DeviceHandler{
+			TimerEnabled:  true,
+			TimerInterval: 1,
+			TimerPriority: 3,
+		})
+
+		mc.State.Procstat = 3 << 8
+
+		mc.Step()
+
+		if mc.State.Program != 0x3001 {
+			t.Fatalf(
+				"Timer preempted a process of equal priority"+
+					"\nwant:0x3001\nhave:%#04x",
+				mc.State.Program,
+			)
+		}
+	})
+
+	t.Run("Latched While Masked", func(t *testing.T) {
+		mc := setup(&machine.DeviceHandler{
+			TimerEnabled:  true,
+			TimerInterval: 2,
+		})
+
+		mc.State.Procstat = 2 << 8
+
+		// The timer expires on the second step, while masked
+		mc.Step()
+		mc.Step()
+
+		if mc.State.Program != 0x3002 {
+			t.Fatalf(
+				"Timer preempted a process of equal priority"+
+					"\nwant:0x3002\nhave:%#04x",
+				mc.State.Program,
+			)
+		}
+
+		// The timer does not expire again on the next step, so the
+		// interrupt is only taken if it was latched
+		mc.State.Procstat = 0
+		mc.Step()
+
+		if mc.State.Program != 0x6000 {
+			t.Fatalf(
+				"Latched timer interrupt was not taken"+
+					"\nwant:0x6000\nhave:%#04x",
+				mc.State.Program,
+			)
+		}
+	})
+}
+
+func TestKeyboard(t *testing.T) {
+	testSuccess(t, []testCase{
+		{
+			Name:     "Read Keyboard",
+			Steps:    2,
+			Keyboard: "foobar",
+			Input: testMachineState{
+				Priority: 7, // Ignore interrupt
+				Program:  0x3000,
+				Registers: [8]uint16{
+					0: 0xDEAD, // LDR[0] DR
+					1: 0xFE00, // LDR[0] BaseR (Keyboard Status Register)
+					2: 0xDEAD, // LDR[1] DR
+					3: 0xFE02, // LDR[1] BaseR (Keyboard Data Register)
+				},
+				Memory: map[uint16]uint16{
+					// LDR R0 R1 0x0
+					0x3000: 0b0110_000_001_000000,
+					// LDR R2 R3 0x0
+					0x3001: 0b0110_010_011_000000,
+					// Uninitialized KBSR
+					0xFE00: 0x0000,
+					// Uninitialized KBDR
+					0xFE02: 0x0000,
+				},
+			},
+			Output: testMachineState{
+				Priority:  7,
+				Program:   0x3002,
+				Condition: 0b001, // Positive LDR[1] DR (#102)
+				Registers: [8]uint16{
+					0: 0x8000, // LDR[0] DR (KBSR: 1 << 15)
+					1: 0xFE00, // LDR[0] BaseR (Keyboard Status Register)
+					2: 0x0066, // LDR[1] DR (KBDR: 'f', #102)
+					3: 0xFE02, // LDR[1] BaseR (Keyboard Data Register)
+				},
+				Memory: map[uint16]uint16{
+					// KBSR: 1 << 15
+					0xFE00: 0x8000,
+					// KBDR: 'f', #102
+					0xFE02: 0x0066,
+				},
+			},
+		},
+	})
+}
+
+func TestKeyboardFile(t *testing.T) {
+	filename := t.TempDir() + "/input.txt"
+
+	if err := os.WriteFile(filename, []byte("hello"), 0666); err != nil {
+		t.Fatal(err)
+	}
+
+	file, err := os.Open(filename)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer file.Close()
+
+	var mc machine.Machine
+	var display bytes.Buffer
+
+	mc.Devices = &machine.DeviceHandler{
+		Keyboard: bufio.NewReader(file),
+		Display:  bufio.NewWriter(&display),
+	}
+
+	mc.State.Reset()
+	mc.State.Program = 0x3000
+	mc.State.Procstat = 7 << 8     // Ignore interrupt
+	mc.State.Registers[1] = 0xFE00 // Keyboard Status Register
+	mc.State.Registers[3] = 0xFE02 // Keyboard Data Register
+	mc.State.Registers[5] = 0xFE06 // Display Data Register
+
+	// LDR R0 R1 0x0
+	mc.State.Memory[0x3000] = 0b0110_000_001_000000
+	// BRzp #3 (No key ready)
+	mc.State.Memory[0x3001] = 0b0000_011_000000011
+	// LDR R2 R3 0x0
+	mc.State.Memory[0x3002] = 0b0110_010_011_000000
+	// STR R2 R5 0x0
+	mc.State.Memory[0x3003] = 0b0111_010_101_000000
+	// BRnzp #-5
+	mc.State.Memory[0x3004] = 0b0000_111_111111011
+
+	for i := 0; i < 100 && mc.State.Program != 0x3005; i++ {
+		mc.Step()
+	}
+
+	if mc.State.Program != 0x3005 {
+		t.Fatalf("Keyboard was not exhausted, PC:%#04x", mc.State.Program)
+	}
+
+	if kbsr := mc.State.Memory[0xFE00]; kbsr != 0 {
+		t.Fatalf("Invalid KBSR once exhausted\nwant:0x0000\nhave:%#04x", kbsr)
+	}
+
+	if have := display.String(); have != "hello" {
+		t.Fatalf("Invalid display output\nwant:%q\nhave:%q", "hello", have)
+	}
+}
+
+// Keyboard holding a fixed sequence of keys
+type testKeyboard struct {
+	keys []byte
+}
+
+func (kb *testKeyboard) ReadByte() (byte, error) {
+	if len(kb.keys) == 0 {
+		return 0, io.EOF
+	}
+
+	key := kb.keys[0]
+	kb.keys = kb.keys[1:]
+
+	return key, nil
+}
+
+func (kb *testKeyboard) Peek(n int) ([]byte, error) {
+	if len(kb.keys) < n {
+		return kb.keys, io.EOF
+	}
+
+	return kb.keys[:n], nil
+}
+
+// Display recording each character written, which is only ready while busy is
+// unset
+type testDisplay struct {
+	written []byte
+	busy    bool
+}
+
+func (d *testDisplay) WriteByte(c byte) error {
+	d.written = append(d.written, c)
+	return nil
+}
+
+func (d *testDisplay) Flush() error {
+	return nil
+}
+
+func (d *testDisplay) Available() int {
+	if d.busy {
+		return 0
+	}
+
+	return 1
+}
+
+func TestDeviceInterfaces(t *testing.T) {
+	var mc machine.Machine
+
+	keyboard := &testKeyboard{keys: []byte("x")}
+	display := &testDisplay{}
+
+	mc.Devices = &machine.DeviceHandler{Keyboard: keyboard, Display: display}
+	mc.State.Reset()
+
+	if have := mc.GetMemory(0xFE00); have != 0x8000 {
+		t.Fatalf("Invalid KBSR\nwant:0x8000\nhave:%#04x", have)
+	}
+
+	if have := mc.GetMemory(0xFE02); have != 'x' {
+		t.Fatalf("Invalid KBDR\nwant:%#04x\nhave:%#04x", 'x', have)
+	}
+
+	if have := mc.GetMemory(0xFE00); have != 0x0000 {
+		t.Fatalf("Invalid KBSR once exhausted\nwant:0x0000\nhave:%#04x", have)
+	}
+
+	if have := mc.GetMemory(0xFE04); have != 0x8000 {
+		t.Fatalf("Invalid DSR\nwant:0x8000\nhave:%#04x", have)
+	}
+
+	display.busy = true
+
+	if have := mc.GetMemory(0xFE04); have != 0x0000 {
+		t.Fatalf("Invalid DSR while busy\nwant:0x0000\nhave:%#04x", have)
+	}
+
+	mc.SetMemory(0xFE06, 'y')
+
+	if have := string(display.written); have != "y" {
+		t.Fatalf("Invalid display output\nwant:%q\nhave:%q", "y", have)
+	}
+}
+
+// Device counting the reads and writes of its address, reading as the number
+// of reads so far
+type testCounter struct {
+	reads  uint16
+	writes []uint16
+}
+
+func (c *testCounter) OnRead(addr uint16) uint16 {
+	c.reads++
+	return c.reads
+}
+
+func (c *testCounter) OnWrite(addr uint16, value uint16) {
+	c.writes = append(c.writes, value)
+}
+
+func TestRegisterMMIO(t *testing.T) {
+	var mc machine.Machine
+	var counter testCounter
+
+	mc.State.Reset()
+	mc.State.Program = 0x3000
+	mc.State.Registers[1] = 0xFE10
+	mc.State.Registers[2] = 0xBEEF
+
+	// LDR R0 R1 0x0
+	mc.State.Memory[0x3000] = 0b0110_000_001_000000
+	// LDR R0 R1 0x0
+	mc.State.Memory[0x3001] = 0b0110_000_001_000000
+	// STR R2 R1 0x0
+	mc.State.Memory[0x3002] = 0b0111_010_001_000000
+	// LDR R0 R1 0x0
+	mc.State.Memory[0x3003] = 0b0110_000_001_000000
+
+	mc.RegisterMMIO(0xFE10, &counter)
+	mc.RunN(3)
+
+	if have := mc.State.Registers[0]; have != 2 {
+		t.Fatalf("Invalid value read from device\nwant:2\nhave:%d", have)
+	}
+
+	if !reflect.DeepEqual(counter.writes, []uint16{0xBEEF}) {
+		t.Fatalf(
+			"Invalid writes to device\nwant:[0xbeef]\nhave:%#04x",
+			counter.writes,
+		)
+	}
+
+	// Once unregistered the address reads as memory, holding the last write
+	mc.UnregisterMMIO(0xFE10)
+	mc.Step()
+
+	if have := mc.State.Registers[0]; have != 0xBEEF {
+		t.Fatalf("Invalid value read from memory\nwant:0xbeef\nhave:%#04x", have)
+	}
+
+	if counter.reads != 2 {
+		t.Fatalf("Invalid device read count\nwant:2\nhave:%d", counter.reads)
+	}
+}
+
+func TestMemoryAccessors(t *testing.T) {
+	var mc machine.Machine
+
+	mc.Devices = &machine.DeviceHandler{
+		Keyboard: bufio.NewReader(strings.NewReader("a")),
+	}
+
+	mc.State.Reset()
+	mc.SetMemory(0x3000, 0x1234)
+
+	if have := mc.GetMemory(0x3000); have != 0x1234 {
+		t.Fatalf("Memory value mismatch\nwant:0x1234\nhave:%#04x", have)
+	}
+
+	// Reading the KBSR polls the keyboard
+	if have := mc.GetMemory(0xFE00); have != 0x8000 {
+		t.Fatalf("Invalid KBSR\nwant:0x8000\nhave:%#04x", have)
+	}
+
+	if have := mc.GetMemory(0xFE02); have != 'a' {
+		t.Fatalf("Invalid KBDR\nwant:%#04x\nhave:%#04x", 'a', have)
+	}
+}
+
+func TestRegisterAccessors(t *testing.T) {
+	var mc machine.Machine
+
+	for r := 0; r < 8; r++ {
+		if err := mc.SetRegister(r, uint16(r)+1); err != nil {
+			t.Fatal(err)
+		}
+
+		if have, err := mc.GetRegister(r); err != nil {
+			t.Fatal(err)
+		} else if have != uint16(r)+1 {
+			t.Fatalf("Register R%d mismatch\nwant:%d\nhave:%d", r, r+1, have)
+		}
+	}
+
+	for _, r := range []int{-1, 8} {
+		err := mc.SetRegister(r, 0)
+
+		if !errors.Is(err, machine.ErrInvalidRegister) {
+			t.Fatalf("Expected ErrInvalidRegister setting R%d, have:%v", r, err)
+		}
+
+		_, err = mc.GetRegister(r)
+
+		if !errors.Is(err, machine.ErrInvalidRegister) {
+			t.Fatalf("Expected ErrInvalidRegister getting R%d, have:%v", r, err)
+		}
+	}
+}
+
+func TestConcurrentKeyboard(t *testing.T) {
+	reader, writer, err := os.Pipe()
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer reader.Close()
+
+	var mc machine.Machine
+	var display bytes.Buffer
+
+	mc.Devices = &machine.DeviceHandler{
+		Keyboard: bufio.NewReader(reader),
+		Display:  bufio.NewWriter(&display),
+	}
+
+	mc.State.Reset()
+	mc.State.Program = 0x3000
+	mc.State.Registers[1] = 0xFE00 // Keyboard Status Register
+	mc.State.Registers[3] = 0xFE02 // Keyboard Data Register
+	mc.State.Registers[5] = 0xFE06 // Display Data Register
+
+	// BRnzp #-1
+	mc.State.Memory[0x3000] = 0b0000_111_111111111
+	// Keyboard Interrupt Handler Address
+	mc.State.Memory[0x0180] = 0x4000
+	// LDR R0 R1 0x0
+	mc.State.Memory[0x4000] = 0b0110_000_001_000000
+	// LDR R2 R3 0x0
+	mc.State.Memory[0x4001] = 0b0110_010_011_000000
+	// STR R2 R5 0x0
+	mc.State.Memory[0x4002] = 0b0111_010_101_000000
+	// RTI
+	mc.State.Memory[0x4003] = 0b1000_000000000000
+
+	done := make(chan error)
+
+	go func() {
+		// Each step waits on the pipe until a key arrives or it is closed
+		done <- mc.RunN(1000)
+	}()
+
+	go func() {
+		for _, key := range []byte("hello") {
+			writer.Write([]byte{key})
+			time.Sleep(time.Millisecond)
+		}
+
+		writer.Close()
+	}()
+
+	select {
+	case err := <-done:
+		if err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("Machine did not finish running")
+	}
+
+	if have := display.String(); have != "hello" {
+		t.Fatalf("Invalid display output\nwant:%q\nhave:%q", "hello", have)
+	}
+}
+
+func TestDisplay(t *testing.T) {
+	testSuccess(t, []testCase{
+		{
+			Name:    "Write Display",
+			Steps:   8,
+			Display: "aaa",
+			Input: testMachineState{
+				Program: 0x3000,
+				Registers: [8]uint16{
+					0: 0xDEAD, // LDR DR
+					1: 0xFE04, // LDR BaseR (Display Status Register)
+					2: 0x0061, // STR SR ('a', #97)
+					3: 0xFE06, // STR BaseR (Display Data Register)
+					4: 0x3000, // JMP BaseR
+				},
+				Memory: map[uint16]uint16{
+					// LDR R0 R1 0x0
+					0x3000: 0b0110_000_001_000000,
+					// STR R2 R3 0x0
+					0x3001: 0b0111_010_011_000000,
+					// JMP R4
+					0x3002: 0b1100_000_100_000000,
+				},
+			},
+			Output: testMachineState{
+				Program:   0x3002,
+				Condition: 0b100, // Negative LDR DR (1<<15)
+				Registers: [8]uint16{
+					0: 0x8000, // LDR DR (DSR: 1 << 15)
+					1: 0xFE04, // LDR BaseR (Display Status Register)
+					2: 0x0061, // STR SR ('a', #97)
+					3: 0xFE06, // STR BaseR (Display Data Register)
+					4: 0x3000, // JMP BaseR
+				},
+				Memory: map[uint16]uint16{
+					// DSR: 1 << 15
+					0xFE04: 0x8000,
+					// DDR: Contains last written character
+					0xFE06: 0x0061,
+				},
+			},
+		},
+		{
+			// Devices is nil, the write must be discarded rather than panic
+			Name: "Write Without Display",
+			Input: testMachineState{
+				Program: 0x3000,
+				Registers: [8]uint16{
+					2: 0x0061, // STR SR ('a', #97)
+					3: 0xFE06, // STR BaseR (Display Data Register)
+				},
+				Memory: map[uint16]uint16{
+					// STR R2 R3 0x0
+					0x3000: 0b0111_010_011_000000,
+				},
+			},
+			Output: testMachineState{
+				Program: 0x3001,
+				Registers: [8]uint16{
+					2: 0x0061, // STR SR ('a', #97)
+					3: 0xFE06, // STR BaseR (Display Data Register)
+				},
+				Memory: map[uint16]uint16{
+					0xFE06: 0x0061,
+				},
+			},
+		},
+	})
+}
+
+func TestMachineControl(t *testing.T) {
+	testSuccess(t, []testCase{
+		{
+			Name:  "MCR Halt",
+			Steps: 2,
+			Input: testMachineState{
+				Program: 0x3000,
+				Registers: [8]uint16{
+					0: 0x0000, // STR SR (Clock disabled)
+					1: 0xFFFE, // STR BaseR (Machine Control Register)
+				},
+				Memory: map[uint16]uint16{
+					// STR R0 R1 0x0
+					0x3000: 0b0111_000_001_000000,
+					// NOT R0 R0
+					0x3001: 0b1001_000_000_111111,
+				},
+			},
+			Output: testMachineState{
+				// NOT is never executed
+				Program: 0x3001,
+				Registers: [8]uint16{
+					0: 0x0000,
+					1: 0xFFFE,
+				},
+			},
+		},
+		{
+			Name:  "MCR Clock Enabled",
+			Steps: 2,
+			Input: testMachineState{
+				Program: 0x3000,
+				Registers: [8]uint16{
+					0: 0x8000, // STR SR (Clock enabled)
+					1: 0xFFFE, // STR BaseR (Machine Control Register)
+				},
+				Memory: map[uint16]uint16{
+					// STR R0 R1 0x0
+					0x3000: 0b0111_000_001_000000,
+					// NOT R0 R0
+					0x3001: 0b1001_000_000_111111,
+				},
+			},
+			Output: testMachineState{
+				Program:   0x3002,
+				Condition: 0b001,
+				Registers: [8]uint16{
+					0: 0x7FFF,
+					1: 0xFFFE,
+				},
+				Memory: map[uint16]uint16{
+					0xFFFE: 0x8000,
+				},
+			},
+		},
+		{
+			Name: "MCR Read",
+			Input: testMachineState{
+				Program: 0x3000,
+				Registers: [8]uint16{
+					1: 0xFFFE, // LDR BaseR (Machine Control Register)
+				},
+				Memory: map[uint16]uint16{
+					// LDR R0 R1 0x0
+					0x3000: 0b0110_000_001_000000,
+				},
+			},
+			Output: testMachineState{
+				Program:   0x3001,
+				Condition: 0b100,
+				Registers: [8]uint16{
+					0: 0x8000,
+					1: 0xFFFE,
+				},
+				Memory: map[uint16]uint16{
+					0xFFFE: 0x8000,
+				},
+			},
+		},
+		{
+			// A HALT service routine may stop the machine by clearing the MCR
+			Name:  "MCR Trap Halt",
+			Steps: 3,
+			Input: testMachineState{
+				Program: 0x3000,
+				Registers: [8]uint16{
+					0: 0x0000, // STR SR (Clock disabled)
+					1: 0xFFFE, // STR BaseR (Machine Control Register)
+				},
+				Memory: map[uint16]uint16{
+					0x0025: 0x1000, // HALT Service Routine Address
+					// STR R0 R1 0x0
+					0x1000: 0b0111_000_001_000000,
+					// NOT R0 R0
+					0x1001: 0b1001_000_000_111111,
+					// HALT
+					0x3000: 0b1111_0000_00100101,
+				},
+			},
+			Output: testMachineState{
+				Privilege: true,
+				Program:   0x1001,
+				Registers: [8]uint16{
+					0: 0x0000,
+					1: 0xFFFE,
+					7: 0x3001,
+				},
+			},
+		},
+	})
+
+	t.Run("Halted", func(t *testing.T) {
+		var mc machine.Machine
+
+		mc.State.Reset()
+		mc.State.Program = 0x3000
+		mc.State.Registers[1] = machine.DEV_MCR
+		// STR R0 R1 0x0
+		mc.State.Memory[0x3000] = 0b0111_000_001_000000
+
+		mc.Step()
+
+		if !mc.Halted {
+			t.Fatal("Machine did not halt after clearing MCR clock enable")
+		}
+	})
+}
+
+func TestHaltTrap(t *testing.T) {
+	var mc machine.Machine
+	var rec stateRecorder
+
+	mc.State.Reset()
+	mc.State.Program = 0x3000
+	mc.State.Registers[1] = machine.DEV_MCR
+	mc.State.Memory[0x0025] = 0x1000                 // HALT Trap Routine Address
+	mc.State.Memory[0x1000] = 0b0111_000_001_000000  // STR R0, R1, #0 (MCR)
+	mc.State.Memory[0x3000] = 0b1111_0000_00100101   // TRAP 0x25
+	mc.State.Memory[0x3001] = 0b0001_000_000_1_00001 // ADD R0, R0, #1
+	mc.Debugger = &rec
+
+	if err := mc.RunN(10); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	if !mc.IsHalted() {
+		t.Fatal("Machine did not halt")
+	}
+
+	if len(rec.States) != 2 || mc.State.Program != 0x1001 {
+		t.Fatalf(
+			"Machine stepped after halting"+
+				"\nwant:2 steps (0x1001)\nhave:%d steps (%#04x)",
+			len(rec.States),
+			mc.State.Program,
+		)
+	}
+
+	mc.Step()
+
+	if mc.State.Program != 0x1001 || mc.State.Registers[0] != 0 {
+		t.Fatal("Step executed an instruction while halted")
+	}
+}
+
+func TestLoadProgress(t *testing.T) {
+	binary := make([]byte, 2048*2)
+
+	t.Run("Callback", func(t *testing.T) {
+		var mc machine.Machine
+		var progress []int
+
+		mc.LoadOptions.OnProgress = func(wordsLoaded int) {
+			progress = append(progress, wordsLoaded)
+		}
+
+		if _, err := mc.LoadBin(bytes.NewReader(binary), 0); err != nil {
+			t.Fatal(err)
+		}
+
+		if len(progress) != 2 || progress[0] != 1024 || progress[1] != 2048 {
+			t.Fatalf(
+				"Load progress mismatch\nwant:[1024 2048]\nhave:%v",
+				progress,
+			)
+		}
+	})
+
+	t.Run("No Callback", func(t *testing.T) {
+		var mc machine.Machine
+
+		if _, err := mc.LoadBin(bytes.NewReader(binary), 0); err != nil {
+			t.Fatal(err)
+		}
+	})
+}
+
+func TestRestoreState(t *testing.T) {
+	var mc machine.Machine
+	var state machine.MachineState
+
+	state.Reset()
+	state.Program = 0x3000
+	state.Registers[0] = 0xBEEF
+	state.Memory[0x0180] = 0x6000 // Interrupt Handler Address
+
+	mc.State.Reset()
+	mc.State.Procstat = 7 << 8 // Mask the injected interrupt
+	mc.InjectInterrupt(0x80, 4)
+	mc.Step()
+	mc.Halted = true
+
+	mc.RestoreState(state)
+
+	if mc.IsHalted() || mc.StepCount() != 0 {
+		t.Fatalf(
+			"Machine not reset\nhalted:%t\nsteps:%d",
+			mc.IsHalted(),
+			mc.StepCount(),
+		)
+	}
+
+	if mc.State.Registers[0] != 0xBEEF {
+		t.Fatalf(
+			"Register mismatch\nwant:0xbeef\nhave:%#04x", mc.State.Registers[0],
+		)
+	}
+
+	// The interrupt pending before the restore is not delivered after it
+	mc.Step()
+
+	if mc.State.Program != 0x3001 {
+		t.Fatalf(
+			"Stale interrupt was taken\nwant:0x3001\nhave:%#04x",
+			mc.State.Program,
+		)
+	}
+}
+
+func TestLoadBinOrigin(t *testing.T) {
+	binary := []byte{0x12, 0x34, 0xF0, 0x25}
+
+	for _, test := range []struct {
+		Name   string
+		Origin uint16
+	}{
+		{"Origin 0x0000", 0x0000},
+		{"Origin 0x3000", 0x3000},
+		{"Origin 0xFFFE", 0xFFFE},
+	} {
+		t.Run(test.Name, func(t *testing.T) {
+			var mc machine.Machine
+
+			mc.State.Memory[0x4000] = 0xFFFF
+			mc.Step()
+			mc.Halted = true
+
+			if _, err := mc.LoadBin(
+				bytes.NewReader(binary), test.Origin,
+			); err != nil {
+				t.Fatal(err)
+			}
+
+			want := map[uint16]uint16{
+				test.Origin:     0x1234,
+				test.Origin + 1: 0xF025,
+			}
+
+			// Memory is reset before loading, and nothing outside of the
+			// binary is written
+			for addr := range mc.State.Memory {
+				value := want[uint16(addr)]
+
+				if have := mc.State.Memory[addr]; have != value {
+					t.Fatalf(
+						"Memory value mismatch\n"+
+							"want:%#04x ([%#04x])\nhave:%#04x",
+						value,
+						addr,
+						have,
+					)
+				}
+			}
+
+			// State kept outside of MachineState is reset alongside it
+			if mc.IsHalted() || mc.StepCount() != 0 {
+				t.Fatalf(
+					"Machine not reset\nhalted:%t\nsteps:%d",
+					mc.IsHalted(),
+					mc.StepCount(),
+				)
+			}
+		})
+	}
+
+	t.Run("Exceeds Memory", func(t *testing.T) {
+		var mc machine.Machine
+
+		if _, err := mc.LoadBin(bytes.NewReader(binary), 0xFFFF); err == nil {
+			t.Fatal("Expected error loading past the end of memory")
+		}
+	})
+}
+
+func TestLoadBinWords(t *testing.T) {
+	t.Run("Words Loaded", func(t *testing.T) {
+		var mc machine.Machine
+
+		binary := []byte{0x12, 0x34, 0xF0, 0x25}
+
+		wordsLoaded, err := mc.LoadBin(bytes.NewReader(binary), 0x3000)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if wordsLoaded != 2 {
+			t.Fatalf("Invalid word count\nwant:2\nhave:%d", wordsLoaded)
+		}
+	})
+
+	t.Run("Empty Binary", func(t *testing.T) {
+		var mc machine.Machine
+
+		wordsLoaded, err := mc.LoadBin(bytes.NewReader(nil), 0)
+
+		if !errors.Is(err, machine.ErrEmptyBinary) {
+			t.Fatalf("Expected ErrEmptyBinary, have:%v", err)
+		}
+
+		if wordsLoaded != 0 {
+			t.Fatalf("Invalid word count\nwant:0\nhave:%d", wordsLoaded)
+		}
+	})
+}
+
+func TestLoadRelocatable(t *testing.T) {
+	assembled := assembler.AssembleLC3Source(strings.NewReader(`
+	.ORIG 0x3000
+	ADD R0, R1, R2
+	AND R0, R1, #0
+	NOT R0, R1
+	OUT
+	HALT
+	`))
+
+	if !assembled.Success() {
+		t.Fatal(assembled.Errors[0])
+	}
+
+	result := assembled.Memory
+
+	var buffer bytes.Buffer
+
+	if err := assembler.WriteRelocatable(
+		&buffer, result, assembled.Origin,
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	if have, want := buffer.Len(), 2*(1+5); have != want {
+		t.Fatalf("Relocatable binary size mismatch\nwant:%d\nhave:%d", want, have)
+	}
+
+	var mc machine.Machine
+
+	if err := mc.LoadRelocatable(&buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	for addr, value := range mc.State.Memory {
+		want := uint16(0)
+		if addr >= 0x3000 && addr < 0x3005 {
+			want = result[addr]
+		}
+
+		if value != want {
+			t.Fatalf(
+				"Memory value mismatch\nwant:%#04x (result[%#04x])\nhave:%#04x",
+				want,
+				addr,
+				value,
+			)
+		}
+	}
+}
+
+func TestLoadRelocatableLeadingZero(t *testing.T) {
+	assembled := assembler.AssembleLC3Source(strings.NewReader(`
+	.ORIG 0x3000
+	.FILL 0x0000
+	HALT
+	`))
+
+	if !assembled.Success() {
+		t.Fatal(assembled.Errors[0])
+	}
+
+	var buffer bytes.Buffer
+
+	if err := assembler.WriteRelocatable(
+		&buffer, assembled.Memory, assembled.Origin,
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	// The header is the origin rather than the first non-zero word
+	want := []byte{0x30, 0x00, 0x00, 0x00, 0xF0, 0x25}
+
+	if have := buffer.Bytes(); !bytes.Equal(have, want) {
+		t.Fatalf("Relocatable binary mismatch\nwant:% x\nhave:% x", want, have)
+	}
+
+	var mc machine.Machine
+
+	if err := mc.LoadRelocatable(&buffer); err != nil {
+		t.Fatal(err)
+	}
+
+	if have := mc.State.Memory[0x3001]; have != 0xF025 {
+		t.Fatalf("Memory value mismatch\nwant:0xf025\nhave:%#04x", have)
+	}
+}
+
+func TestLoadBinAt(t *testing.T) {
+	system := []byte{0xF0, 0x25, 0x80, 0x00}
+	user := []byte{0x10, 0x42, 0x50, 0x60, 0xF0, 0x25}
+
+	t.Run("Regions", func(t *testing.T) {
+		var mc machine.Machine
+
+		if err := mc.LoadBinAt(bytes.NewReader(system), 0x0200); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := mc.LoadBinAt(bytes.NewReader(user), 0x3000); err != nil {
+			t.Fatal(err)
+		}
+
+		want := map[uint16]uint16{
+			0x0200: 0xF025,
+			0x0201: 0x8000,
+			0x3000: 0x1042,
+			0x3001: 0x5060,
+			0x3002: 0xF025,
+		}
+
+		for addr, value := range mc.State.Memory {
+			if value != want[uint16(addr)] {
+				t.Fatalf(
+					"Memory value mismatch\nwant:%#04x ([%#04x])\nhave:%#04x",
+					want[uint16(addr)],
+					addr,
+					value,
+				)
+			}
+		}
+	})
+
+	t.Run("Strict", func(t *testing.T) {
+		var mc machine.Machine
+
+		if err := mc.LoadBinAtStrict(bytes.NewReader(user), 0x3000); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := mc.LoadBinAtStrict(
+			bytes.NewReader(system), 0x3002,
+		); err != machine.ErrMemoryOverlap {
+			t.Fatalf(
+				"Invalid error\nwant:%v\nhave:%v", machine.ErrMemoryOverlap, err,
+			)
+		}
+
+		if have, want := mc.State.Memory[0x3003], uint16(0); have != want {
+			t.Fatalf(
+				"Memory modified by rejected load\nwant:%#04x\nhave:%#04x",
+				want,
+				have,
+			)
+		}
+
+		if err := mc.LoadBinAtStrict(bytes.NewReader(system), 0x3003); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("Oversized", func(t *testing.T) {
+		var mc machine.Machine
+
+		if err := mc.LoadBinAt(bytes.NewReader(system), 0xFFFF); err == nil {
+			t.Fatal("Expected error loading beyond memory")
+		}
+	})
+}
+
+func TestChecksum(t *testing.T) {
+	var a, b machine.MachineState
+
+	a.Reset()
+	b.Reset()
+
+	a.Registers[0] = 0xCAFE
+	b.Registers[0] = 0xCAFE
+	a.Memory[0x3000] = 0x1234
+	b.Memory[0x3000] = 0x1234
+
+	t.Run("Identical", func(t *testing.T) {
+		if a.Checksum() != b.Checksum() {
+			t.Fatalf(
+				"Checksum mismatch\nwant:%#08x\nhave:%#08x",
+				a.Checksum(),
+				b.Checksum(),
+			)
+		}
+	})
+
+	t.Run("Memory Bit Flip", func(t *testing.T) {
+		c := b
+		c.Memory[0xFFFF] ^= 0x0001
+
+		if a.Checksum() == c.Checksum() {
+			t.Fatalf("Checksum unchanged\nhave:%#08x", c.Checksum())
+		}
+	})
+
+	t.Run("Register Change", func(t *testing.T) {
+		c := b
+		c.Registers[7] = 0x0001
+
+		if a.Checksum() == c.Checksum() {
+			t.Fatalf("Checksum unchanged\nhave:%#08x", c.Checksum())
+		}
+	})
+}
+
+func TestRunN(t *testing.T) {
+	t.Run("Steps", func(t *testing.T) {
+		var mc machine.Machine
+		var rec stateRecorder
+
+		mc.State.Reset()
+		mc.State.Program = 0x3000
+		mc.State.Memory[0x3000] = 0b0001_000_000_1_00001 // ADD R0, R0, #1
+		mc.State.Memory[0x3001] = 0b0000_111_111111110   // BRnzp #-2
+		mc.Debugger = &rec
+
+		if err := mc.RunN(9); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		if mc.State.Registers[0] != 5 {
+			t.Fatalf("Register mismatch\nwant:5\nhave:%d", mc.State.Registers[0])
+		}
+
+		if len(rec.States) != 9 {
+			t.Fatalf("Debugger step mismatch\nwant:9\nhave:%d", len(rec.States))
+		}
+	})
+
+	t.Run("Halted", func(t *testing.T) {
+		var mc machine.Machine
+		var rec stateRecorder
+
+		mc.State.Reset()
+		mc.State.Program = 0x3000
+		mc.State.Registers[1] = machine.DEV_MCR
+		mc.State.Memory[0x3000] = 0b0111_000_001_000000 // STR R0, R1, #0
+		mc.Debugger = &rec
+
+		if err := mc.RunN(100); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		if !mc.Halted || len(rec.States) != 1 {
+			t.Fatalf(
+				"Machine did not stop on halt\nwant:1 step\nhave:%d steps",
+				len(rec.States),
+			)
+		}
+	})
+
+	t.Run("Keyboard Error", func(t *testing.T) {
+		var mc machine.Machine
+
+		mc.Devices = &machine.DeviceHandler{
+			Keyboard: bufio.NewReader(iotest.ErrReader(errors.New("broken"))),
+		}
+
+		mc.State.Reset()
+		mc.State.Program = 0x3000
+		mc.State.Registers[1] = machine.DEV_KBSR
+		mc.State.Memory[0x3000] = 0b0110_000_001_000000 // LDR R0, R1, #0
+
+		if err := mc.RunN(1); err == nil || err.Error() != "broken" {
+			t.Fatalf("Error mismatch\nwant:broken\nhave:%v", err)
+		}
+	})
+}
+
+func TestMaxSteps(t *testing.T) {
+	setup := func() *machine.Machine {
+		var mc machine.Machine
+
+		mc.State.Reset()
+		mc.State.Program = 0x3000
+		mc.MaxSteps = 100
+
+		// ADD R0 R0 #1
+		for addr := 0x3000; addr < 0x3100; addr++ {
+			mc.State.Memory[addr] = 0b0001_000_000_1_00001
+		}
+
+		return &mc
+	}
+
+	check := func(t *testing.T, mc *machine.Machine, err error) {
+		if !errors.Is(err, machine.ErrExecutionLimitReached) {
+			t.Fatalf("Expected ErrExecutionLimitReached, have:%v", err)
+		}
+
+		if have := mc.State.Registers[0]; have != 100 {
+			t.Fatalf("Invalid instruction count\nwant:100\nhave:%d", have)
+		}
+
+		if have := mc.StepCount(); have != 100 {
+			t.Fatalf("Invalid step count\nwant:100\nhave:%d", have)
+		}
+	}
+
+	t.Run("RunN", func(t *testing.T) {
+		mc := setup()
+		check(t, mc, mc.RunN(1000))
+	})
+
+	t.Run("RunN Below Limit", func(t *testing.T) {
+		mc := setup()
+
+		if err := mc.RunN(100); err != nil {
+			t.Fatal(err)
+		}
+
+		check(t, mc, mc.RunN(1))
+	})
+
+	t.Run("RunWithContext", func(t *testing.T) {
+		mc := setup()
+		check(t, mc, mc.RunWithContext(context.Background()))
+	})
+
+	t.Run("Step", func(t *testing.T) {
+		mc := setup()
+
+		for i := 0; i < 1000; i++ {
+			mc.Step()
+		}
+
+		check(t, mc, machine.ErrExecutionLimitReached)
+
+		if !mc.ExecutionLimitReached() {
+			t.Fatal("Expected the execution limit to be reached")
+		}
+	})
+}
+
+func TestSynchronizedMachine(t *testing.T) {
+	var sm machine.SynchronizedMachine
+	var wg sync.WaitGroup
+
+	sm.State.Reset()
+	sm.State.Program = 0x3000
+
+	// ADD R0 R0 #1
+	sm.State.Memory[0x3000] = 0b0001_000_000_1_00001
+	// BRnzp #-2
+	sm.State.Memory[0x3001] = 0b0000_111_111111110
+
+	done := make(chan struct{})
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(done)
+
+		for i := 0; i < 1000; i++ {
+			sm.Step()
+		}
+	}()
+
+	errs := make(chan error, 3)
+
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+
+			var last uint16
+
+			for {
+				select {
+				case <-done:
+					return
+				default:
+				}
+
+				state := sm.Snapshot()
+
+				if state.Registers[0] < last {
+					errs <- fmt.Errorf(
+						"R0 went backwards from %d to %d",
+						last,
+						state.Registers[0],
+					)
+					return
+				}
+
+				last = state.Registers[0]
+
+				if _, err := sm.GetRegister(0); err != nil {
+					errs <- err
+					return
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		t.Error(err)
+	}
+
+	if have := sm.Snapshot().Registers[0]; have != 500 {
+		t.Fatalf("Invalid R0 after stepping\nwant:500\nhave:%d", have)
+	}
+}
+
+func TestRunUntilHalt(t *testing.T) {
+	t.Run("Halt", func(t *testing.T) {
+		var mc machine.Machine
+
+		mc.State.Reset()
+		mc.State.Program = 0x3000
+		mc.State.Registers[0] = 3
+		mc.State.Registers[2] = machine.DEV_MCR
+		mc.State.Memory[0x3000] = 0b0001_000_000_1_11111 // ADD R0, R0, #-1
+		mc.State.Memory[0x3001] = 0b0000_101_111111110   // BRnp #-2
+		mc.State.Memory[0x3002] = 0b0111_000_010_000000  // STR R0, R2, #0
+
+		if err := mc.RunUntilHalt(context.Background()); err != nil {
+			t.Fatalf("Unexpected error: %s", err)
+		}
+
+		if mc.State.Program != 0x3003 {
+			t.Fatalf(
+				"Program mismatch\nwant:0x3003\nhave:%#04x", mc.State.Program,
+			)
+		}
+	})
+
+	t.Run("Cancelled", func(t *testing.T) {
+		var mc machine.Machine
+
+		mc.State.Reset()
+		mc.State.Program = 0x3000
+		mc.State.Memory[0x3000] = 0b0000_111_111111111 // BRnzp #-1
+
+		ctx, cancel := context.WithTimeout(
+			context.Background(), 10*time.Millisecond,
+		)
+		defer cancel()
+
+		if err := mc.RunUntilHalt(ctx); err != context.DeadlineExceeded {
+			t.Fatalf(
+				"Error mismatch\nwant:%s\nhave:%v", context.DeadlineExceeded, err,
+			)
+		}
+	})
+}
+
+func TestStateDiff(t *testing.T) {
+	var before machine.MachineState
+
+	before.Reset()
+	before.Memory[0x3000] = 0x1234
+
+	after := before.Clone()
+	after.Registers[2] = 0xCAFE
+	after.Program = 0x3001
+	after.Memory[0x3000] = 0x4321
+	after.Memory[0xFFFE] = 0x8000
+
+	if before.Memory[0x3000] != 0x1234 {
+		t.Fatal("Clone shares memory with the original state")
+	}
+
+	want := []machine.StateDelta{
+		{machine.DELTA_REGISTER, 2, 0x0000, 0xCAFE},
+		{machine.DELTA_PROGRAM, 0, 0x0200, 0x3001},
+		{machine.DELTA_MEMORY, 0x3000, 0x1234, 0x4321},
+		{machine.DELTA_MEMORY, 0xFFFE, 0x0000, 0x8000},
+	}
+
+	if have := before.Diff(after); !reflect.DeepEqual(have, want) {
+		t.Fatalf("Diff mismatch\nwant:%v\nhave:%v", want, have)
+	}
+
+	if have := before.Diff(before.Clone()); len(have) != 0 {
+		t.Fatalf("Identical states differ\nhave:%v", have)
+	}
+}
+
+func TestStateJSON(t *testing.T) {
+	var state machine.MachineState
+
+	state.Reset()
+	state.Registers[3] = 0xCAFE
+	state.Procstat = 0x8002
+	state.Memory[0x3000] = 0xABCD
+	state.Memory[0xFFFF] = 0x0001
+
+	data, err := json.Marshal(&state)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	const want = `{"registers":[0,0,0,51966,0,0,12288,0],` +
+		`"program":"0x0200","procstat":"0x8002","stack":"0xFE00",` +
+		`"memory":{"0x3000":"0xABCD","0xFFFF":"0x0001"}}`
+
+	if string(data) != want {
+		t.Fatalf("JSON mismatch\nwant:%s\nhave:%s", want, data)
+	}
+
+	var decoded machine.MachineState
+
+	decoded.Memory[0x4000] = 0xFFFF
+
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	if delta := state.Diff(decoded); len(delta) != 0 {
+		t.Fatalf("State did not round-trip\nhave:%v", delta)
+	}
+
+	if err := json.Unmarshal(
+		[]byte(`{"program":"3000"}`), &decoded,
+	); err == nil {
+		t.Fatal("Expected error decoding a word without a hex prefix")
+	}
+}
+
+func ExampleMachine_RunWithContext() {
+	var mc machine.Machine
+
+	mc.State.Reset()
+	mc.State.Program = 0x3000
+	mc.State.Memory[0x3000] = 0b0000_111_111111111 // BRnzp #-1
+
+	ctx, cancel := context.WithTimeout(
+		context.Background(), 10*time.Millisecond,
+	)
+	defer cancel()
+
+	fmt.Println(mc.RunWithContext(ctx))
+	// Output: context deadline exceeded
+}
+
+func BenchmarkMachine(b *testing.B) {
+	var mc machine.Machine
+
+	mc.State.Reset()
+	mc.State.Program = 0x3000
+
+	// ADD R0 R0 #1
+	mc.State.Memory[0x3000] = 0b0001_000_000_1_00001
+	// LDR R1 R2 0x0
+	mc.State.Memory[0x3001] = 0b0110_001_010_000000
+	// STR R0 R2 0x1
+	mc.State.Memory[0x3002] = 0b0111_000_010_000001
+	// BR -(4)
+	mc.State.Memory[0x3003] = 0b0000_000_111111100
+
+	mc.State.Registers[2] = 0x4000
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		mc.Step()
+	}
+}
+
+// Steps the given instruction at 0x3000 b.N times, restoring the program
+// counter, registers and processor status between steps
+func benchmarkStep(b *testing.B, instruction uint16, devices *machine.DeviceHandler) {
+	var mc machine.Machine
+
+	mc.Devices = devices
+	mc.State.Reset()
+	mc.State.Memory[0x3000] = instruction
+	mc.State.Registers[2] = 0x4000
+
+	registers := mc.State.Registers
+	procstat := mc.State.Procstat
+	stack := mc.State.Stack
+
+	b.ResetTimer()
+
+	for i := 0; i < b.N; i++ {
+		mc.State.Program = 0x3000
+		mc.State.Registers = registers
+		mc.State.Procstat = procstat
+		mc.State.Stack = stack
+
+		mc.Step()
+	}
+}
+
+func BenchmarkStepADD(b *testing.B) {
+	// ADD R0 R0 #1
+	benchmarkStep(b, 0b0001_000_000_1_00001, nil)
+}
+
+func BenchmarkStepAND(b *testing.B) {
+	// AND R0 R0 R1
+	benchmarkStep(b, 0b0101_000_000_0_00_001, nil)
+}
+
+func BenchmarkStepBR(b *testing.B) {
+	// BRnzp #-1
+	benchmarkStep(b, 0b0000_111_111111111, nil)
+}
+
+func BenchmarkStepJMP(b *testing.B) {
+	// JMP R2
+	benchmarkStep(b, 0b1100_000_010_000000, nil)
+}
+
+func BenchmarkStepJSR(b *testing.B) {
+	// JSR #16
+	benchmarkStep(b, 0b0100_1_00000010000, nil)
+}
+
+func BenchmarkStepLD(b *testing.B) {
+	// LD R0 #1
+	benchmarkStep(b, 0b0010_000_000000001, nil)
+}
+
+func BenchmarkStepLDI(b *testing.B) {
+	// LDI R0 #1
+	benchmarkStep(b, 0b1010_000_000000001, nil)
+}
+
+func BenchmarkStepLDR(b *testing.B) {
+	// LDR R0 R2 0x0
+	benchmarkStep(b, 0b0110_000_010_000000, nil)
+}
+
+func BenchmarkStepLEA(b *testing.B) {
+	// LEA R0 #1
+	benchmarkStep(b, 0b1110_000_000000001, nil)
+}
+
+func BenchmarkStepNOT(b *testing.B) {
+	// NOT R0 R1
+	benchmarkStep(b, 0b1001_000_001_111111, nil)
+}
+
+func BenchmarkStepRTI(b *testing.B) {
+	// RTI
+	benchmarkStep(b, 0b1000_000000000000, nil)
+}
+
+func BenchmarkStepST(b *testing.B) {
+	// ST R0 #1
+	benchmarkStep(b, 0b0011_000_000000001, nil)
+}
+
+func BenchmarkStepSTI(b *testing.B) {
+	// STI R0 #1
+	benchmarkStep(b, 0b1011_000_000000001, nil)
+}
+
+func BenchmarkStepSTR(b *testing.B) {
+	// STR R0 R2 0x0
+	benchmarkStep(b, 0b0111_000_010_000000, nil)
+}
+
+func BenchmarkStepTRAP(b *testing.B) {
+	// TRAP x20
+	benchmarkStep(b, 0b1111_0000_00100000, nil)
+}
+
+func BenchmarkStepRES(b *testing.B) {
+	// RES (Illegal opcode exception)
+	benchmarkStep(b, 0b1101_000000000000, nil)
+}
+
+func BenchmarkStepKeyboard(b *testing.B) {
+	// ADD R0 R0 #1, polling an empty keyboard for interrupts after each step
+	benchmarkStep(b, 0b0001_000_000_1_00001, &machine.DeviceHandler{
+		Keyboard: bufio.NewReader(iotest.ErrReader(io.EOF)),
+	})
+}
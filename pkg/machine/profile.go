@@ -0,0 +1,113 @@
+// Copyright (C) 2021  Antonio Lassandro
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+
+// You should have received a copy of the GNU General Public License along
+// with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package machine
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+var opcodeNames = map[uint16]string{
+	OP_ADD:  "ADD",
+	OP_AND:  "AND",
+	OP_BR:   "BR",
+	OP_JMP:  "JMP",
+	OP_JSR:  "JSR",
+	OP_LD:   "LD",
+	OP_LDI:  "LDI",
+	OP_LDR:  "LDR",
+	OP_LEA:  "LEA",
+	OP_NOT:  "NOT",
+	OP_RTI:  "RTI",
+	OP_ST:   "ST",
+	OP_STI:  "STI",
+	OP_STR:  "STR",
+	OP_TRAP: "TRAP",
+	OP_RES:  "RES",
+}
+
+// Counts of the instructions executed by a machine, indexed by opcode and by
+// address
+type InstructionProfile struct {
+	Counts    [16]uint64
+	Addresses [1 << 16]uint64
+}
+
+// The number of times the instruction at an address was executed
+type ProfileEntry struct {
+	Addr   uint16
+	Opcode string
+	Count  uint64
+}
+
+// Returns a table of every opcode with its count and share of all executed
+// instructions, sorted by descending count
+func (profile *InstructionProfile) Report() string {
+	opcodes := make([]uint16, len(profile.Counts))
+	total := uint64(0)
+
+	for i, count := range profile.Counts {
+		opcodes[i] = uint16(i)
+		total += count
+	}
+
+	sort.SliceStable(opcodes, func(i, j int) bool {
+		return profile.Counts[opcodes[i]] > profile.Counts[opcodes[j]]
+	})
+
+	var builder strings.Builder
+
+	for _, opcode := range opcodes {
+		count := profile.Counts[opcode]
+		share := 0.0
+
+		if total > 0 {
+			share = float64(count) * 100 / float64(total)
+		}
+
+		fmt.Fprintf(
+			&builder, "%-4s %10d %6.2f%%\n", opcodeNames[opcode], count, share,
+		)
+	}
+
+	return builder.String()
+}
+
+// Returns an entry for each executed address, sorted by descending count and
+// then by address. Opcodes are decoded from the words in the state's memory
+func (profile *InstructionProfile) Hotspots(state *MachineState) []ProfileEntry {
+	var entries []ProfileEntry
+
+	for addr, count := range profile.Addresses {
+		if count == 0 {
+			continue
+		}
+
+		entries = append(entries, ProfileEntry{
+			Addr:   uint16(addr),
+			Opcode: opcodeNames[state.Memory[addr]>>12],
+			Count:  count,
+		})
+	}
+
+	// Entries are already in address order, which is kept for ties
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].Count > entries[j].Count
+	})
+
+	return entries
+}
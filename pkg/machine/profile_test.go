@@ -0,0 +1,91 @@
+// Copyright (C) 2021  Antonio Lassandro
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+
+// You should have received a copy of the GNU General Public License along
+// with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package machine_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/lassandro/golc3/pkg/machine"
+)
+
+func TestProfileReport(t *testing.T) {
+	var profile machine.InstructionProfile
+
+	profile.Counts[machine.OP_ADD] = 3
+	profile.Counts[machine.OP_BR] = 1
+	profile.Counts[machine.OP_TRAP] = 4
+
+	lines := strings.Split(profile.Report(), "\n")
+
+	want := []string{
+		"TRAP          4  50.00%",
+		"ADD           3  37.50%",
+		"BR            1  12.50%",
+		"LD            0   0.00%", // Ties are ordered by opcode
+	}
+
+	for i, line := range want {
+		if lines[i] != line {
+			t.Fatalf("Report mismatch\nwant:%q\nhave:%q", line, lines[i])
+		}
+	}
+
+	if len(lines) != len(profile.Counts)+1 {
+		t.Fatalf(
+			"Report length mismatch\nwant:%d lines\nhave:%d lines",
+			len(profile.Counts),
+			len(lines)-1,
+		)
+	}
+}
+
+func TestProfileHotspots(t *testing.T) {
+	var mc machine.Machine
+	mc.Profile = &machine.InstructionProfile{}
+
+	mc.State.Program = 0x3000
+	mc.State.Memory[0x3000] = 0x5020 // AND R0, R0, #0
+	mc.State.Memory[0x3001] = 0x1021 // ADD R0, R0, #1
+	mc.State.Memory[0x3002] = 0x0FFE // BRnzp #-2
+
+	if err := mc.RunN(1000); err != nil {
+		t.Fatalf("Unexpected error: %s", err)
+	}
+
+	// One step clears R0, the remaining 999 alternate between ADD and BR
+	if have := mc.Profile.Counts[machine.OP_ADD]; have != 500 {
+		t.Fatalf("ADD count mismatch\nwant:500\nhave:%d", have)
+	}
+
+	want := []machine.ProfileEntry{
+		{Addr: 0x3001, Opcode: "ADD", Count: 500},
+		{Addr: 0x3002, Opcode: "BR", Count: 499},
+		{Addr: 0x3000, Opcode: "AND", Count: 1},
+	}
+
+	have := mc.Profile.Hotspots(&mc.State)
+
+	if len(have) != len(want) {
+		t.Fatalf("Hotspot count mismatch\nwant:%v\nhave:%v", want, have)
+	}
+
+	for i := range want {
+		if have[i] != want[i] {
+			t.Fatalf("Hotspot mismatch\nwant:%v\nhave:%v", want[i], have[i])
+		}
+	}
+}
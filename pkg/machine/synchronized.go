@@ -0,0 +1,143 @@
+// Copyright (C) 2021  Antonio Lassandro
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+
+// You should have received a copy of the GNU General Public License along
+// with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package machine
+
+import (
+	"context"
+	"io"
+)
+
+// Steps the machine once under the write lock
+func (sm *SynchronizedMachine) Step() {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	sm.Machine.Step()
+}
+
+// Runs Machine.RunN under the write lock
+func (sm *SynchronizedMachine) RunN(n uint64) error {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	return sm.Machine.RunN(n)
+}
+
+// Like Machine.RunUntilHalt, but releases the write lock between steps so that
+// other goroutines may access the machine while it runs
+func (sm *SynchronizedMachine) RunUntilHalt(ctx context.Context) error {
+	return sm.run(ctx, 1)
+}
+
+// Like Machine.RunWithContext, but releases the write lock every CheckInterval
+// steps so that other goroutines may access the machine while it runs
+func (sm *SynchronizedMachine) RunWithContext(ctx context.Context) error {
+	sm.mutex.RLock()
+	interval := sm.Machine.CheckInterval
+	sm.mutex.RUnlock()
+
+	if interval == 0 {
+		interval = RUN_CHECK_INTERVAL
+	}
+
+	return sm.run(ctx, interval)
+}
+
+func (sm *SynchronizedMachine) run(ctx context.Context, interval uint64) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		default:
+		}
+
+		sm.mutex.Lock()
+		err := sm.Machine.RunN(interval)
+		halted := sm.Machine.IsHalted()
+		sm.mutex.Unlock()
+
+		if err != nil || halted {
+			return err
+		}
+	}
+}
+
+// Runs Machine.InjectInterrupt under the write lock
+func (sm *SynchronizedMachine) InjectInterrupt(vector uint8, priority uint8) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	sm.Machine.InjectInterrupt(vector, priority)
+}
+
+// Runs Machine.LoadBin under the write lock
+func (sm *SynchronizedMachine) LoadBin(
+	reader io.Reader, origin uint16,
+) (wordsLoaded int, err error) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	return sm.Machine.LoadBin(reader, origin)
+}
+
+// Runs Machine.LoadRelocatable under the write lock
+func (sm *SynchronizedMachine) LoadRelocatable(reader io.Reader) error {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	return sm.Machine.LoadRelocatable(reader)
+}
+
+// Runs Machine.GetMemory under the write lock, as reads of device registers
+// and watchpoints may modify the machine
+func (sm *SynchronizedMachine) GetMemory(addr uint16) uint16 {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	return sm.Machine.GetMemory(addr)
+}
+
+// Runs Machine.SetMemory under the write lock
+func (sm *SynchronizedMachine) SetMemory(addr uint16, value uint16) {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	sm.Machine.SetMemory(addr, value)
+}
+
+// Runs Machine.GetRegister under the read lock
+func (sm *SynchronizedMachine) GetRegister(r int) (uint16, error) {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
+	return sm.Machine.GetRegister(r)
+}
+
+// Runs Machine.SetRegister under the write lock
+func (sm *SynchronizedMachine) SetRegister(r int, value uint16) error {
+	sm.mutex.Lock()
+	defer sm.mutex.Unlock()
+
+	return sm.Machine.SetRegister(r, value)
+}
+
+// Runs Machine.IsHalted under the read lock
+func (sm *SynchronizedMachine) IsHalted() bool {
+	sm.mutex.RLock()
+	defer sm.mutex.RUnlock()
+
+	return sm.Machine.IsHalted()
+}
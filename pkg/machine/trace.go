@@ -0,0 +1,101 @@
+// Copyright (C) 2021  Antonio Lassandro
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+
+// You should have received a copy of the GNU General Public License along
+// with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package machine
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// A single step of execution, serialised as TRACE_RECORD_SIZE big-endian
+// bytes
+type TraceRecord struct {
+	Step        uint64
+	Program     uint16
+	Instruction uint16
+	Registers   [8]uint16
+}
+
+// Writes a TraceRecord of the machine state after every step. Any debugger
+// assigned to Next continues to receive events
+type BinaryTracer struct {
+	Next MachineDebugger
+
+	writer *bufio.Writer
+	step   uint64
+	err    error
+}
+
+func NewBinaryTracer(writer io.Writer) *BinaryTracer {
+	return &BinaryTracer{writer: bufio.NewWriter(writer)}
+}
+
+func (tracer *BinaryTracer) Step(mc *Machine) {
+	tracer.step++
+
+	if tracer.err == nil {
+		record := TraceRecord{
+			Step:        tracer.step,
+			Program:     mc.State.Program,
+			Instruction: mc.State.Memory[mc.State.Program],
+			Registers:   mc.State.Registers,
+		}
+
+		tracer.err = binary.Write(tracer.writer, binary.BigEndian, &record)
+	}
+
+	if tracer.Next != nil {
+		tracer.Next.Step(mc)
+	}
+}
+
+func (tracer *BinaryTracer) Read(addr uint16, mc *Machine) {
+	if tracer.Next != nil {
+		tracer.Next.Read(addr, mc)
+	}
+}
+
+func (tracer *BinaryTracer) Write(addr uint16, mc *Machine) {
+	if tracer.Next != nil {
+		tracer.Next.Write(addr, mc)
+	}
+}
+
+// Writes any buffered records, returning the first error encountered while
+// tracing
+func (tracer *BinaryTracer) Flush() error {
+	if tracer.err != nil {
+		return tracer.err
+	}
+
+	return tracer.writer.Flush()
+}
+
+// Reads the next record of a binary trace, returning io.EOF once the trace
+// has been exhausted
+func ReadTraceRecord(reader io.Reader) (TraceRecord, error) {
+	var record TraceRecord
+
+	err := binary.Read(reader, binary.BigEndian, &record)
+
+	if err == io.ErrUnexpectedEOF {
+		return record, errors.New("Truncated trace record")
+	}
+
+	return record, err
+}
@@ -0,0 +1,99 @@
+// Copyright (C) 2021  Antonio Lassandro
+
+// This program is free software: you can redistribute it and/or modify it
+// under the terms of the GNU General Public License as published by the Free
+// Software Foundation, either version 3 of the License, or (at your option)
+// any later version.
+
+// This program is distributed in the hope that it will be useful, but WITHOUT
+// ANY WARRANTY; without even the implied warranty of MERCHANTABILITY or
+// FITNESS FOR A PARTICULAR PURPOSE.  See the GNU General Public License for
+// more details.
+
+// You should have received a copy of the GNU General Public License along
+// with this program.  If not, see <http://www.gnu.org/licenses/>.
+
+package machine_test
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/lassandro/golc3/pkg/machine"
+)
+
+type stateRecorder struct {
+	States []machine.MachineState
+}
+
+func (rec *stateRecorder) Step(mc *machine.Machine) {
+	rec.States = append(rec.States, mc.State)
+}
+
+func (rec *stateRecorder) Read(addr uint16, mc *machine.Machine)  {}
+func (rec *stateRecorder) Write(addr uint16, mc *machine.Machine) {}
+
+func TestBinaryTracer(t *testing.T) {
+	const steps = 10
+
+	var mc machine.Machine
+	var trace bytes.Buffer
+	var rec stateRecorder
+
+	mc.State.Reset()
+	mc.State.Program = 0x3000
+	mc.State.Memory[0x3000] = 0b0001_000_000_1_00001 // ADD R0, R0, #1
+	mc.State.Memory[0x3001] = 0b0001_001_001_1_11111 // ADD R1, R1, #-1
+	mc.State.Memory[0x3002] = 0b0000_111_111111101   // BRnzp #-3
+
+	tracer := machine.NewBinaryTracer(&trace)
+	tracer.Next = &rec
+	mc.Debugger = tracer
+
+	for i := 0; i < steps; i++ {
+		mc.Step()
+	}
+
+	if err := tracer.Flush(); err != nil {
+		t.Fatal(err)
+	}
+
+	if have := trace.Len(); have != steps*machine.TRACE_RECORD_SIZE {
+		t.Fatalf(
+			"Trace size mismatch\nwant:%d\nhave:%d",
+			steps*machine.TRACE_RECORD_SIZE,
+			have,
+		)
+	}
+
+	for i := 0; i < steps; i++ {
+		record, err := machine.ReadTraceRecord(&trace)
+
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		state := rec.States[i]
+
+		want := machine.TraceRecord{
+			Step:        uint64(i + 1),
+			Program:     state.Program,
+			Instruction: state.Memory[state.Program],
+			Registers:   state.Registers,
+		}
+
+		if record != want {
+			t.Fatalf(
+				"Trace record mismatch\nwant:%+v (record %d)\nhave:%+v",
+				want,
+				i,
+				record,
+			)
+		}
+	}
+
+	if _, err := machine.ReadTraceRecord(&trace); err != io.EOF {
+		t.Fatalf("Expected end of trace\nwant:%v\nhave:%v", io.EOF, err)
+	}
+}
@@ -16,12 +16,36 @@
 package machine
 
 import (
-	"bufio"
+	"sync"
 )
 
+// Source of the keys read through the Keyboard Status and Data Registers,
+// satisfied by *bufio.Reader. A key is ready while Peek(1) succeeds, and
+// io.EOF from either method means no key is ready. The keyboard is only used
+// by the goroutine stepping the machine, so other goroutines should feed it
+// keys through a pipe rather than accessing it directly
+type Keyboard interface {
+	ReadByte() (byte, error)
+	Peek(n int) ([]byte, error)
+}
+
+// Destination of the characters written to the Display Data Register,
+// satisfied by *bufio.Writer. The display is ready while Available is non-zero
+type Display interface {
+	WriteByte(c byte) error
+	Flush() error
+	Available() int
+}
+
 type DeviceHandler struct {
-	Keyboard *bufio.Reader
-	Display  *bufio.Writer
+	Keyboard Keyboard
+	Display  Display
+
+	// Timer state, mirrored by the Timer Control Register and Timer Interval
+	// Register. While enabled an interrupt is raised every TimerInterval steps
+	TimerEnabled  bool
+	TimerInterval uint16
+	TimerPriority uint8
 }
 
 type MachineState struct {
@@ -38,8 +62,73 @@ type MachineDebugger interface {
 	Write(addr uint16, mc *Machine)
 }
 
+type LoadOptions struct {
+	// Called every LOAD_PROGRESS_INTERVAL words while loading a binary
+	OnProgress func(wordsLoaded int)
+}
+
+// A Machine is not safe for concurrent use, callers stepping or running it
+// from multiple goroutines must guarantee exclusive access themselves
 type Machine struct {
-	Devices  *DeviceHandler
-	State    MachineState
-	Debugger MachineDebugger
+	Devices     *DeviceHandler
+	State       MachineState
+	Debugger    MachineDebugger
+	LoadOptions LoadOptions
+
+	// Counts executed instructions by opcode when set
+	Profile *InstructionProfile
+
+	// Number of steps between checks of the context by RunWithContext, or
+	// RUN_CHECK_INTERVAL when zero
+	CheckInterval uint64
+
+	// Total number of steps after which Step does nothing, or unlimited when
+	// zero. Counted from the last load of a binary
+	MaxSteps uint64
+
+	// Set when the clock is stopped via the Machine Control Register
+	Halted bool
+
+	// Interrupts raised by InjectInterrupt which have yet to be serviced
+	pending []Interrupt
+
+	// Steps remaining until the timer next raises an interrupt
+	timer uint16
+
+	// Steps executed since the last load of a binary
+	steps uint64
+
+	// Devices registered by RegisterMMIO, keyed by their address
+	mmio map[uint16]MMIODevice
+}
+
+// A peripheral mapped to an address by Machine.RegisterMMIO. OnRead supplies
+// the value of each read from the address, and OnWrite receives each write
+type MMIODevice interface {
+	OnRead(addr uint16) uint16
+	OnWrite(addr uint16, value uint16)
+}
+
+// A Machine whose methods are safe for concurrent use, i.e. stepping a program
+// in one goroutine while others take snapshots of its state. Fields of the
+// embedded Machine, and its methods without a SynchronizedMachine counterpart,
+// must only be used before it is shared
+type SynchronizedMachine struct {
+	Machine
+
+	mutex sync.RWMutex
+}
+
+// An interrupt raised by a device outside of the machine
+type Interrupt struct {
+	Vector   uint8
+	Priority uint8
+}
+
+// A single difference between two machine states, see MachineState.Diff
+type StateDelta struct {
+	Kind   string
+	Index  uint16
+	Before uint16
+	After  uint16
 }
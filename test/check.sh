@@ -0,0 +1,38 @@
+#!/bin/sh
+# Integration test for golc3-asm -check, run from the repository root:
+#   $ sh test/check.sh
+
+set -u
+
+dir=$(mktemp -d)
+trap 'rm -rf "$dir"' EXIT
+
+fail() {
+	echo "FAIL: $1"
+	exit 1
+}
+
+go build -o "$dir/golc3-asm" ./cmd/golc3-asm || fail "unable to build golc3-asm"
+
+printf '.ORIG x3000\nADD R0, R9, #1\nHALT\n' > "$dir/bad.asm"
+printf '.ORIG x3000\nADD R0, R0, #1\n.BLKW #0\nHALT\n' > "$dir/good.asm"
+
+cd "$dir"
+
+./golc3-asm -check bad.asm < /dev/null 2> /dev/null
+[ $? -eq 1 ] || fail "expected exit code 1 for a file with errors"
+
+./golc3-asm -check good.asm < /dev/null 2> /dev/null
+[ $? -eq 0 ] || fail "expected exit code 0 for a file with only warnings"
+
+[ ! -e bad.bin ] && [ ! -e good.bin ] || fail "-check wrote a binary"
+
+output=$(./golc3-asm -check -json bad.asm < /dev/null)
+[ $? -eq 1 ] || fail "expected exit code 1 with -json"
+
+case "$output" in
+*'"file":"bad.asm","line":2,"col":9'*'"severity":"error"'*) ;;
+*) fail "unexpected JSON diagnostics: $output" ;;
+esac
+
+echo "PASS"
@@ -0,0 +1,37 @@
+#!/bin/sh
+# Integration test for golc3 -timeout, run from the repository root:
+#   $ sh test/timeout.sh
+#
+# golc3 expects a terminal on stdin, which is provided by script(1)
+
+set -u
+
+dir=$(mktemp -d)
+trap 'rm -rf "$dir"' EXIT
+
+fail() {
+	echo "FAIL: $1"
+	exit 1
+}
+
+go build -o "$dir/golc3-asm" ./cmd/golc3-asm || fail "unable to build golc3-asm"
+go build -o "$dir/golc3" ./cmd/golc3 || fail "unable to build golc3"
+
+printf '.ORIG x3000\nLOOP BRnzp LOOP\n' > "$dir/loop.asm"
+
+cd "$dir"
+
+./golc3-asm -out loop.bin loop.asm < /dev/null || fail "unable to assemble"
+
+start=$(date +%s)
+output=$(script -q /dev/null ./golc3 -timeout 1s loop.bin < /dev/null)
+elapsed=$(($(date +%s) - start))
+
+case "$output" in
+*"execution timed out after 1s"*) ;;
+*) fail "unexpected output: $output" ;;
+esac
+
+[ "$elapsed" -le 3 ] || fail "took ${elapsed}s to time out after 1s"
+
+echo "PASS"